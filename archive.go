@@ -0,0 +1,88 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"io"
+	"sync"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// ArchiveFormat is the backup format of the streams written by ArchiveWriter.
+// The key of a record is the version the record was pruned at, followed by
+// the storage key of the node.
+const ArchiveFormat = "smt-archive"
+
+var _ ArchiveSink = (*ArchiveWriter)(nil)
+
+// ArchiveSink receives the stored node records before the pruned versions are
+// removed from them, so the full history can be reconstructed offline.
+// The records of a commit are handed over by concurrent workers, so a sink
+// must be safe for concurrent use.
+type ArchiveSink interface {
+	// Archive receives the record of the node stored under key, before the
+	// versions older than version are trimmed from it. The records handed over
+	// by a commit may include the version being committed. A failure aborts the prune.
+	Archive(version Version, key, record []byte) error
+}
+
+// ArchiveWriter is an ArchiveSink streaming the records to a writer, e.g. a file
+// or an object storage upload, in the backup format readable by database.NewBackupReader.
+type ArchiveWriter struct {
+	mu sync.Mutex
+	bw *database.BackupWriter
+}
+
+// NewArchiveWriter writes the header of the archive stream to w.
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	bw, err := database.NewBackupWriter(w, ArchiveFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{bw: bw}, nil
+}
+
+// Archive appends the record to the stream.
+func (a *ArchiveWriter) Archive(version Version, key, record []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.bw.Add(append(encodeVersion(version), key...), record)
+}
+
+// Close ends the stream and flushes the buffered records, w is not closed.
+func (a *ArchiveWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.bw.Close()
+}
+
+// archiveRecord hands the record over to the archive sink, if any.
+func (tree *BNBSparseMerkleTree) archiveRecord(version Version, key, record []byte) error {
+	if tree.archiveSink == nil {
+		return nil
+	}
+	return tree.archiveSink.Archive(version, key, record)
+}
+
+// archiveNode hands the in-memory node over to the archive sink, if the
+// versions older than version are about to be pruned from it.
+func (tree *BNBSparseMerkleTree) archiveNode(node *TreeNode, version Version) error {
+	if tree.archiveSink == nil {
+		return nil
+	}
+	node.mu.RLock()
+	pruned := len(pruneVersions(node.Versions, version, tree.pinned)) != len(node.Versions)
+	node.mu.RUnlock()
+	if !pruned {
+		return nil
+	}
+	record, err := encodeTreeNode(node)
+	if err != nil {
+		return err
+	}
+	return tree.archiveSink.Archive(version, tree.nodeKeys.key(node.depth, node.path), record)
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+func Test_BNBSparseMerkleTree_ArchiveOnPrune(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var buf bytes.Buffer
+	sink, err := NewArchiveWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, ArchiveOnPrune(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:4] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := smt.(*BNBSparseMerkleTree).Prune(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := database.NewBackupReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.Format() != ArchiveFormat {
+		t.Fatalf("unexpected format %s", br.Format())
+	}
+	leafKey := storageFullTreeNodeKey(8, items[0].Key)
+	var archived bool
+	for {
+		key, record, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key[8:], leafKey) {
+			continue
+		}
+		node, err := decodeStorageTreeNode(key[8:], record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(node.Versions) != 4 || !bytes.Equal(node.Versions[0].Hash, items[0].Val) {
+			t.Fatalf("the archived leaf should keep the pruned versions, got %d versions", len(node.Versions))
+		}
+		archived = true
+	}
+	if !archived {
+		t.Fatal("the pruned leaf should be archived")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// auditLogPrefix is the prefix of the audit log records,
+// format: auditLog:${version}${commit time}
+var auditLogPrefix = []byte(`auditLog:`)
+
+func auditLogKey(version Version, commitTime []byte) []byte {
+	key := make([]byte, 0, len(auditLogPrefix)+16)
+	key = append(key, auditLogPrefix...)
+	key = append(key, encodeVersion(version)...)
+	return append(key, commitTime...)
+}
+
+// AuditRecord is a leaf write recorded in the audit log, with the tag set by
+// SetAuditTag when the leaf was written.
+type AuditRecord struct {
+	Version Version
+	Key     uint64
+	Tag     string
+	// Time is the time the version was committed.
+	Time time.Time
+}
+
+// auditEntry is the stored form of an AuditRecord, the version and the time
+// are part of the key of the record.
+type auditEntry struct {
+	Key uint64
+	Tag string
+}
+
+// auditTags holds the tags of the pending leaf writes.
+type auditTags struct {
+	mu      sync.Mutex
+	tag     string
+	pending map[uint64]string
+}
+
+// SetAuditTag sets the tag which the leaf writes following it are recorded
+// with in the audit log, typically the operator and the reason of a change.
+// The tag of the last write of a leaf in a version is recorded.
+func (tree *BNBSparseMerkleTree) SetAuditTag(tag string) {
+	tree.auditTags.mu.Lock()
+	tree.auditTags.tag = tag
+	tree.auditTags.mu.Unlock()
+}
+
+// tagWrite records the current tag for the pending write of the key.
+func (tree *BNBSparseMerkleTree) tagWrite(key uint64) {
+	if !tree.auditLog {
+		return
+	}
+	tree.auditTags.mu.Lock()
+	if tree.auditTags.pending == nil {
+		tree.auditTags.pending = make(map[uint64]string)
+	}
+	tree.auditTags.pending[key] = tree.auditTags.tag
+	tree.auditTags.mu.Unlock()
+}
+
+// writtenTag returns the tag of the pending write of the key.
+func (tree *BNBSparseMerkleTree) writtenTag(key uint64) string {
+	tree.auditTags.mu.Lock()
+	defer tree.auditTags.mu.Unlock()
+	return tree.auditTags.pending[key]
+}
+
+// discardTags drops the tags of the pending writes, once they are committed or discarded.
+func (tree *BNBSparseMerkleTree) discardTags() {
+	tree.auditTags.mu.Lock()
+	tree.auditTags.pending = nil
+	tree.auditTags.mu.Unlock()
+}
+
+// writeAuditRecord appends the entries of the version committed at commitTime to the log.
+func (tree *BNBSparseMerkleTree) writeAuditRecord(batch database.Batcher, version Version, commitTime []byte, entries []auditEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	data, err := rlp.EncodeToBytes(entries)
+	if err != nil {
+		return err
+	}
+	return batch.Set(auditLogKey(version, commitTime), data)
+}
+
+// discardAuditRecord deletes the audit record of a failed commit of the
+// version. The record is written after the commit time record of the version
+// and keyed by it, so the record is found if it was written at all.
+func (tree *BNBSparseMerkleTree) discardAuditRecord(batch database.Batcher, version Version) error {
+	commitTime, err := tree.db.Get(versionTimeKey(version))
+	if errors.Is(err, database.ErrDatabaseNotFound) || len(commitTime) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return batch.Delete(auditLogKey(version, commitTime))
+}
+
+// ReadAuditLog reads back the leaf writes of the versions in [from, to] from the
+// audit log, ordered by version, commit time and key. Only the versions
+// committed with the AuditLog option enabled are recorded. The log is append
+// only: the records of the versions rolled back are kept, and precede the
+// records of the versions committed again in their place.
+func (tree *BNBSparseMerkleTree) ReadAuditLog(from, to Version) ([]*AuditRecord, error) {
+	return tree.scanAuditLog(from, to, func(uint64) bool { return true })
+}
+
+// ReadKeyAuditLog reads back the writes of the key in the versions in [from, to]
+// from the audit log, as ReadAuditLog does.
+func (tree *BNBSparseMerkleTree) ReadKeyAuditLog(key uint64, from, to Version) ([]*AuditRecord, error) {
+	return tree.scanAuditLog(from, to, func(k uint64) bool { return k == key })
+}
+
+func (tree *BNBSparseMerkleTree) scanAuditLog(from, to Version, match func(key uint64) bool) ([]*AuditRecord, error) {
+	if from > to {
+		return nil, ErrInvalidVersionRange
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return nil, err
+	}
+	var records []*AuditRecord
+	it := tree.db.NewIterator(auditLogPrefix, encodeVersion(from))
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()[len(auditLogPrefix):]
+		if len(key) != 16 {
+			return nil, ErrUnexpected
+		}
+		version := Version(binary.BigEndian.Uint64(key))
+		if version > to {
+			break
+		}
+		commitTime, err := decodeVersionTime(key[8:])
+		if err != nil {
+			return nil, err
+		}
+		var entries []auditEntry
+		if err := rlp.DecodeBytes(it.Value(), &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if match(entry.Key) {
+				records = append(records, &AuditRecord{Version: version, Key: entry.Key, Tag: entry.Tag, Time: commitTime})
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_AuditLog(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, AuditLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	defer tree.StopGC()
+	val := func(s string) []byte { return env.hasher.Hash([]byte(s)) }
+
+	tree.SetAuditTag("alice")
+	if err := smt.Set(1, val("a1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.Set(2, val("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	tree.SetAuditTag("bob")
+	if err := smt.MultiSet([]Item{{Key: 1, Val: val("b1")}, {Key: 3, Val: val("b3")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := tree.ReadKeyAuditLog(1, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Tag != "alice" || records[0].Version != 1 ||
+		records[1].Tag != "bob" || records[1].Version != 2 {
+		t.Fatalf("unexpected records of key 1: %+v", records)
+	}
+	if commitTime, err := tree.VersionTime(2); err != nil || !records[1].Time.Equal(commitTime) {
+		t.Fatalf("unexpected commit time %v, %v", records[1].Time, err)
+	}
+
+	// the records of the rolled back version are kept
+	if err := smt.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	tree.SetAuditTag("carol")
+	if err := smt.Set(3, val("c3")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	records, err = tree.ReadAuditLog(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, record := range records {
+		tags = append(tags, record.Tag)
+	}
+	if len(records) != 3 || records[0].Key != 1 || tags[0] != "bob" || tags[1] != "bob" ||
+		records[2].Key != 3 || tags[2] != "carol" {
+		t.Fatalf("unexpected records of version 2: %v", tags)
+	}
+
+	if _, err := tree.ReadAuditLog(2, 1); err != ErrInvalidVersionRange {
+		t.Fatalf("expected ErrInvalidVersionRange, got %v", err)
+	}
+}
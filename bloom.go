@@ -0,0 +1,194 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// bloomFilterKey is the key of the persisted bloom filter of the populated leaf keys.
+var bloomFilterKey = []byte(`bloomFilter`)
+
+// bloomFilter is a bloom filter over the leaf keys committed in any version.
+// Keys are never removed, so a key rolled back or set to the nil hash may
+// still be reported, but a key never committed is not.
+type bloomFilter struct {
+	mu     sync.RWMutex
+	bits   []uint64
+	hashes uint32
+	dirty  bool
+}
+
+// newBloomFilter sizes the filter for the expected number of keys and false positive rate.
+func newBloomFilter(expectedKeys uint64, falsePositiveRate float64) *bloomFilter {
+	if expectedKeys == 0 {
+		expectedKeys = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	m := math.Ceil(-float64(expectedKeys) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(expectedKeys) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint32(k),
+	}
+}
+
+// mix64 is the finalizer of splitmix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// positions calls fn with the bit positions of the key, derived by double hashing.
+func (f *bloomFilter) positions(key uint64, fn func(word int, mask uint64)) {
+	h1 := mix64(key)
+	h2 := mix64(h1) | 1
+	size := uint64(len(f.bits)) * 64
+	for i := uint32(0); i < f.hashes; i++ {
+		pos := (h1 + uint64(i)*h2) % size
+		fn(int(pos/64), 1<<(pos%64))
+	}
+}
+
+func (f *bloomFilter) add(key uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.positions(key, func(word int, mask uint64) {
+		if f.bits[word]&mask == 0 {
+			f.bits[word] |= mask
+			f.dirty = true
+		}
+	})
+}
+
+// has reports false if the key was never added.
+func (f *bloomFilter) has(key uint64) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	found := true
+	f.positions(key, func(word int, mask uint64) {
+		if f.bits[word]&mask == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// header returns the sizes of the filter, which prefix the persisted record.
+func (f *bloomFilter) header() []byte {
+	buf := make([]byte, 12)
+	binary.BigEndian.PutUint32(buf, f.hashes)
+	binary.BigEndian.PutUint64(buf[4:], uint64(len(f.bits)))
+	return buf
+}
+
+// encodeIfDirty returns the record of the filter if keys were added since it
+// was last encoded, otherwise nil.
+func (f *bloomFilter) encodeIfDirty() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.dirty {
+		return nil
+	}
+	return f.marshal()
+}
+
+// encode returns the record of the filter.
+func (f *bloomFilter) encode() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.marshal()
+}
+
+// marshal returns the record of the filter and clears the dirty flag.
+func (f *bloomFilter) marshal() []byte {
+	header := f.header()
+	buf := make([]byte, len(header)+len(f.bits)*8)
+	copy(buf, header)
+	for i, word := range f.bits {
+		binary.BigEndian.PutUint64(buf[len(header)+i*8:], word)
+	}
+	f.dirty = false
+	return buf
+}
+
+// decode restores the filter from the record, returning false if the record
+// was written by a filter of other sizes.
+func (f *bloomFilter) decode(data []byte) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	header := f.header()
+	if len(data) < len(header) || !bytes.Equal(data[:len(header)], header) {
+		return false, nil
+	}
+	data = data[len(header):]
+	if len(data) != len(f.bits)*8 {
+		return false, errors.New("invalid bloom filter record")
+	}
+	for i := range f.bits {
+		f.bits[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+	f.dirty = false
+	return true, nil
+}
+
+// initBloomFilter restores the persisted bloom filter, or rebuilds it from the
+// stored leaves if it is missing or was sized differently.
+func (tree *BNBSparseMerkleTree) initBloomFilter() error {
+	if tree.bloom == nil {
+		return nil
+	}
+	data, err := tree.db.Get(bloomFilterKey)
+	if err == nil {
+		restored, err := tree.bloom.decode(data)
+		if err != nil || restored {
+			return err
+		}
+	}
+
+	it := tree.db.NewIterator(tree.nodeKeys.levelPrefix(tree.maxDepth), nil)
+	defer it.Release()
+	for it.Next() {
+		if path, ok := tree.nodeKeys.leafPath(it.Key(), tree.maxDepth); ok {
+			tree.bloom.add(path)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if tree.readOnly {
+		return nil
+	}
+	return tree.db.Set(bloomFilterKey, tree.bloom.encode())
+}
+
+// Contains reports whether the key holds a value other than the nil hash in
+// the latest version. The keys absent from the bloom filter are answered
+// without reading the tree.
+func (tree *BNBSparseMerkleTree) Contains(key uint64) (bool, error) {
+	val, err := tree.Get(key, nil)
+	if errors.Is(err, ErrNodeNotFound) || errors.Is(err, ErrEmptyRoot) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(val, tree.nilHashes.Get(tree.maxDepth)), nil
+}
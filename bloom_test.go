@@ -0,0 +1,82 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_BloomFilter(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+
+	items := prepareKVData(env.hasher)
+	smt, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash, BloomFilter(uint64(len(items)), 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	populated := make(map[uint64]bool)
+	for _, item := range items {
+		populated[item.Key] = true
+	}
+	check := func(tree *BNBSparseMerkleTree, db *readCountingDB) {
+		for _, item := range items {
+			if found, err := tree.Contains(item.Key); err != nil || !found {
+				t.Fatalf("key %d should be found, %v", item.Key, err)
+			}
+		}
+		// the filter is sized for a false positive rate of 1%
+		absent, misses := 0, 0
+		for key := uint64(0); key < 256; key++ {
+			if populated[key] {
+				continue
+			}
+			absent++
+			before := db.nodes
+			if found, err := tree.Contains(key); err != nil || found {
+				t.Fatalf("key %d should not be found, %v", key, err)
+			}
+			if db.nodes != before {
+				misses++
+			}
+		}
+		if misses > absent/10 {
+			t.Fatalf("too many absent keys read from the database: %d", misses)
+		}
+	}
+
+	db := &readCountingDB{TreeDB: memDB}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BloomFilter(uint64(len(items)), 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.iterators != 0 {
+		t.Fatal("the persisted filter should be restored")
+	}
+	check(reopened.(*BNBSparseMerkleTree), db)
+
+	// a filter of other sizes is rebuilt from the leaves
+	db = &readCountingDB{TreeDB: memDB}
+	rebuilt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BloomFilter(uint64(2*len(items)), 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.iterators != 1 {
+		t.Fatal("the filter should be rebuilt from the leaves")
+	}
+	check(rebuilt.(*BNBSparseMerkleTree), db)
+}
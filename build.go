@@ -0,0 +1,248 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// LeafIterator is a stream of leaves sorted by key in ascending order.
+type LeafIterator interface {
+	// Next moves the iterator to the next leaf, it returns false once the
+	// stream is exhausted or failed.
+	Next() bool
+
+	// Leaf returns the current leaf.
+	Leaf() Item
+
+	// Error returns the failure that stopped the stream, if any.
+	Error() error
+}
+
+// sliceLeafIterator iterates over a sorted slice of items.
+type sliceLeafIterator struct {
+	items []Item
+	index int
+}
+
+// NewSliceLeafIterator returns a LeafIterator over the items, which must be
+// sorted by key.
+func NewSliceLeafIterator(items []Item) LeafIterator {
+	return &sliceLeafIterator{items: items, index: -1}
+}
+
+func (it *sliceLeafIterator) Next() bool {
+	it.index++
+	return it.index < len(it.items)
+}
+
+func (it *sliceLeafIterator) Leaf() Item {
+	return it.items[it.index]
+}
+
+func (it *sliceLeafIterator) Error() error {
+	return nil
+}
+
+// treeBuilder constructs a tree bottom-up from sorted leaves. Only the nodes on
+// the path of the current leaf are open, a node is hashed and written once the
+// stream moves past its subtree, and only its versions are kept by its parent.
+type treeBuilder struct {
+	tree    *BNBSparseMerkleTree
+	version Version
+	batch   database.Batcher
+	keys    *nodeKeyArena
+	open    []*TreeNode // open[i] is the open node at depth 4*i
+}
+
+// close finishes the open nodes deeper than level, from the deepest one.
+func (b *treeBuilder) close(level int) error {
+	for i := len(b.open) - 1; i > level; i-- {
+		node := b.open[i]
+		if node == nil {
+			continue
+		}
+		if err := b.finish(node); err != nil {
+			return err
+		}
+		b.open[i] = nil
+		b.attach(b.open[i-1], node)
+	}
+	return nil
+}
+
+// finish computes the hash of an internal node and writes its record.
+func (b *treeBuilder) finish(node *TreeNode) error {
+	if node.depth < b.tree.maxDepth {
+		node.ComputeInternalHash()
+		node.newVersion(&VersionInfo{
+			Ver:  b.version,
+			Hash: b.tree.hasher.Hash(node.internal(0), node.internal(1)),
+		})
+	}
+	if b.batch == nil {
+		return nil
+	}
+	record, err := encodeTreeNode(node)
+	if err != nil {
+		return err
+	}
+	return b.batch.Set(b.keys.key(node.depth, node.path), record)
+}
+
+// attach links the finished node to its parent. With a database, the parent
+// only keeps the versions of the node, like a node restored from storage.
+func (b *treeBuilder) attach(parent, node *TreeNode) {
+	nibble := node.path & 0xf
+	if b.batch == nil {
+		parent.Children[nibble] = node
+		return
+	}
+	parent.Children[nibble] = &TreeNode{
+		Versions:  node.Versions,
+		nilHashes: node.nilHashes,
+		hasher:    node.hasher,
+		temporary: true,
+		depth:     node.depth,
+		path:      node.path,
+	}
+}
+
+// BuildFrom constructs an empty tree from a stream of leaves sorted by key,
+// and commits them as the first version. The nodes are built bottom-up, so
+// every node is hashed and written once, in large sequential batches, and only
+// the nodes on the path of the current leaf are held in memory. It is the
+// fast path of building a large genesis state compared to Set and Commit.
+//
+// The leaves are not journaled, if the build is interrupted the tree is left
+// empty with partially written nodes, and must be built again with BuildFrom
+// before any other write.
+func (tree *BNBSparseMerkleTree) BuildFrom(iter LeafIterator) (Version, error) {
+	return tree.buildFrom(iter, tree.version+1)
+}
+
+// buildFrom builds an empty tree from the leaves as BuildFrom does, and
+// commits them as the given version.
+func (tree *BNBSparseMerkleTree) buildFrom(iter LeafIterator, version Version) (Version, error) {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	if err := tree.awaitCommit(); err != nil {
+		return tree.version, err
+	}
+	if tree.journal.len() > 0 {
+		return tree.version, ErrPendingChanges
+	}
+	if tree.version > 0 || !tree.IsEmpty() {
+		return tree.version, ErrTreeNotEmpty
+	}
+
+	levels := int(tree.maxDepth) / 4
+	b := &treeBuilder{
+		tree:    tree,
+		version: version,
+		keys:    newNodeKeyArena(tree.nodeKeys, nodeKeyChunk),
+		open:    make([]*TreeNode, levels+1),
+	}
+	if tree.db != nil {
+		b.batch = database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	}
+	b.open[0] = NewTreeNode(0, 0, tree.nilHashes, tree.hasher)
+
+	var (
+		count uint64
+		prev  uint64
+	)
+	for iter.Next() {
+		leaf := iter.Leaf()
+		if leaf.Key >= 1<<tree.maxDepth {
+			return tree.version, ErrInvalidKey
+		}
+		if count > 0 && leaf.Key <= prev {
+			return tree.version, ErrUnsortedLeaves
+		}
+		// the first level the path of the leaf diverges from the open nodes
+		level := 1
+		for count > 0 && level < levels && leaf.Key>>(int(tree.maxDepth)-4*level) == prev>>(int(tree.maxDepth)-4*level) {
+			level++
+		}
+		if err := b.close(level - 1); err != nil {
+			return tree.version, err
+		}
+		for i := level; i <= levels; i++ {
+			depth := uint8(4 * i)
+			b.open[i] = NewTreeNode(depth, leaf.Key>>(int(tree.maxDepth)-int(depth)), tree.nilHashes, tree.hasher)
+		}
+		b.open[levels].Set(leaf.Val, b.version)
+		if tree.bloom != nil {
+			tree.bloom.add(leaf.Key)
+		}
+		prev = leaf.Key
+		count++
+	}
+	if err := iter.Error(); err != nil {
+		return tree.version, err
+	}
+	if count == 0 {
+		return tree.version, nil
+	}
+	if err := b.close(0); err != nil {
+		return tree.version, err
+	}
+	root := b.open[0]
+	if err := b.finish(root); err != nil {
+		return tree.version, err
+	}
+
+	if b.batch != nil {
+		if tree.bloom != nil {
+			if err := b.batch.Set(bloomFilterKey, tree.bloom.encode()); err != nil {
+				return tree.version, err
+			}
+		}
+		if err := b.batch.Set(versionTimeKey(b.version), encodeVersionTime(time.Now())); err != nil {
+			return tree.version, err
+		}
+		info := &versionInfo{ChangedKeys: count, Metadata: tree.pendingMetadata()}
+		if err := writeVersionInfo(b.batch, b.version, info); err != nil {
+			return tree.version, err
+		}
+		// the latest version is written last, the tree is empty until the build is done
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(b.version))
+		if err := b.batch.Set(latestVersionKey, buf); err != nil {
+			return tree.version, err
+		}
+		if err := b.batch.Write(); err != nil {
+			return tree.version, err
+		}
+	}
+
+	tree.root = root
+	tree.version = b.version
+	tree.rolledBack = nil
+	tree.discardMetadata()
+	size := root.Size()
+	for i := 0; i < len(root.Children); i++ {
+		if root.Children[i] != nil {
+			size += uint64(versionSize * len(root.Children[i].Versions))
+		}
+	}
+	tree.setSize(size)
+	tree.gcStatus.add(tree.version, tree.rootSize)
+	tree.lastSaveRoot = tree.root
+	tree.lastSaveRootSize = tree.rootSize
+
+	if tree.metrics != nil {
+		tree.metrics.CommitNum(int(count))
+		tree.metrics.CurrentSize(tree.rootSize)
+		tree.metrics.Version(uint64(tree.version))
+	}
+	return tree.version, nil
+}
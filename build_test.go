@@ -0,0 +1,175 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_BuildFrom(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			items := prepareKVData(env.hasher)
+			sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+			refDB, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer refDB.Close()
+			ref, err := NewBNBSparseMerkleTree(env.hasher, refDB, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ref.MultiSet(items); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ref.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BloomFilter(uint64(len(items)), 0.01))
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := smt.(*BNBSparseMerkleTree).BuildFrom(NewSliceLeafIterator(items))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != 1 || smt.LatestVersion() != 1 {
+				t.Fatalf("the leaves should be committed as the first version, got %d", version)
+			}
+			verifyItems(t, ref, smt, items)
+
+			// the records are the same as written by a commit
+			for _, item := range items {
+				expected, err := refDB.Get(storageFullTreeNodeKey(8, item.Key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				record, err := db.Get(storageFullTreeNodeKey(8, item.Key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(record, expected) {
+					t.Fatalf("leaf record %d does not match the committed one", item.Key)
+				}
+			}
+
+			reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifyItems(t, ref, reopened, items)
+
+			// the built tree accepts later versions
+			if err := reopened.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+				t.Fatal(err)
+			}
+			if err := ref.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(reopened.Root(), ref.Root()) {
+				t.Fatalf("root hash does not match after a later set, %x, %x", reopened.Root(), ref.Root())
+			}
+		})
+	}
+}
+
+func Test_BNBSparseMerkleTree_BuildFrom_Invalid(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	items := prepareKVData(env.hasher)
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	if _, err := tree.BuildFrom(NewSliceLeafIterator(items)); err != ErrUnsortedLeaves {
+		t.Fatalf("unsorted leaves should be rejected, got %v", err)
+	}
+	if has, _ := db.Has(latestVersionKey); has {
+		t.Fatal("a failed build should not commit a version")
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	if _, err := tree.BuildFrom(NewSliceLeafIterator([]Item{items[0], items[0]})); err != ErrUnsortedLeaves {
+		t.Fatalf("duplicated leaves should be rejected, got %v", err)
+	}
+	if _, err := tree.BuildFrom(NewSliceLeafIterator(items)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.BuildFrom(NewSliceLeafIterator(items)); err != ErrTreeNotEmpty {
+		t.Fatalf("a tree with versions should be rejected, got %v", err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_BuildFrom_Deep(t *testing.T) {
+	env := prepareEnv()[0]
+	rng := rand.New(rand.NewSource(1))
+	seen := make(map[uint64]bool)
+	var items []Item
+	for len(items) < 500 {
+		key := rng.Uint64() >> 40
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key), byte(key >> 8), byte(key >> 16)})})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	refDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer refDB.Close()
+	ref, err := NewBNBSparseMerkleTree(env.hasher, refDB, 24, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 24, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.(*BNBSparseMerkleTree).BuildFrom(NewSliceLeafIterator(items)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(smt.Root(), ref.Root()) {
+		t.Fatalf("root hash does not match, %x, %x", smt.Root(), ref.Root())
+	}
+	for _, item := range items[:50] {
+		proof, err := smt.GetProof(item.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !smt.VerifyProof(item.Key, proof) {
+			t.Fatalf("proof of key %d should verify", item.Key)
+		}
+	}
+}
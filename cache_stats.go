@@ -0,0 +1,101 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync/atomic"
+
+	"github.com/bnb-chain/zkbnb-smt/metrics"
+)
+
+// cacheOp is the operation type the node lookups are counted for.
+type cacheOp int
+
+const (
+	cacheOpGet cacheOp = iota
+	cacheOpSet
+	cacheOpProof
+	cacheOpRollback
+	cacheOps
+
+	// cacheOpCounted marks the lookups counted by the caller already.
+	cacheOpCounted = cacheOps
+)
+
+// CacheCounters count the node lookups of an operation type.
+type CacheCounters struct {
+	// Hits is the number of nodes found in memory.
+	Hits uint64
+	// Faults is the number of nodes read from the database, including the
+	// reads of the missing nodes.
+	Faults uint64
+}
+
+// CacheStats are the node lookups per operation type, counted since the tree was opened.
+type CacheStats struct {
+	// Get counts the leaves looked up by Get in the leaf cache.
+	Get CacheCounters
+	// Set counts the nodes on the paths of the keys set by Set and MultiSet.
+	Set CacheCounters
+	// Proof counts the nodes on the paths of the keys proven by GetProof and GetProofs.
+	Proof CacheCounters
+	// Rollback counts the nodes visited by Rollback.
+	Rollback CacheCounters
+}
+
+// cacheCounters accumulates the node lookups.
+type cacheCounters struct {
+	hits   [cacheOps]uint64
+	faults [cacheOps]uint64
+}
+
+func (c *cacheCounters) hit(op cacheOp, n int) {
+	if op == cacheOpCounted {
+		return
+	}
+	atomic.AddUint64(&c.hits[op], uint64(n))
+}
+
+func (c *cacheCounters) fault(op cacheOp, n int) {
+	if op == cacheOpCounted {
+		return
+	}
+	atomic.AddUint64(&c.faults[op], uint64(n))
+}
+
+func (c *cacheCounters) get(op cacheOp) CacheCounters {
+	return CacheCounters{
+		Hits:   atomic.LoadUint64(&c.hits[op]),
+		Faults: atomic.LoadUint64(&c.faults[op]),
+	}
+}
+
+// CacheStats returns the counts of the nodes found in memory and read from
+// the database, per operation type.
+func (tree *BNBSparseMerkleTree) CacheStats() CacheStats {
+	return CacheStats{
+		Get:      tree.cacheCounters.get(cacheOpGet),
+		Set:      tree.cacheCounters.get(cacheOpSet),
+		Proof:    tree.cacheCounters.get(cacheOpProof),
+		Rollback: tree.cacheCounters.get(cacheOpRollback),
+	}
+}
+
+// reportCacheLookups reports the node lookups counted so far to the OperationMetrics.
+func (tree *BNBSparseMerkleTree) reportCacheLookups() {
+	stats := tree.CacheStats()
+	for _, lookups := range []struct {
+		op       string
+		counters CacheCounters
+	}{
+		{metrics.CacheGet, stats.Get},
+		{metrics.CacheSet, stats.Set},
+		{metrics.CacheProof, stats.Proof},
+		{metrics.CacheRollback, stats.Rollback},
+	} {
+		tree.opMetrics.CacheLookups(lookups.op, lookups.counters.Hits, lookups.counters.Faults)
+	}
+}
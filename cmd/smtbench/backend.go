@@ -0,0 +1,119 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/etcd"
+	"github.com/bnb-chain/zkbnb-smt/database/leveldb"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/database/mmap"
+	"github.com/bnb-chain/zkbnb-smt/database/redis"
+)
+
+// benchFlags are the flags locating the benchmarked tree and its parameters.
+type benchFlags struct {
+	backend   string
+	path      string
+	addr      string
+	namespace string
+	depth     uint
+	hash      string
+}
+
+func (f *benchFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.backend, "backend", "memory", "database backend: leveldb, redis, etcd, mmap or memory")
+	fs.StringVar(&f.path, "path", "", "directory of a leveldb or mmap database")
+	fs.StringVar(&f.addr, "addr", "", "comma separated addresses of the redis or etcd servers, several redis addresses denote a cluster")
+	fs.StringVar(&f.namespace, "namespace", "smtbench", "namespace of the tree in the database")
+	fs.UintVar(&f.depth, "depth", 32, "maximum depth of the tree, a multiple of 4")
+	fs.StringVar(&f.hash, "hash", "sha256", "hash function of the tree: sha256 or keccak256")
+}
+
+// openDB opens the database of the backend, the memory backend is not persisted.
+func (f *benchFlags) openDB() (database.TreeDB, error) {
+	var addrs []string
+	for _, addr := range strings.Split(f.addr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	switch f.backend {
+	case "leveldb":
+		if f.path == "" {
+			return nil, errors.New("-path is required by leveldb")
+		}
+		return leveldb.NewWithConfig(f.path, f.namespace, &leveldb.LevelDBConfig{})
+	case "redis":
+		if len(addrs) == 0 {
+			return nil, errors.New("-addr is required by redis")
+		}
+		config := &redis.RedisConfig{Addr: addrs[0]}
+		if len(addrs) > 1 {
+			config = &redis.RedisConfig{ClusterAddr: addrs}
+		}
+		db, err := redis.New(config)
+		if err != nil {
+			return nil, err
+		}
+		return redis.WrapWithNamespace(db, f.namespace), nil
+	case "etcd":
+		if len(addrs) == 0 {
+			return nil, errors.New("-addr is required by etcd")
+		}
+		db, err := etcd.New(&etcd.EtcdConfig{Endpoints: addrs})
+		if err != nil {
+			return nil, err
+		}
+		return etcd.WrapWithNamespace(db, f.namespace), nil
+	case "mmap":
+		if f.path == "" {
+			return nil, errors.New("-path is required by mmap")
+		}
+		return mmap.New(f.path)
+	case "memory":
+		return memory.NewMemoryDB(), nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", f.backend)
+}
+
+// openTree opens the database and the tree stored in it, the workload is
+// committed on top of the versions it holds already.
+func (f *benchFlags) openTree(opts ...bsmt.Option) (*bsmt.BNBSparseMerkleTree, database.TreeDB, error) {
+	if f.depth == 0 || f.depth%4 != 0 || f.depth > 64 {
+		return nil, nil, errors.New("-depth must be a multiple of 4 up to 64")
+	}
+	var init func() hash.Hash
+	switch f.hash {
+	case "sha256":
+		init = sha256.New
+	case "keccak256":
+		init = func() hash.Hash { return crypto.NewKeccakState() }
+	default:
+		return nil, nil, fmt.Errorf("unknown hash function %q", f.hash)
+	}
+	hasher := bsmt.NewHasherPool(init)
+	db, err := f.openDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := bsmt.NewBNBSparseMerkleTree(hasher, db, uint8(f.depth), hasher.Hash([]byte("nilHash")), opts...)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return tree.(*bsmt.BNBSparseMerkleTree), db, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// storage is the size of the stored nodes of a tree.
+type storage struct {
+	nodes int
+	bytes int64
+}
+
+// result is the measurement of a workload.
+type result struct {
+	first, last bsmt.Version
+	writes      int
+	elapsed     time.Duration
+	set         []time.Duration // the latency of the MultiSet of every version
+	commit      []time.Duration // the latency of the Commit of every version
+	proofs      int
+	proofTime   time.Duration
+	before      storage
+	after       storage
+}
+
+// runBench commits the versions of the workload to the tree, measuring every
+// one of them, and reports the progress to w.
+func runBench(tree *bsmt.BNBSparseMerkleTree, work *workload, w io.Writer) (*result, error) {
+	before, err := measureStorage(tree)
+	if err != nil {
+		return nil, err
+	}
+	r := &result{first: tree.LatestVersion() + 1, before: before}
+	start := time.Now()
+	lastReport := start
+	for i := 0; i < work.versions; i++ {
+		items := work.items()
+		r.writes += len(items)
+		t := time.Now()
+		if err := tree.MultiSet(items); err != nil {
+			return nil, err
+		}
+		r.set = append(r.set, time.Since(t))
+
+		// the versions beyond -keep are pruned by the RetainVersions option
+		t = time.Now()
+		version, err := tree.Commit(nil)
+		if err != nil {
+			return nil, err
+		}
+		r.commit = append(r.commit, time.Since(t))
+		r.last = version
+
+		t = time.Now()
+		for j := 0; j < work.proofs; j++ {
+			if _, err := tree.GetProof(work.writtenKey()); err != nil {
+				return nil, err
+			}
+		}
+		r.proofs += work.proofs
+		r.proofTime += time.Since(t)
+
+		if now := time.Now(); now.Sub(lastReport) >= time.Second {
+			fmt.Fprintf(w, "committed %d/%d versions\n", i+1, work.versions)
+			lastReport = now
+		}
+	}
+	r.elapsed = time.Since(start)
+	if r.after, err = measureStorage(tree); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// measureStorage returns the size of the stored nodes of the tree.
+func measureStorage(tree *bsmt.BNBSparseMerkleTree) (storage, error) {
+	breakdown, err := tree.AnalyzeStorage(0)
+	if err != nil {
+		return storage{}, err
+	}
+	return storage{nodes: breakdown.Nodes, bytes: breakdown.Bytes}, nil
+}
+
+// percentile returns the latency at the percentile p of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (r *result) print(w io.Writer) {
+	versions := len(r.commit)
+	fmt.Fprintf(w, "versions:     %d-%d (%d versions, %d writes in %s)\n", r.first, r.last, versions, r.writes, r.elapsed.Round(time.Millisecond))
+	for _, latency := range []struct {
+		name      string
+		durations []time.Duration
+	}{
+		{"set", r.set},
+		{"commit", r.commit},
+	} {
+		sorted := append([]time.Duration(nil), latency.durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		fmt.Fprintf(w, "%-13s p50 %s, p90 %s, p99 %s, max %s\n", latency.name+":",
+			percentile(sorted, 0.5).Round(time.Microsecond), percentile(sorted, 0.9).Round(time.Microsecond),
+			percentile(sorted, 0.99).Round(time.Microsecond), percentile(sorted, 1).Round(time.Microsecond))
+	}
+	if r.proofs > 0 && r.proofTime > 0 {
+		fmt.Fprintf(w, "proofs:       %d in %s, %.0f proofs/s\n", r.proofs, r.proofTime.Round(time.Millisecond), float64(r.proofs)/r.proofTime.Seconds())
+	}
+	growth := r.after.bytes - r.before.bytes
+	fmt.Fprintf(w, "storage:      %d nodes, %d bytes (%+d nodes, %+d bytes, %+d bytes per version)\n",
+		r.after.nodes, r.after.bytes, r.after.nodes-r.before.nodes, growth, growth/int64(versions))
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Command smtbench runs a synthetic workload against a sparse merkle tree
+// stored in any supported database backend, and reports the commit latency
+// percentiles, the proof throughput and the storage growth.
+//
+// Usage:
+//
+//	smtbench [flags]
+//
+// Run "smtbench -h" for the flags.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "smtbench:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out, errOut io.Writer) error {
+	fs := flag.NewFlagSet("smtbench", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.Usage = func() {
+		fmt.Fprintf(errOut, "Usage: smtbench [flags]\n\nRun a synthetic workload against a tree and report its commit latency, proof throughput and storage growth.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var (
+		bf benchFlags
+		wf workloadFlags
+	)
+	bf.register(fs)
+	wf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	workload, err := wf.workload(bf.depth)
+	if err != nil {
+		return err
+	}
+	var opts []bsmt.Option
+	if wf.keep > 0 {
+		opts = append(opts, bsmt.RetainVersions(wf.keep))
+	}
+	tree, db, err := bf.openTree(opts...)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer tree.StopGC()
+
+	result, err := runBench(tree, workload, errOut)
+	if err != nil {
+		return err
+	}
+	result.print(out)
+	return nil
+}
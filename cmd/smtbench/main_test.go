@@ -0,0 +1,63 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runBenchCLI(t *testing.T, args ...string) string {
+	var out, errOut bytes.Buffer
+	if err := run(args, &out, &errOut); err != nil {
+		t.Fatalf("smtbench %s: %v\n%s", strings.Join(args, " "), err, errOut.String())
+	}
+	return out.String()
+}
+
+func TestBench(t *testing.T) {
+	for _, distribution := range []string{"uniform", "sequential", "zipf"} {
+		t.Run(distribution, func(t *testing.T) {
+			out := runBenchCLI(t, "-depth", "16", "-versions", "10", "-batch", "50", "-proofs", "10", "-keep", "4",
+				"-distribution", distribution, "-seed", "1")
+			for _, line := range []string{"versions:     1-10 (10 versions, 500 writes", "commit:       p50", "proofs:       100 in", "storage:"} {
+				if !strings.Contains(out, line) {
+					t.Fatalf("expected %q in the report:\n%s", line, out)
+				}
+			}
+		})
+	}
+
+	// the workload is committed on top of a stored tree
+	path := t.TempDir()
+	flags := []string{"-backend", "leveldb", "-path", path, "-depth", "8", "-versions", "3", "-batch", "10", "-seed", "1"}
+	runBenchCLI(t, flags...)
+	if out := runBenchCLI(t, flags...); !strings.HasPrefix(out, "versions:     4-6 (3 versions, 30 writes") {
+		t.Fatalf("unexpected report:\n%s", out)
+	}
+
+	var out, errOut bytes.Buffer
+	if err := run([]string{"-update-ratio", "2"}, &out, &errOut); err == nil {
+		t.Fatal("expected an invalid update ratio to fail")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	for p, expected := range map[float64]time.Duration{0: 1, 0.5: 50, 0.9: 90, 0.99: 99, 1: 100} {
+		if actual := percentile(sorted, p); actual != expected {
+			t.Fatalf("percentile %v is %d, expected %d", p, actual, expected)
+		}
+	}
+	if percentile(nil, 0.5) != 0 {
+		t.Fatal("the percentile of no latency should be 0")
+	}
+}
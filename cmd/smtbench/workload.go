@@ -0,0 +1,130 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// workloadFlags are the flags shaping the synthetic workload.
+type workloadFlags struct {
+	versions     int
+	batch        int
+	updateRatio  float64
+	distribution string
+	zipfS        float64
+	proofs       int
+	keep         uint
+	seed         int64
+}
+
+func (f *workloadFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.versions, "versions", 100, "number of versions to commit")
+	fs.IntVar(&f.batch, "batch", 1000, "number of leaf writes per version")
+	fs.Float64Var(&f.updateRatio, "update-ratio", 0.5, "share of the writes updating a leaf written before, from 0 to 1")
+	fs.StringVar(&f.distribution, "distribution", "uniform", "distribution of the keys: uniform, sequential or zipf")
+	fs.Float64Var(&f.zipfS, "zipf-s", 1.1, "exponent of the zipf distribution, greater than 1, a higher one concentrates the writes on fewer keys")
+	fs.IntVar(&f.proofs, "proofs", 100, "number of proofs of written leaves generated after every commit")
+	fs.UintVar(&f.keep, "keep", 128, "number of the latest versions kept, the older ones are pruned, 0 keeps every version")
+	fs.Int64Var(&f.seed, "seed", 0, "seed of the workload, default is the current time")
+}
+
+// workload generates the leaf writes of the versions.
+type workload struct {
+	workloadFlags
+	rand     *rand.Rand
+	keySpace uint64 // the largest key, a mask of the key bits
+	zipf     *rand.Zipf
+	next     uint64 // the next key of the sequential distribution
+	written  []uint64
+	indexes  map[uint64]struct{}
+}
+
+func (f *workloadFlags) workload(depth uint) (*workload, error) {
+	if f.versions <= 0 || f.batch <= 0 || f.proofs < 0 {
+		return nil, errors.New("-versions and -batch must be positive, -proofs must not be negative")
+	}
+	if f.updateRatio < 0 || f.updateRatio > 1 {
+		return nil, errors.New("-update-ratio must be from 0 to 1")
+	}
+	seed := f.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	w := &workload{
+		workloadFlags: *f,
+		rand:          rand.New(rand.NewSource(seed)),
+		keySpace:      1<<depth - 1,
+		indexes:       make(map[uint64]struct{}),
+	}
+	switch f.distribution {
+	case "uniform", "sequential":
+	case "zipf":
+		if f.zipfS <= 1 {
+			return nil, errors.New("-zipf-s must be greater than 1")
+		}
+		w.zipf = rand.NewZipf(w.rand, f.zipfS, 1, w.keySpace)
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q", f.distribution)
+	}
+	return w, nil
+}
+
+// items returns the leaf writes of the next version, with distinct keys. A
+// batch is cut short once the distribution keeps drawing the keys it holds.
+func (w *workload) items() []bsmt.Item {
+	items := make([]bsmt.Item, 0, w.batch)
+	batch := make(map[uint64]struct{}, w.batch)
+	for attempts := 0; len(items) < w.batch && attempts < 10*w.batch; attempts++ {
+		key := w.key()
+		if _, ok := batch[key]; ok {
+			continue
+		}
+		batch[key] = struct{}{}
+		if _, ok := w.indexes[key]; !ok {
+			w.indexes[key] = struct{}{}
+			w.written = append(w.written, key)
+		}
+		val := make([]byte, 32)
+		w.rand.Read(val)
+		items = append(items, bsmt.Item{Key: key, Val: val})
+	}
+	return items
+}
+
+// key returns the key of the next write, a written one with the update ratio.
+func (w *workload) key() uint64 {
+	if len(w.written) > 0 && w.rand.Float64() < w.updateRatio {
+		if w.zipf != nil {
+			// the keys written first are the hot ones
+			return w.written[w.zipf.Uint64()%uint64(len(w.written))]
+		}
+		return w.written[w.rand.Intn(len(w.written))]
+	}
+	switch w.distribution {
+	case "zipf":
+		return w.zipf.Uint64()
+	case "sequential":
+		key := w.next
+		if w.next < w.keySpace {
+			w.next++
+		}
+		return key
+	}
+	return w.rand.Uint64() & w.keySpace
+}
+
+// writtenKey returns a key written by the workload, to be proven.
+func (w *workload) writtenKey() uint64 {
+	return w.written[w.rand.Intn(len(w.written))]
+}
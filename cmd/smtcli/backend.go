@@ -0,0 +1,195 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/cassandra"
+	"github.com/bnb-chain/zkbnb-smt/database/etcd"
+	"github.com/bnb-chain/zkbnb-smt/database/leveldb"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/database/mmap"
+	"github.com/bnb-chain/zkbnb-smt/database/redis"
+)
+
+// treeFlags are the flags locating a tree and its parameters.
+type treeFlags struct {
+	backend   string
+	path      string
+	addr      string
+	namespace string
+	keyspace  string
+	readOnly  bool
+
+	depth   uint
+	hash    string
+	nilHash string
+}
+
+func (f *treeFlags) register(fs *flag.FlagSet, readOnly bool) {
+	fs.StringVar(&f.backend, "backend", "leveldb", "database backend: leveldb, redis, etcd, cassandra, foundationdb, mmap or memory")
+	fs.StringVar(&f.path, "path", "", "directory of a leveldb or mmap database, file of a memory database, cluster file of foundationdb")
+	fs.StringVar(&f.addr, "addr", "", "comma separated addresses of the redis, etcd or cassandra servers, several redis addresses denote a cluster")
+	fs.StringVar(&f.namespace, "namespace", "", "namespace of the tree in the database")
+	fs.StringVar(&f.keyspace, "keyspace", "smt", "keyspace of a cassandra database")
+	f.readOnly = readOnly
+	if readOnly {
+		fs.BoolVar(&f.readOnly, "readonly", true, "open the tree without writing to the database, an interrupted commit is reported but not repaired")
+	}
+	fs.UintVar(&f.depth, "depth", 0, "maximum depth of the tree, a multiple of 4")
+	f.registerHash(fs)
+}
+
+// registerHash registers the flags of the hash functions only, for the
+// commands not opening a database.
+func (f *treeFlags) registerHash(fs *flag.FlagSet) {
+	fs.StringVar(&f.hash, "hash", "sha256", "hash function of the tree: sha256 or keccak256")
+	fs.StringVar(&f.nilHash, "nil-hash", "", "hex encoded hash of an empty leaf, default is the hash of \"nilHash\"")
+}
+
+// hasher returns the hasher and the nil hash of the tree.
+func (f *treeFlags) hasher() (*bsmt.Hasher, []byte, error) {
+	var init func() hash.Hash
+	switch f.hash {
+	case "sha256":
+		init = sha256.New
+	case "keccak256":
+		init = func() hash.Hash { return crypto.NewKeccakState() }
+	default:
+		return nil, nil, fmt.Errorf("unknown hash function %q", f.hash)
+	}
+	hasher := bsmt.NewHasherPool(init)
+	if f.nilHash == "" {
+		return hasher, hasher.Hash([]byte("nilHash")), nil
+	}
+	nilHash, err := decodeHex(f.nilHash)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid -nil-hash")
+	}
+	return hasher, nilHash, nil
+}
+
+// openDB opens the database of the backend.
+func (f *treeFlags) openDB() (database.TreeDB, error) {
+	addrs := splitList(f.addr)
+	switch f.backend {
+	case "leveldb":
+		if f.path == "" {
+			return nil, errors.New("-path is required by leveldb")
+		}
+		return leveldb.NewWithConfig(f.path, f.namespace, &leveldb.LevelDBConfig{ReadOnly: f.readOnly})
+	case "redis":
+		if len(addrs) == 0 {
+			return nil, errors.New("-addr is required by redis")
+		}
+		config := &redis.RedisConfig{Addr: addrs[0]}
+		if len(addrs) > 1 {
+			config = &redis.RedisConfig{ClusterAddr: addrs}
+		}
+		db, err := redis.New(config)
+		if err != nil {
+			return nil, err
+		}
+		return redis.WrapWithNamespace(db, f.namespace), nil
+	case "etcd":
+		if len(addrs) == 0 {
+			return nil, errors.New("-addr is required by etcd")
+		}
+		db, err := etcd.New(&etcd.EtcdConfig{Endpoints: addrs})
+		if err != nil {
+			return nil, err
+		}
+		return etcd.WrapWithNamespace(db, f.namespace), nil
+	case "cassandra":
+		// the table of the namespace is created if it does not exist, even by a
+		// read-only command, the tree itself is not written
+		if len(addrs) == 0 {
+			return nil, errors.New("-addr is required by cassandra")
+		}
+		db, err := cassandra.New(&cassandra.CassandraConfig{Hosts: addrs, Keyspace: f.keyspace})
+		if err != nil {
+			return nil, err
+		}
+		if f.namespace == "" {
+			return db, nil
+		}
+		wrapped, err := cassandra.WrapWithNamespace(db, f.namespace)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return wrapped, nil
+	case "foundationdb":
+		return openFoundationDB(f.path, f.namespace)
+	case "mmap":
+		if f.path == "" {
+			return nil, errors.New("-path is required by mmap")
+		}
+		return mmap.New(f.path)
+	case "memory":
+		if f.path == "" {
+			return nil, errors.New("-path is required by memory")
+		}
+		return memory.NewPersistentMemoryDB(f.path)
+	}
+	return nil, fmt.Errorf("unknown backend %q", f.backend)
+}
+
+// openTree opens the database and the tree stored in it. The tree of a
+// read-only command is opened with bsmt.ReadOnly, so that neither the tree nor
+// a repair writes to the database, whatever the backend.
+func (f *treeFlags) openTree(opts ...bsmt.Option) (*bsmt.BNBSparseMerkleTree, database.TreeDB, error) {
+	if f.depth == 0 || f.depth%4 != 0 || f.depth > 64 {
+		return nil, nil, errors.New("-depth must be a multiple of 4 up to 64")
+	}
+	hasher, nilHash, err := f.hasher()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := f.openDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.readOnly {
+		opts = append(opts, bsmt.ReadOnly())
+	}
+	tree, err := bsmt.NewBNBSparseMerkleTree(hasher, db, uint8(f.depth), nilHash, opts...)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return tree.(*bsmt.BNBSparseMerkleTree), db, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// decodeHex decodes a hex string with an optional 0x prefix.
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+}
+
+func encodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
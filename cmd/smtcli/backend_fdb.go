@@ -0,0 +1,29 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+//go:build fdb
+
+package main
+
+import (
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/foundationdb"
+)
+
+// The foundationdb backend is a module of its own, smtcli is built with
+// -tags fdb in a workspace including database/foundationdb.
+
+// openFoundationDB opens the FoundationDB cluster of the cluster file, an
+// empty path selects the default cluster file.
+func openFoundationDB(clusterFile, namespace string) (database.TreeDB, error) {
+	db, err := foundationdb.New(clusterFile)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		return db, nil
+	}
+	return foundationdb.WrapWithNamespace(db, namespace), nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+//go:build !fdb
+
+package main
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// openFoundationDB fails without the fdb build tag, the FoundationDB bindings
+// require the native client library.
+func openFoundationDB(string, string) (database.TreeDB, error) {
+	return nil, errors.New("foundationdb requires smtcli built with -tags fdb")
+}
@@ -0,0 +1,253 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// proofJSON is the JSON encoding of a proof printed by the proof command.
+type proofJSON struct {
+	Root    string   `json:"root"`
+	Key     uint64   `json:"key"`
+	Value   string   `json:"value"`
+	Version uint64   `json:"version"`
+	Proof   []string `json:"proof"`
+}
+
+func runInfo(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	countLeaves := fs.Bool("leaves", true, "count the leaves by scanning the stored leaf nodes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	latest := tree.LatestVersion()
+	fmt.Fprintf(out, "root:           %s\n", encodeHex(tree.Root()))
+	fmt.Fprintf(out, "latest version: %d\n", latest)
+	fmt.Fprintf(out, "recent version: %d\n", tree.RecentVersion())
+	if versions := tree.Versions(); len(versions) > 0 {
+		fmt.Fprintf(out, "versions:       %d-%d (%d readable)\n", versions[0], versions[len(versions)-1], len(versions))
+	}
+	if pinned := tree.PinnedVersions(); len(pinned) > 0 {
+		fmt.Fprintf(out, "pinned:         %v\n", pinned)
+	}
+	if report := tree.StartupRepair(); report != nil {
+		fmt.Fprintf(out, "repaired:       version %d (rolled back: %t)\n", report.Version, report.RolledBack)
+	}
+	if version, ok := tree.InterruptedCommit(); ok {
+		fmt.Fprintf(out, "interrupted:    version %d, repaired by the next writable open\n", version)
+	}
+	if !*countLeaves || tree.IsEmpty() {
+		return nil
+	}
+	scanner, err := tree.Leaves(latest)
+	if err != nil {
+		return err
+	}
+	leaves := 0
+	for scanner.Next() {
+		leaves++
+	}
+	if err := scanner.Error(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "leaves:         %d\n", leaves)
+	return nil
+}
+
+func runUsage(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	prefixDepth := fs.Uint("prefix-depth", 4, "depth of the subtrees the nodes are grouped by, a multiple of 4")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *prefixDepth > 64 {
+		return errors.New("-prefix-depth must be a multiple of 4 up to the depth")
+	}
+	breakdown, err := tree.AnalyzeStorage(uint8(*prefixDepth))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "nodes: %d\nbytes: %d\n\n", breakdown.Nodes, breakdown.Bytes)
+	fmt.Fprintf(out, "%-12s %10s %10s %12s\n", "version", "nodes", "entries", "bytes")
+	for _, v := range breakdown.Versions {
+		fmt.Fprintf(out, "%-12d %10d %10d %12d\n", v.Version, v.Nodes, v.Entries, v.Bytes)
+	}
+	fmt.Fprintf(out, "\n%-12s %10s %10s %12s\n", "subtree", "nodes", "entries", "bytes")
+	if top := breakdown.Top; top.Nodes > 0 {
+		fmt.Fprintf(out, "%-12s %10d %10d %12d\n", "top", top.Nodes, top.Entries, top.Bytes)
+	}
+	for _, s := range breakdown.Subtrees {
+		fmt.Fprintf(out, "%-12s %10d %10d %12d\n", fmt.Sprintf("%d:%x", breakdown.PrefixDepth, s.Prefix), s.Nodes, s.Entries, s.Bytes)
+	}
+	return nil
+}
+
+func runHistory(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	from := fs.Uint64("from", 0, "first version to list")
+	to := fs.Int64("to", -1, "last version to list, default is the latest version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	last := tree.LatestVersion()
+	if *to >= 0 {
+		last = bsmt.Version(*to)
+	}
+	history, err := tree.VersionHistory(bsmt.Version(*from), last)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%-12s %-30s %8s  %s\n", "version", "committed", "changed", "root")
+	for _, summary := range history {
+		committed, changed := "-", "-"
+		if !summary.Time.IsZero() {
+			committed = summary.Time.UTC().Format(time.RFC3339Nano)
+		}
+		if summary.Recorded {
+			changed = strconv.FormatUint(summary.ChangedKeys, 10)
+		}
+		fmt.Fprintf(out, "%-12d %-30s %8s  %s", summary.Version, committed, changed, encodeHex(summary.Root))
+		if len(summary.Metadata) > 0 {
+			fmt.Fprintf(out, " %s", encodeHex(summary.Metadata))
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+func runGet(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	version := fs.Int64("version", -1, "version to read, default is the latest version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keys, err := parseKeys(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	_, nilHash, err := tf.hasher()
+	if err != nil {
+		return err
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var ver *bsmt.Version
+	if *version >= 0 {
+		v := bsmt.Version(*version)
+		ver = &v
+	}
+	for _, key := range keys {
+		val, err := tree.Get(key, ver)
+		if errors.Is(err, bsmt.ErrNodeNotFound) || (err == nil && bytes.Equal(val, nilHash)) {
+			fmt.Fprintf(out, "%d: <empty>\n", key)
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "key %d", key)
+		}
+		fmt.Fprintf(out, "%d: %s\n", key, encodeHex(val))
+	}
+	return nil
+}
+
+func runProof(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keys, err := parseKeys(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(keys) != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	proof, err := tree.GetProof(keys[0])
+	if err != nil {
+		return err
+	}
+	val, err := tree.Get(keys[0], nil)
+	if errors.Is(err, bsmt.ErrNodeNotFound) || errors.Is(err, bsmt.ErrEmptyRoot) {
+		_, val, err = tf.hasher()
+	}
+	if err != nil {
+		return err
+	}
+	encoded := proofJSON{
+		Root:    encodeHex(tree.Root()),
+		Key:     keys[0],
+		Value:   encodeHex(val),
+		Version: uint64(tree.LatestVersion()),
+		Proof:   make([]string, len(proof)),
+	}
+	for i, hash := range proof {
+		encoded.Proof[i] = encodeHex(hash)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(encoded)
+}
+
+func parseKeys(args []string) ([]uint64, error) {
+	keys := make([]uint64, len(args))
+	for i, arg := range args {
+		key, err := strconv.ParseUint(arg, 0, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %q", arg)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
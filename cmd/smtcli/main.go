@@ -0,0 +1,89 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Command smtcli inspects the sparse merkle trees stored in any supported
+// database backend.
+//
+// Usage:
+//
+//	smtcli <command> [flags] [arguments]
+//
+// Run "smtcli <command> -h" for the flags of a command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of smtcli.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string, out io.Writer) error
+}
+
+func commands() []command {
+	return []command{
+		{"info", "", "print the latest root, the version range and the leaf count", runInfo},
+		{"usage", "", "print the storage of the stored nodes per version and per subtree", runUsage},
+		{"history", "", "print the root, the commit time and the changed key count of every retained version", runHistory},
+		{"get", "key...", "print the values of the leaves", runGet},
+		{"proof", "key", "print the proof of a leaf as JSON", runProof},
+		{"verify-proof", "", "verify a proof against a root hash without a database", runVerifyProof},
+		{"check-storage", "", "check the stored nodes against the root, and list the leaked ones", runCheckStorage},
+		{"export", "", "export the leaves of a version to a snapshot file", runExport},
+		{"import", "", "build an empty tree from a snapshot file and verify its root", runImport},
+		{"prune", "", "prune the old versions of a stopped tree's database", runPrune},
+		{"rebuild", "", "rebuild the internal nodes of a stopped tree's database from its leaves", runRebuild},
+		{"replay", "", "replay the operation log into a tree in memory and check the root of every version", runReplay},
+	}
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp && err != errInvalidProof && err != errStorageIssues && err != errReplayDiverged {
+			fmt.Fprintln(os.Stderr, "smtcli:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out, errOut io.Writer) error {
+	if len(args) == 0 {
+		usage(errOut)
+		return flag.ErrHelp
+	}
+	for _, cmd := range commands() {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.SetOutput(errOut)
+		fs.Usage = func() {
+			fmt.Fprintf(errOut, "Usage: smtcli %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+			fs.PrintDefaults()
+		}
+		return cmd.run(fs, args[1:], out)
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage(errOut)
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("unknown command %q, run smtcli help", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: smtcli <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+}
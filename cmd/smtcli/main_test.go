@@ -0,0 +1,105 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database/leveldb"
+)
+
+// prepareTree commits a tree of depth 8 with the leaves 1, 2 and 23 to a
+// leveldb database under a temporary directory, and returns its path.
+func prepareTree(t *testing.T) (string, *bsmt.Hasher) {
+	path := t.TempDir()
+	db, err := leveldb.New(path, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	hasher := bsmt.NewHasherPool(sha256.New)
+	tree, err := bsmt.NewBNBSparseMerkleTree(hasher, db, 8, hasher.Hash([]byte("nilHash")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []uint64{1, 2, 23} {
+		if err := tree.Set(key, hasher.Hash([]byte{byte(key)})); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tree.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path, hasher
+}
+
+func runCLI(t *testing.T, args ...string) string {
+	var out, errOut bytes.Buffer
+	if err := run(args, &out, &errOut); err != nil {
+		t.Fatalf("smtcli %s: %v\n%s", strings.Join(args, " "), err, errOut.String())
+	}
+	return out.String()
+}
+
+func TestInspect(t *testing.T) {
+	path, hasher := prepareTree(t)
+	flags := []string{"-path", path, "-depth", "8"}
+
+	info := runCLI(t, append([]string{"info"}, flags...)...)
+	for _, line := range []string{"latest version: 3", "versions:       1-3 (3 readable)", "leaves:         3"} {
+		if !strings.Contains(info, line) {
+			t.Fatalf("expected %q in the info:\n%s", line, info)
+		}
+	}
+
+	usage := runCLI(t, append([]string{"usage"}, flags...)...)
+	for _, line := range []string{"nodes: 6\n", "\n3 ", "\ntop ", "\n4:1 "} {
+		if !strings.Contains(usage, line) {
+			t.Fatalf("expected %q in the usage:\n%s", line, usage)
+		}
+	}
+
+	history := strings.Split(strings.TrimSpace(runCLI(t, append([]string{"history", "-from", "2"}, flags...)...)), "\n")
+	if len(history) != 3 || !strings.HasPrefix(history[1], "2 ") || !strings.Contains(history[2], "       1  0x") {
+		t.Fatalf("unexpected history:\n%s", strings.Join(history, "\n"))
+	}
+
+	get := runCLI(t, append(append([]string{"get"}, flags...), "-version", "1", "2", "23")...)
+	expected := "2: <empty>\n23: <empty>\n"
+	if get != expected {
+		t.Fatalf("expected %q, got %q", expected, get)
+	}
+	get = runCLI(t, append(append([]string{"get"}, flags...), "23")...)
+	if expected := "23: " + encodeHex(hasher.Hash([]byte{23})) + "\n"; get != expected {
+		t.Fatalf("expected %q, got %q", expected, get)
+	}
+
+	var proof proofJSON
+	if err := json.Unmarshal([]byte(runCLI(t, append(append([]string{"proof"}, flags...), "2")...)), &proof); err != nil {
+		t.Fatal(err)
+	}
+	if proof.Key != 2 || proof.Version != 3 || len(proof.Proof) != 8 {
+		t.Fatalf("unexpected proof %+v", proof)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if err := run([]string{"nope"}, &out, &errOut); err == nil {
+		t.Fatal("expected an unknown command error")
+	}
+	if err := run([]string{"info", "-depth", "6", "-path", t.TempDir()}, &out, &errOut); err == nil {
+		t.Fatal("expected an invalid depth error")
+	}
+	if err := run([]string{"info", "-depth", "8", "-backend", "foundationdb"}, &out, &errOut); err == nil {
+		t.Fatal("expected a build tag error")
+	}
+}
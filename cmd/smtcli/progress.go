@@ -0,0 +1,79 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	progressWidth    = 30
+	progressInterval = 200 * time.Millisecond
+)
+
+// progress renders a progress bar of the work done out of a total on a line
+// of its own, rewritten at most every progressInterval. Without a total, the
+// amount of work done and the rate are rendered instead.
+type progress struct {
+	w     io.Writer
+	label string
+	unit  string
+	total uint64
+	start time.Time
+	last  time.Time
+	done  uint64
+}
+
+func newProgress(w io.Writer, label, unit string, total uint64) *progress {
+	now := time.Now()
+	return &progress{w: w, label: label, unit: unit, total: total, start: now}
+}
+
+// update sets the work done so far.
+func (p *progress) update(done uint64) {
+	p.done = done
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.render()
+	}
+}
+
+// finish renders the final state and ends the line.
+func (p *progress) finish() {
+	p.render()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) render() {
+	elapsed := time.Since(p.start)
+	rate := float64(p.done) / elapsed.Seconds()
+	if p.total == 0 {
+		fmt.Fprintf(p.w, "\r%s %d %s (%.0f/s) %s", p.label, p.done, p.unit, rate, elapsed.Round(time.Second))
+		return
+	}
+	done := p.done
+	if done > p.total {
+		done = p.total
+	}
+	filled := int(done * progressWidth / p.total)
+	fmt.Fprintf(p.w, "\r%s [%s%s] %3d%% %d/%d %s %s", p.label, strings.Repeat("#", filled),
+		strings.Repeat(" ", progressWidth-filled), done*100/p.total, done, p.total, p.unit, elapsed.Round(time.Second))
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
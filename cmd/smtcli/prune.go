@@ -0,0 +1,97 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+func runPrune(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, false)
+	version := fs.Int64("version", -1, "prune the versions older than this version")
+	keep := fs.Uint64("keep", 0, "prune all but the latest versions, an alternative to -version")
+	compact := fs.Bool("compact", false, "fold the pruned versions into a baseline by rewriting every stored node, see Compact")
+	dryRun := fs.Bool("dry-run", false, "report what the prune would reclaim without modifying the database")
+	step := fs.Uint64("step", 0, "number of versions pruned at a time, default is a hundredth of the pruned range")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*version >= 0) == (*keep > 0) {
+		return errors.New("exactly one of -version and -keep is required")
+	}
+	// the tree must not be written by a node meanwhile
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	latest, recent := tree.LatestVersion(), tree.RecentVersion()
+	target := bsmt.Version(*version)
+	if *keep > 0 {
+		target = 0
+		if uint64(latest) >= *keep {
+			target = latest - bsmt.Version(*keep) + 1
+		}
+	}
+	if target > latest {
+		return fmt.Errorf("version %d is higher than the latest version %d", target, latest)
+	}
+	if target <= recent {
+		fmt.Fprintf(out, "nothing to prune: the versions older than %d are pruned already\n", recent)
+		return nil
+	}
+
+	nodes, reclaimed, err := tree.EstimatePrune(target)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "would prune versions %d-%d: %d nodes rewritten, %d bytes reclaimed\n", recent, target-1, nodes, reclaimed)
+		if *compact {
+			fmt.Fprintln(out, "the nodes written before the orphans were tracked are only found by the compaction scan and are not counted")
+		}
+		return nil
+	}
+
+	if *step == 0 {
+		*step = uint64(target-recent) / 100
+		if *step == 0 {
+			*step = 1
+		}
+	}
+	bar := newProgress(fs.Output(), "pruning", "versions", uint64(target-recent))
+	for v := recent; v < target; {
+		v += bsmt.Version(*step)
+		if v > target {
+			v = target
+		}
+		if err := tree.Prune(v); err != nil {
+			bar.finish()
+			return errors.Wrapf(err, "pruning up to version %d", v)
+		}
+		bar.update(uint64(v - recent))
+	}
+	bar.finish()
+	if *compact {
+		fmt.Fprintln(fs.Output(), "compacting the stored nodes")
+		if err := tree.Compact(tree.RecentVersion()); err != nil {
+			return err
+		}
+	}
+	if pruned := tree.RecentVersion(); pruned < target {
+		fmt.Fprintf(out, "the versions from %d are protected from pruning\n", pruned)
+	}
+	fmt.Fprintf(out, "pruned versions %d-%d: %d nodes rewritten, %d bytes reclaimed\n", recent, tree.RecentVersion()-1, nodes, reclaimed)
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	path, _ := prepareTree(t)
+	flags := []string{"-path", path, "-depth", "8"}
+
+	out := runCLI(t, append([]string{"prune", "-dry-run", "-keep", "1"}, flags...)...)
+	if !strings.HasPrefix(out, "would prune versions 0-2:") {
+		t.Fatalf("unexpected dry run %q", out)
+	}
+	if info := runCLI(t, append([]string{"info"}, flags...)...); !strings.Contains(info, "recent version: 0") {
+		t.Fatalf("the dry run should not prune:\n%s", info)
+	}
+
+	out = runCLI(t, append([]string{"prune", "-keep", "1", "-compact"}, flags...)...)
+	if !strings.HasPrefix(out, "pruned versions 0-2:") {
+		t.Fatalf("unexpected prune %q", out)
+	}
+	info := runCLI(t, append([]string{"info"}, flags...)...)
+	if !strings.Contains(info, "recent version: 3") || !strings.Contains(info, "leaves:         3") {
+		t.Fatalf("unexpected info after the prune:\n%s", info)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := run(append(append([]string{"get"}, flags...), "-version", "1", "1"), &stdout, &stderr); err == nil {
+		t.Fatal("expected the pruned version to be unreadable")
+	}
+	if out := runCLI(t, append([]string{"prune", "-version", "2"}, flags...)...); !strings.HasPrefix(out, "nothing to prune") {
+		t.Fatalf("unexpected prune %q", out)
+	}
+}
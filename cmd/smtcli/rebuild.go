@@ -0,0 +1,45 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+func runRebuild(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if tf.depth == 0 || tf.depth%4 != 0 || tf.depth > 64 {
+		return errors.New("-depth must be a multiple of 4 up to 64")
+	}
+	hasher, nilHash, err := tf.hasher()
+	if err != nil {
+		return err
+	}
+	// the tree must not be written by a node meanwhile
+	db, err := tf.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := bsmt.RebuildFromLeaves(hasher, db, uint8(tf.depth), nilHash)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "rebuilt version %d from %d leaves: %d internal nodes written, %d removed, %d leaves trimmed\n",
+		report.Version, report.Leaves, report.Nodes, report.Removed, report.TrimmedLeaves)
+	return nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	path, _ := prepareTree(t)
+	flags := []string{"-path", path, "-depth", "8"}
+	before := runCLI(t, append([]string{"info"}, flags...)...)
+
+	out := runCLI(t, append([]string{"rebuild"}, flags...)...)
+	if expected := "rebuilt version 3 from 3 leaves: 3 internal nodes written, 3 removed, 0 leaves trimmed\n"; out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+	if after := runCLI(t, append([]string{"info"}, flags...)...); after != before {
+		t.Fatalf("unexpected info after the rebuild:\n%s", after)
+	}
+	if out := runCLI(t, append([]string{"check-storage"}, flags...)...); !strings.HasSuffix(out, "0 missing, 0 mismatched, 0 corrupted, 0 leaked\n") {
+		t.Fatalf("unexpected storage check %q", out)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+// errReplayDiverged fails the replay command of an operation log which diverges.
+var errReplayDiverged = errors.New("the replay diverged")
+
+func runReplay(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	to := fs.Int64("to", -1, "last version to replay, default is the latest version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hasher, nilHash, err := tf.hasher()
+	if err != nil {
+		return err
+	}
+	// the versions are replayed into a tree in memory
+	target, err := bsmt.NewBNBSparseMerkleTree(hasher, memory.NewMemoryDB(), uint8(tf.depth), nilHash)
+	if err != nil {
+		return err
+	}
+	defer target.(*bsmt.BNBSparseMerkleTree).StopGC()
+
+	last := tree.LatestVersion()
+	if *to >= 0 {
+		last = bsmt.Version(*to)
+	}
+	report, err := tree.ReplayOperationLog(target, last, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "replayed versions %d-%d: %d versions, %d roots checked\n", report.From, report.To, report.Versions, report.Checked)
+	if d := report.Divergence; d != nil {
+		if d.Operation != nil {
+			fmt.Fprintf(out, "diverged at version %d: key %d has the value %s, the log expects %s\n",
+				d.Version, d.Operation.Key, encodeHex(d.Actual), encodeHex(d.Expected))
+		} else {
+			fmt.Fprintf(out, "diverged at version %d: root %s, recorded root %s\n", d.Version, encodeHex(d.Actual), encodeHex(d.Expected))
+		}
+		return errReplayDiverged
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database/leveldb"
+)
+
+func TestReplay(t *testing.T) {
+	path := t.TempDir()
+	db, err := leveldb.New(path, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := bsmt.NewHasherPool(sha256.New)
+	tree, err := bsmt.NewBNBSparseMerkleTree(hasher, db, 8, hasher.Hash([]byte("nilHash")), bsmt.OperationLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []uint64{1, 2, 1} {
+		if err := tree.Set(key, hasher.Hash([]byte{byte(key)}, tree.Root())); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tree.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.(*bsmt.BNBSparseMerkleTree).StopGC()
+	db.Close()
+
+	flags := []string{"-path", path, "-depth", "8"}
+	if out := runCLI(t, append([]string{"replay"}, flags...)...); out != "replayed versions 1-3: 3 versions, 3 roots checked\n" {
+		t.Fatalf("unexpected replay %q", out)
+	}
+	if out := runCLI(t, append([]string{"replay", "-to", "2"}, flags...)...); out != "replayed versions 1-2: 2 versions, 2 roots checked\n" {
+		t.Fatalf("unexpected replay %q", out)
+	}
+
+	// the roots replayed with another nil hash diverge from the first version
+	var stdout, stderr bytes.Buffer
+	if err := run(append([]string{"replay", "-nil-hash", "0x00"}, flags...), &stdout, &stderr); err != errReplayDiverged {
+		t.Fatalf("expected a divergence, got %v\n%s", err, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "diverged at version 1: root") {
+		t.Fatalf("unexpected divergence %q", stdout.String())
+	}
+}
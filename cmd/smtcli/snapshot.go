@@ -0,0 +1,185 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+func runExport(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	version := fs.Int64("version", -1, "version to export, default is the latest version")
+	output := fs.String("out", "", "file to write the snapshot to")
+	format := fs.String("format", "snapshot", "format of the file: snapshot, or jsonl and csv for the analytics which cannot be imported back")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	var leafFormat bsmt.LeafFormat
+	if *format != "snapshot" {
+		var err error
+		if leafFormat, err = bsmt.ParseLeafFormat(*format); err != nil {
+			return err
+		}
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ver := tree.LatestVersion()
+	if *version >= 0 {
+		ver = bsmt.Version(*version)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	var info *bsmt.SnapshotInfo
+	if *format == "snapshot" {
+		bar := newProgress(fs.Output(), "exporting", "leaves", 0)
+		info, err = tree.ExportSnapshot(ver, w, bar.update)
+		bar.finish()
+	} else {
+		info = &bsmt.SnapshotInfo{Version: ver}
+		if info.Leaves, err = tree.ExportLeaves(ver, w, leafFormat); err == nil {
+			info.Root, err = tree.RootAt(ver)
+		}
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported version %d: %d leaves, root %s\n", info.Version, info.Leaves, encodeHex(info.Root))
+	return nil
+}
+
+func runImport(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, false)
+	input := fs.String("in", "", "file to read the snapshot from")
+	format := fs.String("format", "snapshot", "format of the file: snapshot, jsonl or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	file, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if *format != "snapshot" {
+		leafFormat, err := bsmt.ParseLeafFormat(*format)
+		if err != nil {
+			return err
+		}
+		return importLeaves(&tf, file, leafFormat, out)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	counter := &countingReader{r: file}
+	reader, err := bsmt.NewSnapshotReader(counter)
+	if err != nil {
+		return err
+	}
+	info := reader.Info()
+	if tf.depth == 0 {
+		tf.depth = uint(info.MaxDepth)
+	}
+	bar := newProgress(fs.Output(), "importing", "bytes", uint64(stat.Size()))
+	version, err := importSnapshot(&tf, reader, func(uint64) { bar.update(counter.n) })
+	bar.update(counter.n)
+	bar.finish()
+	if err != nil {
+		return err
+	}
+	// the final check reads the root back from the database
+	if err := verifyImported(&tf, info.Root); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported version %d: %d leaves, root %s verified\n", version, reader.Info().Leaves, encodeHex(info.Root))
+	return nil
+}
+
+// importSnapshot builds the tree from the snapshot, and closes the database.
+func importSnapshot(tf *treeFlags, reader *bsmt.SnapshotReader, progress func(uint64)) (bsmt.Version, error) {
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return 0, err
+	}
+	version, err := tree.ImportSnapshot(reader, progress)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return version, err
+}
+
+// importLeaves builds the tree from the leaves of a JSONL or CSV file, and
+// reports the root to be cross-checked against the exported one.
+func importLeaves(tf *treeFlags, r io.Reader, format bsmt.LeafFormat, out io.Writer) error {
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	reader, err := bsmt.NewLeafReader(bufio.NewReader(r), format, uint8(tf.depth))
+	if err != nil {
+		db.Close()
+		return err
+	}
+	info, err := tree.ImportLeaves(reader)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyImported(tf, info.Root); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported version %d: %d leaves, root %s\n", info.Version, info.Leaves, encodeHex(info.Root))
+	return nil
+}
+
+// verifyImported reopens the tree and compares its root with the root of the snapshot.
+func verifyImported(tf *treeFlags, root []byte) error {
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if !bytes.Equal(tree.Root(), root) {
+		return errors.Wrapf(bsmt.ErrSnapshotMismatch, "stored root %s, snapshot root %s", encodeHex(tree.Root()), encodeHex(root))
+	}
+	return nil
+}
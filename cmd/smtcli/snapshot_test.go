@@ -0,0 +1,62 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	path, _ := prepareTree(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "state.snap")
+
+	out := runCLI(t, "export", "-path", path, "-depth", "8", "-version", "2", "-out", file)
+	if !strings.HasPrefix(out, "exported version 2: 2 leaves") {
+		t.Fatalf("unexpected export %q", out)
+	}
+
+	memFile := filepath.Join(dir, "state.mem")
+	out = runCLI(t, "import", "-backend", "memory", "-path", memFile, "-in", file)
+	if !strings.HasPrefix(out, "imported version 2: 2 leaves") || !strings.HasSuffix(out, "verified\n") {
+		t.Fatalf("unexpected import %q", out)
+	}
+	info := runCLI(t, "info", "-backend", "memory", "-path", memFile, "-depth", "8")
+	if !strings.Contains(info, "latest version: 2") || !strings.Contains(info, "leaves:         2") {
+		t.Fatalf("unexpected info of the imported tree:\n%s", info)
+	}
+
+	// a tree is imported into an empty database only
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"import", "-backend", "memory", "-path", memFile, "-in", file}, &stdout, &stderr); err == nil {
+		t.Fatal("expected the import into a non-empty tree to fail")
+	}
+
+	csvFile := filepath.Join(dir, "leaves.csv")
+	out = runCLI(t, "export", "-path", path, "-depth", "8", "-format", "csv", "-out", csvFile)
+	if !strings.HasPrefix(out, "exported version 3: 3 leaves") {
+		t.Fatalf("unexpected csv export %q", out)
+	}
+	data, err := os.ReadFile(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 4 || lines[0] != "key,value,version" {
+		t.Fatalf("unexpected csv leaves:\n%s", data)
+	}
+	csvMem := filepath.Join(dir, "leaves.mem")
+	out = runCLI(t, "import", "-backend", "memory", "-path", csvMem, "-depth", "8", "-format", "csv", "-in", csvFile)
+	if !strings.HasPrefix(out, "imported version 1: 3 leaves") {
+		t.Fatalf("unexpected csv import %q", out)
+	}
+	if root := runCLI(t, "info", "-path", path, "-depth", "8"); !strings.Contains(root, strings.TrimSpace(out[strings.LastIndex(out, " "):])) {
+		t.Fatalf("the imported root %q is not the root of the tree:\n%s", out, root)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// errInvalidProof fails the verify-proof command of an invalid proof, so the
+// exit status tells the result as well.
+var errInvalidProof = errors.New("invalid proof")
+
+// errStorageIssues fails the check-storage command of a database with issues.
+var errStorageIssues = errors.New("storage issues found")
+
+func runVerifyProof(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.registerHash(fs)
+	root := fs.String("root", "", "hex encoded root hash, default is the root of a JSON proof")
+	key := fs.String("key", "", "key of the proven leaf, default is the key of a JSON proof")
+	value := fs.String("value", "", "hex encoded value of the leaf, default is the value of a JSON proof or the nil hash")
+	depth := fs.Uint("depth", 0, "maximum depth of the tree, default is the length of the proof")
+	proofArg := fs.String("proof", "", "the proof: the JSON printed by the proof command, a JSON array of hex hashes, "+
+		"comma separated hex hashes or their hex concatenation. @file reads the proof from a file, @- from stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *proofArg == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	hasher, nilHash, err := tf.hasher()
+	if err != nil {
+		return err
+	}
+	encoded, err := readArg(*proofArg)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseProof(encoded, len(nilHash))
+	if err != nil {
+		return err
+	}
+
+	// the flags take precedence over the fields of a JSON proof
+	if *root != "" {
+		parsed.Root = *root
+	}
+	if *key != "" {
+		k, err := strconv.ParseUint(*key, 0, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid key %q", *key)
+		}
+		parsed.Key = k
+	} else if !parsed.hasKey {
+		return errors.New("-key is required unless the proof is the JSON of the proof command")
+	}
+	if *value != "" {
+		parsed.Value = *value
+	}
+	if parsed.Root == "" {
+		return errors.New("-root is required unless the proof is the JSON of the proof command")
+	}
+	rootHash, err := decodeHex(parsed.Root)
+	if err != nil {
+		return errors.Wrap(err, "invalid root")
+	}
+	val := nilHash
+	if parsed.Value != "" {
+		if val, err = decodeHex(parsed.Value); err != nil {
+			return errors.Wrap(err, "invalid value")
+		}
+	}
+	if *depth == 0 {
+		*depth = uint(len(parsed.proof))
+	}
+	if *depth > 64 {
+		return fmt.Errorf("invalid depth %d", *depth)
+	}
+
+	if !bsmt.VerifyProof(hasher, rootHash, uint8(*depth), parsed.Key, val, parsed.proof) {
+		fmt.Fprintf(out, "invalid: the proof of key %d does not lead to root %s\n", parsed.Key, parsed.Root)
+		return errInvalidProof
+	}
+	fmt.Fprintf(out, "valid: key %d holds %s under root %s\n", parsed.Key, encodeHex(val), parsed.Root)
+	return nil
+}
+
+func runCheckStorage(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var tf treeFlags
+	tf.register(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, db, err := tf.openTree()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := tree.CheckStorage()
+	if err != nil {
+		return err
+	}
+	for _, issue := range []struct {
+		kind  string
+		nodes []bsmt.NodeRef
+	}{
+		{"missing", report.Missing},
+		{"mismatched", report.Mismatched},
+		{"corrupted", report.Corrupted},
+		{"leaked", report.Leaked},
+	} {
+		for _, node := range issue.nodes {
+			fmt.Fprintf(out, "%s: depth %d path %d\n", issue.kind, node.Depth, node.Path)
+		}
+	}
+	fmt.Fprintf(out, "checked %d nodes at version %d: %d missing, %d mismatched, %d corrupted, %d leaked\n",
+		report.Nodes, report.Version, len(report.Missing), len(report.Mismatched), len(report.Corrupted), len(report.Leaked))
+	if !report.OK() {
+		return errStorageIssues
+	}
+	return nil
+}
+
+// parsedProof is a proof decoded from any of the accepted encodings.
+type parsedProof struct {
+	proofJSON
+	hasKey bool
+	proof  bsmt.Proof
+}
+
+// parseProof decodes the proof printed by the proof command, a JSON array of
+// hex hashes, comma separated hex hashes, or hex concatenated hashes of hashSize bytes.
+func parseProof(encoded string, hashSize int) (*parsedProof, error) {
+	encoded = strings.TrimSpace(encoded)
+	p := &parsedProof{}
+	var hashes []string
+	switch {
+	case strings.HasPrefix(encoded, "{"):
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(encoded), &fields); err != nil {
+			return nil, errors.Wrap(err, "invalid JSON proof")
+		}
+		if err := json.Unmarshal([]byte(encoded), &p.proofJSON); err != nil {
+			return nil, errors.Wrap(err, "invalid JSON proof")
+		}
+		_, p.hasKey = fields["key"]
+		hashes = p.Proof
+	case strings.HasPrefix(encoded, "["):
+		if err := json.Unmarshal([]byte(encoded), &hashes); err != nil {
+			return nil, errors.Wrap(err, "invalid JSON proof")
+		}
+	case strings.Contains(encoded, ","):
+		hashes = splitList(encoded)
+	default:
+		concatenated, err := decodeHex(encoded)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid hex proof")
+		}
+		if hashSize == 0 || len(concatenated)%hashSize != 0 {
+			return nil, fmt.Errorf("the hex proof is not a sequence of %d byte hashes", hashSize)
+		}
+		for i := 0; i < len(concatenated); i += hashSize {
+			p.proof = append(p.proof, concatenated[i:i+hashSize])
+		}
+		return p, nil
+	}
+	for i, h := range hashes {
+		hash, err := decodeHex(h)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid hash %d of the proof", i)
+		}
+		p.proof = append(p.proof, hash)
+	}
+	return p, nil
+}
+
+// readArg returns the argument, or the content of the file it names with
+// a leading @, @- names stdin.
+func readArg(arg string) (string, error) {
+	if !strings.HasPrefix(arg, "@") {
+		return arg, nil
+	}
+	var data []byte
+	var err error
+	if arg == "@-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(arg[1:])
+	}
+	return string(data), err
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyProof(t *testing.T) {
+	path, hasher := prepareTree(t)
+	encoded := runCLI(t, "proof", "-path", path, "-depth", "8", "23")
+	var proof proofJSON
+	if err := json.Unmarshal([]byte(encoded), &proof); err != nil {
+		t.Fatal(err)
+	}
+	if proof.Value != encodeHex(hasher.Hash([]byte{23})) {
+		t.Fatalf("unexpected value %s", proof.Value)
+	}
+
+	file := filepath.Join(t.TempDir(), "proof.json")
+	if err := os.WriteFile(file, []byte(encoded), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out := runCLI(t, "verify-proof", "-proof", "@"+file); !strings.HasPrefix(out, "valid:") {
+		t.Fatalf("expected a valid proof, got %q", out)
+	}
+
+	// the concatenated hex hashes with the root, key and value given by flags
+	concatenated := ""
+	for _, h := range proof.Proof {
+		concatenated += strings.TrimPrefix(h, "0x")
+	}
+	if out := runCLI(t, "verify-proof", "-root", proof.Root, "-key", "23", "-value", proof.Value, "-proof", concatenated); !strings.HasPrefix(out, "valid:") {
+		t.Fatalf("expected a valid proof, got %q", out)
+	}
+	if out := runCLI(t, "verify-proof", "-root", proof.Root, "-key", "23", "-value", proof.Value, "-proof", strings.Join(proof.Proof, ",")); !strings.HasPrefix(out, "valid:") {
+		t.Fatalf("expected a valid proof, got %q", out)
+	}
+
+	// an absent key is proven with the nil hash
+	var absent proofJSON
+	if err := json.Unmarshal([]byte(runCLI(t, "proof", "-path", path, "-depth", "8", "100")), &absent); err != nil {
+		t.Fatal(err)
+	}
+	array, _ := json.Marshal(absent.Proof)
+	if out := runCLI(t, "verify-proof", "-root", absent.Root, "-key", "100", "-proof", string(array)); !strings.HasPrefix(out, "valid:") {
+		t.Fatalf("expected a valid proof of the absent key, got %q", out)
+	}
+
+	var out, errOut bytes.Buffer
+	err := run([]string{"verify-proof", "-key", "2", "-proof", "@" + file}, &out, &errOut)
+	if err != errInvalidProof || !strings.HasPrefix(out.String(), "invalid:") {
+		t.Fatalf("expected the proof of another key to be invalid, got %v %q", err, out.String())
+	}
+	if err := run([]string{"verify-proof", "-proof", concatenated}, &out, &errOut); err == nil {
+		t.Fatal("expected the missing root and key to be reported")
+	}
+}
+
+func TestCheckStorage(t *testing.T) {
+	path, _ := prepareTree(t)
+	out := runCLI(t, "check-storage", "-path", path, "-depth", "8")
+	if expected := "checked 6 nodes at version 3: 0 missing, 0 mismatched, 0 corrupted, 0 leaked\n"; out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
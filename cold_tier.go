@@ -0,0 +1,46 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// Offloader moves stored records to a cold tier while keeping them readable
+// through the database of the tree, e.g. objstore.Database which uploads the
+// values to an object storage.
+type Offloader interface {
+	// Offload moves the records of the given keys, the missing or already
+	// offloaded keys are skipped.
+	Offload(keys ...[]byte) error
+}
+
+// coldKeys returns the collector of the nodes released by the GC, nil if the
+// released nodes are not offloaded.
+func (tree *BNBSparseMerkleTree) coldKeys() *[]journalKey {
+	if tree.coldTier == nil || tree.readOnly {
+		return nil
+	}
+	return new([]journalKey)
+}
+
+// offload moves the records of the released nodes to the cold tier. The nodes
+// have not been updated since the pruned versions, and are not written by the
+// commits excluded by gcMu. A failure leaves the records in the local store.
+func (tree *BNBSparseMerkleTree) offload(cold *[]journalKey) {
+	if cold == nil || len(*cold) == 0 {
+		return
+	}
+	keys := make([][]byte, len(*cold))
+	for i, jk := range *cold {
+		keys[i] = tree.nodeKeys.key(jk.depth, jk.path)
+	}
+	if err := tree.coldTier.Offload(keys...); err != nil {
+		tree.log.Warn("failed to offload the released nodes", logger.F("nodes", len(keys)), logger.F("error", err))
+		return
+	}
+	tree.log.Debug("offloaded the released nodes", logger.F("nodes", len(keys)))
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/database/objstore"
+)
+
+func Test_BNBSparseMerkleTree_OffloadReleased(t *testing.T) {
+	env := prepareEnv()[0]
+	store, err := objstore.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := memory.NewMemoryDB()
+	db := objstore.New(local, store)
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, OffloadReleased(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := smt.(*BNBSparseMerkleTree).Prune(smt.LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first leaf is released and offloaded, the last one is still in use
+	offloaded := func(key uint64) bool {
+		record, err := local.Get(storageFullTreeNodeKey(8, key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the records referencing an object start with 1
+		return record[0] == 1
+	}
+	if !offloaded(items[0].Key) {
+		t.Fatal("the released leaf should be offloaded")
+	}
+	if offloaded(items[len(items)-1].Key) {
+		t.Fatal("the leaf of the latest version should stay in the local store")
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, smt, reopened, items)
+	// an offloaded leaf is written back to the local store
+	if err := smt.Set(items[0].Key, items[1].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if offloaded(items[0].Key) {
+		t.Fatal("the updated leaf should be stored locally")
+	}
+}
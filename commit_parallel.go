@@ -0,0 +1,155 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// parallelCommitThreshold is the number of dirty nodes from which a commit
+// prepares the dirty subtrees in parallel.
+const parallelCommitThreshold = 64
+
+// workerCount returns the configured number of workers, or GOMAXPROCS if none
+// is configured, capped at max.
+func workerCount(configured, max int) int {
+	workers := configured
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > max {
+		workers = max
+	}
+	return workers
+}
+
+// preparedNode is a dirty node pruned and encoded for the commit batch.
+type preparedNode struct {
+	node    *TreeNode
+	key     []byte
+	record  []byte
+	changed uint64
+}
+
+// prepareNode prunes the versions older than recentVersion from the dirty node
+// and encodes its storage record.
+func (tree *BNBSparseMerkleTree) prepareNode(fullNode *TreeNode, recentVersion *Version, keys *nodeKeyArena) (preparedNode, error) {
+	prepared := preparedNode{node: fullNode, key: keys.key(fullNode.depth, fullNode.path)}
+	if fullNode.PreviousVersion() > tree.gcStatus.latestGCVersion {
+		// If the previous version is greater than the last GC version,
+		// the node has a high probability of existing in memory
+		prepared.changed = versionSize
+	} else {
+		prepared.changed = fullNode.Size()
+	}
+	// prune versions
+	if recentVersion != nil {
+		if err := tree.archiveNode(fullNode, *recentVersion); err != nil {
+			return prepared, err
+		}
+		prepared.changed -= fullNode.prune(*recentVersion, tree.pinned)
+	}
+
+	var err error
+	prepared.record, err = encodeTreeNode(fullNode)
+	return prepared, err
+}
+
+// prepareNodes prepares the dirty nodes for the commit batch. The nodes below
+// the root are partitioned into the 16 subtrees of the root, which are spread
+// over a bounded number of workers. A node is in the subtree of its children,
+// so the record of a node never races with the pruning of its children.
+// The root is prepared last, after all the subtrees are done.
+func (tree *BNBSparseMerkleTree) prepareNodes(nodes []*TreeNode, recentVersion *Version) ([]preparedNode, error) {
+	var (
+		root     *TreeNode
+		subtrees [16][]*TreeNode
+	)
+	for _, node := range nodes {
+		if node.depth == 0 {
+			root = node
+			continue
+		}
+		nibble := node.path >> (node.depth - 4)
+		subtrees[nibble] = append(subtrees[nibble], node)
+	}
+
+	workers := 1
+	if len(nodes) >= parallelCommitThreshold {
+		workers = workerCount(tree.commitWorkers, len(subtrees))
+	}
+
+	var prepared [16][]preparedNode
+	prepare := func(i int) error {
+		// the children are pruned before their parents are encoded
+		sort.Slice(subtrees[i], func(a, b int) bool {
+			if subtrees[i][a].depth != subtrees[i][b].depth {
+				return subtrees[i][a].depth > subtrees[i][b].depth
+			}
+			return subtrees[i][a].path < subtrees[i][b].path
+		})
+		prepared[i] = make([]preparedNode, 0, len(subtrees[i]))
+		keys := newNodeKeyArena(tree.nodeKeys, len(subtrees[i]))
+		for _, node := range subtrees[i] {
+			p, err := tree.prepareNode(node, recentVersion, keys)
+			if err != nil {
+				return err
+			}
+			prepared[i] = append(prepared[i], p)
+		}
+		return nil
+	}
+
+	if workers == 1 {
+		for i := range subtrees {
+			if err := prepare(i); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		errs := make([]error, workers)
+		wg := sync.WaitGroup{}
+		for w := 0; w < workers; w++ {
+			w := w
+			wg.Add(1)
+			err := tree.goroutinePool.Submit(func() {
+				defer wg.Done()
+				tree.labeled(PhaseEncode, func() {
+					for i := w; i < len(subtrees); i += workers {
+						if errs[w] = prepare(i); errs[w] != nil {
+							return
+						}
+					}
+				})
+			})
+			if err != nil {
+				wg.Done()
+				errs[w] = err
+			}
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([]preparedNode, 0, len(nodes))
+	for i := range prepared {
+		result = append(result, prepared[i]...)
+	}
+	if root != nil {
+		p, err := tree.prepareNode(root, recentVersion, newNodeKeyArena(tree.nodeKeys, 1))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// commitPipeline writes the batch of the last commit in the background.
+type commitPipeline struct {
+	mu     sync.Mutex
+	done   chan struct{}
+	err    error
+	revert func(cause error) error
+}
+
+// start runs the write in the background, the previous write must be waited for.
+// If the write fails, revert is called by the next wait, from the goroutine of
+// the operation waiting for the write.
+func (p *commitPipeline) start(write func() error, revert func(cause error) error) {
+	done := make(chan struct{})
+	p.mu.Lock()
+	p.done = done
+	p.mu.Unlock()
+
+	go func() {
+		err := write()
+		p.mu.Lock()
+		if err != nil && p.err == nil {
+			p.err = errors.Wrap(err, "pipelined commit failed")
+			p.revert = revert
+		}
+		p.mu.Unlock()
+		close(done)
+	}()
+}
+
+// wait blocks until the running write completes, and returns the error of a
+// failed write once it is reverted. The error is kept if the revert fails,
+// since the tree is ahead of the database.
+func (p *commitPipeline) wait() error {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if revert := p.revert; revert != nil {
+		p.revert = nil
+		cause := p.err
+		if err := revert(cause); err != cause {
+			p.err = err
+			return err
+		}
+		p.err = nil
+		return cause
+	}
+	return p.err
+}
+
+// awaitCommit is the barrier of the operations reading or writing the database,
+// which must not overlap with a pipelined commit write.
+func (tree *BNBSparseMerkleTree) awaitCommit() error {
+	if tree.pipeline == nil {
+		return nil
+	}
+	return tree.pipeline.wait()
+}
+
+// WaitCommit blocks until the database write of the last pipelined commit
+// completes, it should be called before the database is closed. A failed write
+// is reverted like a failed Commit, its error is returned by WaitCommit or by
+// the next operation reaching the database, whichever comes first, and the
+// changes set since the failed commit are discarded. If the revert fails as
+// well, the error is returned by every following operation reaching the
+// database, and the tree must be reopened, which repairs the interrupted
+// commit. It is a no-op if the commits are not pipelined.
+func (tree *BNBSparseMerkleTree) WaitCommit() error {
+	return tree.awaitCommit()
+}
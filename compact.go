@@ -0,0 +1,114 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// Compact folds the versions older than version into a single baseline version,
+// pruning them as Prune does, and rewrites every stored node which still keeps
+// more than one version at or beneath version, so each node is left with one
+// record of its state as of version. The loaded and the cached nodes are
+// trimmed alike. The orphan records, the commit times and the summaries of the
+// versions beneath the baseline are deleted.
+//
+// Unlike Prune, which only trims the nodes rewritten by the pruned versions,
+// Compact scans the whole tree, including the records written before the
+// orphans were tracked. The orphan records above the lowest pinned version
+// are kept, they list the nodes to trim once the version is unpinned.
+func (tree *BNBSparseMerkleTree) Compact(version Version) error {
+	if err := tree.Prune(version); err != nil {
+		return err
+	}
+	if tree.db == nil {
+		return nil
+	}
+
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	// the prune gate may hold the baseline back
+	version = tree.recentVersion
+
+	batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	if err := tree.compactNodes(batch, version); err != nil {
+		return err
+	}
+	// the orphan records referred to by the pins are kept, see UnpinVersion
+	orphansBelow := version + 1
+	if len(tree.pinned) > 0 && tree.pinned[0] < version {
+		orphansBelow = tree.pinned[0] + 1
+	}
+	if err := deleteVersionRecords(tree.db, batch, orphanPrefix, orphansBelow); err != nil {
+		return err
+	}
+	if err := deleteVersionRecords(tree.db, batch, versionTimePrefix, version); err != nil {
+		return err
+	}
+	if err := deleteVersionRecords(tree.db, batch, versionInfoPrefix, version); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	// the loaded nodes would write the folded versions back
+	tree.root.trimLoaded(version, tree.pinned)
+	if tree.lastSaveRoot != nil && tree.lastSaveRoot != tree.root {
+		tree.lastSaveRoot.trimLoaded(version, tree.pinned)
+	}
+	tree.dbCache.Purge()
+	return nil
+}
+
+// compactNodes rewrites the stored nodes keeping superseded versions at or beneath version.
+func (tree *BNBSparseMerkleTree) compactNodes(batch database.Batcher, version Version) error {
+	for _, prefix := range tree.nodeKeys.prefixes(tree.maxDepth) {
+		if err := tree.compactPrefix(batch, prefix, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactPrefix rewrites the stored nodes under the prefix.
+func (tree *BNBSparseMerkleTree) compactPrefix(batch database.Batcher, prefix []byte, version Version) error {
+	it := tree.db.NewIterator(prefix, nil)
+	defer it.Release()
+	for it.Next() {
+		data, trimmed, err := trimStorageNode(it.Key(), it.Value(), version, tree.pinned)
+		if err != nil {
+			return err
+		}
+		if !trimmed {
+			continue
+		}
+		if err := tree.archiveRecord(version, it.Key(), it.Value()); err != nil {
+			return err
+		}
+		if err := batch.Set(append([]byte(nil), it.Key()...), data); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// deleteVersionRecords deletes the records keyed by prefix and a version below version.
+func deleteVersionRecords(db database.TreeDB, batch database.Batcher, prefix []byte, version Version) error {
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+	for it.Next() {
+		if Version(binary.BigEndian.Uint64(it.Key()[len(prefix):])) >= version {
+			break
+		}
+		if err := batch.Delete(append([]byte(nil), it.Key()...)); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
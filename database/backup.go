@@ -0,0 +1,220 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package database
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidBackup is returned if a backup stream is malformed or truncated.
+	ErrInvalidBackup = errors.New("invalid backup")
+
+	// ErrUnsupportedBackupFormat is returned if a backup was taken in a format
+	// the restoring database does not understand.
+	ErrUnsupportedBackupFormat = errors.New("unsupported backup format")
+)
+
+const (
+	// BackupFormatKV is the portable backup format holding the plain key/value pairs,
+	// it can be restored into any TreeDB.
+	BackupFormatKV = "kv"
+
+	backupMagic = "zkbnb-smt-backup"
+
+	recordEnd   byte = 0
+	recordEntry byte = 1
+
+	// maxBackupFieldSize bounds the size of a key or value read from a backup.
+	maxBackupFieldSize = 1 << 30
+)
+
+// Backuper is implemented by the TreeDBs taking backups natively, e.g. from a
+// consistent snapshot while commits continue.
+type Backuper interface {
+	// Backup writes all the keys of the database to w.
+	Backup(w io.Writer) error
+
+	// Restore writes all the keys of the backup read from r into the database.
+	Restore(r io.Reader) error
+}
+
+// Backup writes all the keys of db to w, natively if db is a Backuper,
+// otherwise in the portable format by iterating over the database.
+func Backup(db TreeDB, w io.Writer) error {
+	if b, ok := db.(Backuper); ok {
+		return b.Backup(w)
+	}
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	return BackupKV(it, w)
+}
+
+// Restore writes the keys of the backup read from r into db. Existing keys
+// which are not part of the backup are kept, so a backup should be restored
+// into an empty database or namespace.
+func Restore(db TreeDB, r io.Reader) error {
+	if b, ok := db.(Backuper); ok {
+		return b.Restore(r)
+	}
+	br, err := NewBackupReader(r)
+	if err != nil {
+		return err
+	}
+	if br.Format() != BackupFormatKV {
+		return ErrUnsupportedBackupFormat
+	}
+	return RestoreKV(db, br)
+}
+
+// BackupKV writes the key/value pairs of the iterator to w in the portable format.
+func BackupKV(it Iterator, w io.Writer) error {
+	bw, err := NewBackupWriter(w, BackupFormatKV)
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		if err := bw.Add(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+// RestoreKV writes the key/value pairs of a backup in the portable format into db.
+func RestoreKV(db TreeDB, br *BackupReader) error {
+	b := NewAutoFlushBatch(db.NewBatch(), 0)
+	for {
+		key, value, err := br.Next()
+		if err == io.EOF {
+			return b.Write()
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.Set(key, value); err != nil {
+			return err
+		}
+	}
+}
+
+// BackupWriter writes the records of a backup stream. The stream starts with
+// a header naming the format of the records, and ends with an end marker
+// so truncated backups are detected.
+type BackupWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+// NewBackupWriter writes the header of a backup in the given format to w.
+func NewBackupWriter(w io.Writer, format string) (*BackupWriter, error) {
+	bw := &BackupWriter{w: bufio.NewWriter(w)}
+	if _, err := bw.w.WriteString(backupMagic); err != nil {
+		return nil, err
+	}
+	if err := bw.writeField([]byte(format)); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+func (bw *BackupWriter) writeField(field []byte) error {
+	n := binary.PutUvarint(bw.buf[:], uint64(len(field)))
+	if _, err := bw.w.Write(bw.buf[:n]); err != nil {
+		return err
+	}
+	_, err := bw.w.Write(field)
+	return err
+}
+
+// Add appends a record to the backup.
+func (bw *BackupWriter) Add(key, value []byte) error {
+	if err := bw.w.WriteByte(recordEntry); err != nil {
+		return err
+	}
+	if err := bw.writeField(key); err != nil {
+		return err
+	}
+	return bw.writeField(value)
+}
+
+// Close writes the end marker and flushes the buffered records,
+// the underlying writer is not closed.
+func (bw *BackupWriter) Close() error {
+	if err := bw.w.WriteByte(recordEnd); err != nil {
+		return err
+	}
+	return bw.w.Flush()
+}
+
+// BackupReader reads the records of a backup stream.
+type BackupReader struct {
+	r      *bufio.Reader
+	format string
+}
+
+// NewBackupReader reads the header of the backup from r.
+func NewBackupReader(r io.Reader) (*BackupReader, error) {
+	br := &BackupReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br.r, magic); err != nil || string(magic) != backupMagic {
+		return nil, ErrInvalidBackup
+	}
+	format, err := br.readField()
+	if err != nil {
+		return nil, err
+	}
+	br.format = string(format)
+	return br, nil
+}
+
+// Format returns the format of the backup records.
+func (br *BackupReader) Format() string {
+	return br.format
+}
+
+func (br *BackupReader) readField() ([]byte, error) {
+	size, err := binary.ReadUvarint(br.r)
+	if err != nil || size > maxBackupFieldSize {
+		return nil, ErrInvalidBackup
+	}
+	field := make([]byte, size)
+	if _, err := io.ReadFull(br.r, field); err != nil {
+		return nil, ErrInvalidBackup
+	}
+	return field, nil
+}
+
+// Next returns the next record of the backup, or io.EOF after the last one.
+func (br *BackupReader) Next() ([]byte, []byte, error) {
+	kind, err := br.r.ReadByte()
+	if err != nil {
+		return nil, nil, ErrInvalidBackup
+	}
+	switch kind {
+	case recordEnd:
+		return nil, nil, io.EOF
+	case recordEntry:
+		key, err := br.readField()
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := br.readField()
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, value, nil
+	default:
+		return nil, nil, ErrInvalidBackup
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package database_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := memory.NewMemoryDB()
+	defer src.Close()
+	for i := 0; i < 100; i++ {
+		if err := src.Set([]byte(fmt.Sprintf("t:%d", i)), []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := database.Backup(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+	backup := buf.Bytes()
+
+	dst := memory.NewMemoryDB()
+	defer dst.Close()
+	if err := database.Restore(dst, bytes.NewReader(backup)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		value, err := dst.Get([]byte(fmt.Sprintf("t:%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != fmt.Sprintf("v%d", i) {
+			t.Fatalf("unexpected value %q", value)
+		}
+	}
+
+	truncated := backup[:len(backup)-1]
+	if err := database.Restore(memory.NewMemoryDB(), bytes.NewReader(truncated)); err != database.ErrInvalidBackup {
+		t.Fatalf("truncated backup should be rejected, got %v", err)
+	}
+}
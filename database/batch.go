@@ -0,0 +1,60 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package database
+
+// DefaultBatchSizeLimit is the documented maximum amount of data a batch should
+// buffer before being flushed. Backends like the Redis pipeline hold the whole
+// batch in memory, so unbounded batches can exhaust the memory of the client or the server.
+const DefaultBatchSizeLimit = 100 * 1024 * 1024
+
+var _ Batcher = (*autoFlushBatch)(nil)
+
+// autoFlushBatch flushes the wrapped batch whenever its ValueSize exceeds the limit.
+type autoFlushBatch struct {
+	Batcher
+	limit int
+}
+
+// NewAutoFlushBatch wraps the batch so that the buffered data is written as soon
+// as its ValueSize exceeds limit, a non-positive limit defaults to DefaultBatchSizeLimit.
+// The changes are no longer applied atomically, data written by an automatic
+// flush is persisted even if the final Write is never called or fails.
+func NewAutoFlushBatch(b Batcher, limit int) Batcher {
+	if limit <= 0 {
+		limit = DefaultBatchSizeLimit
+	}
+	return &autoFlushBatch{
+		Batcher: b,
+		limit:   limit,
+	}
+}
+
+// Set inserts the given value into the batch, flushing it if the limit is exceeded.
+func (b *autoFlushBatch) Set(key []byte, value []byte) error {
+	if err := b.Batcher.Set(key, value); err != nil {
+		return err
+	}
+	return b.flushIfNeeded()
+}
+
+// Delete inserts the a key removal into the batch, flushing it if the limit is exceeded.
+func (b *autoFlushBatch) Delete(key []byte) error {
+	if err := b.Batcher.Delete(key); err != nil {
+		return err
+	}
+	return b.flushIfNeeded()
+}
+
+func (b *autoFlushBatch) flushIfNeeded() error {
+	if b.Batcher.ValueSize() <= b.limit {
+		return nil
+	}
+	if err := b.Batcher.Write(); err != nil {
+		return err
+	}
+	b.Batcher.Reset()
+	return nil
+}
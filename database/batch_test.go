@@ -0,0 +1,38 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package database_test
+
+import (
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestAutoFlushBatch(t *testing.T) {
+	db := memory.NewMemoryDB()
+	defer db.Close()
+
+	b := database.NewAutoFlushBatch(db.NewBatch(), 16)
+	if err := b.Set([]byte("1"), make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := db.Has([]byte("1")); has {
+		t.Fatal("batch should not be flushed below the limit")
+	}
+
+	if err := b.Set([]byte("2"), make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"1", "2"} {
+		if has, _ := db.Has([]byte(k)); !has {
+			t.Fatalf("key %s should be flushed once the limit is exceeded", k)
+		}
+	}
+	if size := b.ValueSize(); size != 0 {
+		t.Fatalf("batch should be reset after a flush, got %d bytes", size)
+	}
+}
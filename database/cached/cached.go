@@ -0,0 +1,297 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package cached
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+)
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+func (e *entry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+// Database is a read-through, write-through cache in front of a TreeDB.
+// The cached records are evicted in least recently used order once their
+// total size exceeds the configured amount of bytes.
+type Database struct {
+	db database.TreeDB
+
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	lru      *list.List
+	size     int
+	maxBytes int
+	// epoch is increased after every write, so a read racing with a write
+	// does not cache a stale value.
+	epoch uint64
+}
+
+// Wrap returns a TreeDB caching at most maxBytes of key and value data of db in memory.
+func Wrap(db database.TreeDB, maxBytes int) *Database {
+	return &Database{
+		db:       db,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+		maxBytes: maxBytes,
+	}
+}
+
+// Size returns the amount of cached data in bytes.
+func (db *Database) Size() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.size
+}
+
+func (db *Database) lookup(key []byte) ([]byte, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	elem, ok := db.items[string(key)]
+	if !ok {
+		return nil, false
+	}
+	db.lru.MoveToFront(elem)
+	return elem.Value.(*entry).value, true
+}
+
+// add caches the value, the caller must hold the lock.
+func (db *Database) add(key string, value []byte) {
+	if elem, ok := db.items[key]; ok {
+		e := elem.Value.(*entry)
+		db.size += len(value) - len(e.value)
+		e.value = value
+		db.lru.MoveToFront(elem)
+	} else {
+		e := &entry{key: key, value: value}
+		db.items[key] = db.lru.PushFront(e)
+		db.size += e.size()
+	}
+
+	for db.size > db.maxBytes && db.lru.Len() > 0 {
+		db.remove(db.lru.Back())
+	}
+}
+
+// invalidate removes the key from the cache, the caller must hold the lock.
+func (db *Database) invalidate(key string) {
+	if elem, ok := db.items[key]; ok {
+		db.remove(elem)
+	}
+}
+
+func (db *Database) remove(elem *list.Element) {
+	e := db.lru.Remove(elem).(*entry)
+	delete(db.items, e.key)
+	db.size -= e.size()
+}
+
+// Has retrieves if a key is present in the cache or the underlying store.
+func (db *Database) Has(key []byte) (bool, error) {
+	if _, ok := db.lookup(key); ok {
+		return true, nil
+	}
+	return db.db.Has(key)
+}
+
+// Get retrieves the given key from the cache, reading it from the underlying store on a miss.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	if value, ok := db.lookup(key); ok {
+		return utils.CopyBytes(value), nil
+	}
+
+	db.mu.Lock()
+	epoch := db.epoch
+	db.mu.Unlock()
+
+	value, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	if db.epoch == epoch {
+		db.add(string(key), utils.CopyBytes(value))
+	}
+	db.mu.Unlock()
+	return value, nil
+}
+
+// MultiGet retrieves the cached keys from the cache, and the others from the
+// underlying store with a single MultiGet.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	var missing []int
+	for i, key := range keys {
+		if value, ok := db.lookup(key); ok {
+			values[i] = utils.CopyBytes(value)
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	db.mu.Lock()
+	epoch := db.epoch
+	db.mu.Unlock()
+
+	missingKeys := make([][]byte, len(missing))
+	for j, i := range missing {
+		missingKeys[j] = keys[i]
+	}
+	fetched, err := db.db.MultiGet(missingKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for j, i := range missing {
+		if fetched[j] == nil {
+			continue
+		}
+		values[i] = fetched[j]
+		if db.epoch == epoch {
+			db.add(string(keys[i]), utils.CopyBytes(fetched[j]))
+		}
+	}
+	return values, nil
+}
+
+// Set inserts the given value into the underlying store and the cache.
+func (db *Database) Set(key []byte, value []byte) error {
+	err := db.db.Set(key, value)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.epoch++
+	if err != nil {
+		db.invalidate(string(key))
+		return err
+	}
+	db.add(string(key), utils.CopyBytes(value))
+	return nil
+}
+
+// Delete removes the key from the underlying store and the cache.
+func (db *Database) Delete(key []byte) error {
+	err := db.db.Delete(key)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.epoch++
+	db.invalidate(string(key))
+	return err
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The iterator reads from the underlying store, the iterated values are not cached.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return db.db.NewIterator(prefix, start)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+		b:  db.db.NewBatch(),
+	}
+}
+
+// Ping checks the underlying store.
+func (db *Database) Ping() error {
+	return db.db.Ping()
+}
+
+// Close drops the cache and closes the underlying store.
+func (db *Database) Close() error {
+	db.mu.Lock()
+	db.items = make(map[string]*list.Element)
+	db.lru.Init()
+	db.size = 0
+	db.mu.Unlock()
+	return db.db.Close()
+}
+
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch writes to the underlying batch and updates the cache once the batch
+// is written. A batch cannot be used concurrently.
+type batch struct {
+	db     *Database
+	b      database.Batcher
+	writes []keyvalue
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{utils.CopyBytes(key), utils.CopyBytes(value), false})
+	return b.b.Set(key, value)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{utils.CopyBytes(key), nil, true})
+	return b.b.Delete(key)
+}
+
+// Write flushes any accumulated data to the underlying store and updates the cache.
+func (b *batch) Write() error {
+	err := b.b.Write()
+
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	b.db.epoch++
+	if err != nil {
+		// the batch may be partially written
+		for _, kv := range b.writes {
+			b.db.invalidate(string(kv.key))
+		}
+		return err
+	}
+	for _, kv := range b.writes {
+		if kv.delete {
+			b.db.invalidate(string(kv.key))
+			continue
+		}
+		b.db.add(string(kv.key), kv.value)
+	}
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+	b.writes = b.writes[:0]
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package cached
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestCached(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			return Wrap(memory.NewMemoryDB(), 1024)
+		})
+	})
+}
+
+func TestCachedEviction(t *testing.T) {
+	underlying := memory.NewMemoryDB()
+	db := Wrap(underlying, 8)
+	defer db.Close()
+
+	// each entry takes 4 bytes
+	for _, k := range []string{"k1", "k2", "k3"} {
+		if err := db.Set([]byte(k), []byte("vv")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.Size() != 8 {
+		t.Fatalf("cache size should be bounded, got %d", db.Size())
+	}
+	if _, ok := db.lookup([]byte("k1")); ok {
+		t.Fatal("least recently used entry should be evicted")
+	}
+
+	// read through
+	if got, err := db.Get([]byte("k1")); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, []byte("vv")) {
+		t.Fatalf("wrong value: %q", got)
+	}
+	if _, ok := db.lookup([]byte("k1")); !ok {
+		t.Fatal("entry should be cached after read")
+	}
+
+	// invalidate on delete
+	b := db.NewBatch()
+	b.Delete([]byte("k1"))
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.lookup([]byte("k1")); ok {
+		t.Fatal("deleted entry should be invalidated")
+	}
+	if has, err := db.Has([]byte("k1")); err != nil || has {
+		t.Fatalf("deleted entry should not exist, got %t, %v", has, err)
+	}
+}
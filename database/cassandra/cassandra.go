@@ -0,0 +1,481 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package cassandra implements a TreeDB on Cassandra, storing each namespace in
+// a table of key and value blobs.
+//
+// The keys are partitioned by their token and have no order, an iterator scans
+// the whole table and sorts the matching keys in memory. The backend is therefore
+// unsuitable for large tables with the features iterating the database, such as
+// the pruning of the orphans, the leaf scans and the storage checks.
+package cassandra
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gocql/gocql"
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB   = (*Database)(nil)
+	_ database.Batcher  = (*batch)(nil)
+	_ database.Iterator = (*iterator)(nil)
+
+	_ database.NamespaceManager = (*Database)(nil)
+
+	// ErrInvalidName is returned if a keyspace or namespace is not a valid CQL identifier.
+	ErrInvalidName = stdErrors.New("invalid keyspace or namespace name")
+
+	identifierRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,47}$`)
+)
+
+const (
+	// defaultTable is the table used by a Database without namespace.
+	defaultTable = "smt"
+
+	defaultMaxBatchSize = 32 * 1024
+
+	defaultMaxMultiGetKeys = 100
+)
+
+// New returns a wrapped Cassandra object.
+func New(config *CassandraConfig) (*Database, error) {
+	if !identifierRegexp.MatchString(config.Keyspace) {
+		return nil, ErrInvalidName
+	}
+
+	cluster := gocql.NewCluster(config.Hosts...)
+	cluster.Consistency = gocql.LocalQuorum
+	if config.Consistency != 0 {
+		cluster.Consistency = config.Consistency
+	}
+	if config.NumConns > 0 {
+		cluster.NumConns = config.NumConns
+	}
+	if config.Timeout > 0 {
+		cluster.Timeout = config.Timeout
+	}
+	if config.ConnectTimeout > 0 {
+		cluster.ConnectTimeout = config.ConnectTimeout
+	}
+	if len(config.Username) > 0 {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: config.Username,
+			Password: config.Password,
+		}
+	}
+	if len(config.LocalDC) > 0 {
+		cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(
+			gocql.DCAwareRoundRobinPolicy(config.LocalDC))
+	}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Replication) > 0 {
+		if err := session.Query(createKeyspaceStmt(config.Keyspace, config.Replication)).Exec(); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
+	db, err := NewFromExistSession(session, config.Keyspace)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if config.MaxBatchSize > 0 {
+		db.maxBatchSize = config.MaxBatchSize
+	}
+	if config.MaxMultiGetKeys > 0 {
+		db.maxMultiGetKeys = config.MaxMultiGetKeys
+	}
+	return db, nil
+}
+
+// NewFromExistSession returns a wrapped Cassandra object using the tables of the given keyspace.
+func NewFromExistSession(session *gocql.Session, keyspace string) (*Database, error) {
+	if !identifierRegexp.MatchString(keyspace) {
+		return nil, ErrInvalidName
+	}
+	db := &Database{
+		session:         session,
+		keyspace:        keyspace,
+		table:           defaultTable,
+		maxBatchSize:    defaultMaxBatchSize,
+		maxMultiGetKeys: defaultMaxMultiGetKeys,
+	}
+	if err := db.createTable(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// WrapWithNamespace returns a wrapped Cassandra object.
+// Each namespace is stored in its own table, which is created if it does not exist.
+func WrapWithNamespace(db *Database, namespace string) (*Database, error) {
+	if !identifierRegexp.MatchString(namespace) {
+		return nil, ErrInvalidName
+	}
+	wrapped := &Database{
+		session:         db.session,
+		keyspace:        db.keyspace,
+		table:           namespace,
+		maxBatchSize:    db.maxBatchSize,
+		maxMultiGetKeys: db.maxMultiGetKeys,
+	}
+	if err := wrapped.createTable(); err != nil {
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+type Database struct {
+	session         *gocql.Session
+	keyspace        string
+	table           string
+	maxBatchSize    int
+	maxMultiGetKeys int
+}
+
+func createKeyspaceStmt(keyspace string, replication map[string]int) string {
+	dcs := make([]string, 0, len(replication))
+	for dc := range replication {
+		dcs = append(dcs, dc)
+	}
+	sort.Strings(dcs)
+
+	factors := make([]string, 0, len(dcs))
+	for _, dc := range dcs {
+		factors = append(factors, fmt.Sprintf("'%s': %d", strings.ReplaceAll(dc, "'", "''"), replication[dc]))
+	}
+	return fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH replication = {'class': 'NetworkTopologyStrategy', %s}",
+		keyspace, strings.Join(factors, ", "))
+}
+
+func (db *Database) createTable() error {
+	return db.session.Query(fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s.%s (key blob PRIMARY KEY, value blob)", db.keyspace, db.table)).Exec()
+}
+
+func (db *Database) selectStmt() string {
+	return fmt.Sprintf("SELECT value FROM %s.%s WHERE key = ?", db.keyspace, db.table)
+}
+
+func (db *Database) multiSelectStmt() string {
+	return fmt.Sprintf("SELECT key, value FROM %s.%s WHERE key IN ?", db.keyspace, db.table)
+}
+
+func (db *Database) insertStmt() string {
+	return fmt.Sprintf("INSERT INTO %s.%s (key, value) VALUES (?, ?)", db.keyspace, db.table)
+}
+
+func (db *Database) scanStmt() string {
+	return fmt.Sprintf("SELECT key FROM %s.%s", db.keyspace, db.table)
+}
+
+func (db *Database) deleteStmt() string {
+	return fmt.Sprintf("DELETE FROM %s.%s WHERE key = ?", db.keyspace, db.table)
+}
+
+// Namespaces lists the namespace tables of the keyspace, the default table is not reported.
+func (db *Database) Namespaces() ([]string, error) {
+	var (
+		table      string
+		namespaces []string
+	)
+	iter := db.session.Query("SELECT table_name FROM system_schema.tables WHERE keyspace_name = ?", db.keyspace).Iter()
+	for iter.Scan(&table) {
+		if table != defaultTable {
+			namespaces = append(namespaces, table)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// DropNamespace drops the table of the namespace, which deletes all its keys at once.
+func (db *Database) DropNamespace(namespace string) error {
+	if len(namespace) == 0 {
+		return database.ErrEmptyNamespace
+	}
+	if !identifierRegexp.MatchString(namespace) {
+		return ErrInvalidName
+	}
+	return db.session.Query(fmt.Sprintf("DROP TABLE IF EXISTS %s.%s", db.keyspace, namespace)).Exec()
+}
+
+// Ping checks that the cluster is reachable.
+func (db *Database) Ping() error {
+	return db.session.Query("SELECT now() FROM system.local").Exec()
+}
+
+// Close closes the session, which is shared by all namespaces.
+func (db *Database) Close() error {
+	db.session.Close()
+	return nil
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	_, err := db.Get(key)
+	if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := db.session.Query(db.selectStmt(), key).Scan(&value)
+	if stdErrors.Is(err, gocql.ErrNotFound) {
+		return nil, database.ErrDatabaseNotFound
+	}
+	return value, err
+}
+
+// MultiGet retrieves the given keys with IN queries of at most maxMultiGetKeys keys.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	index := make(map[string][]int, len(keys))
+	for i, key := range keys {
+		index[string(key)] = append(index[string(key)], i)
+	}
+	values := make([][]byte, len(keys))
+	for _, chunk := range splitKeys(keys, db.maxMultiGetKeys) {
+		iter := db.session.Query(db.multiSelectStmt(), chunk).Iter()
+		var key, value []byte
+		for iter.Scan(&key, &value) {
+			for _, i := range index[string(key)] {
+				values[i] = utils.CopyBytes(value)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// splitKeys splits the keys into chunks of at most limit keys.
+func splitKeys(keys [][]byte, limit int) [][][]byte {
+	var chunks [][][]byte
+	for from := 0; from < len(keys); from += limit {
+		to := from + limit
+		if to > len(keys) {
+			to = len(keys)
+		}
+		chunks = append(chunks, keys[from:to])
+	}
+	return chunks
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	return db.session.Query(db.insertStmt(), key, value).Exec()
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.session.Query(db.deleteStmt(), key).Exec()
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+//
+// The keys are partitioned by their token, so the whole table is scanned
+// and the matching keys are sorted in memory, the values are fetched while iterating.
+// The memory and the time taken grow with the table, an iterator is unsuitable
+// for large tables.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	first := append(utils.CopyBytes(prefix), start...)
+
+	var (
+		keys [][]byte
+		key  []byte
+	)
+	scanner := db.session.Query(db.scanStmt()).Iter().Scanner()
+	for scanner.Next() {
+		if err := scanner.Scan(&key); err != nil {
+			return database.NewErrorIterator(err)
+		}
+		if bytes.HasPrefix(key, prefix) && bytes.Compare(key, first) >= 0 {
+			keys = append(keys, key)
+		}
+		key = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return database.NewErrorIterator(err)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	return &iterator{
+		db:    db,
+		keys:  keys,
+		index: -1,
+	}
+}
+
+// iterator iterates over the sorted keys, fetching the value of each key on demand.
+type iterator struct {
+	db    *Database
+	keys  [][]byte
+	value []byte
+	index int
+	err   error
+}
+
+// Next moves the iterator to the next key/value pair, skipping the keys deleted meanwhile.
+func (it *iterator) Next() bool {
+	for it.err == nil {
+		it.index++
+		if it.index >= len(it.keys) {
+			it.index = len(it.keys)
+			it.value = nil
+			return false
+		}
+		it.value, it.err = it.db.Get(it.keys[it.index])
+		if stdErrors.Is(it.err, database.ErrDatabaseNotFound) {
+			it.err = nil
+			continue
+		}
+		return it.err == nil
+	}
+	return false
+}
+
+// Error returns any accumulated error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *iterator) Key() []byte {
+	if it.err != nil || it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.index]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if it.err != nil || it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.value
+}
+
+// Release releases the collected keys.
+func (it *iterator) Release() {
+	it.index = len(it.keys)
+	it.keys, it.value = nil, nil
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+	}
+}
+
+type statement struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch is a write-only batch that commits changes to its host database
+// with unlogged batch statements when Write is called. Unlogged batches
+// are not atomic, a failed write may be partially applied.
+// A batch cannot be used concurrently.
+type batch struct {
+	db     *Database
+	writes []statement
+	size   int
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.writes = append(b.writes, statement{key: utils.CopyBytes(key), value: utils.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, statement{key: utils.CopyBytes(key), delete: true})
+	b.size += len(key)
+	return nil
+}
+
+// Write flushes any accumulated data, split into unlogged batches of at most maxBatchSize bytes.
+func (b *batch) Write() error {
+	insert, del := b.db.insertStmt(), b.db.deleteStmt()
+	for _, writes := range splitWrites(b.writes, b.db.maxBatchSize) {
+		cb := b.db.session.NewBatch(gocql.UnloggedBatch)
+		for _, w := range writes {
+			if w.delete {
+				cb.Query(del, w.key)
+			} else {
+				cb.Query(insert, w.key, w.value)
+			}
+		}
+		if err := b.db.session.ExecuteBatch(cb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitWrites splits the writes into chunks, a chunk is closed once its keys
+// and values reach maxSize bytes.
+func splitWrites(writes []statement, maxSize int) [][]statement {
+	var (
+		chunks [][]statement
+		from   int
+		size   int
+	)
+	for i, w := range writes {
+		size += len(w.key) + len(w.value)
+		if size >= maxSize {
+			chunks = append(chunks, writes[from:i+1])
+			from, size = i+1, 0
+		}
+	}
+	if from < len(writes) {
+		chunks = append(chunks, writes[from:])
+	}
+	return chunks
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
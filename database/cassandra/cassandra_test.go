@@ -0,0 +1,69 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package cassandra
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCreateKeyspaceStmt(t *testing.T) {
+	stmt := createKeyspaceStmt("smt", map[string]int{"dc2": 2, "dc1": 3, "o'dc": 1})
+	expected := "CREATE KEYSPACE IF NOT EXISTS smt WITH replication = {'class': 'NetworkTopologyStrategy', 'dc1': 3, 'dc2': 2, 'o''dc': 1}"
+	if stmt != expected {
+		t.Fatalf("expected %q, got %q", expected, stmt)
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	keys := make([][]byte, 250)
+	for i := range keys {
+		keys[i] = []byte{byte(i)}
+	}
+	chunks := splitKeys(keys, defaultMaxMultiGetKeys)
+	if len(chunks) != 3 || len(chunks[0]) != 100 || len(chunks[1]) != 100 || len(chunks[2]) != 50 {
+		t.Fatalf("unexpected chunks of %d", len(chunks))
+	}
+	if !bytes.Equal(chunks[2][0], []byte{200}) {
+		t.Fatalf("unexpected first key %x of the last chunk", chunks[2][0])
+	}
+	if chunks := splitKeys(nil, defaultMaxMultiGetKeys); len(chunks) != 0 {
+		t.Fatal("no keys should be split into no chunk")
+	}
+}
+
+func TestSplitWrites(t *testing.T) {
+	value := make([]byte, 9)
+	writes := make([]statement, 10)
+	for i := range writes {
+		// every write is 10 bytes, the deletes have no value
+		writes[i] = statement{key: []byte{byte(i)}, value: value}
+		if i%3 == 0 {
+			writes[i] = statement{key: make([]byte, 10), delete: true}
+		}
+	}
+	chunks := splitWrites(writes, 30)
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d", len(chunks))
+	}
+	total := 0
+	for i, chunk := range chunks {
+		size := 0
+		for _, w := range chunk {
+			size += len(w.key) + len(w.value)
+		}
+		if (i < 3 && size != 30) || (i == 3 && size != 10) {
+			t.Fatalf("unexpected size %d of chunk %d", size, i)
+		}
+		total += len(chunk)
+	}
+	if total != len(writes) {
+		t.Fatalf("expected %d writes, got %d", len(writes), total)
+	}
+	if chunks := splitWrites(writes[:1], 30); len(chunks) != 1 {
+		t.Fatal("a small batch should be written at once")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package cassandra
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type CassandraConfig struct {
+	// Initial contact points of the cluster.
+	Hosts []string
+	// Keyspace holding the tree tables.
+	Keyspace string
+	// Optional credentials for the PasswordAuthenticator.
+	Username string
+	Password string
+
+	// Name of the local datacenter. If set, queries are routed to the
+	// replicas of the local datacenter first.
+	LocalDC string
+	// Replication factor per datacenter. If set, the keyspace is created
+	// with NetworkTopologyStrategy when it does not exist yet.
+	Replication map[string]int
+
+	// Consistency level of reads and writes.
+	// Default is LOCAL_QUORUM.
+	Consistency gocql.Consistency
+	// Number of connections per host.
+	// Default is 2.
+	NumConns int
+	// Timeout of each query.
+	// Default is 11 seconds.
+	Timeout time.Duration
+	// Timeout for establishing new connections.
+	// Default is 600 milliseconds.
+	ConnectTimeout time.Duration
+
+	// Maximum amount of value bytes sent in a single unlogged batch statement,
+	// larger batches are split. Default is 32KB, which is below the default
+	// batch_size_fail_threshold of Cassandra.
+	MaxBatchSize int
+	// Maximum number of keys read by a single IN query of MultiGet, larger
+	// reads are split. Default is 100, a long IN list loads the coordinator.
+	MaxMultiGetKeys int
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package compress
+
+import (
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+
+	// ErrUnknownCodec is returned if a stored value has a header of an unknown codec.
+	ErrUnknownCodec = stdErrors.New("unknown compression codec")
+)
+
+// Codec identifies the compression algorithm, it is stored as the first byte of every value.
+type Codec byte
+
+const (
+	// None stores the values uncompressed.
+	None Codec = iota
+	// Snappy compresses the values with snappy, favouring speed.
+	Snappy
+	// Zstd compresses the values with zstd, favouring the compression ratio.
+	Zstd
+)
+
+// minCompressSize is the size below which values are stored uncompressed,
+// e.g. the version markers of the tree.
+const minCompressSize = 64
+
+// Database is a TreeDB wrapper compressing the stored values. Every value is
+// prefixed with the header of its codec, so values written with different codecs
+// can be read back regardless of the configured one. Values which do not shrink
+// are stored uncompressed.
+type Database struct {
+	db    database.TreeDB
+	codec Codec
+	enc   *zstd.Encoder
+	dec   *zstd.Decoder
+}
+
+// Wrap returns a TreeDB compressing the values written to db with the codec.
+func Wrap(db database.TreeDB, codec Codec) (*Database, error) {
+	if codec > Zstd {
+		return nil, ErrUnknownCodec
+	}
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{
+		db:    db,
+		codec: codec,
+		enc:   enc,
+		dec:   dec,
+	}, nil
+}
+
+func (db *Database) encode(value []byte) []byte {
+	if db.codec != None && len(value) >= minCompressSize {
+		var compressed []byte
+		switch db.codec {
+		case Snappy:
+			compressed = snappy.Encode(nil, value)
+		case Zstd:
+			compressed = db.enc.EncodeAll(value, make([]byte, 0, len(value)/2))
+		}
+		if len(compressed) < len(value) {
+			return append([]byte{byte(db.codec)}, compressed...)
+		}
+	}
+	return append([]byte{byte(None)}, value...)
+}
+
+func (db *Database) decode(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return nil, ErrUnknownCodec
+	}
+	switch Codec(value[0]) {
+	case None:
+		return value[1:], nil
+	case Snappy:
+		return snappy.Decode(nil, value[1:])
+	case Zstd:
+		return db.dec.DecodeAll(value[1:], nil)
+	default:
+		return nil, ErrUnknownCodec
+	}
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.db.Has(key)
+}
+
+// Get retrieves and decompresses the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	value, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return db.decode(value)
+}
+
+// MultiGet retrieves the given keys from the underlying store and decompresses them.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	values, err := db.db.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if values[i], err = db.decode(value); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Set compresses and inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	return db.db.Set(key, db.encode(value))
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.db.Delete(key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The values are decompressed while iterating.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return database.NewTransformIterator(db.db.NewIterator(prefix, start), func(_, value []byte) ([]byte, error) {
+		return db.decode(value)
+	})
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+		b:  db.db.NewBatch(),
+	}
+}
+
+// Ping checks the underlying store.
+func (db *Database) Ping() error {
+	return db.db.Ping()
+}
+
+// Close closes the underlying store.
+func (db *Database) Close() error {
+	db.dec.Close()
+	return db.db.Close()
+}
+
+// batch compresses the values before queueing them into the underlying batch.
+type batch struct {
+	db *Database
+	b  database.Batcher
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	return b.b.Set(key, b.db.encode(value))
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	return b.b.Delete(key)
+}
+
+// Write flushes any accumulated data to the underlying store.
+func (b *batch) Write() error {
+	return b.b.Write()
+}
+
+// ValueSize retrieves the amount of compressed data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+}
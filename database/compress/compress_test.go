@@ -0,0 +1,61 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package compress
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestCompress(t *testing.T) {
+	for _, codec := range []Codec{None, Snappy, Zstd} {
+		t.Run("DatabaseSuite", func(t *testing.T) {
+			dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+				db, err := Wrap(memory.NewMemoryDB(), codec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return db
+			})
+		})
+	}
+}
+
+func TestCompressMixedCodecs(t *testing.T) {
+	underlying := memory.NewMemoryDB()
+	value := bytes.Repeat([]byte("internal node "), 64)
+
+	snappyDB, err := Wrap(underlying, Snappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snappyDB.Set([]byte("snappy"), value); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := underlying.Get([]byte("snappy")); len(stored) >= len(value) || Codec(stored[0]) != Snappy {
+		t.Fatal("value should be compressed with snappy")
+	}
+
+	// switching the codec keeps the old values readable
+	zstdDB, err := Wrap(underlying, Zstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zstdDB.Set([]byte("zstd"), value); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"snappy", "zstd"} {
+		if got, err := zstdDB.Get([]byte(key)); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, value) {
+			t.Fatalf("wrong value of %s", key)
+		}
+	}
+}
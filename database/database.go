@@ -23,12 +23,67 @@ type (
 	TreeDB interface {
 		KeyValueReader
 		KeyValueWriter
+
+		// MultiGet retrieves the given keys, in a single round trip if the backend
+		// supports it. The values are returned in the order of the keys,
+		// a missing key has a nil value.
+		MultiGet(keys [][]byte) ([][]byte, error)
+
 		// NewBatch creates a write-only database that buffers changes to its host db
 		// until a final write is called.
 		NewBatch() Batcher
+
+		// NewIterator creates a binary-alphabetical iterator over a subset of
+		// database content with a particular key prefix, starting at a particular
+		// initial key (or after, if it does not exist). The start key is relative
+		// to the prefix.
+		NewIterator(prefix []byte, start []byte) Iterator
+
+		// Ping checks that the database is reachable and usable, it is meant
+		// for health checks and for probing a backend before retrying.
+		Ping() error
 		Close() error
 	}
 
+	// NamespaceManager is implemented by the backends which can store several
+	// namespaces in a single database.
+	NamespaceManager interface {
+		// Namespaces lists the namespaces holding at least one key.
+		Namespaces() ([]string, error)
+
+		// DropNamespace deletes all the keys of the namespace.
+		DropNamespace(namespace string) error
+	}
+
+	// Iterator iterates over a database's key/value pairs in ascending key order.
+	// The iterator must be released after use, by calling Release method.
+	Iterator interface {
+		// Next moves the iterator to the next key/value pair. It returns whether
+		// the iterator is exhausted.
+		Next() bool
+
+		// Error returns any accumulated error. Exhausting all the key/value pairs
+		// is not considered to be an error.
+		Error() error
+
+		// Key returns the key of the current key/value pair, or nil if done. The
+		// caller should not modify the contents of the returned slice, and its
+		// contents may change on the next call to Next.
+		Key() []byte
+
+		// Value returns the value of the current key/value pair, or nil if done.
+		// The caller should not modify the contents of the returned slice, and its
+		// contents may change on the next call to Next.
+		Value() []byte
+
+		// Release releases associated resources. Release should always succeed
+		// and can be called multiple times without causing error.
+		Release()
+	}
+
+	// Batcher buffers writes until Write is called. Implementations do not bound
+	// the amount of buffered data, callers composing large batches should flush
+	// once ValueSize reaches DefaultBatchSizeLimit or wrap the batch with NewAutoFlushBatch.
 	Batcher interface {
 		KeyValueWriter
 
@@ -15,6 +15,15 @@ import (
 // TestDatabaseSuite runs a suite of tests against a KeyValueStore database
 // implementation.
 func TestDatabaseSuite(t *testing.T, New func() database.TreeDB) {
+	t.Run("Ping", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		if err := db.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
 	t.Run("KeyValueOperations", func(t *testing.T) {
 		db := New()
 		defer db.Close()
@@ -142,4 +151,135 @@ func TestDatabaseSuite(t *testing.T, New func() database.TreeDB) {
 			}
 		}
 	})
+
+	t.Run("MultiGet", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		if err := db.Set([]byte("a"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set([]byte("c"), []byte("3")); err != nil {
+			t.Fatal(err)
+		}
+		keys := [][]byte{[]byte("c"), []byte("b"), []byte("a"), []byte("c")}
+		values, err := db.MultiGet(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := [][]byte{[]byte("3"), nil, []byte("1"), []byte("3")}
+		if len(values) != len(expected) {
+			t.Fatalf("wrong number of values: %d", len(values))
+		}
+		for i := range expected {
+			if !bytes.Equal(values[i], expected[i]) || (values[i] == nil) != (expected[i] == nil) {
+				t.Errorf("wrong value of %q: %q", keys[i], values[i])
+			}
+		}
+
+		if values, err := db.MultiGet(nil); err != nil || len(values) != 0 {
+			t.Errorf("empty MultiGet should return no values, got %q %v", values, err)
+		}
+	})
+
+	t.Run("Iterator", func(t *testing.T) {
+		tests := []struct {
+			content map[string]string
+			prefix  string
+			start   string
+			order   []string
+		}{
+			// Empty databases should be iterable
+			{map[string]string{}, "", "", nil},
+			{map[string]string{}, "non-existent-prefix", "", nil},
+
+			// Single-item databases should be iterable
+			{map[string]string{"key": "val"}, "", "", []string{"key"}},
+			{map[string]string{"key": "val"}, "k", "", []string{"key"}},
+			{map[string]string{"key": "val"}, "l", "", nil},
+
+			// Multi-item databases should be fully iterable
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"", "",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"k", "",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"l", "",
+				nil,
+			},
+			// Multi-item databases should be prefix-iterable
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "",
+				[]string{"ka1", "ka2", "ka3", "ka4", "ka5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"kc", "",
+				nil,
+			},
+			// Multi-item databases should be prefix-iterable with start position
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "3",
+				[]string{"ka3", "ka4", "ka5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "8",
+				nil,
+			},
+		}
+		for i, tt := range tests {
+			// Create the key-value data store
+			db := New()
+			for key, val := range tt.content {
+				if err := db.Set([]byte(key), []byte(val)); err != nil {
+					t.Fatalf("test %d: failed to insert item %s:%s into database: %v", i, key, val, err)
+				}
+			}
+			// Iterate over the database with the given configs and verify the results
+			it, idx := db.NewIterator([]byte(tt.prefix), []byte(tt.start)), 0
+			for it.Next() {
+				if len(tt.order) <= idx {
+					t.Errorf("test %d: prefix=%q more items than expected: checking idx=%d (key %q), expecting len=%d", i, tt.prefix, idx, it.Key(), len(tt.order))
+					break
+				}
+				if !bytes.Equal(it.Key(), []byte(tt.order[idx])) {
+					t.Errorf("test %d: item %d: key mismatch: have %s, want %s", i, idx, string(it.Key()), tt.order[idx])
+				}
+				if !bytes.Equal(it.Value(), []byte(tt.content[tt.order[idx]])) {
+					t.Errorf("test %d: item %d: value mismatch: have %s, want %s", i, idx, string(it.Value()), tt.content[tt.order[idx]])
+				}
+				idx++
+			}
+			if err := it.Error(); err != nil {
+				t.Errorf("test %d: iteration failed: %v", i, err)
+			}
+			if idx != len(tt.order) {
+				t.Errorf("test %d: iteration terminated prematurely: have %d, want %d", i, idx, len(tt.order))
+			}
+			it.Release()
+			db.Close()
+		}
+	})
 }
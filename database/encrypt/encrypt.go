@@ -0,0 +1,219 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+
+	// ErrUnknownKey is returned if a value is encrypted with a key missing from the keyring.
+	ErrUnknownKey = stdErrors.New("unknown encryption key")
+
+	// ErrInvalidCiphertext is returned if a stored value can not be decrypted.
+	ErrInvalidCiphertext = stdErrors.New("invalid ciphertext")
+)
+
+const (
+	formatVersion byte = 1
+	// headerSize is the size of the format version and the key id.
+	headerSize = 1 + 4
+)
+
+// Database is a TreeDB wrapper encrypting the stored values with AES-GCM.
+// A stored value is laid out as: version(1) | key id(4) | nonce | ciphertext | tag.
+// The storage key is authenticated as additional data, so a value can not be
+// moved to another key without being detected.
+type Database struct {
+	db      database.TreeDB
+	keyring *Keyring
+}
+
+// Wrap returns a TreeDB encrypting the values written to db with the keys of the keyring.
+func Wrap(db database.TreeDB, keyring *Keyring) *Database {
+	return &Database{
+		db:      db,
+		keyring: keyring,
+	}
+}
+
+func (db *Database) seal(key, value []byte) ([]byte, error) {
+	id, aead := db.keyring.activeAEAD()
+	out := make([]byte, headerSize+aead.NonceSize(), headerSize+aead.NonceSize()+len(value)+aead.Overhead())
+	out[0] = formatVersion
+	binary.BigEndian.PutUint32(out[1:headerSize], id)
+	nonce := out[headerSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, value, key), nil
+}
+
+func (db *Database) open(key, value []byte) ([]byte, error) {
+	if len(value) < headerSize || value[0] != formatVersion {
+		return nil, ErrInvalidCiphertext
+	}
+	aead, ok := db.keyring.aead(binary.BigEndian.Uint32(value[1:headerSize]))
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if len(value) < headerSize+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce := value[headerSize : headerSize+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, value[headerSize+aead.NonceSize():], key)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plain, nil
+}
+
+// KeyID returns the id of the key the stored value of key is encrypted with.
+func (db *Database) KeyID(key []byte) (uint32, error) {
+	value, err := db.db.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) < headerSize || value[0] != formatVersion {
+		return 0, ErrInvalidCiphertext
+	}
+	return binary.BigEndian.Uint32(value[1:headerSize]), nil
+}
+
+// Reencrypt re-encrypts the values of the given keys with the active key,
+// so the previous keys can be removed once all the values are rotated.
+// Missing keys are skipped.
+func (db *Database) Reencrypt(keys ...[]byte) error {
+	b := db.NewBatch()
+	for _, key := range keys {
+		value, err := db.Get(key)
+		if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = b.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return b.Write()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.db.Has(key)
+}
+
+// Get retrieves and decrypts the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	value, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return db.open(key, value)
+}
+
+// MultiGet retrieves the given keys from the underlying store and decrypts them.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	values, err := db.db.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if values[i], err = db.open(keys[i], value); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Set encrypts and inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	sealed, err := db.seal(key, value)
+	if err != nil {
+		return err
+	}
+	return db.db.Set(key, sealed)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.db.Delete(key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The values are decrypted while iterating.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return database.NewTransformIterator(db.db.NewIterator(prefix, start), db.open)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+		b:  db.db.NewBatch(),
+	}
+}
+
+// Ping checks the underlying store.
+func (db *Database) Ping() error {
+	return db.db.Ping()
+}
+
+// Close closes the underlying store.
+func (db *Database) Close() error {
+	return db.db.Close()
+}
+
+// batch encrypts the values before queueing them into the underlying batch.
+type batch struct {
+	db *Database
+	b  database.Batcher
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	sealed, err := b.db.seal(key, value)
+	if err != nil {
+		return err
+	}
+	return b.b.Set(key, sealed)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	return b.b.Delete(key)
+}
+
+// Write flushes any accumulated data to the underlying store.
+func (b *batch) Write() error {
+	return b.b.Write()
+}
+
+// ValueSize retrieves the amount of encrypted data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestEncrypt(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			keyring, err := NewKeyring(1, map[uint32][]byte{1: key1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return Wrap(memory.NewMemoryDB(), keyring)
+		})
+	})
+}
+
+func TestEncryptKeyRotation(t *testing.T) {
+	keyring, err := NewKeyring(1, map[uint32][]byte{1: key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	underlying := memory.NewMemoryDB()
+	db := Wrap(underlying, keyring)
+
+	value := []byte("hello world")
+	if err := db.Set([]byte("foo"), value); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := underlying.Get([]byte("foo")); bytes.Contains(stored, value) {
+		t.Fatal("value should be encrypted")
+	}
+
+	// rotate to a new key, old values stay readable
+	if err := keyring.AddKey(2, key2); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetActive(2); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get([]byte("foo")); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, value) {
+		t.Fatalf("wrong value: %q", got)
+	}
+	if err := db.Reencrypt([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := db.KeyID([]byte("foo")); err != nil || id != 2 {
+		t.Fatalf("value should be encrypted with the new key, got %d, %v", id, err)
+	}
+
+	// values moved to another key are rejected
+	stored, _ := underlying.Get([]byte("foo"))
+	underlying.Set([]byte("bar"), stored)
+	if _, err := db.Get([]byte("bar")); err != ErrInvalidCiphertext {
+		t.Fatalf("moved value should be rejected, got %v", err)
+	}
+}
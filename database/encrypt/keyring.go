@@ -0,0 +1,88 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"sync"
+)
+
+// Keyring holds the AES-GCM keys used to encrypt and decrypt the stored values.
+// New values are encrypted with the active key, while values encrypted with
+// any key of the keyring remain readable, which allows rotating keys without
+// re-encrypting the whole store at once.
+type Keyring struct {
+	mu     sync.RWMutex
+	active uint32
+	aeads  map[uint32]cipher.AEAD
+}
+
+// NewKeyring returns a keyring holding the given keys, indexed by their id.
+// The keys must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewKeyring(active uint32, keys map[uint32][]byte) (*Keyring, error) {
+	kr := &Keyring{
+		aeads: make(map[uint32]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		if err := kr.AddKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if err := kr.SetActive(active); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// AddKey adds a key to the keyring, replacing the key with the same id.
+func (kr *Keyring) AddKey(id uint32, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.aeads[id] = aead
+	return nil
+}
+
+// SetActive selects the key encrypting the new values.
+func (kr *Keyring) SetActive(id uint32) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.aeads[id]; !ok {
+		return ErrUnknownKey
+	}
+	kr.active = id
+	return nil
+}
+
+// Active returns the id of the active key.
+func (kr *Keyring) Active() uint32 {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active
+}
+
+func (kr *Keyring) activeAEAD() (uint32, cipher.AEAD) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active, kr.aeads[kr.active]
+}
+
+func (kr *Keyring) aead(id uint32) (cipher.AEAD, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	aead, ok := kr.aeads[id]
+	return aead, ok
+}
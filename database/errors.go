@@ -17,4 +17,11 @@ var (
 	// ErrDatabaseNotFound is returned if a key is requested that is not found in
 	// the provided database.
 	ErrDatabaseNotFound = errors.New("key not found")
+
+	// ErrEmptyNamespace is returned if a namespace operation is invoked without
+	// namespace, which would otherwise apply to the whole database.
+	ErrEmptyNamespace = errors.New("empty namespace")
+
+	// ErrReadOnly is returned if a write is invoked on a database opened read-only.
+	ErrReadOnly = errors.New("the database is read-only")
 )
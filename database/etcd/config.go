@@ -0,0 +1,35 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package etcd
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+type EtcdConfig struct {
+	// List of etcd cluster endpoints.
+	Endpoints []string
+	// Optional credentials for the etcd authentication.
+	Username string
+	Password string
+	// Optional TLS configuration of the client connections.
+	TLS *tls.Config
+
+	// Timeout for establishing the connection.
+	// Default is 5 seconds.
+	DialTimeout time.Duration
+	// Timeout of each request.
+	// Default is 5 seconds.
+	RequestTimeout time.Duration
+
+	// Maximum number of operations in a single transaction, must not exceed
+	// the --max-txn-ops setting of the cluster. Default is 128.
+	MaxTxnOps int
+	// Maximum amount of data in a single transaction, must not exceed
+	// the --max-request-bytes setting of the cluster. Default is 1MB.
+	MaxTxnBytes int
+}
@@ -0,0 +1,449 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB   = (*Database)(nil)
+	_ database.Batcher  = (*batch)(nil)
+	_ database.Iterator = (*iterator)(nil)
+
+	_ database.NamespaceManager = (*Database)(nil)
+)
+
+const (
+	defaultTimeout     = 5 * time.Second
+	defaultMaxTxnOps   = 128
+	defaultMaxTxnBytes = 1024 * 1024
+
+	// iteratorPageSize is the number of key/value pairs fetched per range request.
+	iteratorPageSize = 512
+)
+
+// New returns a wrapped etcd object.
+func New(config *EtcdConfig) (*Database, error) {
+	dialTimeout := config.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultTimeout
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   config.Endpoints,
+		Username:    config.Username,
+		Password:    config.Password,
+		TLS:         config.TLS,
+		DialTimeout: dialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewFromExistEtcdClient(client)
+	if config.RequestTimeout > 0 {
+		db.timeout = config.RequestTimeout
+	}
+	if config.MaxTxnOps > 0 {
+		db.maxTxnOps = config.MaxTxnOps
+	}
+	if config.MaxTxnBytes > 0 {
+		db.maxTxnBytes = config.MaxTxnBytes
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	// make sure the cluster is reachable
+	if _, err = client.Get(ctx, "health", clientv3.WithCountOnly()); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewFromExistEtcdClient returns a wrapped etcd object.
+func NewFromExistEtcdClient(client *clientv3.Client) *Database {
+	return &Database{
+		client:      client,
+		timeout:     defaultTimeout,
+		maxTxnOps:   defaultMaxTxnOps,
+		maxTxnBytes: defaultMaxTxnBytes,
+	}
+}
+
+// WrapWithNamespace returns a wrapped etcd object.
+// The namespace is the prefix that the datastore.
+func WrapWithNamespace(db *Database, namespace string) *Database {
+	return &Database{
+		namespace:   []byte(namespace),
+		client:      db.client,
+		timeout:     db.timeout,
+		maxTxnOps:   db.maxTxnOps,
+		maxTxnBytes: db.maxTxnBytes,
+	}
+}
+
+type Database struct {
+	namespace   []byte
+	client      *clientv3.Client
+	timeout     time.Duration
+	maxTxnOps   int
+	maxTxnBytes int
+}
+
+// wrapKey returns a wrapper key with namespace.
+func wrapKey(namespace, key []byte) string {
+	if len(namespace) > 0 {
+		return string(bytes.Join([][]byte{namespace, key}, []byte(":")))
+	}
+	return string(key)
+}
+
+// Ping checks that the etcd cluster is reachable and has a leader.
+func (db *Database) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+	// a linearizable read requires a quorum
+	_, err := db.client.Get(ctx, wrapKey(db.namespace, []byte("ping")), clientv3.WithCountOnly())
+	return err
+}
+
+// Close closes the etcd client, which is shared by all namespaces.
+func (db *Database) Close() error {
+	return db.client.Close()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+	resp, err := db.client.Get(ctx, wrapKey(db.namespace, key), clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+	resp, err := db.client.Get(ctx, wrapKey(db.namespace, key))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, database.ErrDatabaseNotFound
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// MultiGet retrieves the given keys with transactions of at most maxTxnOps reads,
+// the keys of a transaction are read at the same revision.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for from := 0; from < len(keys); from += db.maxTxnOps {
+		to := from + db.maxTxnOps
+		if to > len(keys) {
+			to = len(keys)
+		}
+		ops := make([]clientv3.Op, 0, to-from)
+		for _, key := range keys[from:to] {
+			ops = append(ops, clientv3.OpGet(wrapKey(db.namespace, key)))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+		resp, err := db.client.Txn(ctx).Then(ops...).Commit()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for i, op := range resp.Responses {
+			if kvs := op.GetResponseRange().Kvs; len(kvs) > 0 {
+				values[from+i] = kvs[0].Value
+			}
+		}
+	}
+	return values, nil
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+	_, err := db.client.Put(ctx, wrapKey(db.namespace, key), string(value))
+	return err
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+	_, err := db.client.Delete(ctx, wrapKey(db.namespace, key))
+	return err
+}
+
+// Namespaces lists the namespaces of the etcd cluster, skipping from one
+// namespace to the next without reading their keys. Keys written without namespace
+// are reported by the part preceding their first separator, e.g. `t` for tree nodes.
+func (db *Database) Namespaces() ([]string, error) {
+	var (
+		namespaces []string
+		from       = "\x00"
+	)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+		resp, err := db.client.Get(ctx, from, clientv3.WithFromKey(), clientv3.WithKeysOnly(), clientv3.WithLimit(1))
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Kvs) == 0 {
+			return namespaces, nil
+		}
+		key := resp.Kvs[0].Key
+		i := bytes.IndexByte(key, ':')
+		if i < 0 {
+			from = string(key) + "\x00"
+			continue
+		}
+		namespaces = append(namespaces, string(key[:i]))
+		// ';' is the byte following the separator, skip the rest of the namespace
+		from = string(key[:i]) + ";"
+	}
+}
+
+// DropNamespace atomically deletes all the keys of the namespace with a single range deletion.
+func (db *Database) DropNamespace(namespace string) error {
+	if len(namespace) == 0 {
+		return database.ErrEmptyNamespace
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+	_, err := db.client.Delete(ctx, wrapKey([]byte(namespace), nil), clientv3.WithPrefix())
+	return err
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The pages are read at the revision of the first page, so the iterator
+// observes a consistent snapshot as long as the revision is not compacted.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	full := wrapKey(db.namespace, prefix)
+	return &iterator{
+		db:    db,
+		next:  full + string(start),
+		end:   clientv3.GetPrefixRangeEnd(full),
+		trim:  len(full) - len(prefix),
+		index: -1,
+		more:  true,
+	}
+}
+
+// iterator reads the key range page by page.
+type iterator struct {
+	db    *Database
+	next  string // first key of the next page
+	end   string
+	trim  int
+	rev   int64
+	kvs   []*mvccpb.KeyValue
+	index int
+	more  bool
+	err   error
+}
+
+// fetch reads the next page of the key range.
+func (it *iterator) fetch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), it.db.timeout)
+	defer cancel()
+	opts := []clientv3.OpOption{
+		clientv3.WithRange(it.end),
+		clientv3.WithLimit(iteratorPageSize),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	}
+	if it.rev > 0 {
+		opts = append(opts, clientv3.WithRev(it.rev))
+	}
+	resp, err := it.db.client.Get(ctx, it.next, opts...)
+	if err != nil {
+		return err
+	}
+	if it.rev == 0 {
+		it.rev = resp.Header.Revision
+	}
+	it.kvs, it.index, it.more = resp.Kvs, 0, resp.More
+	if len(it.kvs) > 0 {
+		it.next = string(it.kvs[len(it.kvs)-1].Key) + "\x00"
+	}
+	return nil
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	if it.index < len(it.kvs) {
+		return true
+	}
+	if !it.more {
+		it.kvs, it.index = nil, 0
+		return false
+	}
+	if it.err = it.fetch(); it.err != nil {
+		it.kvs = nil
+		return false
+	}
+	return len(it.kvs) > 0
+}
+
+// Error returns any accumulated error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair without namespace, or nil if done.
+func (it *iterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.kvs) {
+		return nil
+	}
+	return it.kvs[it.index].Key[it.trim:]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.kvs) {
+		return nil
+	}
+	return it.kvs[it.index].Value
+}
+
+// Release releases the fetched page.
+func (it *iterator) Release() {
+	it.kvs, it.more = nil, false
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+	}
+}
+
+// batch is a write-only batch that commits changes to its host database
+// in etcd transactions when Write is called. Only the last operation on a key
+// is kept, since etcd rejects a transaction writing a key twice.
+//
+// The batch is split into several transactions if it exceeds the operation or
+// size limits of a transaction, which are applied in order but not atomically:
+// a failure leaves the first transactions applied, e.g. the nodes of a tree
+// commit without its version marker, which the tree repairs on startup. The
+// limits should be raised, along with the --max-txn-ops and --max-request-bytes
+// settings of the cluster, for the commits of a version to fit a transaction.
+// A batch cannot be used concurrently.
+type batch struct {
+	db   *Database
+	ops  []clientv3.Op
+	lens []int // the size of each operation, -1 for the superseded ones
+	keys map[string]int
+	size int
+}
+
+// queue appends the operation on the key, superseding the previous one.
+func (b *batch) queue(k string, op clientv3.Op, size int) {
+	if b.keys == nil {
+		b.keys = make(map[string]int)
+	}
+	if i, ok := b.keys[k]; ok {
+		b.lens[i] = -1
+	}
+	b.keys[k] = len(b.ops)
+	b.ops = append(b.ops, op)
+	b.lens = append(b.lens, size)
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	k := wrapKey(b.db.namespace, key)
+	b.queue(k, clientv3.OpPut(k, string(utils.CopyBytes(value))), len(k)+len(value))
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	k := wrapKey(b.db.namespace, key)
+	b.queue(k, clientv3.OpDelete(k), len(k))
+	b.size += len(key)
+	return nil
+}
+
+// pending returns the operations to write along with their sizes, the
+// superseded operations are skipped.
+func (b *batch) pending() ([]clientv3.Op, []int) {
+	if len(b.keys) == len(b.ops) {
+		return b.ops, b.lens
+	}
+	ops := make([]clientv3.Op, 0, len(b.keys))
+	lens := make([]int, 0, len(b.keys))
+	for i, op := range b.ops {
+		if b.lens[i] >= 0 {
+			ops = append(ops, op)
+			lens = append(lens, b.lens[i])
+		}
+	}
+	return ops, lens
+}
+
+func (b *batch) commit(ops []clientv3.Op) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.db.timeout)
+	defer cancel()
+	_, err := b.db.client.Txn(ctx).Then(ops...).Commit()
+	return err
+}
+
+// Write flushes any accumulated data to etcd.
+func (b *batch) Write() error {
+	ops, lens := b.pending()
+	start, size := 0, 0
+	for i := range ops {
+		if i > start && (i-start >= b.db.maxTxnOps || size+lens[i] > b.db.maxTxnBytes) {
+			if err := b.commit(ops[start:i]); err != nil {
+				return err
+			}
+			start, size = i, 0
+		}
+		size += lens[i]
+	}
+	if start < len(ops) {
+		return b.commit(ops[start:])
+	}
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.ops = b.ops[:0]
+	b.lens = b.lens[:0]
+	b.keys = nil
+	b.size = 0
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package etcd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+)
+
+// openTestDatabase connects to the etcd cluster of ETCD_ENDPOINTS, a comma
+// separated list of endpoints, the test is skipped if it is not set.
+func openTestDatabase(t *testing.T) *Database {
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("no etcd cluster, set ETCD_ENDPOINTS")
+	}
+	db, err := New(&EtcdConfig{Endpoints: strings.Split(endpoints, ",")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestEtcd(t *testing.T) {
+	db := openTestDatabase(t)
+	count := 0
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			// every test of the suite expects an empty database
+			count++
+			namespace := fmt.Sprintf("dbtest-%d-%d", time.Now().UnixNano(), count)
+			t.Cleanup(func() { _ = db.DropNamespace(namespace) })
+			wrapped := WrapWithNamespace(db, namespace)
+			// the client is shared by the suite, it is closed by the cleanup
+			return &unclosed{wrapped}
+		})
+	})
+}
+
+func TestEtcdBatchSplit(t *testing.T) {
+	db := openTestDatabase(t)
+	namespace := fmt.Sprintf("split-%d", time.Now().UnixNano())
+	defer db.DropNamespace(namespace)
+	wrapped := WrapWithNamespace(db, namespace)
+	wrapped.maxTxnOps = 4
+
+	b := wrapped.NewBatch()
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key%d", i%5))
+		if err := b.Set(key, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		value, err := wrapped.Get([]byte(fmt.Sprintf("key%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != fmt.Sprint(i+5) {
+			t.Fatalf("the last write of key%d should be kept, got %s", i, value)
+		}
+	}
+}
+
+// unclosed leaves the shared client open when the suite closes a database.
+type unclosed struct {
+	*Database
+}
+
+func (db *unclosed) Close() error {
+	return nil
+}
+
+func TestBatchDeduplication(t *testing.T) {
+	b := (&Database{namespace: []byte("ns")}).NewBatch().(*batch)
+	if err := b.Set([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set([]byte("b"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set([]byte("a"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, _ := b.pending()
+	if len(ops) != 2 {
+		t.Fatalf("only the last operation of a key should be kept, got %d", len(ops))
+	}
+	if string(ops[0].KeyBytes()) != "ns:b" || string(ops[1].KeyBytes()) != "ns:a" ||
+		!ops[1].IsPut() || string(ops[1].ValueBytes()) != "2" {
+		t.Fatalf("the operations should be kept in the order of their last write, got %q %q", ops[0].KeyBytes(), ops[1].KeyBytes())
+	}
+
+	b.Reset()
+	if err := b.Set([]byte("a"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if ops, _ := b.pending(); len(ops) != 1 {
+		t.Fatalf("a reset batch should keep its new operations only, got %d", len(ops))
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package ethdb
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB   = (*Database)(nil)
+	_ database.Batcher  = (*batch)(nil)
+	_ database.Iterator = (*namespaceIterator)(nil)
+)
+
+// Database is a TreeDB stored in a go-ethereum key-value store, so a geth based
+// node can keep the tree alongside its chain data. Any ethdb.Database is
+// also an ethdb.KeyValueStore.
+type Database struct {
+	namespace []byte
+	db        ethdb.KeyValueStore
+}
+
+// New returns a TreeDB on top of the given store. The namespace is the prefix
+// of the tree keys, which keeps them apart from the keys of the node.
+func New(db ethdb.KeyValueStore, namespace string) *Database {
+	return &Database{
+		namespace: []byte(namespace),
+		db:        db,
+	}
+}
+
+// wrapKey returns a wrapper key with namespace.
+func wrapKey(namespace, key []byte) []byte {
+	if len(namespace) > 0 {
+		return bytes.Join([][]byte{namespace, key}, []byte(":"))
+	}
+	return key
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.db.Has(wrapKey(db.namespace, key))
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+// The not found errors of the ethdb implementations are translated to ErrDatabaseNotFound.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	wrapped := wrapKey(db.namespace, key)
+	dat, err := db.db.Get(wrapped)
+	if err != nil {
+		if has, hasErr := db.db.Has(wrapped); hasErr == nil && !has {
+			return nil, database.ErrDatabaseNotFound
+		}
+		return nil, err
+	}
+	return dat, nil
+}
+
+// MultiGet retrieves the given keys one by one, ethdb has no batched read.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	return database.SequentialMultiGet(db, keys)
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	return db.db.Put(wrapKey(db.namespace, key), value)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.db.Delete(wrapKey(db.namespace, key))
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	full := wrapKey(db.namespace, prefix)
+	return &namespaceIterator{
+		it:   db.db.NewIterator(full, start),
+		trim: len(full) - len(prefix),
+	}
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		namespace: db.namespace,
+		b:         db.db.NewBatch(),
+	}
+}
+
+// Ping checks that the store is still usable.
+func (db *Database) Ping() error {
+	_, err := db.db.Has(wrapKey(db.namespace, []byte("ping")))
+	return err
+}
+
+// Close is a no-op, the store is owned by the node and closed along with it.
+func (db *Database) Close() error {
+	return nil
+}
+
+// namespaceIterator strips the namespace from the keys of an ethdb iterator.
+type namespaceIterator struct {
+	it   ethdb.Iterator
+	trim int
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *namespaceIterator) Next() bool {
+	return it.it.Next()
+}
+
+// Error returns any accumulated error.
+func (it *namespaceIterator) Error() error {
+	return it.it.Error()
+}
+
+// Key returns the key of the current key/value pair without namespace, or nil if done.
+func (it *namespaceIterator) Key() []byte {
+	key := it.it.Key()
+	if key == nil {
+		return nil
+	}
+	return key[it.trim:]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *namespaceIterator) Value() []byte {
+	return it.it.Value()
+}
+
+// Release releases the ethdb iterator.
+func (it *namespaceIterator) Release() {
+	it.it.Release()
+}
+
+// batch is a write-only batch that commits changes to its host database
+// when Write is called. A batch cannot be used concurrently.
+type batch struct {
+	namespace []byte
+	b         ethdb.Batch
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	return b.b.Put(wrapKey(b.namespace, key), value)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	return b.b.Delete(wrapKey(b.namespace, key))
+}
+
+// Write flushes any accumulated data to disk.
+func (b *batch) Write() error {
+	return b.b.Write()
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+}
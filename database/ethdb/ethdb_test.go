@@ -0,0 +1,45 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package ethdb
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+)
+
+func TestEthDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			return New(memorydb.New(), "")
+		})
+	})
+	t.Run("DatabaseSuiteWithNamespace", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			return New(memorydb.New(), "smt")
+		})
+	})
+
+	store := memorydb.New()
+	if err := store.Put([]byte("chain"), []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	db := New(store, "smt")
+	if err := db.Set([]byte("chain"), []byte("tree")); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := store.Get([]byte("chain")); err != nil || string(val) != "data" {
+		t.Fatalf("the keys of the node should not be overwritten, got %q %v", val, err)
+	}
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	if !it.Next() || string(it.Key()) != "chain" || it.Next() {
+		t.Fatal("the iterator should only return the keys of the namespace")
+	}
+}
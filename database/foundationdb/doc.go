@@ -0,0 +1,22 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package foundationdb implements a TreeDB on FoundationDB, applying each
+// write batch in a single ACID transaction.
+//
+// The FoundationDB Go bindings require the native client library (libfdb_c),
+// so the backend is only compiled with the `fdb` build tag:
+//
+//	go build -tags fdb
+//
+// The backend is a module of its own requiring the bindings, the applications
+// not using it do not download them. Its tests run the database suite against
+// the cluster of FDB_CLUSTER_FILE, or of the default cluster file:
+//
+//	go test -tags fdb
+//
+// The bindings version pinned by go.mod must match the version of the
+// installed client library.
+package foundationdb
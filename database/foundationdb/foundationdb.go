@@ -0,0 +1,473 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+//go:build fdb
+
+package foundationdb
+
+import (
+	"bytes"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB   = (*Database)(nil)
+	_ database.Batcher  = (*batch)(nil)
+	_ database.Iterator = (*iterator)(nil)
+
+	_ database.NamespaceManager = (*Database)(nil)
+)
+
+const (
+	// APIVersion is the FoundationDB API version selected by New.
+	APIVersion = 710
+
+	// maxValueSize is the size of the chunks a value is split into,
+	// FoundationDB rejects values larger than 100,000 bytes.
+	maxValueSize = 90 * 1024
+
+	// defaultTxnSizeLimit keeps the transactions below the 10MB limit of
+	// FoundationDB, leaving room for the conflict ranges and the key overhead.
+	defaultTxnSizeLimit = 8 * 1024 * 1024
+
+	// iteratorPageSize is the number of chunks read per transaction by an iterator,
+	// long iterations are split since a transaction can not outlive 5 seconds.
+	iteratorPageSize = 1000
+)
+
+// New opens the FoundationDB cluster described by the cluster file,
+// an empty path selects the default cluster file.
+func New(clusterFile string) (*Database, error) {
+	if err := fdb.APIVersion(APIVersion); err != nil {
+		return nil, err
+	}
+	db, err := fdb.OpenDatabase(clusterFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromExistDatabase(db), nil
+}
+
+// NewFromExistDatabase returns a wrapped FoundationDB object.
+func NewFromExistDatabase(db fdb.Database) *Database {
+	return &Database{
+		db:           db,
+		space:        subspace.Sub(),
+		txnSizeLimit: defaultTxnSizeLimit,
+	}
+}
+
+// WrapWithNamespace returns a wrapped FoundationDB object.
+// The namespace is the tuple subspace holding the keys of the datastore.
+func WrapWithNamespace(db *Database, namespace string) *Database {
+	return &Database{
+		db:           db.db,
+		space:        subspace.Sub(namespace),
+		txnSizeLimit: db.txnSizeLimit,
+	}
+}
+
+// WithTxnSizeLimit sets the amount of data written by a single transaction,
+// larger batches are split into several transactions.
+func WithTxnSizeLimit(db *Database, limit int) *Database {
+	return &Database{
+		db:           db.db,
+		space:        db.space,
+		txnSizeLimit: limit,
+	}
+}
+
+// Database stores every value in the subspace of its key, split into chunks
+// of at most maxValueSize bytes.
+type Database struct {
+	db           fdb.Database
+	space        subspace.Subspace
+	txnSizeLimit int
+}
+
+func get(rtr fdb.ReadTransaction, space subspace.Subspace, key []byte) ([]byte, error) {
+	kvs, err := rtr.GetRange(space.Sub(key), fdb.RangeOptions{}).GetSliceWithError()
+	if err != nil {
+		return nil, err
+	}
+	if len(kvs) == 0 {
+		return nil, database.ErrDatabaseNotFound
+	}
+	if len(kvs) == 1 {
+		return kvs[0].Value, nil
+	}
+	size := 0
+	for _, kv := range kvs {
+		size += len(kv.Value)
+	}
+	value := make([]byte, 0, size)
+	for _, kv := range kvs {
+		value = append(value, kv.Value...)
+	}
+	return value, nil
+}
+
+func set(tr fdb.Transaction, space subspace.Subspace, key, value []byte) {
+	sub := space.Sub(key)
+	tr.ClearRange(sub)
+	for i := 0; i == 0 || i*maxValueSize < len(value); i++ {
+		end := (i + 1) * maxValueSize
+		if end > len(value) {
+			end = len(value)
+		}
+		tr.Set(sub.Pack(tuple.Tuple{i}), value[i*maxValueSize:end])
+	}
+}
+
+// Ping checks that the cluster is reachable by acquiring a read version.
+func (db *Database) Ping() error {
+	_, err := db.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		return rtr.GetReadVersion().Get()
+	})
+	return err
+}
+
+// Close is a no-op, the FoundationDB client network is shared by the process.
+func (db *Database) Close() error {
+	return nil
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	ret, err := db.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		kvs, err := rtr.GetRange(db.space.Sub(key), fdb.RangeOptions{Limit: 1}).GetSliceWithError()
+		if err != nil {
+			return false, err
+		}
+		return len(kvs) > 0, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return ret.(bool), nil
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	ret, err := db.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		return get(rtr, db.space, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.([]byte), nil
+}
+
+// MultiGet retrieves the given keys in a single read transaction.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	ret, err := db.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		values := make([][]byte, len(keys))
+		for i, key := range keys {
+			value, err := get(rtr, db.space, key)
+			if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.([][]byte), nil
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	_, err := db.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		set(tr, db.space, key, value)
+		return nil, nil
+	})
+	return err
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	_, err := db.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(db.space.Sub(key))
+		return nil, nil
+	})
+	return err
+}
+
+// Namespaces lists the namespace subspaces of the database, skipping from one
+// namespace to the next without reading their keys. The keys written without
+// namespace are encoded as byte strings and are not reported.
+func (db *Database) Namespaces() ([]string, error) {
+	ret, err := db.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		var namespaces []string
+		// the namespaces are string tuple elements, which are encoded between 0x02 and 0x03
+		begin, end := fdb.Key{0x02}, fdb.Key{0x03}
+		for {
+			kvs, err := rtr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: 1}).GetSliceWithError()
+			if err != nil {
+				return nil, err
+			}
+			if len(kvs) == 0 {
+				return namespaces, nil
+			}
+			t, err := tuple.Unpack(kvs[0].Key)
+			if err != nil {
+				return nil, err
+			}
+			namespace, ok := t[0].(string)
+			if !ok {
+				return nil, stdErrors.Errorf("unexpected key %x in the namespaces", kvs[0].Key)
+			}
+			namespaces = append(namespaces, namespace)
+			_, next := subspace.Sub(namespace).FDBRangeKeys()
+			begin = next.FDBKey()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.([]string), nil
+}
+
+// DropNamespace atomically deletes all the keys of the namespace with a single range clear.
+func (db *Database) DropNamespace(namespace string) error {
+	if len(namespace) == 0 {
+		return database.ErrEmptyNamespace
+	}
+	_, err := db.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(subspace.Sub(namespace))
+		return nil, nil
+	})
+	return err
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// Every page is read in its own transaction, so pages may observe different versions.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	// The tuple encoding of a byte string preserves the order of the raw keys, and
+	// the encoding of a key starts with the encoding of its prefix without the terminator.
+	encoded := db.space.Pack(tuple.Tuple{prefix})
+	end, err := fdb.Strinc(encoded[:len(encoded)-1])
+	if err != nil {
+		return database.NewErrorIterator(err)
+	}
+	return &iterator{
+		db:    db,
+		begin: db.space.Pack(tuple.Tuple{append(utils.CopyBytes(prefix), start...)}),
+		end:   fdb.Key(end),
+		index: -1,
+		more:  true,
+	}
+}
+
+// iterator reads the key range page by page, reassembling the chunked values.
+type iterator struct {
+	db     *Database
+	begin  fdb.Key // first key of the next page
+	end    fdb.Key
+	keys   [][]byte
+	values [][]byte
+	index  int
+	more   bool
+	err    error
+}
+
+// fetch reads the next page of the key range. A page is cut at a key boundary,
+// the chunks of the last key of a full page are read again with the next page.
+func (it *iterator) fetch() error {
+	ret, err := it.db.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		kvs, err := rtr.GetRange(fdb.KeyRange{Begin: it.begin, End: it.end},
+			fdb.RangeOptions{Limit: iteratorPageSize}).GetSliceWithError()
+		if err != nil {
+			return nil, err
+		}
+		return kvs, nil
+	})
+	if err != nil {
+		return err
+	}
+	kvs := ret.([]fdb.KeyValue)
+
+	it.keys, it.values, it.index = it.keys[:0], it.values[:0], 0
+	it.more = len(kvs) == iteratorPageSize
+	for _, kv := range kvs {
+		t, err := it.db.space.Unpack(kv.Key)
+		if err != nil {
+			return err
+		}
+		if len(t) == 0 {
+			return stdErrors.Errorf("unexpected key %x in the subspace", kv.Key)
+		}
+		key, ok := t[0].([]byte)
+		if !ok {
+			return stdErrors.Errorf("unexpected key %x in the subspace", kv.Key)
+		}
+		if n := len(it.keys); n > 0 && bytes.Equal(it.keys[n-1], key) {
+			it.values[n-1] = append(it.values[n-1], kv.Value...)
+			continue
+		}
+		it.keys = append(it.keys, key)
+		it.values = append(it.values, utils.CopyBytes(kv.Value))
+	}
+	if !it.more || len(it.keys) == 0 {
+		return nil
+	}
+
+	last := it.keys[len(it.keys)-1]
+	if len(it.keys) == 1 {
+		// the chunks of a single key fill the page, read the whole value at once
+		value, err := it.db.Get(last)
+		if err != nil {
+			return err
+		}
+		it.values[0] = value
+		_, end := it.db.space.Sub(last).FDBRangeKeys()
+		it.begin = end.FDBKey()
+		return nil
+	}
+	it.keys, it.values = it.keys[:len(it.keys)-1], it.values[:len(it.values)-1]
+	it.begin = it.db.space.Pack(tuple.Tuple{last})
+	return nil
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	if it.index < len(it.keys) {
+		return true
+	}
+	if !it.more {
+		it.keys, it.values, it.index = nil, nil, 0
+		return false
+	}
+	if it.err = it.fetch(); it.err != nil {
+		it.keys, it.values = nil, nil
+		return false
+	}
+	return len(it.keys) > 0
+}
+
+// Error returns any accumulated error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *iterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.index]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+// Release releases the fetched page.
+func (it *iterator) Release() {
+	it.keys, it.values, it.more = nil, nil, false
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+	}
+}
+
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch is a write-only batch that commits changes to its host database
+// in a single transaction when Write is called. If the batch exceeds the
+// transaction size limit, it is split into several transactions, each of
+// them applied atomically. A batch cannot be used concurrently.
+type batch struct {
+	db     *Database
+	writes []keyvalue
+	size   int
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{utils.CopyBytes(key), utils.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{utils.CopyBytes(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *batch) commit(writes []keyvalue) error {
+	_, err := b.db.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for _, kv := range writes {
+			if kv.delete {
+				tr.ClearRange(b.db.space.Sub(kv.key))
+				continue
+			}
+			set(tr, b.db.space, kv.key, kv.value)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// Write flushes any accumulated data to FoundationDB.
+func (b *batch) Write() error {
+	start, size := 0, 0
+	for i, kv := range b.writes {
+		size += len(kv.key) + len(kv.value)
+		if size >= b.db.txnSizeLimit {
+			if err := b.commit(b.writes[start : i+1]); err != nil {
+				return err
+			}
+			start, size = i+1, 0
+		}
+	}
+	if start < len(b.writes) {
+		return b.commit(b.writes[start:])
+	}
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+//go:build fdb
+
+package foundationdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+)
+
+// defaultClusterFile is the cluster file installed by the FoundationDB
+// packages, used by the client when FDB_CLUSTER_FILE is not set.
+const defaultClusterFile = "/etc/foundationdb/fdb.cluster"
+
+func openTestDatabase(t *testing.T) *Database {
+	clusterFile := os.Getenv("FDB_CLUSTER_FILE")
+	if clusterFile == "" {
+		if _, err := os.Stat(defaultClusterFile); err != nil {
+			t.Skip("no FoundationDB cluster file, set FDB_CLUSTER_FILE")
+		}
+	}
+	db, err := New(clusterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFoundationDB(t *testing.T) {
+	db := openTestDatabase(t)
+	count := 0
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			// every test of the suite expects an empty database
+			count++
+			namespace := fmt.Sprintf("dbtest-%d-%d", os.Getpid(), count)
+			if err := db.DropNamespace(namespace); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = db.DropNamespace(namespace) })
+			return WrapWithNamespace(db, namespace)
+		})
+	})
+}
+
+func TestFoundationDBTxnSizeLimit(t *testing.T) {
+	db := openTestDatabase(t)
+	count := 0
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			count++
+			namespace := fmt.Sprintf("dbtest-limit-%d-%d", os.Getpid(), count)
+			if err := db.DropNamespace(namespace); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = db.DropNamespace(namespace) })
+			// splits the batches of the suite into several transactions
+			return WithTxnSizeLimit(WrapWithNamespace(db, namespace), 1024)
+		})
+	})
+}
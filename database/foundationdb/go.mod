@@ -0,0 +1,14 @@
+module github.com/bnb-chain/zkbnb-smt/database/foundationdb
+
+go 1.18
+
+// The bindings are not tagged with semantic versions, the tag of the
+// FoundationDB release matching the installed client library is resolved to
+// its pseudo-version by go mod tidy.
+require (
+	github.com/apple/foundationdb/bindings/go 7.1.27
+	github.com/bnb-chain/zkbnb-smt v0.0.0
+	github.com/pkg/errors v0.9.1
+)
+
+replace github.com/bnb-chain/zkbnb-smt => ../..
@@ -0,0 +1,230 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package database
+
+import (
+	"bytes"
+)
+
+var (
+	_ Iterator = (*sliceIterator)(nil)
+	_ Iterator = (*mergedIterator)(nil)
+	_ Iterator = (*transformIterator)(nil)
+)
+
+// NewSliceIterator returns an iterator over the given key/value pairs,
+// the keys must be sorted in ascending order.
+func NewSliceIterator(keys, values [][]byte) Iterator {
+	return &sliceIterator{
+		keys:   keys,
+		values: values,
+		index:  -1,
+	}
+}
+
+// NewErrorIterator returns an iterator which yields nothing and reports the error.
+func NewErrorIterator(err error) Iterator {
+	return &sliceIterator{
+		index: -1,
+		err:   err,
+	}
+}
+
+// sliceIterator iterates over pre-loaded key/value pairs.
+type sliceIterator struct {
+	keys   [][]byte
+	values [][]byte
+	index  int
+	err    error
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *sliceIterator) Next() bool {
+	if it.err != nil || it.index >= len(it.keys) {
+		return false
+	}
+	it.index++
+	return it.index < len(it.keys)
+}
+
+// Error returns any accumulated error.
+func (it *sliceIterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *sliceIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.index]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *sliceIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+// Release releases the pre-loaded key/value pairs.
+func (it *sliceIterator) Release() {
+	it.index = len(it.keys)
+	it.keys, it.values = nil, nil
+}
+
+// NewMergedIterator returns an iterator yielding the union of the given iterators
+// in ascending key order. If a key is present in several iterators, the value of
+// the first one is returned.
+func NewMergedIterator(iterators ...Iterator) Iterator {
+	return &mergedIterator{
+		iterators: iterators,
+		valid:     make([]bool, len(iterators)),
+		current:   -1,
+	}
+}
+
+// mergedIterator merges several sorted iterators.
+type mergedIterator struct {
+	iterators []Iterator
+	valid     []bool
+	started   bool
+	current   int
+	err       error
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *mergedIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		for i, sub := range it.iterators {
+			it.valid[i] = sub.Next()
+		}
+	} else if it.current >= 0 {
+		// advance every iterator positioned on the yielded key
+		key := it.iterators[it.current].Key()
+		for i, sub := range it.iterators {
+			if i != it.current && it.valid[i] && bytes.Equal(sub.Key(), key) {
+				it.valid[i] = sub.Next()
+			}
+		}
+		it.valid[it.current] = it.iterators[it.current].Next()
+	}
+
+	it.current = -1
+	for i, sub := range it.iterators {
+		if !it.valid[i] {
+			if err := sub.Error(); err != nil {
+				it.err = err
+				return false
+			}
+			continue
+		}
+		if it.current < 0 || bytes.Compare(sub.Key(), it.iterators[it.current].Key()) < 0 {
+			it.current = i
+		}
+	}
+	return it.current >= 0
+}
+
+// Error returns any accumulated error.
+func (it *mergedIterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *mergedIterator) Key() []byte {
+	if it.current < 0 {
+		return nil
+	}
+	return it.iterators[it.current].Key()
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *mergedIterator) Value() []byte {
+	if it.current < 0 {
+		return nil
+	}
+	return it.iterators[it.current].Value()
+}
+
+// Release releases all the merged iterators.
+func (it *mergedIterator) Release() {
+	for _, sub := range it.iterators {
+		sub.Release()
+	}
+	it.current = -1
+}
+
+// NewTransformIterator returns an iterator which decodes the values of the
+// given iterator with fn, e.g. to decompress or decrypt them. The iteration
+// stops at the first value that fails to decode.
+func NewTransformIterator(it Iterator, fn func(key, value []byte) ([]byte, error)) Iterator {
+	return &transformIterator{
+		it: it,
+		fn: fn,
+	}
+}
+
+// transformIterator decodes the values of the wrapped iterator.
+type transformIterator struct {
+	it    Iterator
+	fn    func(key, value []byte) ([]byte, error)
+	value []byte
+	valid bool
+	err   error
+}
+
+// Next moves the iterator to the next key/value pair and decodes its value.
+func (it *transformIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.valid = it.it.Next()
+	if !it.valid {
+		it.value = nil
+		return false
+	}
+	it.value, it.err = it.fn(it.it.Key(), it.it.Value())
+	if it.err != nil {
+		it.valid = false
+	}
+	return it.valid
+}
+
+// Error returns any accumulated error.
+func (it *transformIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.it.Error()
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *transformIterator) Key() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.it.Key()
+}
+
+// Value returns the decoded value of the current key/value pair, or nil if done.
+func (it *transformIterator) Value() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.value
+}
+
+// Release releases the wrapped iterator.
+func (it *transformIterator) Release() {
+	it.it.Release()
+	it.value, it.valid = nil, false
+}
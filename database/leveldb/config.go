@@ -0,0 +1,45 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package leveldb
+
+type LevelDBConfig struct {
+	// Amount of memory in megabytes to allocate to the block cache.
+	// Default is 8MB, the minimum is 8MB.
+	BlockCache int
+	// Amount of memory in megabytes to buffer writes in the memtable,
+	// two of these are used internally. Larger buffers reduce the number
+	// of level 0 compactions during large commits.
+	// Default is 4MB, the minimum is 4MB.
+	WriteBuffer int
+	// Number of open files the table cache may hold.
+	// Default is 16, the minimum is 16.
+	Handles int
+	// Bits per key of the bloom filter, -1 disables the filter.
+	// Default is 10.
+	BloomFilterBits int
+
+	// Size in megabytes of a table file produced by the compaction.
+	// Default is 2MB.
+	CompactionTableSize int
+	// Limit in megabytes of the total size of level 1, the limit of the
+	// following levels grows by a factor of 10.
+	// Default is 10MB.
+	CompactionTotalSize int
+	// Number of level 0 tables that triggers a compaction.
+	// Default is 4.
+	CompactionL0Trigger int
+	// Number of level 0 tables that slows down the writes.
+	// Default is 8.
+	WriteL0SlowdownTrigger int
+	// Number of level 0 tables that pauses the writes.
+	// Default is 12.
+	WriteL0PauseTrigger int
+	// Disables the compactions triggered by seeks.
+	DisableSeeksCompaction bool
+
+	// Opens the database in read-only mode.
+	ReadOnly bool
+}
@@ -7,19 +7,29 @@ package leveldb
 
 import (
 	"bytes"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
 	stdErrors "github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
 )
 
 var (
-	_ database.TreeDB  = (*Database)(nil)
-	_ database.Batcher = (*batch)(nil)
+	_ database.TreeDB           = (*Database)(nil)
+	_ database.Batcher          = (*batch)(nil)
+	_ database.Iterator         = (*namespaceIterator)(nil)
+	_ database.NamespaceManager = (*Database)(nil)
+	_ database.Backuper         = (*Database)(nil)
 )
 
 const (
@@ -30,6 +40,9 @@ const (
 	// minHandles is the minimum number of files handles to allocate to the open
 	// database files.
 	minHandles = 16
+
+	// multiGetChunk is the number of keys read by a worker at a time in MultiGet.
+	multiGetChunk = 16
 )
 
 type Database struct {
@@ -57,6 +70,57 @@ func New(file string, cache int, handles int, readonly bool) (*Database, error)
 	})
 }
 
+// NewWithConfig returns a wrapped LevelDB object tuned by the config.
+// The namespace is the prefix that the datastore.
+func NewWithConfig(file string, namespace string, config *LevelDBConfig) (*Database, error) {
+	return NewCustom(file, namespace, func(options *opt.Options) {
+		if config.BlockCache > 0 {
+			cache := config.BlockCache
+			if cache < minCache/2 {
+				cache = minCache / 2
+			}
+			options.BlockCacheCapacity = cache * opt.MiB
+		}
+		if config.WriteBuffer > 0 {
+			buffer := config.WriteBuffer
+			if buffer < minCache/4 {
+				buffer = minCache / 4
+			}
+			options.WriteBuffer = buffer * opt.MiB
+		}
+		if config.Handles > 0 {
+			handles := config.Handles
+			if handles < minHandles {
+				handles = minHandles
+			}
+			options.OpenFilesCacheCapacity = handles
+		}
+		switch {
+		case config.BloomFilterBits < 0:
+			options.Filter = nil
+		case config.BloomFilterBits > 0:
+			options.Filter = filter.NewBloomFilter(config.BloomFilterBits)
+		}
+		if config.CompactionTableSize > 0 {
+			options.CompactionTableSize = config.CompactionTableSize * opt.MiB
+		}
+		if config.CompactionTotalSize > 0 {
+			options.CompactionTotalSize = config.CompactionTotalSize * opt.MiB
+		}
+		if config.CompactionL0Trigger > 0 {
+			options.CompactionL0Trigger = config.CompactionL0Trigger
+		}
+		if config.WriteL0SlowdownTrigger > 0 {
+			options.WriteL0SlowdownTrigger = config.WriteL0SlowdownTrigger
+		}
+		if config.WriteL0PauseTrigger > 0 {
+			options.WriteL0PauseTrigger = config.WriteL0PauseTrigger
+		}
+		options.DisableSeeksCompaction = config.DisableSeeksCompaction
+		options.ReadOnly = config.ReadOnly
+	})
+}
+
 // NewFromExistLevelDB returns a wrapped LevelDB object.
 func NewFromExistLevelDB(db *leveldb.DB) *Database {
 	return &Database{
@@ -119,12 +183,99 @@ func wrapKey(namespace, key []byte) []byte {
 	return key
 }
 
+// Namespaces lists the namespaces of the underlying LevelDB, skipping from one
+// namespace to the next without reading their keys. Keys written without namespace
+// are reported by the part preceding their first separator, e.g. `t` for tree nodes.
+func (db *Database) Namespaces() ([]string, error) {
+	it := db.db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var namespaces []string
+	for ok := it.First(); ok; {
+		key := it.Key()
+		i := bytes.IndexByte(key, ':')
+		if i < 0 {
+			ok = it.Next()
+			continue
+		}
+		namespaces = append(namespaces, string(key[:i]))
+		// ';' is the byte following the separator, skip the rest of the namespace
+		ok = it.Seek(append(utils.CopyBytes(key[:i]), ';'))
+	}
+	return namespaces, it.Error()
+}
+
+// DropNamespace atomically deletes all the keys of the namespace with a single batch.
+func (db *Database) DropNamespace(namespace string) error {
+	if len(namespace) == 0 {
+		return database.ErrEmptyNamespace
+	}
+	it := db.db.NewIterator(util.BytesPrefix(wrapKey([]byte(namespace), nil)), nil)
+	defer it.Release()
+
+	b := new(leveldb.Batch)
+	for it.Next() {
+		b.Delete(utils.CopyBytes(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return db.db.Write(b, nil)
+}
+
+// Backup writes the keys of the namespace to w in the portable format.
+// The keys are read from a snapshot, so the backup is consistent while commits continue.
+func (db *Database) Backup(w io.Writer) error {
+	snap, err := db.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	full := wrapKey(db.namespace, nil)
+	it := &namespaceIterator{
+		it:   snap.NewIterator(util.BytesPrefix(full), nil),
+		trim: len(full),
+	}
+	defer it.Release()
+	return database.BackupKV(it, w)
+}
+
+// Restore writes the keys of a backup in the portable format into the namespace.
+func (db *Database) Restore(r io.Reader) error {
+	br, err := database.NewBackupReader(r)
+	if err != nil {
+		return err
+	}
+	if br.Format() != database.BackupFormatKV {
+		return database.ErrUnsupportedBackupFormat
+	}
+	return database.RestoreKV(db, br)
+}
+
+// Ping checks that the LevelDB is still open.
+func (db *Database) Ping() error {
+	_, err := db.db.GetProperty("leveldb.num-files-at-level0")
+	return err
+}
+
 // Close flushes any pending data to disk and closes
 // all io accesses to the underlying key-value store.
 func (db *Database) Close() error {
 	return db.db.Close()
 }
 
+// Stats retrieves the statistics of the underlying LevelDB, such as the number
+// of compactions, the write delays caused by level 0 triggers and the level sizes.
+// The statistics are shared by all the namespaces of the LevelDB.
+func (db *Database) Stats() (*leveldb.DBStats, error) {
+	stats := &leveldb.DBStats{}
+	if err := db.db.Stats(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
 // Has retrieves if a key is present in the key-value store.
 func (db *Database) Has(key []byte) (bool, error) {
 	has, err := db.db.Has(wrapKey(db.namespace, key), nil)
@@ -143,6 +294,61 @@ func (db *Database) Get(key []byte) ([]byte, error) {
 	return dat, err
 }
 
+// MultiGet retrieves the given keys from a snapshot of the LevelDB,
+// large sets of keys are read concurrently.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	snap, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	values := make([][]byte, len(keys))
+	workers := runtime.NumCPU()
+	if chunks := (len(keys) + multiGetChunk - 1) / multiGetChunk; chunks < workers {
+		workers = chunks
+	}
+	var (
+		wg   sync.WaitGroup
+		next int64 = -1
+		errs       = make([]error, workers)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				from := int(atomic.AddInt64(&next, 1)) * multiGetChunk
+				if from >= len(keys) {
+					return
+				}
+				to := from + multiGetChunk
+				if to > len(keys) {
+					to = len(keys)
+				}
+				for i := from; i < to; i++ {
+					value, err := snap.Get(wrapKey(db.namespace, keys[i]), nil)
+					if stdErrors.Is(err, leveldb.ErrNotFound) {
+						continue
+					}
+					if err != nil {
+						errs[w] = err
+						return
+					}
+					values[i] = value
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
 // Put inserts the given value into the key-value store.
 func (db *Database) Set(key []byte, value []byte) error {
 	return db.db.Put(wrapKey(db.namespace, key), value, nil)
@@ -153,6 +359,54 @@ func (db *Database) Delete(key []byte) error {
 	return db.db.Delete(wrapKey(db.namespace, key), nil)
 }
 
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	full := wrapKey(db.namespace, prefix)
+	r := util.BytesPrefix(full)
+	r.Start = append(utils.CopyBytes(full), start...)
+	return &namespaceIterator{
+		it:   db.db.NewIterator(r, nil),
+		trim: len(full) - len(prefix),
+	}
+}
+
+// namespaceIterator strips the namespace from the keys of a leveldb iterator.
+type namespaceIterator struct {
+	it   iterator.Iterator
+	trim int
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *namespaceIterator) Next() bool {
+	return it.it.Next()
+}
+
+// Error returns any accumulated error.
+func (it *namespaceIterator) Error() error {
+	return it.it.Error()
+}
+
+// Key returns the key of the current key/value pair without namespace, or nil if done.
+func (it *namespaceIterator) Key() []byte {
+	key := it.it.Key()
+	if key == nil {
+		return nil
+	}
+	return key[it.trim:]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *namespaceIterator) Value() []byte {
+	return it.it.Value()
+}
+
+// Release releases the leveldb iterator.
+func (it *namespaceIterator) Release() {
+	it.it.Release()
+}
+
 // NewBatch creates a write-only key-value store that buffers changes to its host
 // database until a final write is called.
 func (db *Database) NewBatch() database.Batcher {
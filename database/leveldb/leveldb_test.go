@@ -6,8 +6,10 @@
 package leveldb
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/storage"
 
@@ -43,3 +45,94 @@ func TestLevelDBWithNamespace(t *testing.T) {
 		})
 	})
 }
+
+func TestLevelDBWithConfig(t *testing.T) {
+	db, err := NewWithConfig(t.TempDir(), "test", &LevelDBConfig{
+		BlockCache:          16,
+		WriteBuffer:         8,
+		BloomFilterBits:     -1,
+		CompactionL0Trigger: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Set([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.WritePaused {
+		t.Fatal("writes should not be paused")
+	}
+}
+
+func TestLevelDBNamespaces(t *testing.T) {
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewFromExistLevelDB(ldb)
+	defer db.Close()
+
+	for _, ns := range []string{"a", "b", "c"} {
+		wrapped := WrapWithNamespace(db, ns)
+		for _, key := range []string{"latestVersion", "t:1", "t:2"} {
+			if err := wrapped.Set([]byte(key), []byte(ns)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	namespaces, err := db.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, namespaces)
+
+	assert.ErrorIs(t, db.DropNamespace(""), database.ErrEmptyNamespace)
+	if err := db.DropNamespace("b"); err != nil {
+		t.Fatal(err)
+	}
+	namespaces, err = db.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a", "c"}, namespaces)
+	if has, _ := WrapWithNamespace(db, "c").Has([]byte("t:1")); !has {
+		t.Fatal("other namespaces should be kept")
+	}
+}
+
+func TestLevelDBBackup(t *testing.T) {
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewFromExistLevelDB(ldb)
+	defer db.Close()
+
+	src, dst := WrapWithNamespace(db, "src"), WrapWithNamespace(db, "dst")
+	for _, key := range []string{"latestVersion", "t:1", "t:2"} {
+		if err := src.Set([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := database.Backup(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Restore(dst, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"latestVersion", "t:1", "t:2"} {
+		value, err := dst.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, key, string(value))
+	}
+}
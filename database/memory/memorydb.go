@@ -6,7 +6,12 @@
 package memory
 
 import (
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/bnb-chain/zkbnb-smt/database"
 	"github.com/bnb-chain/zkbnb-smt/utils"
@@ -15,18 +20,50 @@ import (
 var (
 	_ database.TreeDB  = (*MemoryDB)(nil)
 	_ database.Batcher = (*batch)(nil)
+
+	// ErrCapacityExceeded is returned if a write would grow the database beyond its capacity.
+	ErrCapacityExceeded = errors.New("memory database capacity exceeded")
 )
 
-func NewMemoryDB() database.TreeDB {
-	return &MemoryDB{
+// Option is a function that configures a memory database.
+type Option func(*MemoryDB)
+
+// WithMaxBytes bounds the total size of the keys and values held by the database.
+// Writes exceeding the capacity fail with ErrCapacityExceeded, while the
+// deletions are always accepted. Zero, the default, is unlimited.
+func WithMaxBytes(maxBytes int) Option {
+	return func(db *MemoryDB) {
+		db.maxBytes = maxBytes
+	}
+}
+
+func NewMemoryDB(opts ...Option) database.TreeDB {
+	return newMemoryDB(opts...)
+}
+
+func newMemoryDB(opts ...Option) *MemoryDB {
+	db := &MemoryDB{
 		db: make(map[string][]byte),
 	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db
 }
 
 // MemoryDB is a key-value store.
 type MemoryDB struct {
 	db   map[string][]byte
 	lock sync.RWMutex
+
+	size     int // total size of the keys and values
+	maxBytes int
+
+	// snapshot persistence, see NewPersistentMemoryDB
+	path     string
+	interval time.Duration
+	quit     chan struct{}
+	wg       sync.WaitGroup
 }
 
 func (db *MemoryDB) Get(key []byte) ([]byte, error) {
@@ -42,6 +79,22 @@ func (db *MemoryDB) Get(key []byte) ([]byte, error) {
 	return nil, database.ErrDatabaseNotFound
 }
 
+func (db *MemoryDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return nil, database.ErrDatabaseClosed
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if entry, ok := db.db[string(key)]; ok {
+			values[i] = utils.CopyBytes(entry)
+		}
+	}
+	return values, nil
+}
+
 func (db *MemoryDB) Has(key []byte) (bool, error) {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
@@ -60,7 +113,10 @@ func (db *MemoryDB) Set(key []byte, value []byte) error {
 	if db.db == nil {
 		return database.ErrDatabaseClosed
 	}
-	db.db[string(key)] = utils.CopyBytes(value)
+	if db.maxBytes > 0 && db.size+db.growth(string(key), value) > db.maxBytes {
+		return ErrCapacityExceeded
+	}
+	db.put(string(key), utils.CopyBytes(value))
 	return nil
 }
 
@@ -71,17 +127,89 @@ func (db *MemoryDB) Delete(key []byte) error {
 	if db.db == nil {
 		return database.ErrDatabaseClosed
 	}
-	delete(db.db, string(key))
+	db.remove(string(key))
 	return nil
 }
 
+func entrySize(key string, value []byte) int {
+	return len(key) + len(value)
+}
+
+// growth returns the change of the database size if the key is set to value.
+func (db *MemoryDB) growth(key string, value []byte) int {
+	growth := entrySize(key, value)
+	if old, ok := db.db[key]; ok {
+		growth -= entrySize(key, old)
+	}
+	return growth
+}
+
+func (db *MemoryDB) put(key string, value []byte) {
+	db.size += db.growth(key, value)
+	db.db[key] = value
+}
+
+func (db *MemoryDB) remove(key string) {
+	if old, ok := db.db[key]; ok {
+		db.size -= entrySize(key, old)
+		delete(db.db, key)
+	}
+}
+
+func (db *MemoryDB) NewIterator(prefix []byte, start []byte) database.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return database.NewErrorIterator(database.ErrDatabaseClosed)
+	}
+	var (
+		pr     = string(prefix)
+		st     = pr + string(start)
+		keys   = make([]string, 0, len(db.db))
+		values = make([][]byte, 0, len(db.db))
+	)
+	// Collect the keys from the memory database corresponding to the given prefix
+	// and start
+	for key := range db.db {
+		if !strings.HasPrefix(key, pr) {
+			continue
+		}
+		if key >= st {
+			keys = append(keys, key)
+		}
+	}
+	// Sort the items and retrieve the associated values
+	sort.Strings(keys)
+	byteKeys := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		byteKeys = append(byteKeys, []byte(key))
+		values = append(values, utils.CopyBytes(db.db[key]))
+	}
+	return database.NewSliceIterator(byteKeys, values)
+}
+
 func (db *MemoryDB) NewBatch() database.Batcher {
 	return &batch{
 		db: db,
 	}
 }
 
+func (db *MemoryDB) Ping() error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return database.ErrDatabaseClosed
+	}
+	return nil
+}
+
 func (db *MemoryDB) Close() error {
+	if err := db.closeSnapshot(); err != nil {
+		return err
+	}
+
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -124,16 +252,45 @@ func (b *batch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
 
+	if b.db.db == nil {
+		return database.ErrDatabaseClosed
+	}
+	if b.db.maxBytes > 0 && b.db.size+b.growth() > b.db.maxBytes {
+		return ErrCapacityExceeded
+	}
 	for _, keyvalue := range b.writes {
 		if keyvalue.delete {
-			delete(b.db.db, string(keyvalue.key))
+			b.db.remove(string(keyvalue.key))
 			continue
 		}
-		b.db.db[string(keyvalue.key)] = keyvalue.value
+		b.db.put(string(keyvalue.key), keyvalue.value)
 	}
 	return nil
 }
 
+// growth returns the change of the database size once the batch is written,
+// so a batch exceeding the capacity is rejected entirely.
+func (b *batch) growth() int {
+	sizes := make(map[string]int, len(b.writes))
+	growth := 0
+	for _, keyvalue := range b.writes {
+		key := string(keyvalue.key)
+		prev, ok := sizes[key]
+		if !ok {
+			if old, exist := b.db.db[key]; exist {
+				prev = entrySize(key, old)
+			}
+		}
+		next := 0
+		if !keyvalue.delete {
+			next = entrySize(key, keyvalue.value)
+		}
+		growth += next - prev
+		sizes[key] = next
+	}
+	return growth
+}
+
 // ValueSize retrieves the amount of data queued up for writing.
 func (b *batch) ValueSize() int {
 	return b.size
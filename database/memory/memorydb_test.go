@@ -6,7 +6,12 @@
 package memory
 
 import (
+	"bytes"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/bnb-chain/zkbnb-smt/database"
 	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
@@ -19,3 +24,88 @@ func TestMemoryDB(t *testing.T) {
 		})
 	})
 }
+
+func TestPersistentMemoryDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			db, err := NewPersistentMemoryDB(filepath.Join(t.TempDir(), "suite.snapshot"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+
+	db, err := NewPersistentMemoryDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewPersistentMemoryDB(path, WithSnapshotInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := db.Get([]byte("key")); err != nil || !bytes.Equal(val, []byte("value")) {
+		t.Fatalf("contents should be reloaded from the snapshot, got %q %v", val, err)
+	}
+	if err := db.Set([]byte("other"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// the periodic snapshot already contains the new key
+	reloaded, err := NewPersistentMemoryDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := reloaded.Has([]byte("other")); !has {
+		t.Fatal("periodic snapshot should contain the new key")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryDBCapacity(t *testing.T) {
+	db := NewMemoryDB(WithMaxBytes(10))
+	if err := db.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set([]byte("other"), []byte("value")); !errors.Is(err, ErrCapacityExceeded) {
+		t.Fatalf("write beyond the capacity should fail, got %v", err)
+	}
+	// overwriting a key only accounts for the size difference
+	if err := db.Set([]byte("key"), []byte("value12")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := db.NewBatch()
+	if err := b.Delete([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set([]byte("other"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Reset()
+	if err := b.Set([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); !errors.Is(err, ErrCapacityExceeded) {
+		t.Fatalf("batch beyond the capacity should fail, got %v", err)
+	}
+	if has, _ := db.Has([]byte("a")); has {
+		t.Fatal("rejected batch should not be applied")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package memory
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// WithSnapshotInterval additionally writes the snapshot file every interval,
+// bounding the writes lost on a crash. By default, the snapshot is only written on Close.
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(db *MemoryDB) {
+		db.interval = interval
+	}
+}
+
+// NewPersistentMemoryDB returns a memory database that is loaded from the
+// snapshot file at path, and written back to it on Close. A missing file
+// results in an empty database. It is intended for development and test
+// environments that want to survive restarts, not for production use.
+func NewPersistentMemoryDB(path string, opts ...Option) (*MemoryDB, error) {
+	db := newMemoryDB(opts...)
+	db.path = path
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	if db.interval > 0 {
+		db.quit = make(chan struct{})
+		db.wg.Add(1)
+		go db.snapshotLoop()
+	}
+	return db, nil
+}
+
+// load reads the records of the snapshot file into the database.
+func (db *MemoryDB) load() error {
+	f, err := os.Open(db.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br, err := database.NewBackupReader(f)
+	if err != nil {
+		return err
+	}
+	if br.Format() != database.BackupFormatKV {
+		return database.ErrUnsupportedBackupFormat
+	}
+	for {
+		key, value, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if db.maxBytes > 0 && db.size+entrySize(string(key), value) > db.maxBytes {
+			return ErrCapacityExceeded
+		}
+		db.put(string(key), value)
+	}
+}
+
+func (db *MemoryDB) snapshotLoop() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(db.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// a failed snapshot is retried on the next tick, and on Close
+			_ = db.Snapshot()
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+// Snapshot writes the contents of the database to the snapshot file. The file
+// is replaced atomically, so a crash never leaves a partially written snapshot.
+// It is a no-op for a database created without a snapshot file.
+func (db *MemoryDB) Snapshot() error {
+	if db.path == "" {
+		return nil
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return database.ErrDatabaseClosed
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if err = db.writeSnapshot(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
+
+func (db *MemoryDB) writeSnapshot(f *os.File) error {
+	keys := make([]string, 0, len(db.db))
+	for key := range db.db {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bw, err := database.NewBackupWriter(f, database.BackupFormatKV)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := bw.Add([]byte(key), db.db[key]); err != nil {
+			return err
+		}
+	}
+	if err := bw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// closeSnapshot stops the periodic snapshots and writes the final one.
+func (db *MemoryDB) closeSnapshot() error {
+	if db.path == "" {
+		return nil
+	}
+	db.lock.RLock()
+	closed := db.db == nil
+	db.lock.RUnlock()
+	if closed {
+		return nil
+	}
+
+	if db.quit != nil {
+		close(db.quit)
+		db.wg.Wait()
+		db.quit = nil
+	}
+	return db.Snapshot()
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package metered
+
+import (
+	"time"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/metrics"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+)
+
+// Database is a TreeDB decorator reporting the operation counts, latencies,
+// errors and batch sizes of the underlying store to a DBMetrics.
+type Database struct {
+	db      database.TreeDB
+	metrics metrics.DBMetrics
+}
+
+// Wrap returns a TreeDB reporting the operations of db to m.
+func Wrap(db database.TreeDB, m metrics.DBMetrics) *Database {
+	return &Database{
+		db:      db,
+		metrics: m,
+	}
+}
+
+// observe reports an operation, a missing key is not an error of the store.
+func (db *Database) observe(op string, start time.Time, err error) {
+	if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+		err = nil
+	}
+	db.metrics.DBOperation(op, time.Since(start), err)
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	start := time.Now()
+	has, err := db.db.Has(key)
+	db.observe(metrics.DBHas, start, err)
+	return has, err
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	start := time.Now()
+	value, err := db.db.Get(key)
+	db.observe(metrics.DBGet, start, err)
+	return value, err
+}
+
+// MultiGet retrieves the given keys from the key-value store.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	start := time.Now()
+	values, err := db.db.MultiGet(keys)
+	db.observe(metrics.DBMultiGet, start, err)
+	return values, err
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	start := time.Now()
+	err := db.db.Set(key, value)
+	db.observe(metrics.DBSet, start, err)
+	return err
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	start := time.Now()
+	err := db.db.Delete(key)
+	db.observe(metrics.DBDel, start, err)
+	return err
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// Only the creation of the iterator is reported.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	defer db.observe(metrics.DBIterate, time.Now(), nil)
+	return db.db.NewIterator(prefix, start)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+		b:  db.db.NewBatch(),
+	}
+}
+
+// Ping checks the underlying store.
+func (db *Database) Ping() error {
+	return db.db.Ping()
+}
+
+// Close closes the underlying store.
+func (db *Database) Close() error {
+	return db.db.Close()
+}
+
+// batch counts the queued operations and reports the batch once written.
+type batch struct {
+	db  *Database
+	b   database.Batcher
+	ops int
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.ops++
+	return b.b.Set(key, value)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.ops++
+	return b.b.Delete(key)
+}
+
+// Write flushes any accumulated data to the underlying store.
+func (b *batch) Write() error {
+	start := time.Now()
+	err := b.b.Write()
+	b.db.observe(metrics.DBWrite, start, err)
+	b.db.metrics.DBBatch(b.ops, b.b.ValueSize())
+	return err
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+	b.ops = 0
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package metered
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/metrics"
+)
+
+type recorder struct {
+	ops     map[string]int
+	errs    int
+	batches int
+	size    int
+}
+
+func (r *recorder) DBOperation(op string, _ time.Duration, err error) {
+	r.ops[op]++
+	if err != nil {
+		r.errs++
+	}
+}
+
+func (r *recorder) DBBatch(_ int, size int) {
+	r.batches++
+	r.size += size
+}
+
+func TestMetered(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			return Wrap(memory.NewMemoryDB(), &recorder{ops: make(map[string]int)})
+		})
+	})
+}
+
+func TestMeteredReport(t *testing.T) {
+	r := &recorder{ops: make(map[string]int)}
+	db := Wrap(memory.NewMemoryDB(), r)
+
+	db.Set([]byte("foo"), []byte("bar"))
+	db.Get([]byte("foo"))
+	db.Get([]byte("missing"))
+	b := db.NewBatch()
+	b.Set([]byte("1"), []byte("12345"))
+	b.Write()
+	db.Close()
+	db.Get([]byte("foo"))
+
+	if r.ops[metrics.DBSet] != 1 || r.ops[metrics.DBGet] != 3 || r.ops[metrics.DBWrite] != 1 {
+		t.Fatalf("unexpected operation counts: %v", r.ops)
+	}
+	if r.errs != 1 {
+		t.Fatalf("only reading a closed database should be an error, got %d errors", r.errs)
+	}
+	if r.batches != 1 || r.size != 5 {
+		t.Fatalf("unexpected batch report: %d batches, %d bytes", r.batches, r.size)
+	}
+}
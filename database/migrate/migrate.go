@@ -0,0 +1,196 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package migrate copies the content of a TreeDB into another one,
+// e.g. to move a tree from Redis to LevelDB.
+package migrate
+
+import (
+	"bytes"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	// ErrVerificationFailed is returned if a copied key is missing or differs in the destination.
+	ErrVerificationFailed = stdErrors.New("migration verification failed")
+)
+
+const defaultBatchSize = 4 * 1024 * 1024
+
+// Progress describes the state of a copy.
+type Progress struct {
+	// Keys is the number of keys copied by this call so far.
+	Keys int
+	// Bytes is the amount of value data copied by this call so far.
+	Bytes int
+	// LastKey is the last key durably written to the destination,
+	// passing it to Resume continues the copy after it.
+	LastKey []byte
+	// Verified is the number of keys checked by the verification pass.
+	Verified int
+}
+
+// Option is a function that configures a copy.
+type Option func(*config)
+
+type config struct {
+	prefix    []byte
+	resume    []byte
+	batchSize int
+	verify    bool
+	progress  func(Progress)
+}
+
+// WithPrefix only copies the keys with the given prefix.
+func WithPrefix(prefix []byte) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// Resume continues an interrupted copy after the given key, which is the
+// LastKey of the last reported progress.
+func Resume(lastKey []byte) Option {
+	return func(c *config) {
+		c.resume = lastKey
+	}
+}
+
+// WithBatchSize sets the amount of data written to the destination per batch.
+func WithBatchSize(size int) Option {
+	return func(c *config) {
+		c.batchSize = size
+	}
+}
+
+// WithoutVerification skips the final verification pass.
+func WithoutVerification() Option {
+	return func(c *config) {
+		c.verify = false
+	}
+}
+
+// WithProgress reports the progress after every written batch and during the verification.
+func WithProgress(fn func(Progress)) Option {
+	return func(c *config) {
+		c.progress = fn
+	}
+}
+
+// Copy streams all the keys of src into dst, and verifies afterwards that every
+// key of src is present in dst with the same value. Both stores should be
+// wrapped with the namespace to migrate.
+//
+// The copy is idempotent, so an interrupted copy can be resumed or restarted.
+// Keys written to src during the copy may be missed or fail the verification,
+// the commits should be paused, at least for a final resumed pass.
+func Copy(src, dst database.TreeDB, opts ...Option) (Progress, error) {
+	c := &config{
+		batchSize: defaultBatchSize,
+		verify:    true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	progress, err := copyKeys(src, dst, c)
+	if err != nil || !c.verify {
+		return progress, err
+	}
+	err = verify(src, dst, c, &progress)
+	return progress, err
+}
+
+func copyKeys(src, dst database.TreeDB, c *config) (Progress, error) {
+	var (
+		progress Progress
+		start    []byte
+	)
+	if c.resume != nil {
+		if !bytes.HasPrefix(c.resume, c.prefix) {
+			return progress, stdErrors.Errorf("resume key %x is not within the prefix %x", c.resume, c.prefix)
+		}
+		// the smallest key following the resume key
+		start = append(utils.CopyBytes(c.resume[len(c.prefix):]), 0)
+		progress.LastKey = c.resume
+	}
+
+	it := src.NewIterator(c.prefix, start)
+	defer it.Release()
+
+	var (
+		batch   = dst.NewBatch()
+		pending = 0
+		lastKey []byte
+	)
+	flush := func() error {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		progress.Keys += pending
+		progress.LastKey = lastKey
+		pending = 0
+		if c.progress != nil {
+			c.progress(progress)
+		}
+		return nil
+	}
+	for it.Next() {
+		if err := batch.Set(it.Key(), it.Value()); err != nil {
+			return progress, err
+		}
+		lastKey = utils.CopyBytes(it.Key())
+		progress.Bytes += len(it.Value())
+		pending++
+		if batch.ValueSize() >= c.batchSize {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return progress, err
+	}
+	if pending > 0 {
+		if err := flush(); err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
+
+func verify(src, dst database.TreeDB, c *config, progress *Progress) error {
+	it := src.NewIterator(c.prefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		value, err := dst.Get(it.Key())
+		if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+			return stdErrors.Wrapf(ErrVerificationFailed, "key %x is missing", it.Key())
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(value, it.Value()) {
+			return stdErrors.Wrapf(ErrVerificationFailed, "value of key %x differs", it.Key())
+		}
+		progress.Verified++
+		if c.progress != nil && progress.Verified%1000 == 0 {
+			c.progress(*progress)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if c.progress != nil {
+		c.progress(*progress)
+	}
+	return nil
+}
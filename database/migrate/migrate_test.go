@@ -0,0 +1,68 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package migrate
+
+import (
+	"fmt"
+	"testing"
+
+	stdErrors "github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+
+	wrappedLevelDB "github.com/bnb-chain/zkbnb-smt/database/leveldb"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestCopy(t *testing.T) {
+	src := memory.NewMemoryDB()
+	for i := 0; i < 100; i++ {
+		if err := src.Set([]byte(fmt.Sprintf("t:%03d", i)), []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := wrappedLevelDB.WrapWithNamespace(wrappedLevelDB.NewFromExistLevelDB(ldb), "test")
+
+	// interrupt the copy after the first batch
+	var checkpoint Progress
+	stop := stdErrors.New("stop")
+	func() {
+		defer func() {
+			if r := recover(); r != stop {
+				t.Fatalf("unexpected panic %v", r)
+			}
+		}()
+		Copy(src, dst, WithBatchSize(64), WithProgress(func(p Progress) {
+			checkpoint = p
+			panic(stop)
+		}))
+	}()
+	if checkpoint.Keys == 0 || checkpoint.Keys == 100 {
+		t.Fatalf("the copy should be interrupted after the first batch, copied %d keys", checkpoint.Keys)
+	}
+
+	progress, err := Copy(src, dst, Resume(checkpoint.LastKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Keys+progress.Keys != 100 {
+		t.Fatalf("resumed copy should copy the remaining keys, copied %d+%d", checkpoint.Keys, progress.Keys)
+	}
+	if progress.Verified != 100 {
+		t.Fatalf("all the keys should be verified, got %d", progress.Verified)
+	}
+
+	if err := dst.Set([]byte("t:042"), []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Copy(src, dst, Resume([]byte("t:099"))); !stdErrors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("a differing key should fail the verification, got %v", err)
+	}
+}
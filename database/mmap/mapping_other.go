@@ -0,0 +1,22 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package mmap
+
+import (
+	"os"
+)
+
+// mapFile is not supported on this platform, the segments are read with
+// positioned reads instead.
+func mapFile(*os.File, int64) ([]byte, error) {
+	return nil, nil
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
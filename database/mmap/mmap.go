@@ -0,0 +1,434 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package mmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+
+	// ErrCorruptedSegment is returned if a segment holds a frame that passes
+	// its checksum but cannot be decoded.
+	ErrCorruptedSegment = errors.New("corrupted segment record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+const (
+	// DefaultSegmentSize is the capacity of a segment file, unless configured.
+	DefaultSegmentSize = 64 << 20
+
+	// segmentExt is the file extension of the segment files.
+	segmentExt = ".seg"
+
+	// frameHeaderSize is the size of a frame header, format: ${checksum}${length}
+	frameHeaderSize = 8
+
+	opSet    byte = 1
+	opDelete byte = 2
+)
+
+// Option is a function that configures a memory-mapped database.
+type Option func(*Database)
+
+// WithSegmentSize sets the capacity of the segment files. A batch larger than
+// the capacity is written to a segment of its own.
+func WithSegmentSize(size int64) Option {
+	return func(db *Database) {
+		db.segmentSize = size
+	}
+}
+
+// WithNoSync skips the fsync after every batch, a crash may then lose the
+// most recent batches, but never tears one.
+func WithNoSync() Option {
+	return func(db *Database) {
+		db.noSync = true
+	}
+}
+
+// location is the position of a value in the segments.
+type location struct {
+	segment int
+	offset  int64
+	length  int
+}
+
+// Database is a TreeDB that appends every batch to memory-mapped segment files,
+// and keeps the position of every live key in an in-memory index.
+// Reads are served straight from the mapping without any compaction running
+// in the background, which suits read-mostly archive nodes. The space of
+// overwritten and deleted keys is not reclaimed.
+//
+// A segment is preallocated to its capacity and written with positioned writes,
+// every batch is a single checksummed frame, so a torn batch is discarded when
+// the database is reopened.
+type Database struct {
+	dir         string
+	segmentSize int64
+	noSync      bool
+
+	lock     sync.RWMutex
+	segments []*segment
+	index    map[string]location
+	offset   int64 // the write offset in the last segment
+	closed   bool
+}
+
+// New opens the segments under dir, creating the directory if needed, and
+// rebuilds the index by scanning them.
+func New(dir string, opts ...Option) (*Database, error) {
+	db := &Database{
+		dir:         dir,
+		segmentSize: DefaultSegmentSize,
+		index:       make(map[string]location),
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if name != db.segmentPath(i) {
+			db.release()
+			return nil, errors.Errorf("unexpected segment file %s", name)
+		}
+		seg, err := openSegment(name, 0)
+		if err != nil {
+			db.release()
+			return nil, err
+		}
+		db.segments = append(db.segments, seg)
+		if db.offset, err = db.scan(i); err != nil {
+			db.release()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (db *Database) segmentPath(i int) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%08d%s", i, segmentExt))
+}
+
+// scan indexes the frames of a segment and returns the offset following the
+// last intact frame.
+func (db *Database) scan(i int) (int64, error) {
+	seg := db.segments[i]
+	offset := int64(0)
+	for offset+frameHeaderSize <= seg.size {
+		header := seg.read(offset, frameHeaderSize)
+		checksum := binary.BigEndian.Uint32(header)
+		length := int64(binary.BigEndian.Uint32(header[4:]))
+		if length == 0 || offset+frameHeaderSize+length > seg.size {
+			break
+		}
+		payload := seg.read(offset+frameHeaderSize, int(length))
+		if crc32.Checksum(payload, crcTable) != checksum {
+			break
+		}
+		if err := db.apply(i, offset+frameHeaderSize, payload); err != nil {
+			return 0, err
+		}
+		offset += frameHeaderSize + length
+	}
+	return offset, nil
+}
+
+// apply updates the index with the records of a frame payload located at base.
+func (db *Database) apply(segment int, base int64, payload []byte) error {
+	pos := 0
+	for pos < len(payload) {
+		op := payload[pos]
+		pos++
+		klen, n := binary.Uvarint(payload[pos:])
+		if n <= 0 {
+			return ErrCorruptedSegment
+		}
+		pos += n
+		vlen, n := binary.Uvarint(payload[pos:])
+		if n <= 0 {
+			return ErrCorruptedSegment
+		}
+		pos += n
+		if uint64(len(payload)-pos) < klen+vlen {
+			return ErrCorruptedSegment
+		}
+		key := string(payload[pos : pos+int(klen)])
+		pos += int(klen)
+		switch op {
+		case opSet:
+			db.index[key] = location{segment: segment, offset: base + int64(pos), length: int(vlen)}
+		case opDelete:
+			delete(db.index, key)
+		default:
+			return ErrCorruptedSegment
+		}
+		pos += int(vlen)
+	}
+	return nil
+}
+
+// value returns a copy of the value at the location, the mapping is released
+// once the database is closed.
+func (db *Database) value(loc location) []byte {
+	value := make([]byte, loc.length)
+	copy(value, db.segments[loc.segment].read(loc.offset, loc.length))
+	return value
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return false, database.ErrDatabaseClosed
+	}
+	_, ok := db.index[string(key)]
+	return ok, nil
+}
+
+// Get retrieves the given key from the mapped segments.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, database.ErrDatabaseClosed
+	}
+	loc, ok := db.index[string(key)]
+	if !ok {
+		return nil, database.ErrDatabaseNotFound
+	}
+	return db.value(loc), nil
+}
+
+// MultiGet retrieves the given keys from the mapped segments, a missing key
+// results in a nil value.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, database.ErrDatabaseClosed
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if loc, ok := db.index[string(key)]; ok {
+			values[i] = db.value(loc)
+		}
+	}
+	return values, nil
+}
+
+// Set appends the given value to the segments.
+func (db *Database) Set(key []byte, value []byte) error {
+	b := db.NewBatch()
+	if err := b.Set(key, value); err != nil {
+		return err
+	}
+	return b.Write()
+}
+
+// Delete appends a key removal to the segments.
+func (db *Database) Delete(key []byte) error {
+	b := db.NewBatch()
+	if err := b.Delete(key); err != nil {
+		return err
+	}
+	return b.Write()
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return database.NewErrorIterator(database.ErrDatabaseClosed)
+	}
+	var (
+		pr   = string(prefix)
+		st   = pr + string(start)
+		keys []string
+	)
+	for key := range db.index {
+		if strings.HasPrefix(key, pr) && key >= st {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	byteKeys := make([][]byte, 0, len(keys))
+	values := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		byteKeys = append(byteKeys, []byte(key))
+		values = append(values, db.value(db.index[key]))
+	}
+	return database.NewSliceIterator(byteKeys, values)
+}
+
+// NewBatch creates a batch which is appended as a single frame.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+	}
+}
+
+// Ping reports whether the database is still open.
+func (db *Database) Ping() error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return database.ErrDatabaseClosed
+	}
+	return nil
+}
+
+// Close unmaps and closes the segment files.
+func (db *Database) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	db.index = nil
+	return db.release()
+}
+
+func (db *Database) release() error {
+	var first error
+	for _, seg := range db.segments {
+		if err := seg.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	db.segments = nil
+	return first
+}
+
+// append writes the frame to the last segment, rotating to a new segment if
+// the frame does not fit, and returns the offset of the frame payload.
+func (db *Database) append(frame []byte) (int, int64, error) {
+	size := int64(len(frame))
+	last := len(db.segments) - 1
+	if last < 0 || db.offset+size > db.segments[last].size {
+		capacity := db.segmentSize
+		if capacity < size {
+			capacity = size
+		}
+		seg, err := openSegment(db.segmentPath(last+1), capacity)
+		if err != nil {
+			return 0, 0, err
+		}
+		db.segments = append(db.segments, seg)
+		db.offset = 0
+		last++
+	}
+	seg := db.segments[last]
+	if _, err := seg.file.WriteAt(frame, db.offset); err != nil {
+		return 0, 0, err
+	}
+	if !db.noSync {
+		if err := seg.file.Sync(); err != nil {
+			return 0, 0, err
+		}
+	}
+	offset := db.offset
+	db.offset += size
+	return last, offset + frameHeaderSize, nil
+}
+
+// batch is a write-only batch that is appended to its host database as
+// a single frame when Write is called. A batch cannot be used concurrently.
+type batch struct {
+	db      *Database
+	payload []byte
+	size    int
+}
+
+func (b *batch) record(op byte, key, value []byte) {
+	var lengths [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lengths[:], uint64(len(key)))
+	n += binary.PutUvarint(lengths[n:], uint64(len(value)))
+	b.payload = append(b.payload, op)
+	b.payload = append(b.payload, lengths[:n]...)
+	b.payload = append(b.payload, key...)
+	b.payload = append(b.payload, value...)
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.record(opSet, key, value)
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.record(opDelete, key, nil)
+	b.size += len(key)
+	return nil
+}
+
+// Write appends the batch as a single checksummed frame and updates the index.
+func (b *batch) Write() error {
+	if len(b.payload) == 0 {
+		return nil
+	}
+	frame := make([]byte, frameHeaderSize+len(b.payload))
+	binary.BigEndian.PutUint32(frame, crc32.Checksum(b.payload, crcTable))
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(b.payload)))
+	copy(frame[frameHeaderSize:], b.payload)
+
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	if b.db.closed {
+		return database.ErrDatabaseClosed
+	}
+	segment, base, err := b.db.append(frame)
+	if err != nil {
+		return err
+	}
+	return b.db.apply(segment, base, b.payload)
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.payload = b.payload[:0]
+	b.size = 0
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package mmap
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+)
+
+func TestMmapDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			db, err := New(t.TempDir(), WithSegmentSize(64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+func TestMmapDBReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, WithSegmentSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 32; i++ {
+		if err := db.Set([]byte{byte(i)}, bytes.Repeat([]byte{byte(i)}, 16)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete([]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.segments) < 2 {
+		t.Fatalf("segments should be rotated, got %d", len(db.segments))
+	}
+	last := db.segmentPath(len(db.segments) - 1)
+	offset := db.offset
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte{1}); err != database.ErrDatabaseClosed {
+		t.Fatalf("closed database should be reported, got %v", err)
+	}
+
+	// tear a trailing frame, it is discarded on reopen
+	file, err := os.OpenFile(last, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{0xde, 0xad, 0, 0, 0, 8, 1}, offset); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	db, err = New(dir, WithSegmentSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.offset != offset {
+		t.Fatalf("torn frame should be discarded, offset %d, want %d", db.offset, offset)
+	}
+	for i := 0; i < 32; i++ {
+		val, err := db.Get([]byte{byte(i)})
+		if i == 3 {
+			if err != database.ErrDatabaseNotFound {
+				t.Fatalf("deleted key should stay deleted, got %v", err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(val, bytes.Repeat([]byte{byte(i)}, 16)) {
+			t.Fatalf("key %d not restored, got %x %v", i, val, err)
+		}
+	}
+	if err := db.Set([]byte("next"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := db.Get([]byte("next")); err != nil || !bytes.Equal(val, []byte("value")) {
+		t.Fatalf("write after reopen failed, got %q %v", val, err)
+	}
+}
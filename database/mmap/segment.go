@@ -0,0 +1,70 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package mmap
+
+import (
+	"os"
+)
+
+// segment is a preallocated segment file and its read-only mapping.
+type segment struct {
+	file *os.File
+	data []byte // nil if the platform does not support mappings
+	size int64
+}
+
+// openSegment opens the segment file, a non-zero capacity creates or extends
+// the file to the capacity.
+func openSegment(path string, capacity int64) (*segment, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	if capacity > 0 {
+		if err := file.Truncate(capacity); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	seg := &segment{file: file, size: info.Size()}
+	if seg.size > 0 {
+		if seg.data, err = mapFile(file, seg.size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return seg, nil
+}
+
+// read returns n bytes at the offset, the result aliases the mapping and must
+// not be retained after the segment is closed.
+func (s *segment) read(offset int64, n int) []byte {
+	if s.data != nil {
+		return s.data[offset : offset+int64(n)]
+	}
+	buf := make([]byte, n)
+	if _, err := s.file.ReadAt(buf, offset); err != nil {
+		// the range is within the preallocated file, a failed read
+		// is returned as zeros, which never pass the frame checksum
+		return make([]byte, n)
+	}
+	return buf
+}
+
+func (s *segment) close() error {
+	if s.data != nil {
+		if err := unmapFile(s.data); err != nil {
+			return err
+		}
+		s.data = nil
+	}
+	return s.file.Close()
+}
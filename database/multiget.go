@@ -0,0 +1,28 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package database
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SequentialMultiGet retrieves the keys one by one, for the stores without
+// a batched read. The values are returned in the order of the keys,
+// a missing key has a nil value.
+func SequentialMultiGet(r KeyValueReader, keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := r.Get(key)
+		if errors.Is(err, ErrDatabaseNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+
+	// ErrCorruptedObject is returned if the content of a downloaded object
+	// does not match the digest it is addressed by.
+	ErrCorruptedObject = stdErrors.New("object content does not match its digest")
+
+	// ErrInvalidRecord is returned if a record in the local store cannot be decoded.
+	ErrInvalidRecord = stdErrors.New("invalid object record")
+)
+
+const (
+	// recordInline marks a local record holding the value itself.
+	recordInline byte = iota
+	// recordObject marks a local record holding the digest of an offloaded object.
+	recordObject
+)
+
+// Option is a function that configures the object storage tier.
+type Option func(*Database)
+
+// WithObjectPrefix sets the prefix of the object names, e.g. a bucket folder.
+func WithObjectPrefix(prefix string) Option {
+	return func(db *Database) {
+		db.prefix = prefix
+	}
+}
+
+// Database is a TreeDB that keeps every key in a fast local store, while the
+// values of cold keys can be offloaded as content-addressed objects to an ObjectStore.
+// Offloaded keys only occupy a small reference record in the local store and
+// are transparently downloaded on read. A tree created with the bsmt.OffloadReleased
+// option offloads the nodes its GC releases from memory.
+//
+// Values are stored with a one byte record header, so an existing local store
+// can not be wrapped without migrating its data.
+type Database struct {
+	local  database.TreeDB
+	store  ObjectStore
+	prefix string
+}
+
+// New returns a TreeDB that combines the local store with the object storage cold tier.
+func New(local database.TreeDB, store ObjectStore, opts ...Option) *Database {
+	db := &Database{
+		local: local,
+		store: store,
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db
+}
+
+func (db *Database) objectName(digest []byte) string {
+	return db.prefix + hex.EncodeToString(digest)
+}
+
+func encodeInline(value []byte) []byte {
+	record := make([]byte, len(value)+1)
+	record[0] = recordInline
+	copy(record[1:], value)
+	return record
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.local.Has(key)
+}
+
+// Get retrieves the given key from the local store, downloading the value
+// from the object store if the key has been offloaded.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	record, err := db.local.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return db.decode(record)
+}
+
+// MultiGet retrieves the given keys from the local store, downloading the
+// values of the offloaded keys.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	records, err := db.local.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		if record == nil {
+			continue
+		}
+		if records[i], err = db.decode(record); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// decode returns the value of a local record, downloading the offloaded values.
+func (db *Database) decode(record []byte) ([]byte, error) {
+	if len(record) == 0 {
+		return nil, ErrInvalidRecord
+	}
+
+	switch record[0] {
+	case recordInline:
+		return record[1:], nil
+	case recordObject:
+		digest := record[1:]
+		if len(digest) != sha256.Size {
+			return nil, ErrInvalidRecord
+		}
+		value, err := db.store.GetObject(context.Background(), db.objectName(digest))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(value)
+		if !bytes.Equal(sum[:], digest) {
+			return nil, ErrCorruptedObject
+		}
+		return value, nil
+	default:
+		return nil, ErrInvalidRecord
+	}
+}
+
+// Set inserts the given value into the local store.
+func (db *Database) Set(key []byte, value []byte) error {
+	return db.local.Set(key, encodeInline(value))
+}
+
+// Delete removes the key from the local store. The offloaded object is kept,
+// since the same content may be referenced by other keys.
+func (db *Database) Delete(key []byte) error {
+	return db.local.Delete(key)
+}
+
+// Offload uploads the values of the given keys to the object store and replaces
+// the local records with references. Keys that are missing or already offloaded are skipped.
+// The keys must not be written concurrently, otherwise a newer value may be replaced
+// with a reference to the offloaded one.
+func (db *Database) Offload(keys ...[]byte) error {
+	b := db.local.NewBatch()
+	for _, key := range keys {
+		record, err := db.local.Get(key)
+		if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) == 0 {
+			return ErrInvalidRecord
+		}
+		if record[0] != recordInline {
+			continue
+		}
+
+		sum := sha256.Sum256(record[1:])
+		err = db.store.PutObject(context.Background(), db.objectName(sum[:]), record[1:])
+		if err != nil {
+			return err
+		}
+		err = b.Set(key, append([]byte{recordObject}, sum[:]...))
+		if err != nil {
+			return err
+		}
+	}
+	return b.Write()
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The offloaded values are downloaded while iterating.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return database.NewTransformIterator(db.local.NewIterator(prefix, start), func(_, record []byte) ([]byte, error) {
+		return db.decode(record)
+	})
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		b: db.local.NewBatch(),
+	}
+}
+
+// Ping checks the local store, the object store is only reached on demand.
+func (db *Database) Ping() error {
+	return db.local.Ping()
+}
+
+// Close closes the local store.
+func (db *Database) Close() error {
+	return db.local.Close()
+}
+
+// batch encodes the values as inline records and writes them to the local store.
+type batch struct {
+	b database.Batcher
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	return b.b.Set(key, encodeInline(value))
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	return b.b.Delete(key)
+}
+
+// Write flushes any accumulated data to the local store.
+func (b *batch) Write() error {
+	return b.b.Write()
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestObjectStore(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			store, err := NewDirStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return New(memory.NewMemoryDB(), store)
+		})
+	})
+}
+
+func TestObjectStoreOffload(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := memory.NewMemoryDB()
+	db := New(local, store, WithObjectPrefix("nodes-"))
+	defer db.Close()
+
+	key, value := []byte("foo"), []byte("hello world")
+	if err := db.Set(key, value); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Offload(key, []byte("missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := local.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record[0] != recordObject {
+		t.Fatalf("key should be offloaded, got record type %d", record[0])
+	}
+
+	if got, err := db.Get(key); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, value) {
+		t.Fatalf("wrong value: %q", got)
+	}
+
+	// tamper the object
+	if err := store.PutObject(context.Background(), db.objectName(record[1:]), []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(key); err != ErrCorruptedObject {
+		t.Fatalf("expected corrupted object error, got %v", err)
+	}
+}
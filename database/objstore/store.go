@@ -0,0 +1,90 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package objstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	stdErrors "github.com/pkg/errors"
+)
+
+var (
+	// ErrObjectNotFound is returned by an ObjectStore if the requested object does not exist.
+	ErrObjectNotFound = stdErrors.New("object not found")
+
+	_ ObjectStore = (*DirStore)(nil)
+)
+
+// ObjectStore is the minimal set of operations required from an object storage
+// service (S3, GCS, Azure Blob, ...). Objects are written once and never modified,
+// so eventual consistency of overwrites is not a concern for implementations.
+type ObjectStore interface {
+	// PutObject uploads the data under the given name.
+	PutObject(ctx context.Context, name string, data []byte) error
+
+	// GetObject downloads the named object, returning ErrObjectNotFound if it does not exist.
+	GetObject(ctx context.Context, name string) ([]byte, error)
+
+	// DeleteObject removes the named object. Deleting a missing object is not an error.
+	DeleteObject(ctx context.Context, name string) error
+}
+
+// DirStore is an ObjectStore backed by a local directory, one file per object.
+// It is useful for tests and for object storage mounted into the filesystem.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns an ObjectStore that keeps objects under dir, creating it if needed.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
+
+// PutObject writes the object to a temporary file and renames it into place,
+// so readers never observe a partially written object.
+func (s *DirStore) PutObject(_ context.Context, name string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(name))
+}
+
+// GetObject reads the object from disk.
+func (s *DirStore) GetObject(_ context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return data, err
+}
+
+// DeleteObject removes the object file.
+func (s *DirStore) DeleteObject(_ context.Context, name string) error {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
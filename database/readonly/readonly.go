@@ -0,0 +1,85 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package readonly
+
+import (
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+)
+
+// Database is a TreeDB decorator rejecting every write with
+// database.ErrReadOnly, to inspect the database of a running tree on any
+// backend without the risk of altering it.
+type Database struct {
+	db database.TreeDB
+}
+
+// Wrap returns the read-only view of the database.
+func Wrap(db database.TreeDB) *Database {
+	return &Database{db: db}
+}
+
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.db.Has(key)
+}
+
+func (db *Database) Get(key []byte) ([]byte, error) {
+	return db.db.Get(key)
+}
+
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	return db.db.MultiGet(keys)
+}
+
+func (db *Database) Set([]byte, []byte) error {
+	return database.ErrReadOnly
+}
+
+func (db *Database) Delete([]byte) error {
+	return database.ErrReadOnly
+}
+
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return db.db.NewIterator(prefix, start)
+}
+
+// NewBatch returns a batch rejecting the writes, the empty batch is written
+// without error.
+func (db *Database) NewBatch() database.Batcher {
+	return batch{}
+}
+
+func (db *Database) Ping() error {
+	return db.db.Ping()
+}
+
+func (db *Database) Close() error {
+	return db.db.Close()
+}
+
+type batch struct{}
+
+func (batch) Set([]byte, []byte) error {
+	return database.ErrReadOnly
+}
+
+func (batch) Delete([]byte) error {
+	return database.ErrReadOnly
+}
+
+func (batch) Write() error {
+	return nil
+}
+
+func (batch) Reset() {}
+
+func (batch) ValueSize() int {
+	return 0
+}
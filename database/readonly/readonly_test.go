@@ -0,0 +1,47 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package readonly
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestReadOnly(t *testing.T) {
+	mem := memory.NewMemoryDB()
+	if err := mem.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	db := Wrap(mem)
+	if value, err := db.Get([]byte("key")); err != nil || !bytes.Equal(value, []byte("value")) {
+		t.Fatalf("unexpected value %q, %v", value, err)
+	}
+	it := db.NewIterator([]byte("k"), nil)
+	if !it.Next() || !bytes.Equal(it.Key(), []byte("key")) {
+		t.Fatal("expected the key to be iterated")
+	}
+	it.Release()
+
+	if err := db.Set([]byte("key"), []byte("other")); err != database.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := db.Delete([]byte("key")); err != database.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	batch := db.NewBatch()
+	if err := batch.Set([]byte("key"), []byte("other")); err != database.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := mem.Get([]byte("key")); !bytes.Equal(value, []byte("value")) {
+		t.Fatalf("the value is changed to %q", value)
+	}
+}
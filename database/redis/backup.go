@@ -0,0 +1,127 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package redis
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var _ database.Backuper = (*Database)(nil)
+
+const (
+	// BackupFormatDump is the format of the backups holding the DUMP payloads of
+	// the keys, prefixed by their remaining time to live in milliseconds.
+	// The payloads can only be restored into a Redis with a compatible RDB version.
+	BackupFormatDump = "redis-dump"
+
+	// backupPageSize is the number of keys dumped or restored in one pipeline.
+	backupPageSize = 128
+)
+
+// Backup writes the DUMP payloads of the keys of the namespace to w. Redis has no
+// snapshots, so the keys are dumped one page after the other while commits continue.
+func (db *Database) Backup(w io.Writer) error {
+	ctx := context.Background()
+	full := db.wrapKey(nil)
+	keys, err := db.scan(ctx, escapeGlob(full)+"*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	bw, err := database.NewBackupWriter(w, BackupFormatDump)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += backupPageSize {
+		end := start + backupPageSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		pipe := db.db.Pipeline()
+		dumps := make([]*redis.StringCmd, 0, end-start)
+		ttls := make([]*redis.DurationCmd, 0, end-start)
+		for _, key := range keys[start:end] {
+			dumps = append(dumps, pipe.Dump(ctx, key))
+			ttls = append(ttls, pipe.PTTL(ctx, key))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !stdErrors.Is(err, redis.Nil) {
+			return err
+		}
+
+		for i, key := range keys[start:end] {
+			payload, err := dumps[i].Bytes()
+			if stdErrors.Is(err, redis.Nil) {
+				// deleted since the scan
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			record := make([]byte, 8+len(payload))
+			if ttl := ttls[i].Val(); ttl > 0 {
+				binary.BigEndian.PutUint64(record, uint64(ttl.Milliseconds()))
+			}
+			copy(record[8:], payload)
+			if err := bw.Add([]byte(key[len(full):]), record); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Close()
+}
+
+// Restore writes the keys of a backup into the namespace, replacing the existing
+// ones. Both the DUMP backups and the portable backups are supported.
+func (db *Database) Restore(r io.Reader) error {
+	br, err := database.NewBackupReader(r)
+	if err != nil {
+		return err
+	}
+	switch br.Format() {
+	case database.BackupFormatKV:
+		return database.RestoreKV(db, br)
+	case BackupFormatDump:
+	default:
+		return database.ErrUnsupportedBackupFormat
+	}
+
+	ctx := context.Background()
+	pipe, queued := db.db.Pipeline(), 0
+	for {
+		key, record, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < 8 {
+			return database.ErrInvalidBackup
+		}
+		ttl := time.Duration(binary.BigEndian.Uint64(record)) * time.Millisecond
+		pipe.RestoreReplace(ctx, db.wrapKey(key), ttl, string(record[8:]))
+		if queued++; queued >= backupPageSize {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return err
+			}
+			pipe, queued = db.db.Pipeline(), 0
+		}
+	}
+	if queued > 0 {
+		_, err = pipe.Exec(ctx)
+	}
+	return err
+}
@@ -30,6 +30,9 @@ type RedisClient interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
 	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
 	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	PTTL(ctx context.Context, key string) *redis.DurationCmd
+	Dump(ctx context.Context, key string) *redis.StringCmd
+	RestoreReplace(ctx context.Context, key string, ttl time.Duration, value string) *redis.StatusCmd
 	ExpireAt(ctx context.Context, key string, tm time.Time) *redis.BoolCmd
 	Del(ctx context.Context, keys ...string) *redis.IntCmd
 	Get(ctx context.Context, key string) *redis.StringCmd
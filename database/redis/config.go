@@ -6,12 +6,21 @@
 package redis
 
 import (
+	"crypto/tls"
 	"time"
 )
 
 type RedisConfig struct {
 	ClusterAddr []string
 	Addr        string
+
+	// The master name and the sentinel addresses of a Sentinel deployment.
+	// If set, a failover client following the current master is created.
+	MasterName    string
+	SentinelAddrs []string
+	// Optional credentials of the sentinel nodes.
+	SentinelUsername string
+	SentinelPassword string
 	// Use the specified Username to authenticate the current connection
 	// with one of the connections defined in the ACL list when connecting
 	// to a Redis 6.0 instance, or greater, that is using the Redis ACL system.
@@ -21,12 +30,28 @@ type RedisConfig struct {
 	// or the User Password when connecting to a Redis 6.0 instance, or greater,
 	// that is using the Redis ACL system.
 	Password string
+	// Database to be selected after connecting to the server, not supported in cluster mode.
+	DB int
+	// TLS Config to use. When set TLS will be negotiated.
+	TLSConfig *tls.Config
 
 	// The maximum number of retries before giving up. Command is retried
 	// on network errors and MOVED/ASK redirects.
 	// Default is 3 retries.
 	MaxRedirects int
 
+	// Number of leading bytes of the keys hash tagged along with the namespace,
+	// e.g. `{namespace:ab}cd` for the key `abcd` and a prefix of 2, so the keys
+	// sharing a prefix are mapped to the same cluster slot. With the compact
+	// node keys, a prefix of 2 groups the nodes of a level by the top byte of
+	// their path. Zero maps every key to its own slot. Only used in cluster mode.
+	//
+	// A cluster applies a batch as one MULTI/EXEC transaction per slot, so the
+	// batches spanning several slots, such as the commit of a version, are not
+	// atomic. Hash tagging the whole namespace would keep them atomic at the
+	// cost of storing the whole tree in a single slot, thus on a single node.
+	HashTagPrefix int
+
 	// Enables read-only commands on slave nodes.
 	ReadOnly bool
 	// Allows routing read-only commands to the closest master or slave node.
@@ -46,7 +71,23 @@ type RedisConfig struct {
 	// Default is 512 milliseconds; -1 disables backoff.
 	MaxRetryBackoff time.Duration
 
-	// Dial timeout for establishing new connections.
+	// Maximum number of retries of a failed batch write, batch writes are
+	// replayed on failover errors such as READONLY, MOVED or connection resets.
+	// Default is 3 retries; -1 (not 0) disables retries.
+	MaxWriteRetries int
+	// Backoff between batch write retries, multiplied by the number of the attempt.
+	// Default is 100 milliseconds.
+	WriteRetryBackoff time.Duration
+
+	// Flush the pipeline of a batch every PipelineMaxCommands queued commands
+	// or PipelineMaxBytes queued bytes, bounding the memory of large commits.
+	// A flushed batch is no longer applied atomically.
+	// Default is 0, the pipeline is only flushed when the batch is written.
+	PipelineMaxCommands int
+	PipelineMaxBytes    int
+
+	// Dial timeout for establishing new connections,
+	// also used as the timeout of the connectivity check in New.
 	// Default is 5 seconds.
 	DialTimeout time.Duration
 	// Timeout for socket reads. If reached, commands will fail
@@ -0,0 +1,212 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package redis
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var _ database.Iterator = (*iterator)(nil)
+
+const (
+	// scanCount is the number of keys requested per SCAN call.
+	scanCount = 1000
+
+	// iteratorPageSize is the number of values fetched in one pipeline by an iterator.
+	iteratorPageSize = 128
+)
+
+// escapeGlob escapes the glob-style special characters of a SCAN pattern.
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\', '^':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// scan collects the storage keys matching the pattern. In cluster mode,
+// every master node is scanned.
+func (db *Database) scan(ctx context.Context, pattern string) ([]string, error) {
+	var (
+		lock sync.Mutex
+		keys []string
+	)
+	scanNode := func(ctx context.Context, client RedisClient) error {
+		var cursor uint64
+		for {
+			page, next, err := client.Scan(ctx, cursor, pattern, scanCount).Result()
+			if err != nil {
+				return err
+			}
+			lock.Lock()
+			keys = append(keys, page...)
+			lock.Unlock()
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+
+	if cluster, ok := db.db.(*redis.ClusterClient); ok {
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scanNode(ctx, client)
+		})
+		return keys, err
+	}
+	return keys, scanNode(ctx, db.db)
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+//
+// Redis does not keep its keys ordered, so the matching keys are collected
+// with SCAN and sorted in memory, the values are fetched while iterating.
+// Keys written after the creation of the iterator may be missed, and keys
+// deleted meanwhile are skipped.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	first := string(prefix) + string(start)
+
+	keys, err := db.scan(context.Background(), db.scanPattern(prefix))
+	if err != nil {
+		return database.NewErrorIterator(err)
+	}
+	// the keys are sorted without their hash tags, which do not preserve the
+	// order, and deduplicated since SCAN may return a key several times
+	sorted := make([]iteratedKey, 0, len(keys))
+	for _, key := range keys {
+		if unwrapped := db.unwrapKey(key); string(unwrapped) >= first {
+			sorted = append(sorted, iteratedKey{key: unwrapped, storage: key})
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].key, sorted[j].key) < 0
+	})
+	matched := make([]iteratedKey, 0, len(sorted))
+	for i, key := range sorted {
+		if i == 0 || key.storage != sorted[i-1].storage {
+			matched = append(matched, key)
+		}
+	}
+	return &iterator{
+		db:    db,
+		keys:  matched,
+		index: -1,
+	}
+}
+
+// iteratedKey is a key of an iterator along with its storage key.
+type iteratedKey struct {
+	key     []byte
+	storage string
+}
+
+// iterator iterates over the sorted storage keys, fetching the values page by page.
+type iterator struct {
+	db     *Database
+	keys   []iteratedKey
+	values [][]byte
+	exists []bool
+	offset int // index of the first key of the fetched page
+	index  int
+	err    error
+}
+
+// fetch retrieves the values of the page starting at the given index.
+func (it *iterator) fetch(from int) error {
+	to := from + iteratorPageSize
+	if to > len(it.keys) {
+		to = len(it.keys)
+	}
+	ctx := context.Background()
+	pipe := it.db.db.Pipeline()
+	cmds := make([]*redis.StringCmd, 0, to-from)
+	for _, key := range it.keys[from:to] {
+		cmds = append(cmds, pipe.Get(ctx, key.storage))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !stdErrors.Is(err, redis.Nil) {
+		return err
+	}
+
+	it.offset = from
+	it.values = it.values[:0]
+	it.exists = it.exists[:0]
+	for _, cmd := range cmds {
+		value, err := cmd.Bytes()
+		if err != nil && !stdErrors.Is(err, redis.Nil) {
+			return err
+		}
+		it.values = append(it.values, value)
+		it.exists = append(it.exists, err == nil)
+	}
+	return nil
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *iterator) Next() bool {
+	for it.err == nil {
+		it.index++
+		if it.index >= len(it.keys) {
+			it.index = len(it.keys)
+			return false
+		}
+		if it.index >= it.offset+len(it.values) {
+			if it.err = it.fetch(it.index); it.err != nil {
+				return false
+			}
+		}
+		if it.exists[it.index-it.offset] {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns any accumulated error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+func (it *iterator) valid() bool {
+	return it.err == nil && it.index >= 0 && it.index < len(it.keys) && it.index < it.offset+len(it.values)
+}
+
+// Key returns the key of the current key/value pair without namespace, or nil if done.
+func (it *iterator) Key() []byte {
+	if !it.valid() {
+		return nil
+	}
+	return it.keys[it.index].key
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if !it.valid() {
+		return nil
+	}
+	return it.values[it.index-it.offset]
+}
+
+// Release releases the collected keys and values.
+func (it *iterator) Release() {
+	it.index = len(it.keys)
+	it.keys, it.values, it.exists = nil, nil, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package redis
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var _ database.NamespaceManager = (*Database)(nil)
+
+// dropChunkSize is the number of keys deleted by a single DEL command.
+const dropChunkSize = 1000
+
+// namespaceOf returns the namespace of a storage key, which is followed by the
+// separator, inside the hash tag of the hash tagged keys.
+func namespaceOf(key string) (string, bool) {
+	if strings.HasPrefix(key, "{") {
+		if i := strings.IndexAny(key[1:], ":}"); i >= 0 && key[1+i] == ':' {
+			return key[1 : 1+i], true
+		}
+		return "", false
+	}
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i], true
+	}
+	return "", false
+}
+
+// Namespaces lists the namespaces of the Redis database by scanning all its keys.
+// Keys written without namespace are reported by the part preceding their
+// first separator, e.g. `t` for tree nodes.
+func (db *Database) Namespaces() ([]string, error) {
+	keys, err := db.scan(context.Background(), "*")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	namespaces := make([]string, 0)
+	for _, key := range keys {
+		ns, ok := namespaceOf(key)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[ns]; !ok {
+			seen[ns] = struct{}{}
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// DropNamespace deletes all the keys of the namespace. The keys are deleted in a
+// single MULTI/EXEC transaction, except for a cluster where the keys are spread
+// across slots and are deleted one by one.
+func (db *Database) DropNamespace(namespace string) error {
+	if len(namespace) == 0 {
+		return database.ErrEmptyNamespace
+	}
+	ns := *db
+	ns.namespace = []byte(namespace)
+
+	ctx := context.Background()
+	keys, err := db.scan(ctx, ns.scanPattern(nil))
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	if _, cluster := db.db.(*redis.ClusterClient); cluster {
+		_, err = db.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		return err
+	}
+	_, err = db.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for start := 0; start < len(keys); start += dropChunkSize {
+			end := start + dropChunkSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+			pipe.Del(ctx, keys[start:end]...)
+		}
+		return nil
+	})
+	return err
+}
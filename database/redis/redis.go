@@ -8,6 +8,11 @@ package redis
 import (
 	"bytes"
 	"context"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	stdErrors "github.com/pkg/errors"
@@ -21,6 +26,35 @@ var (
 	_ database.Batcher = (*batch)(nil)
 )
 
+const (
+	defaultDialTimeout  = 5 * time.Second
+	defaultWriteRetries = 3
+	defaultWriteBackoff = 100 * time.Millisecond
+)
+
+// failoverErrPrefixes are the prefixes of the redis errors returned
+// during a master failover or a slot migration.
+var failoverErrPrefixes = []string{"READONLY ", "MOVED ", "ASK ", "LOADING ", "TRYAGAIN ", "CLUSTERDOWN ", "MASTERDOWN "}
+
+// isRetryableError reports whether a failed write may succeed after a failover.
+func isRetryableError(err error) bool {
+	if stdErrors.Is(err, io.EOF) || stdErrors.Is(err, io.ErrUnexpectedEOF) ||
+		stdErrors.Is(err, syscall.ECONNRESET) || stdErrors.Is(err, syscall.ECONNREFUSED) || stdErrors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if stdErrors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, prefix := range failoverErrPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // New returns a wrapped Redis object.
 func New(config *RedisConfig, opts ...Option) (*Database, error) {
 	var client RedisClient
@@ -47,11 +81,40 @@ func New(config *RedisConfig, opts ...Option) (*Database, error) {
 			PoolTimeout:        config.PoolTimeout,
 			IdleTimeout:        config.IdleTimeout,
 			IdleCheckFrequency: config.IdleCheckFrequency,
+			TLSConfig:          config.TLSConfig,
+		})
+	} else if len(config.MasterName) > 0 {
+		// sentinel mode
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:         config.MasterName,
+			SentinelAddrs:      config.SentinelAddrs,
+			SentinelUsername:   config.SentinelUsername,
+			SentinelPassword:   config.SentinelPassword,
+			DB:                 config.DB,
+			RouteByLatency:     config.RouteByLatency,
+			RouteRandomly:      config.RouteRandomly,
+			PoolSize:           config.PoolSize,
+			Username:           config.Username,
+			Password:           config.Password,
+			MaxRetries:         config.MaxRetries,
+			MinRetryBackoff:    config.MinRetryBackoff,
+			MaxRetryBackoff:    config.MaxRetryBackoff,
+			DialTimeout:        config.DialTimeout,
+			ReadTimeout:        config.ReadTimeout,
+			WriteTimeout:       config.WriteTimeout,
+			MinIdleConns:       config.MinIdleConns,
+			MaxConnAge:         config.MaxConnAge,
+			PoolFIFO:           config.PoolFIFO,
+			PoolTimeout:        config.PoolTimeout,
+			IdleTimeout:        config.IdleTimeout,
+			IdleCheckFrequency: config.IdleCheckFrequency,
+			TLSConfig:          config.TLSConfig,
 		})
 	} else {
 		// single node mode
 		client = redis.NewClient(&redis.Options{
 			Addr:               config.Addr,
+			DB:                 config.DB,
 			PoolSize:           config.PoolSize,
 			Username:           config.Username,
 			Password:           config.Password,
@@ -67,43 +130,93 @@ func New(config *RedisConfig, opts ...Option) (*Database, error) {
 			PoolTimeout:        config.PoolTimeout,
 			IdleTimeout:        config.IdleTimeout,
 			IdleCheckFrequency: config.IdleCheckFrequency,
+			TLSConfig:          config.TLSConfig,
 		})
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), config.DialTimeout)
+	timeout := config.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	err := client.Ping(ctx).Err()
 	if err != nil {
-		return nil, err
+		client.Close()
+		return nil, stdErrors.Wrap(err, "failed to connect to redis")
 	}
 
 	for _, opt := range opts {
 		opt.Apply(client)
 	}
 
-	return &Database{
-		db: client,
-	}, nil
+	db := NewFromExistRedisClient(client)
+	if len(config.ClusterAddr) > 0 {
+		db.hashTagPrefix = config.HashTagPrefix
+	}
+	if config.MaxWriteRetries != 0 {
+		db.writeRetries = config.MaxWriteRetries
+	}
+	if config.WriteRetryBackoff > 0 {
+		db.writeBackoff = config.WriteRetryBackoff
+	}
+	db.flushCommands = config.PipelineMaxCommands
+	db.flushBytes = config.PipelineMaxBytes
+	return db, nil
 }
 
 // NewFromExistRedisClient returns a wrapped Redis object.
 func NewFromExistRedisClient(db RedisClient) *Database {
 	return &Database{
-		db: db,
+		db:           db,
+		writeRetries: defaultWriteRetries,
+		writeBackoff: defaultWriteBackoff,
+	}
+}
+
+// NewFromExistRedisClusterClient returns a wrapped Redis object on a cluster client.
+// The keys are not hash tagged, every key is mapped to its own slot, see WrapWithHashTagPrefix.
+func NewFromExistRedisClusterClient(db *redis.ClusterClient) *Database {
+	return &Database{
+		db:           db,
+		writeRetries: defaultWriteRetries,
+		writeBackoff: defaultWriteBackoff,
 	}
 }
 
 // WrapWithNamespace returns a wrapped Redis object.
 // The namespace is the prefix that the datastore.
 func WrapWithNamespace(db *Database, namespace string) *Database {
-	return &Database{
-		namespace: []byte(namespace),
-		db:        db.db,
-	}
+	wrapped := *db
+	wrapped.namespace = []byte(namespace)
+	return &wrapped
+}
+
+// WrapWithPipelineLimits returns a wrapped Redis object whose batches flush
+// the pipeline every commands queued commands or bytes queued bytes,
+// zero disables the corresponding limit.
+func WrapWithPipelineLimits(db *Database, commands, bytes int) *Database {
+	wrapped := *db
+	wrapped.flushCommands = commands
+	wrapped.flushBytes = bytes
+	return &wrapped
+}
+
+// WrapWithHashTagPrefix returns a wrapped Redis object which hash tags the
+// namespace with the first prefix bytes of every key, see RedisConfig.HashTagPrefix.
+func WrapWithHashTagPrefix(db *Database, prefix int) *Database {
+	wrapped := *db
+	wrapped.hashTagPrefix = prefix
+	return &wrapped
 }
 
 type Database struct {
-	namespace []byte
-	db        RedisClient // redis client
+	namespace     []byte
+	db            RedisClient // redis client
+	hashTagPrefix int
+	writeRetries  int
+	writeBackoff  time.Duration
+	flushCommands int
+	flushBytes    int
 }
 
 // wrapKey returns a wrapper key with namespace.
@@ -114,6 +227,68 @@ func wrapKey(namespace, key []byte) string {
 	return utils.BytesToString(key)
 }
 
+// wrapHashTagKey returns a wrapper key whose namespace and first prefix bytes
+// are hash tagged, e.g. `{namespace:ab}cd` for the key `abcd` and a prefix of 2.
+func wrapHashTagKey(namespace, key []byte, prefix int) string {
+	if prefix > len(key) {
+		prefix = len(key)
+	}
+	buf := make([]byte, 0, len(namespace)+len(key)+3)
+	buf = append(buf, '{')
+	if len(namespace) > 0 {
+		buf = append(buf, namespace...)
+		buf = append(buf, ':')
+	}
+	buf = append(buf, key[:prefix]...)
+	buf = append(buf, '}')
+	buf = append(buf, key[prefix:]...)
+	return utils.BytesToString(buf)
+}
+
+// wrapKey returns the storage key of the given key.
+func (db *Database) wrapKey(key []byte) string {
+	if db.hashTagPrefix > 0 {
+		return wrapHashTagKey(db.namespace, key, db.hashTagPrefix)
+	}
+	return wrapKey(db.namespace, key)
+}
+
+// unwrapKey returns the key of the given storage key.
+func (db *Database) unwrapKey(key string) []byte {
+	if db.hashTagPrefix == 0 {
+		if len(db.namespace) > 0 {
+			key = key[len(db.namespace)+1:]
+		}
+		return []byte(key)
+	}
+	// strips the opening brace of the tag and the namespace, then the closing
+	// brace which follows the first hashTagPrefix bytes of the key
+	key = key[1:]
+	if len(db.namespace) > 0 {
+		key = key[len(db.namespace)+1:]
+	}
+	prefix := db.hashTagPrefix
+	if prefix > len(key)-1 {
+		prefix = len(key) - 1
+	}
+	return []byte(key[:prefix] + key[prefix+1:])
+}
+
+// scanPattern returns the SCAN pattern matching the storage keys starting with prefix.
+func (db *Database) scanPattern(prefix []byte) string {
+	full := db.wrapKey(prefix)
+	if db.hashTagPrefix > len(prefix) {
+		// the keys longer than the prefix continue the tag
+		full = full[:len(full)-1]
+	}
+	return escapeGlob(full) + "*"
+}
+
+// Ping checks that the redis server is reachable.
+func (db *Database) Ping() error {
+	return db.db.Ping(context.Background()).Err()
+}
+
 // Close flushes any pending data to disk and closes
 // all io accesses to the underlying key-value store.
 func (db *Database) Close() error {
@@ -122,7 +297,7 @@ func (db *Database) Close() error {
 
 // Has retrieves if a key is present in the key-value store.
 func (db *Database) Has(key []byte) (bool, error) {
-	dat, err := db.db.Exists(context.Background(), wrapKey(db.namespace, key)).Result()
+	dat, err := db.db.Exists(context.Background(), db.wrapKey(key)).Result()
 	if err != nil {
 		return false, err
 	}
@@ -131,59 +306,144 @@ func (db *Database) Has(key []byte) (bool, error) {
 
 // Get retrieves the given key if it's present in the key-value store.
 func (db *Database) Get(key []byte) ([]byte, error) {
-	dat, err := db.db.Get(context.Background(), wrapKey(db.namespace, key)).Result()
+	dat, err := db.db.Get(context.Background(), db.wrapKey(key)).Result()
 	if err != nil && stdErrors.Is(redis.Nil, err) {
 		return nil, database.ErrDatabaseNotFound
 	}
 	return utils.StringToBytes(dat), err
 }
 
+// MultiGet retrieves the given keys with MGET commands. The keys of a cluster
+// span several slots, they are read with pipelined GETs.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	ctx := context.Background()
+	values := make([][]byte, len(keys))
+	if _, isCluster := db.db.(*redis.ClusterClient); isCluster {
+		pipe := db.db.Pipeline()
+		cmds := make([]*redis.StringCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, db.wrapKey(key))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !stdErrors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			value, err := cmd.Bytes()
+			if err != nil && !stdErrors.Is(err, redis.Nil) {
+				return nil, err
+			}
+			if err == nil {
+				values[i] = value
+			}
+		}
+		return values, nil
+	}
+
+	for from := 0; from < len(keys); from += iteratorPageSize {
+		to := from + iteratorPageSize
+		if to > len(keys) {
+			to = len(keys)
+		}
+		wrapped := make([]string, 0, to-from)
+		for _, key := range keys[from:to] {
+			wrapped = append(wrapped, db.wrapKey(key))
+		}
+		results, err := db.db.MGet(ctx, wrapped...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, result := range results {
+			if str, ok := result.(string); ok {
+				values[from+i] = utils.StringToBytes(str)
+			}
+		}
+	}
+	return values, nil
+}
+
 // Put inserts the given value into the key-value store.
 func (db *Database) Set(key []byte, value []byte) error {
-	return db.db.Set(context.Background(), wrapKey(db.namespace, key), value, 0).Err()
+	return db.db.Set(context.Background(), db.wrapKey(key), value, 0).Err()
 }
 
 // Delete removes the key from the key-value store.
 func (db *Database) Delete(key []byte) error {
-	return db.db.Del(context.Background(), wrapKey(db.namespace, key)).Err()
+	return db.db.Del(context.Background(), db.wrapKey(key)).Err()
 }
 
 // NewBatch creates a write-only key-value store that buffers changes to its host
 // database until a final write is called.
 func (db *Database) NewBatch() database.Batcher {
 	return &batch{
-		db:        db.db,
-		namespace: db.namespace,
-		b:         db.db.Pipeline(),
+		db: db,
+		b:  db.db.TxPipeline(),
 	}
 }
 
-// batch is a write-only leveldb batch that commits changes to its host database
-// when Write is called. A batch cannot be used concurrently.
+// batch is a write-only redis batch that commits changes to its host database
+// when Write is called. The commands queued by a single node Redis are applied
+// in a single MULTI/EXEC transaction, so other clients never observe a half
+// applied Write, while a cluster applies one transaction per slot, see
+// RedisConfig.HashTagPrefix.
+//
+// The commit of a tree version is not atomic: the tree flushes its commit
+// batch every BatchSizeLimit bytes, and the pipeline limits flush the queued
+// commands early, every flush being a transaction of its own. A single node
+// applies the flushes in order, so a crash leaves the commit intent without
+// the version marker and the interrupted commit is repaired when the tree is
+// opened again. The transactions of a cluster are applied concurrently by the
+// nodes of their slots, which gives no such guarantee.
+// A batch cannot be used concurrently.
 type batch struct {
-	namespace []byte
-	db        RedisClient
-	b         redis.Pipeliner
-	size      int
+	db   *Database
+	b    redis.Pipeliner
+	size int
+
+	pendingCommands int
+	pendingBytes    int
 }
 
 // Put inserts the given value into the batch for later committing.
 func (b *batch) Set(key, value []byte) error {
-	b.b.Set(context.Background(), wrapKey(b.namespace, key), value, 0)
+	b.b.Set(context.Background(), b.db.wrapKey(key), value, 0)
 	b.size += len(value)
-	return nil
+	return b.queued(len(key) + len(value))
 }
 
 // Delete inserts the a key removal into the batch for later committing.
 func (b *batch) Delete(key []byte) error {
-	b.b.Del(context.Background(), wrapKey(b.namespace, key))
+	b.b.Del(context.Background(), b.db.wrapKey(key))
 	b.size += len(key)
+	return b.queued(len(key))
+}
+
+// queued flushes the pipeline if the queued commands exceed the pipeline limits.
+func (b *batch) queued(bytes int) error {
+	b.pendingCommands++
+	b.pendingBytes += bytes
+	if (b.db.flushCommands > 0 && b.pendingCommands >= b.db.flushCommands) ||
+		(b.db.flushBytes > 0 && b.pendingBytes >= b.db.flushBytes) {
+		return b.Write()
+	}
 	return nil
 }
 
-// Write flushes any accumulated data to disk.
+// Write applies any accumulated data, in a transaction per slot.
+// The batch is replayed if the write fails with a failover error,
+// which is safe since all the queued commands are idempotent.
 func (b *batch) Write() error {
-	_, err := b.b.Exec(context.Background())
+	b.pendingCommands, b.pendingBytes = 0, 0
+	ctx := context.Background()
+	cmds, err := b.b.Exec(ctx)
+	for attempt := 1; err != nil && attempt <= b.db.writeRetries && isRetryableError(err); attempt++ {
+		time.Sleep(time.Duration(attempt) * b.db.writeBackoff)
+
+		pipe := b.db.db.TxPipeline()
+		for _, cmd := range cmds {
+			pipe.Do(ctx, cmd.Args()...)
+		}
+		cmds, err = pipe.Exec(ctx)
+	}
 	if err != nil {
 		return err
 	}
@@ -197,6 +457,7 @@ func (b *batch) ValueSize() int {
 
 // Reset resets the batch for reuse.
 func (b *batch) Reset() {
-	b.b = b.db.Pipeline()
+	b.b = b.db.db.TxPipeline()
 	b.size = 0
+	b.pendingCommands, b.pendingBytes = 0, 0
 }
@@ -6,10 +6,14 @@
 package redis
 
 import (
+	"bytes"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
+	stdErrors "github.com/pkg/errors"
 
 	"github.com/bnb-chain/zkbnb-smt/database"
 	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
@@ -49,3 +53,292 @@ func TestRedisWithNamespace(t *testing.T) {
 		})
 	})
 }
+
+func TestRedisWithHashTagPrefix(t *testing.T) {
+	for _, namespace := range []string{"", "test"} {
+		t.Run("DatabaseSuite", func(t *testing.T) {
+			dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+				mr, err := miniredis.Run()
+				if err != nil {
+					t.Fatal(err)
+				}
+				client := redis.NewClient(&redis.Options{
+					Addr: mr.Addr(),
+				})
+
+				db := WrapWithHashTagPrefix(WrapWithNamespace(NewFromExistRedisClient(client), namespace), 2)
+				if err := db.Set([]byte("key"), []byte("value")); err != nil {
+					t.Fatal(err)
+				}
+				tagged := "{ke}y"
+				if namespace != "" {
+					tagged = "{" + namespace + ":ke}y"
+				}
+				if !mr.Exists(tagged) {
+					t.Fatalf("the key prefix should be hash tagged, got %v", mr.Keys())
+				}
+				if err := db.Delete([]byte("key")); err != nil {
+					t.Fatal(err)
+				}
+				return db
+			})
+		})
+	}
+}
+
+func TestRedisHashTagPrefixOrder(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	db := WrapWithHashTagPrefix(WrapWithNamespace(NewFromExistRedisClient(client), "test"), 3)
+	// `{test:ab}` sorts after `{test:ab0}`, the keys are sorted without their tags
+	keys := []string{"ab", "ab0", "ab01", "b"}
+	for _, key := range keys {
+		if err := db.Set([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it := db.NewIterator([]byte("ab"), nil)
+	defer it.Release()
+	var got []string
+	for it.Next() {
+		if !bytes.Equal(it.Key(), it.Value()) {
+			t.Fatalf("key %q read the value %q", it.Key(), it.Value())
+		}
+		got = append(got, string(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != "ab" || got[1] != "ab0" || got[2] != "ab01" {
+		t.Fatalf("unexpected iteration %v", got)
+	}
+}
+
+// failoverHook fails the first pipelines as a demoted master would.
+type failoverHook struct {
+	failures int
+}
+
+func (h *failoverHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *failoverHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (h *failoverHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	if h.failures > 0 {
+		h.failures--
+		return ctx, stdErrors.New("READONLY You can't write against a read only replica.")
+	}
+	return ctx, nil
+}
+
+func (h *failoverHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+func TestRedisBatchRetry(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	hook := &failoverHook{failures: 2}
+	client.AddHook(hook)
+	db := NewFromExistRedisClient(client)
+	db.writeBackoff = time.Millisecond
+
+	b := db.NewBatch()
+	if err := b.Set([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := mr.Get("foo"); err != nil || got != "bar" {
+		t.Fatalf("batch should be replayed, got %q, %v", got, err)
+	}
+
+	hook.failures = defaultWriteRetries + 1
+	if err := b.Set([]byte("foo"), []byte("baz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err == nil {
+		t.Fatal("batch write should fail after exhausting retries")
+	}
+}
+
+// pipelineHook records the commands of the processed pipelines.
+type pipelineHook struct {
+	pipelines [][]string
+}
+
+func (h *pipelineHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *pipelineHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (h *pipelineHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		names = append(names, cmd.Name())
+	}
+	h.pipelines = append(h.pipelines, names)
+	return ctx, nil
+}
+
+func (h *pipelineHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+func TestRedisAtomicBatch(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	hook := &pipelineHook{}
+	client.AddHook(hook)
+	db := NewFromExistRedisClient(client)
+
+	b := db.NewBatch()
+	for _, k := range []string{"1", "2", "latestVersion"} {
+		if err := b.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Delete([]byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.pipelines) != 1 {
+		t.Fatalf("batch should be written in a single pipeline, got %d", len(hook.pipelines))
+	}
+	cmds := hook.pipelines[0]
+	if len(cmds) != 6 || cmds[0] != "multi" || cmds[len(cmds)-1] != "exec" {
+		t.Fatalf("batch should be applied in a transaction, got %v", cmds)
+	}
+	if !mr.Exists("latestVersion") {
+		t.Fatal("the batch should be written")
+	}
+}
+
+func TestRedisNew(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	mr.RequireUserAuth("user", "secret")
+
+	db, err := New(&RedisConfig{
+		Addr:     mr.Addr(),
+		Username: "user",
+		Password: "secret",
+		PoolSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err = New(&RedisConfig{
+		Addr:     mr.Addr(),
+		Username: "user",
+		Password: "wrong",
+	})
+	if err == nil {
+		t.Fatal("connecting with wrong credentials should fail")
+	}
+}
+
+func TestRedisPipelineLimits(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	db := WrapWithPipelineLimits(NewFromExistRedisClient(client), 2, 0)
+
+	b := db.NewBatch()
+	for _, k := range []string{"1", "2", "3"} {
+		if err := b.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !mr.Exists("1") || !mr.Exists("2") {
+		t.Fatal("pipeline should be flushed after 2 commands")
+	}
+	if mr.Exists("3") {
+		t.Fatal("the last command should be pending")
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("3") {
+		t.Fatal("the last command should be written")
+	}
+}
+
+func TestRedisNamespaces(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	db := NewFromExistRedisClient(client)
+	for _, ns := range []string{"a", "b"} {
+		if err := WrapWithNamespace(db, ns).Set([]byte("t:1"), []byte(ns)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagged := WrapWithHashTagPrefix(WrapWithNamespace(db, "c"), 2)
+	if err := tagged.Set([]byte("t:1"), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	namespaces, err := db.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 3 || namespaces[0] != "a" || namespaces[1] != "b" || namespaces[2] != "c" {
+		t.Fatalf("unexpected namespaces %v", namespaces)
+	}
+
+	if err := db.DropNamespace("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tagged.DropNamespace("c"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "b:t:1" {
+		t.Fatalf("only the kept namespace should remain, got %v", keys)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package replica
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+)
+
+// Option is a function that configures the replicated TreeDB.
+type Option func(*Database)
+
+// WithStalenessMarker configures a marker key, such as the latest version key
+// of the tree, used to detect lagging replicas. A replica is only read if its
+// marker equals the last marker written to the primary. The markers of the
+// replicas are checked at most once per interval.
+func WithStalenessMarker(key []byte, interval time.Duration) Option {
+	return func(db *Database) {
+		db.marker = utils.CopyBytes(key)
+		db.interval = interval
+	}
+}
+
+type replica struct {
+	db database.TreeDB
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	fresh     bool
+}
+
+// Database is a TreeDB sending the writes to a primary store and balancing
+// the reads across replicas of it. Reads fall back to the primary if all the
+// replicas are stale, or if a replica fails or misses the key.
+type Database struct {
+	primary  database.TreeDB
+	replicas []*replica
+	next     uint32
+
+	marker   []byte
+	interval time.Duration
+	mu       sync.RWMutex
+	written  []byte
+}
+
+// New returns a TreeDB writing to primary and reading from the replicas.
+func New(primary database.TreeDB, replicas []database.TreeDB, opts ...Option) (*Database, error) {
+	db := &Database{
+		primary: primary,
+	}
+	for _, r := range replicas {
+		db.replicas = append(db.replicas, &replica{db: r})
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	if db.marker != nil {
+		written, err := primary.Get(db.marker)
+		if err != nil && !stdErrors.Is(err, database.ErrDatabaseNotFound) {
+			return nil, err
+		}
+		db.written = written
+	}
+	return db, nil
+}
+
+// markerWritten records the marker written to the primary, the replicas
+// are considered stale until they catch up with it.
+func (db *Database) markerWritten(value []byte) {
+	db.mu.Lock()
+	db.written = utils.CopyBytes(value)
+	db.mu.Unlock()
+
+	for _, r := range db.replicas {
+		r.mu.Lock()
+		r.checkedAt = time.Time{}
+		r.mu.Unlock()
+	}
+}
+
+func (db *Database) isFresh(r *replica) bool {
+	if db.marker == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.checkedAt.IsZero() && time.Since(r.checkedAt) < db.interval {
+		return r.fresh
+	}
+
+	db.mu.RLock()
+	written := db.written
+	db.mu.RUnlock()
+	value, err := r.db.Get(db.marker)
+	switch {
+	case stdErrors.Is(err, database.ErrDatabaseNotFound):
+		r.fresh = written == nil
+	case err != nil:
+		r.fresh = false
+	default:
+		r.fresh = bytes.Equal(value, written)
+	}
+	r.checkedAt = time.Now()
+	return r.fresh
+}
+
+// reader returns the next fresh replica, or the primary if there is none.
+func (db *Database) reader() database.TreeDB {
+	n := len(db.replicas)
+	start := int(atomic.AddUint32(&db.next, 1))
+	for i := 0; i < n; i++ {
+		r := db.replicas[(start+i)%n]
+		if db.isFresh(r) {
+			return r.db
+		}
+	}
+	return db.primary
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	reader := db.reader()
+	has, err := reader.Has(key)
+	if reader != db.primary && (err != nil || !has) {
+		return db.primary.Has(key)
+	}
+	return has, err
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	reader := db.reader()
+	value, err := reader.Get(key)
+	if reader != db.primary && err != nil {
+		return db.primary.Get(key)
+	}
+	return value, err
+}
+
+// MultiGet retrieves the given keys from a fresh replica, the keys missing
+// from the replica are read from the primary store.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	reader := db.reader()
+	if reader == db.primary {
+		return db.primary.MultiGet(keys)
+	}
+	values, err := reader.MultiGet(keys)
+	if err != nil {
+		return db.primary.MultiGet(keys)
+	}
+	var missing [][]byte
+	var indexes []int
+	for i, value := range values {
+		if value == nil {
+			missing = append(missing, keys[i])
+			indexes = append(indexes, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	fetched, err := db.primary.MultiGet(missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		values[i] = fetched[j]
+	}
+	return values, nil
+}
+
+// Set inserts the given value into the primary store.
+func (db *Database) Set(key []byte, value []byte) error {
+	if err := db.primary.Set(key, value); err != nil {
+		return err
+	}
+	if db.marker != nil && bytes.Equal(key, db.marker) {
+		db.markerWritten(value)
+	}
+	return nil
+}
+
+// Delete removes the key from the primary store.
+func (db *Database) Delete(key []byte) error {
+	if err := db.primary.Delete(key); err != nil {
+		return err
+	}
+	if db.marker != nil && bytes.Equal(key, db.marker) {
+		db.markerWritten(nil)
+	}
+	return nil
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// Iterations are served by the primary store, since replicas may be partially replicated.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return db.primary.NewIterator(prefix, start)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+		b:  db.primary.NewBatch(),
+	}
+}
+
+// Ping checks the primary store. Unreachable replicas are not reported,
+// since the reads fall back to the primary.
+func (db *Database) Ping() error {
+	return db.primary.Ping()
+}
+
+// Close closes the primary and the replica stores.
+func (db *Database) Close() error {
+	err := db.primary.Close()
+	for _, r := range db.replicas {
+		if rErr := r.db.Close(); err == nil {
+			err = rErr
+		}
+	}
+	return err
+}
+
+// batch writes to the primary store and tracks the written marker.
+type batch struct {
+	db     *Database
+	b      database.Batcher
+	marker []byte
+	dirty  bool
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	if b.db.marker != nil && bytes.Equal(key, b.db.marker) {
+		b.marker, b.dirty = utils.CopyBytes(value), true
+	}
+	return b.b.Set(key, value)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	if b.db.marker != nil && bytes.Equal(key, b.db.marker) {
+		b.marker, b.dirty = nil, true
+	}
+	return b.b.Delete(key)
+}
+
+// Write flushes any accumulated data to the primary store.
+func (b *batch) Write() error {
+	if err := b.b.Write(); err != nil {
+		return err
+	}
+	if b.dirty {
+		b.db.markerWritten(b.marker)
+	}
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.b.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+	b.marker, b.dirty = nil, false
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package replica
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestReplica(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			db, err := New(memory.NewMemoryDB(), []database.TreeDB{memory.NewMemoryDB()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+func TestReplicaStaleness(t *testing.T) {
+	marker := []byte("latestVersion")
+	primary, replica := memory.NewMemoryDB(), memory.NewMemoryDB()
+	db, err := New(primary, []database.TreeDB{replica}, WithStalenessMarker(marker, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := db.NewBatch()
+	b.Set([]byte("node"), []byte("new"))
+	b.Set(marker, []byte{1})
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	// the replica lags behind with an old value
+	replica.Set([]byte("node"), []byte("old"))
+	if got, _ := db.Get([]byte("node")); !bytes.Equal(got, []byte("new")) {
+		t.Fatalf("stale replica should not be read, got %q", got)
+	}
+
+	// the replica catches up, but is only checked again after the interval
+	replica.Set([]byte("node"), []byte("replicated"))
+	replica.Set(marker, []byte{1})
+	if got, _ := db.Get([]byte("node")); !bytes.Equal(got, []byte("new")) {
+		t.Fatalf("replica should not be checked before the interval, got %q", got)
+	}
+	db.replicas[0].checkedAt = time.Time{}
+	if got, _ := db.Get([]byte("node")); !bytes.Equal(got, []byte("replicated")) {
+		t.Fatalf("fresh replica should be read, got %q", got)
+	}
+
+	// a new marker makes the replica stale again
+	if err := db.Set(marker, []byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.Get([]byte("node")); !bytes.Equal(got, []byte("new")) {
+		t.Fatalf("stale replica should not be read, got %q", got)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package retry
+
+import (
+	"context"
+	"time"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultMinBackoff = 50 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+// Option is a function that configures the retry policy.
+type Option func(*Database)
+
+// WithMaxRetries sets the number of retries of a failed operation, default is 3.
+func WithMaxRetries(retries int) Option {
+	return func(db *Database) {
+		db.maxRetries = retries
+	}
+}
+
+// WithBackoff sets the backoff before the first retry, which is doubled on
+// every further retry up to max. Default is 50 milliseconds up to 2 seconds.
+func WithBackoff(min, max time.Duration) Option {
+	return func(db *Database) {
+		db.minBackoff = min
+		db.maxBackoff = max
+	}
+}
+
+// WithRetryable sets the function deciding whether an error is transient.
+// By default, every error except a missing key, a closed database or
+// a canceled context is retried.
+func WithRetryable(retryable func(error) bool) Option {
+	return func(db *Database) {
+		db.retryable = retryable
+	}
+}
+
+// WithLogger logs each retry and the operations failed after the retries as warnings.
+func WithLogger(l logger.Logger) Option {
+	return func(db *Database) {
+		db.log = l
+	}
+}
+
+func isRetryable(err error) bool {
+	return !stdErrors.Is(err, database.ErrDatabaseNotFound) &&
+		!stdErrors.Is(err, database.ErrDatabaseClosed) &&
+		!stdErrors.Is(err, context.Canceled)
+}
+
+// Database is a TreeDB decorator retrying the operations failed with transient
+// errors, e.g. network errors of a remote backend. The backend is probed with
+// Ping before an operation is retried. Batches are buffered and replayed
+// entirely on retry, so a transient error during a commit does not fail it.
+// Replaying is safe since the writes of a batch are idempotent.
+type Database struct {
+	db         database.TreeDB
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	retryable  func(error) bool
+	log        logger.Logger
+}
+
+// Wrap returns a TreeDB retrying the failed operations of db.
+func Wrap(db database.TreeDB, opts ...Option) *Database {
+	wrapped := &Database{
+		db:         db,
+		maxRetries: defaultMaxRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		retryable:  isRetryable,
+		log:        logger.Nop(),
+	}
+	for _, opt := range opts {
+		opt(wrapped)
+	}
+	return wrapped
+}
+
+// backoff returns the delay before the given retry.
+func (db *Database) backoff(attempt int) time.Duration {
+	delay := db.minBackoff
+	for i := 0; i < attempt && delay < db.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > db.maxBackoff {
+		delay = db.maxBackoff
+	}
+	return delay
+}
+
+// do runs fn until it succeeds, fails with a permanent error or the retries are exhausted.
+func (db *Database) do(fn func() error) error {
+	err := fn()
+	attempt := 0
+	for ; err != nil && attempt < db.maxRetries && db.retryable(err); attempt++ {
+		backoff := db.backoff(attempt)
+		db.log.Warn("retrying a failed database operation",
+			logger.F("attempt", attempt+1), logger.F("backoff", backoff), logger.F("error", err))
+		time.Sleep(backoff)
+		// a backend failing the probe is not retried yet
+		if pingErr := db.db.Ping(); pingErr != nil {
+			err = pingErr
+			continue
+		}
+		err = fn()
+	}
+	if err != nil && attempt > 0 {
+		db.log.Warn("database operation failed after retries",
+			logger.F("retries", attempt), logger.F("error", err))
+	}
+	return err
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	var has bool
+	err := db.do(func() (err error) {
+		has, err = db.db.Has(key)
+		return err
+	})
+	return has, err
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := db.do(func() (err error) {
+		value, err = db.db.Get(key)
+		return err
+	})
+	return value, err
+}
+
+// MultiGet retrieves the given keys from the key-value store.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	var values [][]byte
+	err := db.do(func() (err error) {
+		values, err = db.db.MultiGet(keys)
+		return err
+	})
+	return values, err
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	return db.do(func() error {
+		return db.db.Set(key, value)
+	})
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.do(func() error {
+		return db.db.Delete(key)
+	})
+}
+
+// NewIterator creates an iterator of the underlying store, a failed iteration is not retried.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return db.db.NewIterator(prefix, start)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db: db,
+	}
+}
+
+// Ping checks the underlying store.
+func (db *Database) Ping() error {
+	return db.db.Ping()
+}
+
+// Close closes the underlying store.
+func (db *Database) Close() error {
+	return db.db.Close()
+}
+
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch buffers the writes, and replays them into a new batch of the
+// underlying store on every write attempt. A batch cannot be used concurrently.
+type batch struct {
+	db     *Database
+	writes []keyvalue
+	size   int
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{utils.CopyBytes(key), utils.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{utils.CopyBytes(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+// Write flushes any accumulated data to the underlying store, replaying
+// the whole batch if the write fails with a transient error.
+func (b *batch) Write() error {
+	return b.db.do(func() error {
+		ub := b.db.db.NewBatch()
+		for _, kv := range b.writes {
+			var err error
+			if kv.delete {
+				err = ub.Delete(kv.key)
+			} else {
+				err = ub.Set(kv.key, kv.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return ub.Write()
+	})
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
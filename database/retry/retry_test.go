@@ -0,0 +1,114 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package retry
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+var errTransient = stdErrors.New("connection reset")
+
+// flakyDB fails the next operations and batch writes with a transient error.
+type flakyDB struct {
+	database.TreeDB
+	failures int
+	calls    int
+}
+
+func (db *flakyDB) fail() error {
+	db.calls++
+	if db.failures > 0 {
+		db.failures--
+		return errTransient
+	}
+	return nil
+}
+
+func (db *flakyDB) Get(key []byte) ([]byte, error) {
+	if err := db.fail(); err != nil {
+		return nil, err
+	}
+	return db.TreeDB.Get(key)
+}
+
+func (db *flakyDB) NewBatch() database.Batcher {
+	return &flakyBatch{Batcher: db.TreeDB.NewBatch(), db: db}
+}
+
+type flakyBatch struct {
+	database.Batcher
+	db *flakyDB
+}
+
+func (b *flakyBatch) Write() error {
+	if err := b.db.fail(); err != nil {
+		return err
+	}
+	return b.Batcher.Write()
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			return Wrap(memory.NewMemoryDB())
+		})
+	})
+
+	flaky := &flakyDB{TreeDB: memory.NewMemoryDB()}
+	db := Wrap(flaky, WithBackoff(time.Millisecond, 2*time.Millisecond))
+
+	flaky.failures = 2
+	b := db.NewBatch()
+	if err := b.Set([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := db.Get([]byte("foo")); err != nil || !bytes.Equal(val, []byte("bar")) {
+		t.Fatalf("batch should be replayed, got %q %v", val, err)
+	}
+
+	flaky.failures, flaky.calls = 0, 0
+	if _, err := db.Get([]byte("missing")); !stdErrors.Is(err, database.ErrDatabaseNotFound) {
+		t.Fatalf("missing key should be reported, got %v", err)
+	}
+	if flaky.calls != 1 {
+		t.Fatalf("missing key should not be retried, got %d calls", flaky.calls)
+	}
+
+	flaky.failures = defaultMaxRetries + 1
+	if _, err := db.Get([]byte("foo")); !stdErrors.Is(err, errTransient) {
+		t.Fatalf("get should fail after exhausting retries, got %v", err)
+	}
+}
+
+func TestRetryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	flaky := &flakyDB{TreeDB: memory.NewMemoryDB(), failures: 5}
+	db := Wrap(flaky, WithMaxRetries(2), WithBackoff(time.Millisecond, time.Millisecond),
+		WithLogger(logger.Std(log.New(&buf, "", 0), logger.LevelWarn)))
+
+	if _, err := db.Get([]byte("foo")); !stdErrors.Is(err, errTransient) {
+		t.Fatalf("expected the transient error after the retries, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "WARN retrying a failed database operation attempt=1") ||
+		!strings.HasPrefix(lines[2], "WARN database operation failed after retries retries=2") {
+		t.Fatalf("unexpected log %q", buf.String())
+	}
+}
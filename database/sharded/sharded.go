@@ -0,0 +1,226 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package sharded
+
+import (
+	"hash/fnv"
+	"sync"
+
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+
+	// ErrNoShards is returned if a sharded TreeDB is created without shards.
+	ErrNoShards = stdErrors.New("at least one shard is required")
+)
+
+// Database is a TreeDB distributing the keys across several underlying stores
+// by the FNV-1a hash of the key. The shards must always be passed in the same
+// order, otherwise the keys are looked up in the wrong shards.
+type Database struct {
+	shards []database.TreeDB
+}
+
+// New returns a TreeDB sharding the keys across the given stores.
+func New(shards ...database.TreeDB) (*Database, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	return &Database{
+		shards: shards,
+	}, nil
+}
+
+func (db *Database) shardIndex(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(db.shards)))
+}
+
+func (db *Database) shard(key []byte) database.TreeDB {
+	return db.shards[db.shardIndex(key)]
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.shard(key).Has(key)
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	return db.shard(key).Get(key)
+}
+
+// MultiGet groups the keys by shard and reads the shards in parallel.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	groups := make([][]int, len(db.shards))
+	for i, key := range keys {
+		shard := db.shardIndex(key)
+		groups[shard] = append(groups[shard], i)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		values = make([][]byte, len(keys))
+		errs   = make([]error, len(db.shards))
+	)
+	for shard, indexes := range groups {
+		if len(indexes) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard int, indexes []int) {
+			defer wg.Done()
+			shardKeys := make([][]byte, len(indexes))
+			for j, i := range indexes {
+				shardKeys[j] = keys[i]
+			}
+			shardValues, err := db.shards[shard].MultiGet(shardKeys)
+			if err != nil {
+				errs[shard] = err
+				return
+			}
+			for j, i := range indexes {
+				values[i] = shardValues[j]
+			}
+		}(shard, indexes)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Set inserts the given value into the key-value store.
+func (db *Database) Set(key []byte, value []byte) error {
+	return db.shard(key).Set(key, value)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.shard(key).Delete(key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The iterators of all the shards are merged.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	iterators := make([]database.Iterator, len(db.shards))
+	for i, shard := range db.shards {
+		iterators[i] = shard.NewIterator(prefix, start)
+	}
+	return database.NewMergedIterator(iterators...)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	batches := make([]database.Batcher, len(db.shards))
+	for i, shard := range db.shards {
+		batches[i] = shard.NewBatch()
+	}
+	return &batch{
+		db:      db,
+		batches: batches,
+		dirty:   make([]bool, len(db.shards)),
+	}
+}
+
+// Ping checks all the shards.
+func (db *Database) Ping() error {
+	for _, shard := range db.shards {
+		if err := shard.Ping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all the shards.
+func (db *Database) Close() error {
+	var err error
+	for _, shard := range db.shards {
+		if shardErr := shard.Close(); err == nil {
+			err = shardErr
+		}
+	}
+	return err
+}
+
+// batch splits the writes into a batch per shard, which are written in parallel.
+// The shards are written independently, a failed write may be partially applied.
+// A batch cannot be used concurrently.
+type batch struct {
+	db      *Database
+	batches []database.Batcher
+	dirty   []bool
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	i := b.db.shardIndex(key)
+	b.dirty[i] = true
+	return b.batches[i].Set(key, value)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	i := b.db.shardIndex(key)
+	b.dirty[i] = true
+	return b.batches[i].Delete(key)
+}
+
+// Write flushes the batches of all the modified shards in parallel.
+func (b *batch) Write() error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(b.batches))
+	)
+	for i := range b.batches {
+		if !b.dirty[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = b.batches[i].Write()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing in all the shards.
+func (b *batch) ValueSize() int {
+	size := 0
+	for _, sb := range b.batches {
+		size += sb.ValueSize()
+	}
+	return size
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	for i, sb := range b.batches {
+		sb.Reset()
+		b.dirty[i] = false
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package sharded
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestSharded(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			db, err := New(memory.NewMemoryDB(), memory.NewMemoryDB(), memory.NewMemoryDB())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+func TestShardedDistribution(t *testing.T) {
+	shards := []database.TreeDB{memory.NewMemoryDB(), memory.NewMemoryDB(), memory.NewMemoryDB()}
+	db, err := New(shards...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := db.NewBatch()
+	for i := 0; i < 300; i++ {
+		b.Set([]byte(fmt.Sprintf("t:%d", i)), []byte{1})
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, shard := range shards {
+		count := 0
+		for j := 0; j < 300; j++ {
+			if has, _ := shard.Has([]byte(fmt.Sprintf("t:%d", j))); has {
+				count++
+			}
+		}
+		if count == 0 {
+			t.Fatalf("shard %d should hold some keys", i)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package tiered
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	stdErrors "github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB  = (*Database)(nil)
+	_ database.Batcher = (*batch)(nil)
+)
+
+// Database is a TreeDB combining a fast store holding the recently accessed keys
+// with a slow store holding the others. Keys are written to the fast store,
+// once the number of tracked hot keys exceeds the capacity, the least recently
+// used ones are demoted to the slow store. Reading a cold key promotes it
+// back to the fast store.
+//
+// The recency of the keys is tracked in memory. The keys left in the fast
+// store by a previous process are tracked again on open in key order, as their
+// recency is lost, and the ones exceeding the capacity are demoted.
+type Database struct {
+	fast database.TreeDB
+	slow database.TreeDB
+
+	mu  sync.Mutex
+	hot *simplelru.LRU
+	cap int
+}
+
+// New returns a tiered TreeDB keeping at most capacity recently used keys in the fast store.
+func New(fast, slow database.TreeDB, capacity int) (*Database, error) {
+	hot, err := simplelru.NewLRU(capacity+1, nil)
+	if err != nil {
+		return nil, err
+	}
+	db := &Database{
+		fast: fast,
+		slow: slow,
+		hot:  hot,
+		cap:  capacity,
+	}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// load tracks the keys found in the fast store.
+func (db *Database) load() error {
+	var keys [][]byte
+	it := db.fast.NewIterator(nil, nil)
+	for it.Next() {
+		keys = append(keys, utils.CopyBytes(it.Key()))
+	}
+	err := it.Error()
+	it.Release()
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.touch(keys...)
+}
+
+// touch marks the keys as recently used and demotes the least recently used
+// keys exceeding the capacity. The caller must hold the lock.
+func (db *Database) touch(keys ...[]byte) error {
+	var demoted [][]byte
+	for _, key := range keys {
+		db.hot.Add(string(key), struct{}{})
+		// demote one by one, the tracking set would drop the oldest key silently
+		if db.hot.Len() > db.cap {
+			k, _, _ := db.hot.RemoveOldest()
+			demoted = append(demoted, utils.StringToBytes(k.(string)))
+		}
+	}
+	if len(demoted) == 0 {
+		return nil
+	}
+
+	fastBatch, slowBatch := db.fast.NewBatch(), db.slow.NewBatch()
+	for _, key := range demoted {
+		value, err := db.fast.Get(key)
+		if stdErrors.Is(err, database.ErrDatabaseNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = slowBatch.Set(key, value); err != nil {
+			return err
+		}
+		if err = fastBatch.Delete(key); err != nil {
+			return err
+		}
+	}
+	// write the slow store first, so the keys are always in one of the stores
+	if err := slowBatch.Write(); err != nil {
+		return err
+	}
+	return fastBatch.Write()
+}
+
+// Has retrieves if a key is present in either store.
+func (db *Database) Has(key []byte) (bool, error) {
+	has, err := db.fast.Has(key)
+	if err != nil || has {
+		return has, err
+	}
+	return db.slow.Has(key)
+}
+
+// Get retrieves the given key from the fast store, promoting it from the slow store if needed.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	value, err := db.fast.Get(key)
+	if err == nil {
+		db.mu.Lock()
+		db.hot.Get(string(key))
+		db.mu.Unlock()
+		return value, nil
+	}
+	if !stdErrors.Is(err, database.ErrDatabaseNotFound) {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	// the key may have been promoted while waiting for the lock
+	value, err = db.fast.Get(key)
+	if err == nil || !stdErrors.Is(err, database.ErrDatabaseNotFound) {
+		return value, err
+	}
+	value, err = db.slow.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.fast.Set(key, value); err != nil {
+		return nil, err
+	}
+	return value, db.touch(key)
+}
+
+// MultiGet retrieves the given keys from the fast store, the missing keys are
+// read from the slow store with a single MultiGet and promoted to the fast store.
+func (db *Database) MultiGet(keys [][]byte) ([][]byte, error) {
+	values, err := db.fast.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	var missing [][]byte
+	var indexes []int
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i, value := range values {
+		if value != nil {
+			db.hot.Get(string(keys[i]))
+			continue
+		}
+		missing = append(missing, keys[i])
+		indexes = append(indexes, i)
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	// the keys may have been promoted while waiting for the lock
+	fetched, err := db.fast.MultiGet(missing)
+	if err != nil {
+		return nil, err
+	}
+	var slowKeys [][]byte
+	var slowIndexes []int
+	for j, value := range fetched {
+		if value != nil {
+			values[indexes[j]] = value
+			continue
+		}
+		slowKeys = append(slowKeys, missing[j])
+		slowIndexes = append(slowIndexes, indexes[j])
+	}
+	if len(slowKeys) == 0 {
+		return values, nil
+	}
+	fetched, err = db.slow.MultiGet(slowKeys)
+	if err != nil {
+		return nil, err
+	}
+	var promoted [][]byte
+	for j, value := range fetched {
+		if value == nil {
+			continue
+		}
+		if err = db.fast.Set(slowKeys[j], value); err != nil {
+			return nil, err
+		}
+		values[slowIndexes[j]] = value
+		promoted = append(promoted, slowKeys[j])
+	}
+	return values, db.touch(promoted...)
+}
+
+// Set inserts the given value into the fast store.
+func (db *Database) Set(key []byte, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.fast.Set(key, value); err != nil {
+		return err
+	}
+	return db.touch(key)
+}
+
+// Delete removes the key from both stores.
+func (db *Database) Delete(key []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.hot.Remove(string(key))
+	if err := db.fast.Delete(key); err != nil {
+		return err
+	}
+	return db.slow.Delete(key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+// The iterators of both stores are merged, the fast store taking precedence.
+// Iterating does not promote the keys, and a key moved between the stores
+// during the iteration may be missed.
+func (db *Database) NewIterator(prefix []byte, start []byte) database.Iterator {
+	return database.NewMergedIterator(db.fast.NewIterator(prefix, start), db.slow.NewIterator(prefix, start))
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() database.Batcher {
+	return &batch{
+		db:   db,
+		fast: db.fast.NewBatch(),
+		slow: db.slow.NewBatch(),
+	}
+}
+
+// Ping checks both stores.
+func (db *Database) Ping() error {
+	if err := db.fast.Ping(); err != nil {
+		return err
+	}
+	return db.slow.Ping()
+}
+
+// Close closes both stores.
+func (db *Database) Close() error {
+	err := db.fast.Close()
+	if slowErr := db.slow.Close(); err == nil {
+		err = slowErr
+	}
+	return err
+}
+
+// batch writes the values to the fast store, deletions are applied to both stores.
+// A batch cannot be used concurrently.
+type batch struct {
+	db      *Database
+	fast    database.Batcher
+	slow    database.Batcher
+	written [][]byte
+	deleted [][]byte
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *batch) Set(key, value []byte) error {
+	b.written = append(b.written, utils.CopyBytes(key))
+	return b.fast.Set(key, value)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.deleted = append(b.deleted, utils.CopyBytes(key))
+	if err := b.slow.Delete(key); err != nil {
+		return err
+	}
+	return b.fast.Delete(key)
+}
+
+// Write flushes any accumulated data to the stores.
+func (b *batch) Write() error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+
+	if err := b.slow.Write(); err != nil {
+		return err
+	}
+	if err := b.fast.Write(); err != nil {
+		return err
+	}
+	for _, key := range b.deleted {
+		b.db.hot.Remove(string(key))
+	}
+	return b.db.touch(b.written...)
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.fast.ValueSize() + b.slow.ValueSize()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.fast.Reset()
+	b.slow.Reset()
+	b.written = b.written[:0]
+	b.deleted = b.deleted[:0]
+}
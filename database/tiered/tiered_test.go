@@ -0,0 +1,130 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package tiered
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/dbtest"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func TestTiered(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() database.TreeDB {
+			db, err := New(memory.NewMemoryDB(), memory.NewMemoryDB(), 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+func TestTieredPromotion(t *testing.T) {
+	fast, slow := memory.NewMemoryDB(), memory.NewMemoryDB()
+	db, err := New(fast, slow, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"1", "2", "3"} {
+		if err := db.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the least recently used key is demoted
+	if has, _ := fast.Has([]byte("1")); has {
+		t.Fatal("key 1 should be demoted from the fast store")
+	}
+	if has, _ := slow.Has([]byte("1")); !has {
+		t.Fatal("key 1 should be in the slow store")
+	}
+
+	// reading promotes the key and demotes the next one
+	if got, err := db.Get([]byte("1")); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, []byte("1")) {
+		t.Fatalf("wrong value: %q", got)
+	}
+	if has, _ := fast.Has([]byte("1")); !has {
+		t.Fatal("key 1 should be promoted to the fast store")
+	}
+	if has, _ := fast.Has([]byte("2")); has {
+		t.Fatal("key 2 should be demoted from the fast store")
+	}
+}
+
+func TestTieredReopen(t *testing.T) {
+	fast, slow := memory.NewMemoryDB(), memory.NewMemoryDB()
+	// keys left in the fast store by a previous process
+	for _, k := range []string{"1", "2", "3"} {
+		if err := fast.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := New(fast, slow, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the keys over the capacity are demoted on open
+	if has, _ := fast.Has([]byte("1")); has {
+		t.Fatal("key 1 should be demoted from the fast store")
+	}
+	if has, _ := slow.Has([]byte("1")); !has {
+		t.Fatal("key 1 should be in the slow store")
+	}
+
+	// the leftover keys are tracked, so writing demotes them
+	for _, k := range []string{"4", "5"} {
+		if err := db.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, k := range []string{"2", "3"} {
+		if has, _ := fast.Has([]byte(k)); has {
+			t.Fatalf("key %s should be demoted from the fast store", k)
+		}
+		if got, err := db.Get([]byte(k)); err != nil || !bytes.Equal(got, []byte(k)) {
+			t.Fatalf("wrong value of key %s: %q %v", k, got, err)
+		}
+	}
+}
+
+func TestTieredBatchOverCapacity(t *testing.T) {
+	fast, slow := memory.NewMemoryDB(), memory.NewMemoryDB()
+	db, err := New(fast, slow, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	batch := db.NewBatch()
+	for _, k := range []string{"1", "2", "3", "4", "5"} {
+		if err := batch.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	// every key written over the capacity is demoted, none is left untracked
+	for _, k := range []string{"1", "2", "3"} {
+		if has, _ := fast.Has([]byte(k)); has {
+			t.Fatalf("key %s should be demoted from the fast store", k)
+		}
+	}
+	for _, k := range []string{"4", "5"} {
+		if has, _ := fast.Has([]byte(k)); !has {
+			t.Fatalf("key %s should be in the fast store", k)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// dotHashBytes is the number of bytes of the hashes shown in the DOT labels.
+const dotHashBytes = 4
+
+// DumpDOT writes the populated portion of the tree at the version, nil for the
+// latest one, as a Graphviz DOT graph. Only the nodes stored every 4 levels are
+// rendered, down to maxDepth, or to the leaves if maxDepth is 0 or beyond the
+// depth of the tree. The hashes are truncated, the dump is meant for debugging
+// small trees, as the nodes are loaded into memory as it goes.
+func (tree *BNBSparseMerkleTree) DumpDOT(w io.Writer, version *Version, maxDepth int) error {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	if version == nil {
+		version = &tree.version
+	}
+	if *version > tree.version {
+		return ErrVersionTooHigh
+	}
+	if tree.recentVersion > *version && !tree.isPinned(*version) {
+		return ErrVersionTooOld
+	}
+	if tree.isPruned(*version) {
+		return ErrVersionPruned
+	}
+	if maxDepth <= 0 || maxDepth > int(tree.maxDepth) {
+		maxDepth = int(tree.maxDepth)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph smt {\n")
+	fmt.Fprintf(bw, "\tnode [shape=box, fontname=\"monospace\"];\n")
+	fmt.Fprintf(bw, "\t%s [label=\"root v%d\\n%s\"];\n", dotID(tree.root), *version, dotHash(tree.rootAt(*version)))
+	if !tree.IsEmpty() {
+		if err := tree.dumpDOT(bw, tree.root, *version, uint8(maxDepth)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// dumpDOT writes the populated children of the node at the version and their
+// subtrees down to maxDepth.
+func (tree *BNBSparseMerkleTree) dumpDOT(w io.Writer, node *TreeNode, version Version, maxDepth uint8) error {
+	depth := node.depth + 4
+	if depth > maxDepth {
+		return nil
+	}
+	for nibble := uint64(0); nibble < 16; nibble++ {
+		path := node.path<<4 + nibble
+		if depth < tree.maxDepth {
+			if err := tree.extendNode(node, nibble, path, depth, false, cacheOpGet); err != nil {
+				return err
+			}
+		}
+		child := tree.child(node, nibble)
+		if child == nil {
+			continue
+		}
+		hash, ok := versionHash(child, version)
+		if !ok || bytes.Equal(hash, tree.nilHashes.Get(depth)) {
+			continue
+		}
+		if depth == tree.maxDepth {
+			fmt.Fprintf(w, "\t%s [label=\"key %d\\n%s\", shape=ellipse];\n", dotID(child), path, dotHash(hash))
+		} else {
+			fmt.Fprintf(w, "\t%s [label=\"%d:%d\\n%s\"];\n", dotID(child), depth, path, dotHash(hash))
+		}
+		fmt.Fprintf(w, "\t%s -> %s [label=\"%x\"];\n", dotID(node), dotID(child), nibble)
+		if err := tree.dumpDOT(w, child, version, maxDepth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionHash returns the hash of the node at the version, and false if the
+// node did not exist yet at the version.
+func versionHash(node *TreeNode, version Version) ([]byte, bool) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	for i := len(node.Versions) - 1; i >= 0; i-- {
+		if node.Versions[i].Ver <= version {
+			return node.Versions[i].Hash, true
+		}
+	}
+	return nil, false
+}
+
+// dotID returns the DOT identifier of the node, unique by depth and path.
+func dotID(node *TreeNode) string {
+	return fmt.Sprintf("n%d_%d", node.depth, node.path)
+}
+
+// dotHash returns the hash truncated for the DOT labels.
+func dotHash(hash []byte) string {
+	if len(hash) <= dotHashBytes {
+		return fmt.Sprintf("%x", hash)
+	}
+	return fmt.Sprintf("%x..", hash[:dotHashBytes])
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_BNBSparseMerkleTree_DumpDOT(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val1, val2 := env.hasher.Hash([]byte("val1")), env.hasher.Hash([]byte("val2"))
+	if err := smt.MultiSet([]Item{{Key: 1, Val: val1}, {Key: 200, Val: val1}}); err != nil {
+		t.Fatal(err)
+	}
+	version, err := smt.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.Set(3, val2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	smt.(*BNBSparseMerkleTree).StopGC()
+
+	// the nodes are loaded from the database
+	smt, err = NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	defer tree.StopGC()
+
+	var buf bytes.Buffer
+	if err := tree.DumpDOT(&buf, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, want := range []string{
+		"digraph smt {",
+		fmt.Sprintf("root v%d\\n%x..", tree.LatestVersion(), tree.Root()[:4]),
+		"n0_0 -> n4_0 [label=\"0\"];",
+		"n0_0 -> n4_12 [label=\"c\"];",
+		fmt.Sprintf("n8_1 [label=\"key 1\\n%x..\"", val1[:4]),
+		fmt.Sprintf("n8_3 [label=\"key 3\\n%x..\"", val2[:4]),
+		"key 200",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Fatalf("missing %q in\n%s", want, dot)
+		}
+	}
+
+	// the leaves set later are not in the older versions
+	buf.Reset()
+	if err := tree.DumpDOT(&buf, &version, 0); err != nil {
+		t.Fatal(err)
+	}
+	if dot := buf.String(); !strings.Contains(dot, "key 1\\n") || strings.Contains(dot, "key 3\\n") {
+		t.Fatalf("unexpected dump of version %d\n%s", version, dot)
+	}
+
+	// the leaves are below the depth
+	buf.Reset()
+	if err := tree.DumpDOT(&buf, nil, 4); err != nil {
+		t.Fatal(err)
+	}
+	if dot := buf.String(); strings.Contains(dot, "key ") || !strings.Contains(dot, "n0_0 -> n4_0") {
+		t.Fatalf("unexpected dump of depth 4\n%s", dot)
+	}
+
+	high := tree.LatestVersion() + 1
+	if err := tree.DumpDOT(&buf, &high, 0); !errors.Is(err, ErrVersionTooHigh) {
+		t.Fatalf("expected ErrVersionTooHigh, got %v", err)
+	}
+}
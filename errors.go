@@ -6,6 +6,8 @@
 package bsmt
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 )
 
@@ -29,4 +31,70 @@ var (
 	ErrInvalidDepth = errors.New("depth must be a multiple of 4")
 
 	ErrExtendNode = errors.New("extending node error")
+
+	ErrCorruptedNode = errors.New("corrupted tree node")
+
+	ErrPendingChanges = errors.New("the tree has uncommitted changes")
+
+	ErrArchiveMode = errors.New("pruning is disabled in the archive mode")
+
+	ErrVersionPruned = errors.New("the version has been pruned")
+
+	ErrVersionProtected = errors.New("the version is protected from pruning")
+
+	ErrInvalidVersionRange = errors.New("invalid version range")
+
+	ErrVersionConflict = errors.New("the latest version is not the expected one")
+
+	ErrTreeNotEmpty = errors.New("the tree is not empty")
+
+	ErrUnsortedLeaves = errors.New("the leaves are not sorted by key")
+
+	ErrDuplicateLeaf = errors.New("the leaf key is duplicated")
+
+	ErrInvalidLeafRecord = errors.New("invalid leaf record")
+
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+	ErrSnapshotMismatch = errors.New("the snapshot does not match the tree")
+
+	ErrManifestMismatch = errors.New("the state sync manifest does not match the tree")
+
+	ErrInvalidStateChunk = errors.New("invalid state chunk")
+
+	ErrStateSyncIncomplete = errors.New("the state sync is missing chunks")
+
+	ErrRootMismatch = errors.New("the root is mismatched with the database")
+
+	ErrGCBacklog = errors.New("the GC backlog exceeds the limit")
 )
+
+// CorruptedNodeError is returned if a stored tree node fails the checksum verification
+// or can not be decoded. It matches ErrCorruptedNode with errors.Is.
+type CorruptedNodeError struct {
+	Key []byte
+}
+
+func (e *CorruptedNodeError) Error() string {
+	return fmt.Sprintf("%s: key %x", ErrCorruptedNode, e.Key)
+}
+
+func (e *CorruptedNodeError) Unwrap() error {
+	return ErrCorruptedNode
+}
+
+// VersionConflictError is returned by CommitExpecting if the latest version of
+// the tree, in memory or in the database, is not the expected one. It matches
+// ErrVersionConflict with errors.Is.
+type VersionConflictError struct {
+	Expected Version
+	Actual   Version
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: expected %d, actual %d", ErrVersionConflict, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
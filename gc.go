@@ -0,0 +1,422 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// GCStats are the statistics of the garbage collector, which releases the
+// in-memory nodes of the pruned versions.
+type GCStats struct {
+	// Runs is the number of completed GC runs.
+	Runs uint64
+	// ReleasedNodes is the total number of released nodes, the subtrees
+	// of which are dropped from memory and reloaded from the database on demand.
+	ReleasedNodes uint64
+	// ReclaimedBytes is the total estimated memory reclaimed by the GC runs.
+	ReclaimedBytes uint64
+	// LastRunDuration is the duration of the last GC run. A background sweep
+	// includes the pauses between its steps.
+	LastRunDuration time.Duration
+	// LastRunTime is the time the last GC run completed.
+	LastRunTime time.Time
+	// LatestGCVersion is the version the nodes older than were released by the last GC run.
+	LatestGCVersion Version
+	// PrunableBacklog is the number of prunable versions, which are older than
+	// the recent version, whose nodes have not been released yet.
+	PrunableBacklog uint64
+	// Running reports whether a background sweep is running or queued.
+	Running bool
+}
+
+// gcStats accumulates the statistics of the GC runs.
+type gcStats struct {
+	mu    sync.Mutex
+	stats GCStats
+}
+
+func (s *gcStats) record(start time.Time, version Version, released int, before, after uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Runs++
+	s.stats.ReleasedNodes += uint64(released)
+	if before > after {
+		s.stats.ReclaimedBytes += before - after
+	}
+	s.stats.LastRunTime = time.Now()
+	s.stats.LastRunDuration = s.stats.LastRunTime.Sub(start)
+	s.stats.LatestGCVersion = version
+}
+
+// GCStats returns the statistics of the garbage collector.
+func (tree *BNBSparseMerkleTree) GCStats() GCStats {
+	tree.gcStats.mu.Lock()
+	stats := tree.gcStats.stats
+	tree.gcStats.mu.Unlock()
+
+	tree.gcMu.RLock()
+	if tree.recentVersion > stats.LatestGCVersion {
+		stats.PrunableBacklog = uint64(tree.recentVersion - stats.LatestGCVersion)
+	}
+	tree.gcMu.RUnlock()
+	if tree.gc != nil {
+		tree.gc.mu.Lock()
+		stats.Running = tree.gc.running
+		tree.gc.mu.Unlock()
+	}
+	return stats
+}
+
+// gcWorker releases the in-memory nodes of the pruned versions in the background,
+// so a large sweep does not add to the latency of Commit. A sweep proceeds one
+// subtree of the root at a time, and yields to the tree operations between the steps.
+type gcWorker struct {
+	tree *BNBSparseMerkleTree
+	pace time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending Version // the highest version requested since the last sweep
+	running bool
+	wake    chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func newGCWorker(tree *BNBSparseMerkleTree, pace time.Duration) *gcWorker {
+	w := &gcWorker{
+		tree: tree,
+		pace: pace,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go tree.labeled(PhaseGC, w.run)
+	return w
+}
+
+// trigger requests a sweep releasing the nodes older than version,
+// requests queued during a sweep are merged.
+func (w *gcWorker) trigger(version Version) {
+	w.mu.Lock()
+	if version > w.pending {
+		w.pending = version
+	}
+	w.running = true
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *gcWorker) run() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.wake:
+		case <-w.quit:
+			return
+		}
+		w.mu.Lock()
+		version := w.pending
+		w.pending = 0
+		w.mu.Unlock()
+		if version > 0 {
+			w.sweep(version)
+		}
+
+		w.mu.Lock()
+		if w.pending == 0 {
+			w.running = false
+			w.cond.Broadcast()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// wait blocks until the requested sweeps are done.
+func (w *gcWorker) wait() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.running {
+		w.cond.Wait()
+	}
+}
+
+// sweep releases the subtrees of the root one by one.
+func (w *gcWorker) sweep(version Version) {
+	tree := w.tree
+	start := time.Now()
+
+	tree.gcMu.Lock()
+	startSize := tree.rootSize
+	tree.gcMu.Unlock()
+
+	var (
+		remaining uint64
+		released  int
+	)
+	for i := 0; i < len(tree.root.Children); i++ {
+		select {
+		case <-w.quit:
+			return
+		default:
+		}
+		tree.gcMu.Lock()
+		root := tree.root
+		cold := tree.coldKeys()
+		root.mu.Lock()
+		size, n := root.releaseChild(i, version, cold)
+		root.mu.Unlock()
+		tree.offload(cold)
+		tree.gcMu.Unlock()
+		remaining += size
+		released += n
+
+		if w.pace > 0 {
+			time.Sleep(w.pace)
+		}
+	}
+
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+	swept := tree.root.Size() + remaining
+	// the commits during the sweep changed the size meanwhile
+	size := int64(swept) + int64(tree.rootSize) - int64(startSize)
+	if size < 0 {
+		size = 0
+	}
+	tree.setSize(uint64(size))
+	tree.recordGC(start, version, released, startSize, swept)
+}
+
+// stop terminates the worker, interrupting the running sweep.
+func (w *gcWorker) stop() {
+	select {
+	case <-w.quit:
+	default:
+		close(w.quit)
+	}
+	<-w.done
+
+	w.mu.Lock()
+	w.running = false
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// release releases the in-memory nodes older than version, in the background
+// if the background GC is enabled. The caller must not hold gcMu.
+func (tree *BNBSparseMerkleTree) release(version Version) {
+	if tree.gc != nil {
+		tree.gc.trigger(version)
+		return
+	}
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+	start, before := time.Now(), tree.rootSize
+	cold := tree.coldKeys()
+	size, released := tree.root.release(version, cold)
+	tree.offload(cold)
+	tree.setSize(size)
+	tree.recordGC(start, version, released, before, size)
+}
+
+// enforceGCHardLimit releases the in-memory nodes in a fixed order until the
+// size is within the hard limit: first the nodes not updated by the latest
+// version, then all the nodes below the root. It returns the remaining size.
+// The released nodes are loaded from the database again on demand.
+func (tree *BNBSparseMerkleTree) enforceGCHardLimit(size uint64) uint64 {
+	for _, version := range []Version{tree.version, tree.version + 1} {
+		start, before := time.Now(), size
+		var released int
+		// the nodes of the latest versions are not cold, they are not offloaded
+		size, released = tree.root.release(version, nil)
+		tree.recordGC(start, version, released, before, size)
+		// the sizes of the previous versions are stale now
+		tree.gcStatus.clean(len(tree.gcStatus.sizes) - 1)
+		tree.gcStatus.latestGCVersion = version
+		if size <= tree.gcHardLimit {
+			break
+		}
+	}
+	return size
+}
+
+// Prune marks the versions older than version as prunable, as if version was
+// passed as the recent version of a commit, and releases the in-memory nodes
+// which have not been updated since. The orphaned versions are trimmed from
+// the stored nodes rewritten by the pruned versions. The versions blocked by
+// the prune gate are kept, and the recent version is advanced up to them only.
+func (tree *BNBSparseMerkleTree) Prune(version Version) error {
+	if tree.archive {
+		return ErrArchiveMode
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+	// the recent version is updated, which the operations holding the read lock read
+	tree.gcMu.Lock()
+	if version < tree.recentVersion {
+		tree.gcMu.Unlock()
+		return ErrVersionTooOld
+	}
+	if version > tree.version {
+		tree.gcMu.Unlock()
+		return ErrVersionTooHigh
+	}
+	if version = tree.gatePrune(version, tree.version); version <= tree.recentVersion {
+		tree.gcMu.Unlock()
+		return nil
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+	if err := tree.db.Set(recentVersionNumberKey, buf); err != nil {
+		tree.gcMu.Unlock()
+		return err
+	}
+	err := tree.pruneOrphans(tree.recentVersion, version)
+	tree.recentVersion = version
+	tree.gcStatus.latestGCVersion = version
+	tree.gcMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tree.release(version)
+	return nil
+}
+
+// EstimatePrune reports the number of stored nodes a Prune up to version would
+// rewrite and the bytes the rewrites would reclaim, without modifying anything.
+// The estimation covers the nodes listed by the orphan records, the versions
+// blocked by the prune gate are not counted.
+func (tree *BNBSparseMerkleTree) EstimatePrune(upTo Version) (nodes int, bytes int64, err error) {
+	if tree.archive {
+		return 0, 0, ErrArchiveMode
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return 0, 0, err
+	}
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	if upTo < tree.recentVersion {
+		return 0, 0, ErrVersionTooOld
+	}
+	if upTo > tree.version {
+		return 0, 0, ErrVersionTooHigh
+	}
+	upTo = tree.gatePrune(upTo, tree.version)
+	_, keys, err := tree.collectOrphans(tree.recentVersion, upTo)
+	if err != nil || len(keys) == 0 {
+		return 0, 0, err
+	}
+	values, err := tree.db.MultiGet(keys)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		data, trimmed, err := trimStorageNode(keys[i], value, upTo, tree.pinned)
+		if err != nil {
+			return 0, 0, err
+		}
+		if trimmed {
+			nodes++
+			bytes += int64(len(value) - len(data))
+		}
+	}
+	return nodes, bytes, nil
+}
+
+// SetGCThreshold changes the memory size, in bytes, the in-memory nodes are
+// released at. The new threshold takes effect on the next commit.
+func (tree *BNBSparseMerkleTree) SetGCThreshold(threshold uint64) {
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+
+	stat := tree.gcStatus
+	versions, sizes := stat.versions, stat.sizes
+	stat.threshold = threshold
+	stat.segment = threshold / 10
+	if stat.segment == 0 {
+		stat.segment = 1
+	}
+	// redistribute the recorded versions into the new partitions
+	stat.clean(len(stat.sizes) - 1)
+	for i := range versions {
+		stat.add(versions[i], sizes[i])
+	}
+
+	tree.log.Info("gc threshold changed", logger.F("threshold", threshold))
+	if tree.metrics != nil {
+		tree.metrics.GCThreshold(threshold)
+	}
+}
+
+// GCThreshold returns the memory size, in bytes, the in-memory nodes are released at.
+func (tree *BNBSparseMerkleTree) GCThreshold() uint64 {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	return tree.gcStatus.threshold
+}
+
+// gatePrune returns the highest recent version up to version, the versions
+// beneath which are all allowed to be pruned by the prune gate, and which keeps
+// the rollback window below latest.
+func (tree *BNBSparseMerkleTree) gatePrune(version, latest Version) Version {
+	if depth := Version(tree.maxRollbackDepth); depth > 0 && version+depth > latest {
+		if latest <= depth {
+			return tree.recentVersion
+		}
+		version = latest - depth
+	}
+	if tree.pruneGate == nil {
+		return version
+	}
+	for v := tree.recentVersion; v < version; v++ {
+		if !tree.pruneGate(v) {
+			return v
+		}
+	}
+	return version
+}
+
+// initMaxRollbackDepth persists the configured rollback window, or adopts the
+// persisted one if none is configured.
+func (tree *BNBSparseMerkleTree) initMaxRollbackDepth(persisted []byte) error {
+	if tree.maxRollbackDepth == 0 {
+		if len(persisted) == 8 {
+			tree.maxRollbackDepth = binary.BigEndian.Uint64(persisted)
+		}
+		return nil
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, tree.maxRollbackDepth)
+	if bytes.Equal(buf, persisted) || tree.readOnly {
+		return nil
+	}
+	return tree.db.Set(maxRollbackDepthKey, buf)
+}
+
+// StopGC stops the background garbage collector, interrupting the running sweep.
+// It is a no-op if the background GC is disabled.
+func (tree *BNBSparseMerkleTree) StopGC() {
+	if tree.gc != nil {
+		tree.gc.stop()
+	}
+}
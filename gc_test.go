@@ -0,0 +1,978 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_BNBSparseMerkleTree_BackgroundGC(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash,
+				BackgroundGC(time.Millisecond), GCThreshold(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			defer tree.StopGC()
+
+			items := prepareKVData(env.hasher)
+			for i, item := range items {
+				if err := smt.Set(item.Key, item.Val); err != nil {
+					t.Fatal(err)
+				}
+				if i%4 == 3 || i == len(items)-1 {
+					if _, err := smt.Commit(nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if err := tree.Prune(smt.LatestVersion() + 1); err != ErrVersionTooHigh {
+				t.Fatalf("pruning beyond the latest version should fail, got %v", err)
+			}
+			if err := tree.Prune(smt.LatestVersion()); err != nil {
+				t.Fatal(err)
+			}
+			tree.gc.wait()
+			if smt.RecentVersion() != smt.LatestVersion() {
+				t.Fatal("the pruned version should become the recent version")
+			}
+
+			// the released nodes are reloaded from the database
+			for _, item := range items {
+				proof, err := smt.GetProof(item.Key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !smt.VerifyProof(item.Key, proof) {
+					t.Fatalf("proof of key %d should be valid after the GC", item.Key)
+				}
+			}
+
+			reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reopened.RecentVersion() != smt.LatestVersion() {
+				t.Fatal("the pruned version should be persisted")
+			}
+			verifyItems(t, smt, reopened, items)
+		})
+	}
+}
+
+func Test_BNBSparseMerkleTree_GCStats(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for _, item := range items {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := tree.GCStats(); stats.Runs != 0 {
+		t.Fatalf("no GC should run below the threshold, got %d runs", stats.Runs)
+	}
+
+	// the tree is only pruned, the nodes are still in memory
+	recent := smt.LatestVersion()
+	if _, err := smt.CommitWithNewVersion(&recent, nil); err != nil {
+		t.Fatal(err)
+	}
+	if backlog := tree.GCStats().PrunableBacklog; backlog != uint64(recent) {
+		t.Fatalf("all the pruned versions should be reported as backlog, got %d", backlog)
+	}
+
+	if err := tree.Prune(smt.LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+	stats := tree.GCStats()
+	if stats.Runs != 1 || stats.ReleasedNodes == 0 || stats.ReclaimedBytes == 0 {
+		t.Fatalf("the GC run should release nodes, got %+v", stats)
+	}
+	if stats.PrunableBacklog != 0 || stats.LatestGCVersion != smt.LatestVersion() {
+		t.Fatalf("the backlog should be cleared, got %+v", stats)
+	}
+}
+
+func Test_BNBSparseMerkleTree_RetainVersions(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, RetainVersions(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:5] {
+		if err := smt.Set(0, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if smt.RecentVersion() != 4 {
+		t.Fatalf("only the last 2 versions should be retained, got recent version %d", smt.RecentVersion())
+	}
+	version := Version(4)
+	if val, err := smt.Get(0, &version); err != nil || !bytes.Equal(val, items[3].Val) {
+		t.Fatalf("retained version should be queryable, got %x %v", val, err)
+	}
+	version = 3
+	if _, err := smt.Get(0, &version); err != ErrVersionTooOld {
+		t.Fatalf("older versions should be pruned, got %v", err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_PruneOlderThan(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:4] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pretend the first versions were committed two days ago
+	for _, version := range []Version{1, 2} {
+		if err := db.Set(versionTimeKey(version), encodeVersionTime(time.Now().Add(-48*time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.PruneOlderThan(24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if smt.RecentVersion() != 2 {
+		t.Fatalf("the state as of a day ago should be kept, got recent version %d", smt.RecentVersion())
+	}
+	if _, err := tree.VersionTime(1); err != ErrNodeNotFound {
+		t.Fatalf("the commit time of the pruned version should be deleted, got %v", err)
+	}
+	if _, err := tree.VersionTime(3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_PruneOrphans(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	// keep rewriting the same leaf, the root gets a version each time as well
+	for _, item := range items[:4] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storedVersions := func(depth uint8, path uint64) int {
+		data, err := db.Get(storageFullTreeNodeKey(depth, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := decodeStorageTreeNode(nil, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(node.Versions)
+	}
+	if n := storedVersions(0, 0); n != 4 {
+		t.Fatalf("the root should keep every version before pruning, got %d", n)
+	}
+
+	if err := smt.(*BNBSparseMerkleTree).Prune(3); err != nil {
+		t.Fatal(err)
+	}
+	if n := storedVersions(0, 0); n != 2 {
+		t.Fatalf("the orphaned versions of the root should be trimmed, got %d", n)
+	}
+	if n := storedVersions(4, items[0].Key>>4); n != 2 {
+		t.Fatalf("the orphaned versions of the leaf parent should be trimmed, got %d", n)
+	}
+	for _, version := range []Version{2, 3} {
+		if has, _ := db.Has(orphanKey(version)); has {
+			t.Fatalf("the orphan record of version %d should be deleted", version)
+		}
+	}
+	if has, _ := db.Has(orphanKey(4)); !has {
+		t.Fatal("the orphan record of the latest version should be kept")
+	}
+	val, err := smt.Get(items[0].Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[3].Val) {
+		t.Fatalf("leaf node does not match the origin, %x, %x\n", val, items[3].Val)
+	}
+}
+
+func Test_BNBSparseMerkleTree_Compact(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:6] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// drop the orphan records, as if the history was written before they were tracked
+	for version := Version(1); version <= 6; version++ {
+		if err := db.Delete(orphanKey(version)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree := smt.(*BNBSparseMerkleTree)
+	if err := tree.Compact(4); err != nil {
+		t.Fatal(err)
+	}
+	if smt.RecentVersion() != 4 {
+		t.Fatalf("the baseline should become the recent version, got %d", smt.RecentVersion())
+	}
+	data, err := db.Get(storageFullTreeNodeKey(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := decodeStorageTreeNode(nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Versions) != 3 || root.Versions[0].Ver != 4 {
+		t.Fatalf("the versions beneath the baseline should be folded, got %d", len(root.Versions))
+	}
+	if _, err := tree.VersionTime(3); err != ErrNodeNotFound {
+		t.Fatalf("the commit times beneath the baseline should be deleted, got %v", err)
+	}
+	if _, err := tree.VersionTime(4); err != nil {
+		t.Fatal(err)
+	}
+
+	// the loaded nodes are compacted too, a later commit does not write the folded versions back
+	if err := smt.Set(items[0].Key, items[6].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err = db.Get(storageFullTreeNodeKey(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = decodeStorageTreeNode(nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Versions) != 4 || root.Versions[0].Ver != 4 {
+		t.Fatalf("the folded versions should not be written back, got %d", len(root.Versions))
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reopened.Root(), smt.Root()) {
+		t.Fatal("the compacted tree should keep the latest root")
+	}
+}
+
+func Test_BNBSparseMerkleTree_PruneGate(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	finalized := Version(2)
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, PruneGate(func(v Version) bool {
+		return v < finalized
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:5] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recent := Version(4)
+	if err := smt.Set(items[5].Key, items[5].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(&recent); err != nil {
+		t.Fatal(err)
+	}
+	if smt.RecentVersion() != 2 {
+		t.Fatalf("the versions which are not finalized should be kept, got recent version %d", smt.RecentVersion())
+	}
+	if _, err := smt.Get(items[0].Key, &finalized); err != nil {
+		t.Fatal(err)
+	}
+
+	finalized = 5
+	if err := smt.(*BNBSparseMerkleTree).Prune(6); err != nil {
+		t.Fatal(err)
+	}
+	if smt.RecentVersion() != 5 {
+		t.Fatalf("pruning should be held back to the finalized version, got recent version %d", smt.RecentVersion())
+	}
+}
+
+func Test_BNBSparseMerkleTree_EstimatePrune(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:4] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree := smt.(*BNBSparseMerkleTree)
+	nodes, size, err := tree.EstimatePrune(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the root, the parent of the leaf and the leaf itself
+	if nodes != 3 || size <= 0 {
+		t.Fatalf("unexpected estimation, %d nodes, %d bytes", nodes, size)
+	}
+	if smt.RecentVersion() != 0 {
+		t.Fatal("the estimation should not prune anything")
+	}
+	if _, _, err := tree.EstimatePrune(5); err != ErrVersionTooHigh {
+		t.Fatalf("expected ErrVersionTooHigh, got %v", err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_SetGCThreshold(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	commit := func(items []Item) {
+		for _, item := range items {
+			if err := smt.Set(item.Key, item.Val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(items[:4])
+	commit(items[4:8])
+	if tree.GCStats().Runs != 0 {
+		t.Fatal("the default threshold should not be reached")
+	}
+
+	tree.SetGCThreshold(100)
+	if tree.GCThreshold() != 100 {
+		t.Fatalf("unexpected threshold %d", tree.GCThreshold())
+	}
+	commit(items[8:12])
+	if tree.GCStats().Runs == 0 {
+		t.Fatal("the tightened threshold should trigger the GC")
+	}
+}
+
+func Test_BNBSparseMerkleTree_ArchiveMode(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, ArchiveMode(), RetainVersions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for i, item := range items[:4] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		recent := Version(i)
+		if _, err := smt.Commit(&recent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if smt.RecentVersion() != 0 {
+		t.Fatalf("no version should be pruned, got recent version %d", smt.RecentVersion())
+	}
+	for i := range items[:4] {
+		version := Version(i + 1)
+		val, err := smt.Get(items[0].Key, &version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, items[i].Val) {
+			t.Fatalf("leaf node of version %d does not match the origin, %x, %x\n", version, val, items[i].Val)
+		}
+	}
+	if err := smt.(*BNBSparseMerkleTree).Prune(2); err != ErrArchiveMode {
+		t.Fatalf("expected ErrArchiveMode, got %v", err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_PruneRange(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:6] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.PruneRange(2, 6); err != ErrVersionTooHigh {
+		t.Fatalf("expected ErrVersionTooHigh, got %v", err)
+	}
+	if err := tree.PruneRange(2, 4); err != nil {
+		t.Fatal(err)
+	}
+	for version, want := range map[Version][]byte{1: items[0].Val, 5: items[4].Val, 6: items[5].Val} {
+		version := version
+		val, err := smt.Get(items[0].Key, &version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, want) {
+			t.Fatalf("leaf node of version %d does not match the origin, %x, %x\n", version, val, want)
+		}
+	}
+	version := Version(3)
+	if _, err := smt.Get(items[0].Key, &version); err != ErrVersionPruned {
+		t.Fatalf("expected ErrVersionPruned, got %v", err)
+	}
+	if versions := smt.Versions(); len(versions) != 3 {
+		t.Fatalf("the pruned versions should not be listed, got %v", versions)
+	}
+	data, err := db.Get(storageFullTreeNodeKey(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := decodeStorageTreeNode(nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Versions) != 4 {
+		t.Fatalf("the stored root should keep the last version of the range only, got %d versions", len(root.Versions))
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Rollback(3); err != ErrVersionPruned {
+		t.Fatalf("the pruned ranges should be persisted, got %v", err)
+	}
+	if err := reopened.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get(items[0].Key, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_PinVersion(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, RetainVersions(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for i, item := range items[:6] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if err := tree.PinVersion(2); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if smt.RecentVersion() != 5 {
+		t.Fatalf("unexpected recent version %d", smt.RecentVersion())
+	}
+
+	version := Version(2)
+	val, err := smt.Get(items[0].Key, &version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[1].Val) {
+		t.Fatalf("the pinned version should be kept, %x, %x\n", val, items[1].Val)
+	}
+	version = 3
+	if _, err := smt.Get(items[0].Key, &version); err != ErrVersionTooOld {
+		t.Fatalf("expected ErrVersionTooOld, got %v", err)
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned := reopened.(*BNBSparseMerkleTree).PinnedVersions(); len(pinned) != 1 || pinned[0] != 2 {
+		t.Fatalf("the pins should be persisted, got %v", pinned)
+	}
+	if err := reopened.(*BNBSparseMerkleTree).UnpinVersion(2); err != nil {
+		t.Fatal(err)
+	}
+	version = 2
+	if _, err := reopened.Get(items[0].Key, &version); err != ErrVersionTooOld {
+		t.Fatalf("expected ErrVersionTooOld, got %v", err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_UnpinReclaim(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for i, item := range items[:4] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 {
+			if err := tree.PinVersion(smt.LatestVersion()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tree.Prune(4); err != nil {
+		t.Fatal(err)
+	}
+	storedVersions := func() []Version {
+		data, err := db.Get(storageFullTreeNodeKey(0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := decodeStorageTreeNode(nil, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions := make([]Version, 0, len(root.Versions))
+		for _, v := range root.Versions {
+			versions = append(versions, v.Ver)
+		}
+		return versions
+	}
+	if versions := storedVersions(); len(versions) != 3 || versions[0] != 1 || versions[1] != 2 {
+		t.Fatalf("the stored root should keep the pinned versions, got %v", versions)
+	}
+
+	// the entry of version 2 is still referenced by its pin
+	if err := tree.UnpinVersion(1); err != nil {
+		t.Fatal(err)
+	}
+	if versions := storedVersions(); len(versions) != 2 || versions[0] != 2 {
+		t.Fatalf("the unpinned version should be reclaimed, got %v", versions)
+	}
+	version := Version(1)
+	if _, err := smt.Get(items[0].Key, &version); err != ErrVersionTooOld {
+		t.Fatalf("expected ErrVersionTooOld, got %v", err)
+	}
+	version = 2
+	val, err := smt.Get(items[0].Key, &version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[1].Val) {
+		t.Fatalf("the pinned version should be kept, %x, %x\n", val, items[1].Val)
+	}
+
+	if err := tree.UnpinVersion(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.Set(items[0].Key, items[4].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range storedVersions() {
+		if v < 4 {
+			t.Fatalf("a commit should not write the reclaimed versions back, got %v", storedVersions())
+		}
+	}
+}
+
+func Test_BNBSparseMerkleTree_MaxRollbackDepth(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, MaxRollbackDepth(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:6] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		// the explicit recent version is held back by the rollback window
+		recent := smt.LatestVersion()
+		if _, err := smt.Commit(&recent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if smt.RecentVersion() != 3 {
+		t.Fatalf("unexpected recent version %d", smt.RecentVersion())
+	}
+	if err := smt.Rollback(2); err != ErrVersionTooOld {
+		t.Fatalf("expected ErrVersionTooOld, got %v", err)
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Rollback(2); err != ErrVersionTooOld {
+		t.Fatalf("the rollback window should be persisted, got %v", err)
+	}
+	if err := reopened.Rollback(3); err != nil {
+		t.Fatal(err)
+	}
+	version := Version(3)
+	val, err := reopened.Get(items[0].Key, &version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[2].Val) {
+		t.Fatalf("leaf node does not match the origin, %x, %x\n", val, items[2].Val)
+	}
+}
+
+func Test_BNBSparseMerkleTree_GCHardLimit(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const limit = 8 * 1024
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash, GCHardLimit(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	referenceDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer referenceDB.Close()
+	reference, err := NewBNBSparseMerkleTree(env.hasher, referenceDB, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for round := 0; round < 3; round++ {
+		// every commit updates all the subtrees
+		for key := uint64(round); key < 0x10000; key += 0x100 {
+			item := Item{Key: key, Val: env.hasher.Hash([]byte{byte(round), byte(key >> 8)})}
+			items = append(items, item)
+			if err := smt.Set(item.Key, item.Val); err != nil {
+				t.Fatal(err)
+			}
+			if err := reference.Set(item.Key, item.Val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reference.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		if smt.Size() > limit {
+			t.Fatalf("the size %d should be within the hard limit", smt.Size())
+		}
+	}
+	if !bytes.Equal(smt.Root(), reference.Root()) {
+		t.Fatal("root hash does not match the reference tree")
+	}
+	for _, item := range items[len(items)-4:] {
+		proof, err := smt.GetProof(item.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reference.VerifyProof(item.Key, proof) {
+			t.Fatalf("proof of key %d should be verified by the reference tree", item.Key)
+		}
+	}
+}
+
+func Test_BNBSparseMerkleTree_ConcurrentSize(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BackgroundGC(0), GCThreshold(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smt.(*BNBSparseMerkleTree).StopGC()
+
+	// the size is monitored while the tree is written and swept
+	done := make(chan struct{})
+	monitored := make(chan struct{})
+	go func() {
+		defer close(monitored)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = smt.Size()
+			}
+		}
+	}()
+	for _, item := range prepareKVData(env.hasher) {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	<-monitored
+	if smt.Size() == 0 {
+		t.Fatal("the size of the committed nodes should be reported")
+	}
+}
+
+func Test_BNBSparseMerkleTree_ConcurrentPrune(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the committed versions are pruned while the next versions are committed,
+	// run with -race
+	committed := make(chan Version, 64)
+	pruned := make(chan error)
+	go func() {
+		var err error
+		for version := range committed {
+			if pruneErr := smt.(*BNBSparseMerkleTree).Prune(version); pruneErr != nil && !errors.Is(pruneErr, ErrVersionTooOld) {
+				err = pruneErr
+			}
+		}
+		pruned <- err
+	}()
+	items := prepareKVData(env.hasher)
+	for _, item := range items {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		version, err := smt.Commit(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		committed <- version
+	}
+	close(committed)
+	if err := <-pruned; err != nil {
+		t.Fatal(err)
+	}
+	latest := smt.LatestVersion()
+	if smt.RecentVersion() != latest {
+		t.Fatalf("expected the versions pruned up to %d, got %d", latest, smt.RecentVersion())
+	}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.RecentVersion() != latest {
+		t.Fatalf("expected the recent version %d stored, got %d", latest, reopened.RecentVersion())
+	}
+	verifyItems(t, smt, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_AutoPrune(t *testing.T) {
+	env := prepareEnv()[0]
+	for _, autoPrune := range []bool{false, true} {
+		db, err := env.db()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var opts []Option
+		if autoPrune {
+			opts = append(opts, AutoPrune())
+		}
+		smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := smt.(*BNBSparseMerkleTree)
+		for i, item := range prepareKVData(env.hasher)[:6] {
+			if err := smt.Set(item.Key, item.Val); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+			if i == 3 {
+				if err := tree.Prune(3); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		// the root is written by every commit, a Commit without a recent
+		// version only prunes its versions with AutoPrune
+		expected := 6
+		if autoPrune {
+			expected = 4
+		}
+		if len(tree.root.Versions) != expected || tree.RecentVersion() != 3 {
+			t.Fatalf("auto prune %t: expected %d root versions, got %d", autoPrune, expected, len(tree.root.Versions))
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync"
+)
+
+// hashArena allocates the hashes computed for a version out of shared chunks,
+// so the Go GC tracks a chunk instead of every hash in it. A new chunk is used
+// for the next version, and a chunk is freed as a whole once none of its hashes
+// is referenced, i.e. once the versions and the nodes it was computed for are
+// pruned or rewritten.
+type hashArena struct {
+	mu        sync.Mutex
+	chunkSize int
+	chunk     []byte
+}
+
+func newHashArena(hashesPerChunk int) *hashArena {
+	return &hashArena{chunkSize: hashesPerChunk * hashSize}
+}
+
+// alloc returns an empty slice with the capacity of a hash of size bytes.
+func (a *hashArena) alloc(size int) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.chunk) < size {
+		n := a.chunkSize
+		if n < size {
+			n = size
+		}
+		a.chunk = make([]byte, n)
+	}
+	buf := a.chunk[:0:size]
+	a.chunk = a.chunk[size:]
+	return buf
+}
+
+// reset starts a new chunk for the hashes of the next version, the rest of the
+// current chunk is left unused.
+func (a *hashArena) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.chunk = nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_HashArena(t *testing.T) {
+	arena := newHashArena(2)
+	first := arena.alloc(hashSize)
+	second := arena.alloc(hashSize)
+	if len(first) != 0 || cap(first) != hashSize {
+		t.Fatalf("unexpected hash buffer, len %d cap %d", len(first), cap(first))
+	}
+	first = append(first, bytes.Repeat([]byte{1}, hashSize)...)
+	second = append(second, bytes.Repeat([]byte{2}, hashSize)...)
+	if !bytes.Equal(first, bytes.Repeat([]byte{1}, hashSize)) {
+		t.Fatal("hashes of a chunk should not overlap")
+	}
+	// a hash larger than a chunk gets its own chunk
+	if large := arena.alloc(3 * hashSize); cap(large) != 3*hashSize {
+		t.Fatalf("unexpected hash buffer, cap %d", cap(large))
+	}
+}
+
+func Test_BNBSparseMerkleTree_HashArena(t *testing.T) {
+	env := prepareEnv()[0]
+	refDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer refDB.Close()
+	ref, err := NewBNBSparseMerkleTree(env.hasher, refDB, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash, HashArena(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := prepareKVData(env.hasher)
+	for version := 0; version < 3; version++ {
+		for i := range items {
+			items[i].Val = env.hasher.Hash(items[i].Val)
+		}
+		for _, tree := range []SparseMerkleTree{ref, smt} {
+			if err := tree.MultiSet(items[:len(items)/2]); err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range items[len(items)/2:] {
+				if err := tree.Set(item.Key, item.Val); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := tree.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(ref.Root(), smt.Root()) {
+			t.Fatalf("root hash does not match at version %d, %x, %x", version, ref.Root(), smt.Root())
+		}
+	}
+	if smt.(*BNBSparseMerkleTree).hasher == env.hasher || env.hasher.arena != nil {
+		t.Fatal("the arena should not be shared with the hasher passed in")
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, ref, reopened, items)
+}
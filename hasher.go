@@ -12,7 +12,7 @@ import (
 
 func NewHasherPool(init func() hash.Hash) *Hasher {
 	return &Hasher{
-		pool: sync.Pool{
+		pool: &sync.Pool{
 			New: func() interface{} {
 				return init()
 			},
@@ -21,7 +21,9 @@ func NewHasherPool(init func() hash.Hash) *Hasher {
 }
 
 type Hasher struct {
-	pool sync.Pool
+	pool *sync.Pool
+	// arena is set on the hasher of a tree with the HashArena option
+	arena *hashArena
 }
 
 func (h *Hasher) Hash(inputs ...[]byte) []byte {
@@ -31,5 +33,14 @@ func (h *Hasher) Hash(inputs ...[]byte) []byte {
 	for i := range inputs {
 		hasher.Write(inputs[i])
 	}
+	if h.arena != nil {
+		return hasher.Sum(h.arena.alloc(hasher.Size()))
+	}
 	return hasher.Sum(nil)
 }
+
+// withArena returns a hasher sharing the pool of h, which allocates the hashes
+// from the arena.
+func (h *Hasher) withArena(arena *hashArena) *Hasher {
+	return &Hasher{pool: h.pool, arena: arena}
+}
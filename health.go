@@ -0,0 +1,89 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// HealthCheck checks that the tree is able to serve, for the readiness probes:
+// the database is pinged, the latest version and root persisted must be the
+// committed ones in memory, and the GC backlog must not exceed the limit set by
+// MaxGCBacklog. The pending changes are not checked. Like the other reads, it
+// must not run concurrently with a commit, which would be reported as a mismatch.
+// If ctx is done before the database answers, its error is returned.
+func (tree *BNBSparseMerkleTree) HealthCheck(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tree.db != nil {
+		done := make(chan error, 1)
+		go func() { done <- tree.checkPersisted() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if tree.maxGCBacklog > 0 {
+		if backlog := tree.GCStats().PrunableBacklog; backlog > tree.maxGCBacklog {
+			return errors.Wrapf(ErrGCBacklog, "%d versions, limit %d", backlog, tree.maxGCBacklog)
+		}
+	}
+	return nil
+}
+
+// checkPersisted pings the database and checks the persisted latest version
+// and root against the tree.
+func (tree *BNBSparseMerkleTree) checkPersisted() error {
+	if err := tree.db.Ping(); err != nil {
+		return errors.Wrap(err, "ping database")
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	rootKey := tree.nodeKeys.key(0, 0)
+	values, err := tree.db.MultiGet([][]byte{latestVersionKey, rootKey})
+	if err != nil {
+		return err
+	}
+	var persisted Version
+	if len(values[0]) > 0 {
+		persisted = Version(binary.BigEndian.Uint64(values[0]))
+	}
+	if persisted != tree.version {
+		return errors.Wrapf(ErrVersionMismatched, "persisted version %d, latest version %d", persisted, tree.version)
+	}
+
+	root := tree.nilHashes.Get(0)
+	if values[1] != nil {
+		storageTreeNode, err := decodeStorageTreeNode(rootKey, values[1])
+		if err != nil {
+			return err
+		}
+		for i := len(storageTreeNode.Versions) - 1; i >= 0; i-- {
+			if storageTreeNode.Versions[i].Ver <= persisted {
+				root = storageTreeNode.Versions[i].Hash
+				break
+			}
+		}
+	}
+	if latest := tree.rootAt(tree.version); !bytes.Equal(root, latest) {
+		return errors.Wrapf(ErrRootMismatch, "persisted root %x, latest root %x", root, latest)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func Test_BNBSparseMerkleTree_HealthCheck(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, MaxGCBacklog(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	defer tree.StopGC()
+	ctx := context.Background()
+	if err := tree.HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := smt.Set(uint64(i), env.hasher.Hash([]byte{byte(i)})); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the pending changes are not checked
+	if err := smt.Set(9, env.hasher.Hash([]byte("pending"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := tree.HealthCheck(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// the GC has not released the versions older than the recent version
+	tree.gcStats.stats.LatestGCVersion = 0
+	tree.recentVersion = 3
+	if err := tree.HealthCheck(ctx); !errors.Is(err, ErrGCBacklog) {
+		t.Fatalf("expected ErrGCBacklog, got %v", err)
+	}
+	tree.recentVersion = 0
+
+	// the root persisted by another tree at the same version
+	other, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash, InitializeVersion(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Set(1, env.hasher.Hash([]byte("other"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	rootKey := tree.nodeKeys.key(0, 0)
+	buf, err := other.(*BNBSparseMerkleTree).db.Get(rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := db.Get(rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(rootKey, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.HealthCheck(ctx); !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("expected ErrRootMismatch, got %v", err)
+	}
+	if err := db.Set(rootKey, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	// a version committed by another process
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.(*BNBSparseMerkleTree).StopGC()
+	if err := reopened.Set(5, env.hasher.Hash([]byte("other"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.HealthCheck(ctx); !errors.Is(err, ErrVersionMismatched) {
+		t.Fatalf("expected ErrVersionMismatched, got %v", err)
+	}
+}
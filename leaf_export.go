@@ -0,0 +1,108 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// LeafFormat is a text format of the leaves written by ExportLeaves.
+type LeafFormat int
+
+const (
+	// LeafFormatJSONL writes a JSON object per line:
+	// {"key":1,"value":"0x...","version":3}
+	LeafFormatJSONL LeafFormat = iota
+	// LeafFormatCSV writes a key,value,version header and a row per leaf.
+	LeafFormatCSV
+)
+
+// csvLeafHeader is the header row of the CSV leaves.
+var csvLeafHeader = []string{"key", "value", "version"}
+
+// ParseLeafFormat returns the format named jsonl or csv.
+func ParseLeafFormat(name string) (LeafFormat, error) {
+	switch name {
+	case "jsonl":
+		return LeafFormatJSONL, nil
+	case "csv":
+		return LeafFormatCSV, nil
+	}
+	return 0, errors.Errorf("unknown leaf format %q", name)
+}
+
+func (f LeafFormat) String() string {
+	switch f {
+	case LeafFormatJSONL:
+		return "jsonl"
+	case LeafFormatCSV:
+		return "csv"
+	}
+	return "LeafFormat(" + strconv.Itoa(int(f)) + ")"
+}
+
+// leafRecord is the JSON encoding of a leaf.
+type leafRecord struct {
+	Key     uint64 `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version"`
+}
+
+// ExportLeaves writes the committed leaves of the version to w in the format,
+// sorted by key, with the hex encoded values and the versions the leaves were
+// last written in, for the analytics and the external audits. It returns the
+// number of leaves written.
+func (tree *BNBSparseMerkleTree) ExportLeaves(version Version, w io.Writer, format LeafFormat) (uint64, error) {
+	if format != LeafFormatJSONL && format != LeafFormatCSV {
+		return 0, errors.Errorf("unknown leaf format %v", format)
+	}
+	scanner, err := tree.Leaves(version)
+	if err != nil {
+		return 0, err
+	}
+	defer scanner.Release()
+
+	bw := bufio.NewWriter(w)
+	var cw *csv.Writer
+	if format == LeafFormatCSV {
+		cw = csv.NewWriter(bw)
+		if err := cw.Write(csvLeafHeader); err != nil {
+			return 0, err
+		}
+	}
+	enc := json.NewEncoder(bw)
+	var count uint64
+	for scanner.Next() {
+		leaf := scanner.Leaf()
+		value := "0x" + hex.EncodeToString(leaf.Val)
+		if cw != nil {
+			err = cw.Write([]string{strconv.FormatUint(leaf.Key, 10), value, strconv.FormatUint(uint64(scanner.Version()), 10)})
+		} else {
+			err = enc.Encode(leafRecord{Key: leaf.Key, Value: value, Version: uint64(scanner.Version())})
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := scanner.Error(); err != nil {
+		return count, err
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return count, err
+		}
+	}
+	return count, bw.Flush()
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_ExportLeaves(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	val1, val2 := env.hasher.Hash([]byte("val1")), env.hasher.Hash([]byte("val2"))
+	if err := smt.MultiSet([]Item{{Key: 7, Val: val1}, {Key: 3, Val: val1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	// a leaf reset to the nil hash is not exported
+	if err := smt.MultiSet([]Item{{Key: 3, Val: val2}, {Key: 7, Val: nilHash}, {Key: 200, Val: val2}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := tree.ExportLeaves(2, &buf, LeafFormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("{\"key\":3,\"value\":\"0x%x\",\"version\":2}\n{\"key\":200,\"value\":\"0x%x\",\"version\":2}\n", val2, val2)
+	if n != 2 || buf.String() != expected {
+		t.Fatalf("unexpected %d leaves:\n%s", n, buf.String())
+	}
+
+	buf.Reset()
+	if n, err = tree.ExportLeaves(1, &buf, LeafFormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	expected = "key,value,version\n3,0x" + hex.EncodeToString(val1) + ",1\n7,0x" + hex.EncodeToString(val1) + ",1\n"
+	if n != 2 || buf.String() != expected {
+		t.Fatalf("unexpected %d leaves:\n%s", n, buf.String())
+	}
+
+	if format, err := ParseLeafFormat("csv"); err != nil || format != LeafFormatCSV || format.String() != "csv" {
+		t.Fatalf("unexpected format %v, %v", format, err)
+	}
+	if _, err := ParseLeafFormat("xml"); err == nil || !strings.Contains(err.Error(), "xml") {
+		t.Fatalf("expected an unknown format error, got %v", err)
+	}
+}
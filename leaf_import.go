@@ -0,0 +1,205 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var _ LeafIterator = (*LeafReader)(nil)
+
+// LeafReader reads the leaves written by ExportLeaves as a LeafIterator. The
+// leaves must be sorted by key, unique and within the key range of the depth,
+// a leaf breaking it stops the reader with an error naming its line. The
+// versions of the leaves are read but not used by BuildFrom.
+type LeafReader struct {
+	format   LeafFormat
+	maxDepth uint8
+	lines    *bufio.Reader
+	records  *csv.Reader
+
+	line    int
+	leaf    Item
+	version Version
+	read    uint64
+	done    bool
+	err     error
+}
+
+// NewLeafReader returns a reader of the leaves of a tree of the depth, in the
+// format, from r. A CSV file must start with the key,value,version header.
+func NewLeafReader(r io.Reader, format LeafFormat, maxDepth uint8) (*LeafReader, error) {
+	reader := &LeafReader{format: format, maxDepth: maxDepth}
+	switch format {
+	case LeafFormatJSONL:
+		reader.lines = bufio.NewReader(r)
+	case LeafFormatCSV:
+		reader.records = csv.NewReader(r)
+		reader.records.FieldsPerRecord = len(csvLeafHeader)
+		reader.records.ReuseRecord = true
+		header, err := reader.records.Read()
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(ErrInvalidLeafRecord, err.Error())
+		}
+		if err == io.EOF || strings.Join(header, ",") != strings.Join(csvLeafHeader, ",") {
+			return nil, errors.Wrapf(ErrInvalidLeafRecord, "missing header %s", strings.Join(csvLeafHeader, ","))
+		}
+		reader.line = 1
+	default:
+		return nil, errors.Errorf("unknown leaf format %v", format)
+	}
+	return reader, nil
+}
+
+// Next moves the reader to the next leaf.
+func (r *LeafReader) Next() bool {
+	if r.done {
+		return false
+	}
+	var (
+		ok  bool
+		key uint64
+		val []byte
+		ver uint64
+		err error
+	)
+	if r.format == LeafFormatCSV {
+		ok, key, val, ver, err = r.nextCSV()
+	} else {
+		ok, key, val, ver, err = r.nextJSON()
+	}
+	switch {
+	case err != nil:
+		r.err = err
+	case !ok:
+	case key >= 1<<r.maxDepth:
+		r.err = errors.Wrapf(ErrInvalidKey, "key %d at line %d", key, r.line)
+	case r.read > 0 && key == r.leaf.Key:
+		r.err = errors.Wrapf(ErrDuplicateLeaf, "key %d at line %d", key, r.line)
+	case r.read > 0 && key < r.leaf.Key:
+		r.err = errors.Wrapf(ErrUnsortedLeaves, "key %d at line %d follows key %d", key, r.line, r.leaf.Key)
+	default:
+		r.leaf = Item{Key: key, Val: val}
+		r.version = Version(ver)
+		r.read++
+		return true
+	}
+	r.done = true
+	return false
+}
+
+// nextJSON reads the next non-empty line of a JSONL file.
+func (r *LeafReader) nextJSON() (bool, uint64, []byte, uint64, error) {
+	for {
+		line, err := r.lines.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return false, 0, nil, 0, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			return false, 0, nil, 0, nil
+		}
+		r.line++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var record struct {
+			Key     *uint64 `json:"key"`
+			Value   string  `json:"value"`
+			Version uint64  `json:"version"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return false, 0, nil, 0, errors.Wrapf(ErrInvalidLeafRecord, "line %d: %v", r.line, err)
+		}
+		if record.Key == nil {
+			return false, 0, nil, 0, errors.Wrapf(ErrInvalidLeafRecord, "line %d: missing key", r.line)
+		}
+		val, err := r.decodeValue(record.Value)
+		return err == nil, *record.Key, val, record.Version, err
+	}
+}
+
+// nextCSV reads the next row of a CSV file.
+func (r *LeafReader) nextCSV() (bool, uint64, []byte, uint64, error) {
+	record, err := r.records.Read()
+	if err == io.EOF {
+		return false, 0, nil, 0, nil
+	}
+	if err != nil {
+		return false, 0, nil, 0, errors.Wrap(ErrInvalidLeafRecord, err.Error())
+	}
+	r.line, _ = r.records.FieldPos(0)
+	key, err := strconv.ParseUint(record[0], 10, 64)
+	if err != nil {
+		return false, 0, nil, 0, errors.Wrapf(ErrInvalidLeafRecord, "line %d: invalid key %q", r.line, record[0])
+	}
+	ver, err := strconv.ParseUint(record[2], 10, 64)
+	if err != nil {
+		return false, 0, nil, 0, errors.Wrapf(ErrInvalidLeafRecord, "line %d: invalid version %q", r.line, record[2])
+	}
+	val, err := r.decodeValue(record[1])
+	return err == nil, key, val, ver, err
+}
+
+// decodeValue decodes a hex value, with or without the 0x prefix.
+func (r *LeafReader) decodeValue(value string) ([]byte, error) {
+	val, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil || len(val) == 0 {
+		return nil, errors.Wrapf(ErrInvalidLeafRecord, "line %d: invalid value %q", r.line, value)
+	}
+	return val, nil
+}
+
+// Leaf returns the current leaf.
+func (r *LeafReader) Leaf() Item {
+	return r.leaf
+}
+
+// Version returns the version the current leaf was last written in, as
+// recorded by the file.
+func (r *LeafReader) Version() Version {
+	return r.version
+}
+
+// Read returns the number of leaves read so far.
+func (r *LeafReader) Read() uint64 {
+	return r.read
+}
+
+// Error returns the failure that stopped the reader, if any.
+func (r *LeafReader) Error() error {
+	return r.err
+}
+
+// ImportLeaves builds an empty tree from the leaves read by r with BuildFrom,
+// committed as the first version, and returns the version, the number of
+// leaves and the root of the built tree, to be cross-checked against the root
+// of the exported version. A tree holds a single version of the leaves, the
+// versions recorded by the file are discarded.
+func (tree *BNBSparseMerkleTree) ImportLeaves(r *LeafReader) (*SnapshotInfo, error) {
+	if r.maxDepth != tree.maxDepth {
+		return nil, errors.Errorf("the leaves are read for depth %d, tree depth %d", r.maxDepth, tree.maxDepth)
+	}
+	version, err := tree.BuildFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotInfo{
+		Version:  version,
+		MaxDepth: tree.maxDepth,
+		Root:     tree.Root(),
+		Leaves:   r.Read(),
+	}, nil
+}
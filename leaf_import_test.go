@@ -0,0 +1,101 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func Test_BNBSparseMerkleTree_ImportLeaves(t *testing.T) {
+	env := prepareEnv()[0]
+	smt, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := smt.(*BNBSparseMerkleTree)
+	defer source.StopGC()
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items[:10]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.MultiSet(items[10:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []LeafFormat{LeafFormatJSONL, LeafFormatCSV} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := source.ExportLeaves(2, &buf, format); err != nil {
+				t.Fatal(err)
+			}
+			reader, err := NewLeafReader(&buf, format, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			smt, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			defer tree.StopGC()
+			info, err := tree.ImportLeaves(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Version != 1 || info.Leaves != uint64(len(items)) || !bytes.Equal(info.Root, source.Root()) {
+				t.Fatalf("unexpected import %+v, expected root %x", info, source.Root())
+			}
+		})
+	}
+
+	value := "0x" + strings.Repeat("ab", 32)
+	for name, test := range map[string]struct {
+		input  string
+		format LeafFormat
+		err    error
+	}{
+		"duplicate": {`{"key":1,"value":"` + value + `"}` + "\n" + `{"key":1,"value":"` + value + `"}`, LeafFormatJSONL, ErrDuplicateLeaf},
+		"unsorted":  {"key,value,version\n2," + value + ",1\n1," + value + ",1\n", LeafFormatCSV, ErrUnsortedLeaves},
+		"bounds":    {"key,value,version\n256," + value + ",1\n", LeafFormatCSV, ErrInvalidKey},
+		"value":     {`{"key":1,"value":"0xzz"}`, LeafFormatJSONL, ErrInvalidLeafRecord},
+		"missing":   {`{"value":"` + value + `"}`, LeafFormatJSONL, ErrInvalidLeafRecord},
+		"header":    {"1," + value + ",1\n", LeafFormatCSV, ErrInvalidLeafRecord},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// a malformed header fails the reader, the other records fail the import
+			reader, err := NewLeafReader(strings.NewReader(test.input), test.format, 8)
+			if err == nil {
+				smt, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tree := smt.(*BNBSparseMerkleTree)
+				defer tree.StopGC()
+				_, err = tree.ImportLeaves(reader)
+				if errors.Cause(err) != test.err {
+					t.Fatalf("expected %v, got %v", test.err, err)
+				}
+				if tree.LatestVersion() != 0 {
+					t.Fatal("a failed import should not commit a version")
+				}
+			} else if errors.Cause(err) != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var _ LeafIterator = (*LeafScanner)(nil)
+
+// LeafScanner iterates over the committed leaves of a version, by scanning the
+// stored leaf nodes in the database. The leaves holding the nil hash at the
+// version are skipped.
+type LeafScanner struct {
+	it       database.Iterator
+	nodeKeys nodeKeyFormat
+	maxDepth uint8
+	version  Version
+	nilHash  []byte
+	leaf     Item
+	leafVer  Version
+	err      error
+	released bool
+}
+
+// Leaves returns a scanner of the committed leaves of the version, sorted by
+// key in ascending order. The leaves set since the last commit are not included.
+// The scanner should be released if it is not iterated to the end.
+func (tree *BNBSparseMerkleTree) Leaves(version Version) (*LeafScanner, error) {
+	return tree.leavesFrom(version, 0)
+}
+
+// leavesFrom returns a scanner of the committed leaves of the version, starting
+// at the key.
+func (tree *BNBSparseMerkleTree) leavesFrom(version Version, key uint64) (*LeafScanner, error) {
+	if tree.recentVersion > version && !tree.isPinned(version) {
+		return nil, ErrVersionTooOld
+	}
+	if version > tree.version {
+		return nil, ErrVersionTooHigh
+	}
+	if tree.isPruned(version) {
+		return nil, ErrVersionPruned
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return nil, err
+	}
+	prefix := tree.nodeKeys.levelPrefix(tree.maxDepth)
+	var start []byte
+	if key > 0 {
+		start = tree.nodeKeys.key(tree.maxDepth, key)[len(prefix):]
+	}
+	return &LeafScanner{
+		it:       tree.db.NewIterator(prefix, start),
+		nodeKeys: tree.nodeKeys,
+		maxDepth: tree.maxDepth,
+		version:  version,
+		nilHash:  tree.nilHashes.Get(tree.maxDepth),
+	}, nil
+}
+
+// Next moves the scanner to the next leaf, it returns false once the leaves
+// are exhausted or the scan failed, the scanner is released then.
+func (s *LeafScanner) Next() bool {
+	if s.released {
+		return false
+	}
+	for s.it.Next() {
+		path, ok := s.nodeKeys.leafPath(s.it.Key(), s.maxDepth)
+		if !ok {
+			continue
+		}
+		node, err := decodeStorageTreeNode(s.it.Key(), s.it.Value())
+		if err != nil {
+			s.err = err
+			s.Release()
+			return false
+		}
+		for i := len(node.Versions) - 1; i >= 0; i-- {
+			if node.Versions[i].Ver <= s.version {
+				if bytes.Equal(node.Versions[i].Hash, s.nilHash) {
+					break
+				}
+				s.leaf = Item{Key: path, Val: node.Versions[i].Hash}
+				s.leafVer = node.Versions[i].Ver
+				return true
+			}
+		}
+	}
+	s.err = s.it.Error()
+	s.Release()
+	return false
+}
+
+// Leaf returns the current leaf.
+func (s *LeafScanner) Leaf() Item {
+	return s.leaf
+}
+
+// Version returns the version the current leaf was last written in, up to the
+// scanned version.
+func (s *LeafScanner) Version() Version {
+	return s.leafVer
+}
+
+// Error returns the failure that stopped the scan, if any.
+func (s *LeafScanner) Error() error {
+	return s.err
+}
+
+// Release releases the database iterator of the scanner.
+func (s *LeafScanner) Release() {
+	if !s.released {
+		s.released = true
+		s.it.Release()
+	}
+}
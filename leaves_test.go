@@ -0,0 +1,83 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_Leaves(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			items := []Item{
+				{Key: 200, Val: env.hasher.Hash([]byte("a"))},
+				{Key: 3, Val: env.hasher.Hash([]byte("b"))},
+				{Key: 17, Val: env.hasher.Hash([]byte("c"))},
+			}
+			if err := smt.MultiSet(items); err != nil {
+				t.Fatal(err)
+			}
+			v1, err := smt.Commit(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// clear a leaf and update another in the next version
+			if err := smt.MultiSet([]Item{{Key: 3, Val: tree.nilHashes.Get(8)}, {Key: 17, Val: env.hasher.Hash([]byte("d"))}}); err != nil {
+				t.Fatal(err)
+			}
+			v2, err := smt.Commit(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := smt.Set(42, env.hasher.Hash([]byte("uncommitted"))); err != nil {
+				t.Fatal(err)
+			}
+
+			collect := func(version Version) []Item {
+				scanner, err := tree.Leaves(version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var leaves []Item
+				for scanner.Next() {
+					leaves = append(leaves, scanner.Leaf())
+				}
+				if err := scanner.Error(); err != nil {
+					t.Fatal(err)
+				}
+				return leaves
+			}
+			check := func(got, expected []Item) {
+				if len(got) != len(expected) {
+					t.Fatalf("expected %d leaves, got %d", len(expected), len(got))
+				}
+				for i := range got {
+					if got[i].Key != expected[i].Key || !bytes.Equal(got[i].Val, expected[i].Val) {
+						t.Fatalf("leaf %d: expected key %d, got %d", i, expected[i].Key, got[i].Key)
+					}
+				}
+			}
+			check(collect(v1), []Item{items[1], items[2], items[0]})
+			check(collect(v2), []Item{{Key: 17, Val: env.hasher.Hash([]byte("d"))}, items[0]})
+
+			if _, err := tree.Leaves(v2 + 1); err != ErrVersionTooHigh {
+				t.Fatalf("expected ErrVersionTooHigh, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// defaultSlowThreshold is the duration the commits, rollbacks and proofs are
+// logged as slow at, unless set by SlowOperationThreshold.
+const defaultSlowThreshold = time.Second
+
+// logSlow warns of an operation started at start, if it took longer than the
+// slow operation threshold.
+func (tree *BNBSparseMerkleTree) logSlow(op string, start time.Time, fields ...logger.Field) {
+	threshold := tree.slowThreshold
+	if threshold == 0 {
+		threshold = defaultSlowThreshold
+	}
+	elapsed := time.Since(start)
+	if threshold < 0 || elapsed < threshold {
+		return
+	}
+	fields = append(fields, logger.F("operation", op), logger.F("duration", elapsed))
+	tree.log.Warn("slow tree operation", fields...)
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+type logEntry struct {
+	level  logger.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger records the logged messages.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) log(level logger.Level, msg string, fields []logger.Field) {
+	entry := logEntry{level: level, msg: msg, fields: make(map[string]interface{})}
+	for _, f := range fields {
+		entry.fields[f.Key] = f.Value
+	}
+	l.mu.Lock()
+	l.entries = append(l.entries, entry)
+	l.mu.Unlock()
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...logger.Field) {
+	l.log(logger.LevelDebug, msg, fields)
+}
+func (l *recordingLogger) Info(msg string, fields ...logger.Field) {
+	l.log(logger.LevelInfo, msg, fields)
+}
+func (l *recordingLogger) Warn(msg string, fields ...logger.Field) {
+	l.log(logger.LevelWarn, msg, fields)
+}
+func (l *recordingLogger) Error(msg string, fields ...logger.Field) {
+	l.log(logger.LevelError, msg, fields)
+}
+
+// find returns the entries of the level and message.
+func (l *recordingLogger) find(level logger.Level, msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logEntry
+	for _, e := range l.entries {
+		if e.level == level && e.msg == msg {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func Test_BNBSparseMerkleTree_Logging(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	log := &recordingLogger{}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash,
+		Logging(log), SlowOperationThreshold(time.Nanosecond), GCHardLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := log.find(logger.LevelWarn, "slow tree operation")
+	if len(slow) != 1 || slow[0].fields["operation"] != "commit" || slow[0].fields["version"] != Version(1) {
+		t.Fatalf("expected the slow commit to be logged, got %+v", slow)
+	}
+	if limit := log.find(logger.LevelWarn, "the in-memory nodes exceed the gc hard limit"); len(limit) != 1 {
+		t.Fatalf("expected the hard limit to be logged, got %+v", limit)
+	}
+	if released := log.find(logger.LevelDebug, "released the in-memory nodes"); len(released) == 0 {
+		t.Fatal("expected the gc runs to be logged")
+	}
+}
+
+func Test_BNBSparseMerkleTree_LoggingDisabledSlowOperations(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	log := &recordingLogger{}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, Logging(log), SlowOperationThreshold(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.MultiSet(prepareKVData(env.hasher)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if slow := log.find(logger.LevelWarn, "slow tree operation"); len(slow) != 0 {
+		t.Fatalf("expected no slow operations to be logged, got %+v", slow)
+	}
+}
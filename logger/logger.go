@@ -0,0 +1,103 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package logger defines the leveled, structured logger the tree and the
+// database decorators report their decisions and failures to. A logging
+// library such as zap or logrus is plugged in by a small adapter.
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level is the severity of a message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Field is a key-value pair attached to a message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns the field of the key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+type Logger interface {
+	// Debug logs the per-operation details, e.g. each GC run
+	Debug(msg string, fields ...Field)
+	// Info logs the state changes of the tree
+	Info(msg string, fields ...Field)
+	// Warn logs the degradations recovered from, e.g. retries and slow operations
+	Warn(msg string, fields ...Field)
+	// Error logs the failures the tree cannot recover from by itself
+	Error(msg string, fields ...Field)
+}
+
+// Nop returns a logger discarding every message.
+func Nop() Logger {
+	return nop{}
+}
+
+type nop struct{}
+
+func (nop) Debug(string, ...Field) {}
+func (nop) Info(string, ...Field)  {}
+func (nop) Warn(string, ...Field)  {}
+func (nop) Error(string, ...Field) {}
+
+// Std returns a logger writing the messages at or above the level to l, as
+// the level, the message and the fields in key=value form.
+func Std(l *log.Logger, level Level) Logger {
+	return &std{logger: l, level: level}
+}
+
+type std struct {
+	logger *log.Logger
+	level  Level
+}
+
+func (s *std) log(level Level, msg string, fields []Field) {
+	if level < s.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	s.logger.Print(b.String())
+}
+
+func (s *std) Debug(msg string, fields ...Field) { s.log(LevelDebug, msg, fields) }
+func (s *std) Info(msg string, fields ...Field)  { s.log(LevelInfo, msg, fields) }
+func (s *std) Warn(msg string, fields ...Field)  { s.log(LevelWarn, msg, fields) }
+func (s *std) Error(msg string, fields ...Field) { s.log(LevelError, msg, fields) }
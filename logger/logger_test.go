@@ -0,0 +1,22 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package logger
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := Std(log.New(&buf, "", 0), LevelInfo)
+	l.Debug("dropped", F("key", 1))
+	l.Warn("slow commit", F("version", 3), F("duration", "2s"))
+	if got, want := buf.String(), "WARN slow commit version=3 duration=2s\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
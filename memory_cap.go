@@ -0,0 +1,140 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// dirtyNodeSize is the memory size accounted for each dirty node of the journal.
+const dirtyNodeSize = versionSize + hashSize*14
+
+// accessClock orders the uses of the subtrees the memory cap evicts.
+type accessClock struct {
+	tick uint64
+	// used[i] is the tick the i-th subtree at the eviction depth was last used at
+	used []uint64
+}
+
+// evictDepth is the depth of the subtrees evicted by the memory cap, 256
+// subtrees below depth 8, or the 16 children of the root of a shallow tree.
+func (tree *BNBSparseMerkleTree) evictDepth() uint8 {
+	if tree.maxDepth > 8 {
+		return 8
+	}
+	return 4
+}
+
+// touch records a use of the subtree of the key.
+func (tree *BNBSparseMerkleTree) touch(key uint64) {
+	if tree.memoryCap == 0 {
+		return
+	}
+	i := key >> (tree.maxDepth - tree.evictDepth())
+	atomic.StoreUint64(&tree.access.used[i], atomic.AddUint64(&tree.access.tick, 1))
+}
+
+// subtreeMemory returns the memory size of the in-memory nodes of the subtree,
+// as accounted by Size.
+func subtreeMemory(node *TreeNode) uint64 {
+	size := node.Size()
+	if node.IsTemporary() {
+		return size
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			size += subtreeMemory(child)
+		}
+	}
+	return size
+}
+
+// evictSubtrees releases the committed subtrees at the eviction depth, the least
+// recently used first, until the size is within the memory cap. The subtrees are
+// replaced by stubs instead of being cleared, the reads holding a node keep
+// reading a consistent one. It returns the remaining size.
+func (tree *BNBSparseMerkleTree) evictSubtrees(size uint64) uint64 {
+	start, before := time.Now(), size
+	type candidate struct {
+		parent *TreeNode
+		nibble uint64
+		node   *TreeNode
+		used   uint64
+	}
+	depth := tree.evictDepth()
+	var candidates []candidate
+	var collect func(node *TreeNode)
+	collect = func(node *TreeNode) {
+		for nibble := uint64(0); nibble < 16; nibble++ {
+			child := tree.child(node, nibble)
+			if child == nil || child.IsTemporary() {
+				continue
+			}
+			if child.depth < depth || child.pinned {
+				// the subtrees of the pinned keys are kept, their siblings are not
+				if child.depth < tree.maxDepth {
+					collect(child)
+				}
+				continue
+			}
+			used := atomic.LoadUint64(&tree.access.used[child.path>>(child.depth-depth)])
+			candidates = append(candidates, candidate{node, nibble, child, used})
+		}
+	}
+	collect(tree.root)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].used < candidates[j].used })
+
+	released := 0
+	for _, c := range candidates {
+		if size <= tree.memoryCap {
+			break
+		}
+		c.node.mu.RLock()
+		versions := c.node.Versions
+		c.node.mu.RUnlock()
+		stub := &TreeNode{
+			Versions:  versions,
+			nilHashes: tree.nilHashes,
+			hasher:    tree.hasher,
+			temporary: true,
+			depth:     c.node.depth,
+			path:      c.node.path,
+		}
+		freed := subtreeMemory(c.node) - stub.Size()
+		mu := tree.subtreeLocks.of(c.parent.depth, c.parent.path)
+		mu.Lock()
+		c.parent.Children[c.nibble] = stub
+		mu.Unlock()
+		if freed > size {
+			freed = size
+		}
+		size -= freed
+		released++
+	}
+	tree.recordGC(start, tree.version, released, before, size)
+	return size
+}
+
+// dirtyMemory returns the memory size of the in-memory nodes together with the
+// dirty nodes waiting for the next commit.
+func (tree *BNBSparseMerkleTree) dirtyMemory() uint64 {
+	return tree.Size() + uint64(tree.journal.len())*dirtyNodeSize
+}
+
+// flushIfCapped commits the dirty nodes early, once they exceed the memory cap.
+func (tree *BNBSparseMerkleTree) flushIfCapped() error {
+	if tree.memoryCap == 0 || tree.dirtyMemory() <= tree.memoryCap {
+		return nil
+	}
+	tree.log.Debug("committing the dirty nodes over the memory cap",
+		logger.F("size", tree.dirtyMemory()), logger.F("cap", tree.memoryCap))
+	_, err := tree.Commit(nil)
+	return err
+}
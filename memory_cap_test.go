@@ -0,0 +1,114 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_MemoryCap(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const limit = 64 * 1024
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash, MemoryCap(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	referenceDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer referenceDB.Close()
+	reference, err := NewBNBSparseMerkleTree(env.hasher, referenceDB, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []Item
+	for key := uint64(0); key < 0x10000; key += 0x31 {
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8), byte(key)})})
+	}
+	// the dirty nodes beyond the cap are committed early
+	for _, item := range items {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if tree.dirtyMemory() > limit {
+			t.Fatalf("the dirty nodes of %d bytes should be flushed", tree.dirtyMemory())
+		}
+	}
+	if smt.LatestVersion() < 2 {
+		t.Fatalf("the writes should be committed early, got version %d", smt.LatestVersion())
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := reference.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reference.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if smt.Size() > limit {
+		t.Fatalf("the size %d should be within the cap", smt.Size())
+	}
+	if !bytes.Equal(smt.Root(), reference.Root()) {
+		t.Fatal("root hash does not match the reference tree")
+	}
+
+	// the recently proven subtree is kept, the others are released first
+	hot, pinned := items[0].Key, items[len(items)/2].Key
+	if err := tree.PinKeys([]uint64{pinned}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.GetProof(hot); err != nil {
+		t.Fatal(err)
+	}
+	for _, tree := range []SparseMerkleTree{smt, reference} {
+		if err := tree.Set(items[len(items)-1].Key, env.hasher.Hash([]byte("next"))); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tree.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subtree := tree.root.Children[hot>>12].Children[hot>>8&0xf]
+	if subtree == nil || subtree.IsTemporary() {
+		t.Fatal("the recently used subtree should stay in memory")
+	}
+	released := 0
+	for _, child := range tree.root.Children {
+		for _, subtree := range child.Children {
+			if subtree != nil && subtree.IsTemporary() {
+				released++
+			}
+		}
+	}
+	if released == 0 {
+		t.Fatal("the subtrees beyond the cap should be released")
+	}
+	if subtree := tree.root.Children[pinned>>12].Children[pinned>>8&0xf]; subtree == nil || subtree.IsTemporary() {
+		t.Fatal("the subtree of the pinned key should stay in memory")
+	}
+
+	// the released subtrees are loaded again on demand
+	for _, item := range items[:len(items)-1] {
+		proof, err := smt.GetProof(item.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reference.VerifyProof(item.Key, proof) {
+			t.Fatalf("proof of key %d should be verified by the reference tree", item.Key)
+		}
+	}
+}
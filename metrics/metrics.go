@@ -5,6 +5,8 @@
 
 package metrics
 
+import "time"
+
 type Metrics interface {
 	// The current version of smt
 	Version(uint64)
@@ -28,3 +30,44 @@ type GCVersion struct {
 	Version uint64
 	Size    uint64
 }
+
+// Database operations reported to DBMetrics
+const (
+	DBGet      = "get"
+	DBMultiGet = "multi_get"
+	DBHas      = "has"
+	DBSet      = "set"
+	DBDel      = "delete"
+	DBWrite    = "batch_write"
+	DBIterate  = "iterate"
+)
+
+type DBMetrics interface {
+	// The latency and the result of each database operation
+	DBOperation(op string, duration time.Duration, err error)
+	// The number of operations and the amount of data of each written batch
+	DBBatch(ops int, size int)
+}
+
+// Node lookups reported to OperationMetrics
+const (
+	CacheGet      = "get"
+	CacheSet      = "set"
+	CacheProof    = "proof"
+	CacheRollback = "rollback"
+)
+
+// OperationMetrics is implemented by the Metrics also measuring the tree
+// operations. The tree reports them when the Metrics passed to EnableMetrics
+// implement it.
+type OperationMetrics interface {
+	// The latency of each commit
+	CommitDuration(time.Duration)
+	// The latency of each proof
+	ProofDuration(time.Duration)
+	// The released nodes, the reclaimed bytes and the duration of each GC run
+	GCRun(released int, reclaimed uint64, duration time.Duration)
+	// The nodes found in memory and read from the database by the lookups of
+	// an operation type, counted since the tree was opened
+	CacheLookups(op string, hits, faults uint64)
+}
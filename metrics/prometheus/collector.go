@@ -7,13 +7,17 @@ package prometheus
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/bnb-chain/zkbnb-smt/metrics"
 )
 
-var _ metrics.Metrics = (*Collector)(nil)
+var (
+	_ metrics.Metrics          = (*Collector)(nil)
+	_ metrics.OperationMetrics = (*Collector)(nil)
+)
 
 func NewCollector() *Collector {
 	currentVersion := prometheus.NewGauge(prometheus.GaugeOpts{
@@ -44,6 +48,33 @@ func NewCollector() *Collector {
 		Name: "smt_latest_gc_threshold",
 		Help: "GC trigger threshold",
 	})
+	commitLatency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smt_commit_duration_seconds",
+		Help:    "The latency of each commit",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	})
+	proofLatency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smt_proof_duration_seconds",
+		Help:    "The latency of each proof",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+	})
+	gcLatency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smt_gc_duration_seconds",
+		Help:    "The duration of each GC run",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+	})
+	gcReleasedNodes := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "smt_gc_released_nodes_total",
+		Help: "The number of nodes released by the GC runs",
+	})
+	gcReclaimedBytes := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "smt_gc_reclaimed_bytes_total",
+		Help: "The memory size reclaimed by the GC runs",
+	})
+	cacheLookups := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smt_cache_lookups",
+		Help: "The nodes found in memory (hit) and read from the database (fault) since the tree was opened",
+	}, []string{"op", "result"})
 	prometheus.MustRegister(
 		currentVersion,
 		prunedVersion,
@@ -51,7 +82,13 @@ func NewCollector() *Collector {
 		changeSize,
 		commitNum,
 		latestGCVersion,
-		gcThreshold)
+		gcThreshold,
+		commitLatency,
+		proofLatency,
+		gcLatency,
+		gcReleasedNodes,
+		gcReclaimedBytes,
+		cacheLookups)
 
 	var (
 		gcVersions [10]prometheus.Gauge
@@ -72,15 +109,21 @@ func NewCollector() *Collector {
 	}
 
 	return &Collector{
-		currentVersion:  currentVersion,
-		prunedVersion:   prunedVersion,
-		currentSize:     currentSize,
-		changeSize:      changeSize,
-		commitNum:       commitNum,
-		latestGCVersion: latestGCVersion,
-		gcThreshold:     gcThreshold,
-		gcVersions:      gcVersions,
-		gcSizes:         gcSizes,
+		currentVersion:   currentVersion,
+		prunedVersion:    prunedVersion,
+		currentSize:      currentSize,
+		changeSize:       changeSize,
+		commitNum:        commitNum,
+		latestGCVersion:  latestGCVersion,
+		gcThreshold:      gcThreshold,
+		gcVersions:       gcVersions,
+		gcSizes:          gcSizes,
+		commitLatency:    commitLatency,
+		proofLatency:     proofLatency,
+		gcLatency:        gcLatency,
+		gcReleasedNodes:  gcReleasedNodes,
+		gcReclaimedBytes: gcReclaimedBytes,
+		cacheLookups:     cacheLookups,
 	}
 }
 
@@ -94,6 +137,13 @@ type Collector struct {
 	gcThreshold     prometheus.Gauge
 	gcVersions      [10]prometheus.Gauge
 	gcSizes         [10]prometheus.Gauge
+
+	commitLatency    prometheus.Histogram
+	proofLatency     prometheus.Histogram
+	gcLatency        prometheus.Histogram
+	gcReleasedNodes  prometheus.Counter
+	gcReclaimedBytes prometheus.Counter
+	cacheLookups     *prometheus.GaugeVec
 }
 
 func (c *Collector) Version(ver uint64) {
@@ -130,3 +180,22 @@ func (c *Collector) GCVersions(info [10]*metrics.GCVersion) {
 		c.gcSizes[i].Set(float64(info[i].Size))
 	}
 }
+
+func (c *Collector) CommitDuration(d time.Duration) {
+	c.commitLatency.Observe(d.Seconds())
+}
+
+func (c *Collector) ProofDuration(d time.Duration) {
+	c.proofLatency.Observe(d.Seconds())
+}
+
+func (c *Collector) GCRun(released int, reclaimed uint64, d time.Duration) {
+	c.gcLatency.Observe(d.Seconds())
+	c.gcReleasedNodes.Add(float64(released))
+	c.gcReclaimedBytes.Add(float64(reclaimed))
+}
+
+func (c *Collector) CacheLookups(op string, hits, faults uint64) {
+	c.cacheLookups.WithLabelValues(op, "hit").Set(float64(hits))
+	c.cacheLookups.WithLabelValues(op, "fault").Set(float64(faults))
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bnb-chain/zkbnb-smt/metrics"
+)
+
+var _ metrics.DBMetrics = (*DBCollector)(nil)
+
+func NewDBCollector() *DBCollector {
+	operations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "smt_db_operations_total",
+		Help: "The number of database operations",
+	}, []string{"op", "result"})
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "smt_db_operation_seconds",
+		Help:    "The latency of database operations",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"op"})
+	batchOps := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smt_db_batch_operations",
+		Help:    "The number of operations of each written batch",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	})
+	batchSize := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smt_db_batch_bytes",
+		Help:    "The amount of data of each written batch",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+	})
+	prometheus.MustRegister(operations, latency, batchOps, batchSize)
+
+	return &DBCollector{
+		operations: operations,
+		latency:    latency,
+		batchOps:   batchOps,
+		batchSize:  batchSize,
+	}
+}
+
+type DBCollector struct {
+	operations *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	batchOps   prometheus.Histogram
+	batchSize  prometheus.Histogram
+}
+
+func (c *DBCollector) DBOperation(op string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	c.operations.WithLabelValues(op, result).Inc()
+	c.latency.WithLabelValues(op).Observe(duration.Seconds())
+}
+
+func (c *DBCollector) DBBatch(ops int, size int) {
+	c.batchOps.Observe(float64(ops))
+	c.batchSize.Observe(float64(size))
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MultiProof is the proof of a batch of keys. The sibling hashes shared by the
+// paths of several keys are included once, and the hashes computable from the
+// keys themselves are omitted. The hashes are listed in the depth-first order
+// of the tree, left to right.
+type MultiProof [][]byte
+
+// internalOffsets is the index of the first internal hash of each level within a node.
+var internalOffsets = [4]int{0, 0, 2, 6}
+
+// sortedKeys returns the distinct keys in ascending order.
+func sortedKeys(keys []uint64) []uint64 {
+	sorted := append([]uint64(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	distinct := sorted[:0]
+	for i, key := range sorted {
+		if i == 0 || key != sorted[i-1] {
+			distinct = append(distinct, key)
+		}
+	}
+	return distinct
+}
+
+// splitKeys returns the index of the first key whose bit at the bit depth is
+// set, the keys share the bits above it.
+func splitKeys(keys []uint64, maxDepth uint8, bitDepth int) int {
+	shift := int(maxDepth) - 1 - bitDepth
+	return sort.Search(len(keys), func(i int) bool { return keys[i]>>shift&1 == 1 })
+}
+
+// GetMultiProof returns the proof of the distinct keys, in ascending order.
+// The missing paths of all the keys are loaded first with a single read, then
+// the hashes of the 16 subtrees of the root are collected by up to ProofWorkers
+// workers.
+func (tree *BNBSparseMerkleTree) GetMultiProof(keys []uint64) (MultiProof, error) {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	defer tree.observe(PhaseProof, time.Now())
+
+	for _, key := range keys {
+		if key >= 1<<tree.maxDepth {
+			return nil, ErrInvalidKey
+		}
+		tree.touch(key)
+	}
+	keys = sortedKeys(keys)
+	root := tree.root
+	if tree.IsEmpty() {
+		root = nil
+	} else if err := tree.loadPaths(keys, cacheOpProof); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return MultiProof{tree.Root()}, nil
+	}
+
+	// the hashes within the root node, with a placeholder for each subtree
+	type subtree struct {
+		node   *TreeNode
+		keys   []uint64
+		hashes [][]byte
+	}
+	var (
+		parts    [][][]byte
+		current  [][]byte
+		subtrees []*subtree
+	)
+	tree.collectProof(root, 0, keys, &current, func(child *TreeNode, keys []uint64) {
+		parts = append(parts, current)
+		current = nil
+		subtrees = append(subtrees, &subtree{node: child, keys: keys})
+		parts = append(parts, nil)
+	})
+	parts = append(parts, current)
+
+	collect := func(s *subtree) {
+		tree.collectProof(s.node, 4, s.keys, &s.hashes, nil)
+	}
+	workers := workerCount(tree.proofWorkers, len(subtrees))
+	if workers <= 1 {
+		for _, s := range subtrees {
+			collect(s)
+		}
+	} else {
+		wg := sync.WaitGroup{}
+		var submitErr error
+		for w := 0; w < workers; w++ {
+			w := w
+			wg.Add(1)
+			err := tree.goroutinePool.Submit(func() {
+				defer wg.Done()
+				tree.labeled(PhaseProof, func() {
+					for i := w; i < len(subtrees); i += workers {
+						collect(subtrees[i])
+					}
+				})
+			})
+			if err != nil {
+				wg.Done()
+				submitErr = err
+			}
+		}
+		wg.Wait()
+		if submitErr != nil {
+			return nil, submitErr
+		}
+	}
+
+	var proof MultiProof
+	for i, part := range parts {
+		proof = append(proof, part...)
+		// the subtree placeholders are at the odd parts
+		if i%2 == 1 {
+			proof = append(proof, subtrees[i/2].hashes...)
+		}
+	}
+	return proof, nil
+}
+
+// collectProof appends the hashes of the multiproof of the keys within the node
+// at the depth, a nil node is an empty subtree. If descend is set, the children
+// on the paths of the keys are handed over to it instead of being walked.
+func (tree *BNBSparseMerkleTree) collectProof(node *TreeNode, depth uint8, keys []uint64, out *[][]byte, descend func(*TreeNode, []uint64)) {
+	var walk func(level, index int, keys []uint64)
+	walk = func(level, index int, keys []uint64) {
+		if len(keys) == 0 {
+			*out = append(*out, tree.hashWithin(node, depth, level, index))
+			return
+		}
+		if level == 4 {
+			if depth+4 == tree.maxDepth {
+				// the leaf is provided by the verifier
+				return
+			}
+			var child *TreeNode
+			if node != nil {
+				child = tree.child(node, uint64(index))
+			}
+			if descend != nil {
+				descend(child, keys)
+				return
+			}
+			tree.collectProof(child, depth+4, keys, out, nil)
+			return
+		}
+		split := splitKeys(keys, tree.maxDepth, int(depth)+level)
+		walk(level+1, 2*index, keys[:split])
+		walk(level+1, 2*index+1, keys[split:])
+	}
+	walk(0, 0, keys)
+}
+
+// hashWithin returns the hash at the index of a level within the node, where
+// the level 0 is the node itself and the level 4 its children.
+func (tree *BNBSparseMerkleTree) hashWithin(node *TreeNode, depth uint8, level, index int) []byte {
+	if node == nil {
+		return tree.nilHashes.Get(depth + uint8(level))
+	}
+	switch level {
+	case 0:
+		return node.Root()
+	case 4:
+		if child := tree.child(node, uint64(index)); child != nil {
+			return child.Root()
+		}
+		return tree.nilHashes.Get(depth + 4)
+	default:
+		node.mu.RLock()
+		defer node.mu.RUnlock()
+		return node.internal(internalOffsets[level] + index)
+	}
+}
+
+// VerifyMultiProof verifies the multiproof of the leaves against the root of a
+// tree of maxDepth, without access to the tree. The leaves must be sorted by
+// key without duplicates, the value of an absent key is the nil hash of the leaves.
+func VerifyMultiProof(hasher *Hasher, root []byte, maxDepth uint8, leaves []Item, proof MultiProof) bool {
+	if maxDepth == 0 || maxDepth%4 != 0 || maxDepth > 64 {
+		return false
+	}
+	keys := make([]uint64, len(leaves))
+	for i, leaf := range leaves {
+		if (maxDepth < 64 && leaf.Key >= 1<<maxDepth) || (i > 0 && leaf.Key <= leaves[i-1].Key) {
+			return false
+		}
+		keys[i] = leaf.Key
+	}
+
+	pos := 0
+	var walk func(bitDepth int, keys []uint64, leaves []Item) []byte
+	walk = func(bitDepth int, keys []uint64, leaves []Item) []byte {
+		if len(keys) == 0 {
+			if pos >= len(proof) {
+				return nil
+			}
+			pos++
+			return proof[pos-1]
+		}
+		if bitDepth == int(maxDepth) {
+			return leaves[0].Val
+		}
+		split := splitKeys(keys, maxDepth, bitDepth)
+		left := walk(bitDepth+1, keys[:split], leaves[:split])
+		right := walk(bitDepth+1, keys[split:], leaves[split:])
+		if left == nil || right == nil {
+			return nil
+		}
+		return hasher.Hash(left, right)
+	}
+	computed := walk(0, keys, leaves)
+	return pos == len(proof) && computed != nil && bytes.Equal(root, computed)
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_GetMultiProof(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+
+	// the proof of an empty tree
+	proof, err := tree.GetMultiProof([]uint64{3, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	absent := env.hasher.Hash([]byte("absent"))
+	empty := []Item{{1, tree.nilHashes.Get(16)}, {3, tree.nilHashes.Get(16)}}
+	if !VerifyMultiProof(env.hasher, tree.Root(), 16, empty, proof) {
+		t.Fatal("multiproof of an empty tree should verify")
+	}
+
+	items := prepareKVData(env.hasher)
+	for i := range items {
+		items[i].Key |= uint64(i%3) << 12
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &readCountingDB{TreeDB: db}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, counting, 16, nilHash, ProofWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []uint64{0xffff}
+	values := map[uint64][]byte{0xffff: tree.nilHashes.Get(16)}
+	for _, item := range items {
+		keys = append(keys, item.Key, item.Key)
+		values[item.Key] = item.Val
+	}
+	multiGets := counting.multiGets
+	proof, err = reopened.(*BNBSparseMerkleTree).GetMultiProof(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counting.multiGets != multiGets+1 {
+		t.Fatalf("the paths should be read at once, got %d reads", counting.multiGets-multiGets)
+	}
+
+	sorted := sortedKeys(keys)
+	leaves := make([]Item, len(sorted))
+	for i, key := range sorted {
+		leaves[i] = Item{key, values[key]}
+	}
+	if !VerifyMultiProof(env.hasher, smt.Root(), 16, leaves, proof) {
+		t.Fatal("multiproof should verify")
+	}
+	if len(proof) >= len(leaves)*16 {
+		t.Fatalf("the shared siblings should be included once, got %d hashes", len(proof))
+	}
+
+	// the proof built by a single worker is the same
+	single, err := tree.GetMultiProof(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single) != len(proof) {
+		t.Fatalf("multiproof size mismatch, %d, %d", len(single), len(proof))
+	}
+	for i := range proof {
+		if !bytes.Equal(single[i], proof[i]) {
+			t.Fatalf("multiproof hash %d mismatch", i)
+		}
+	}
+
+	tampered := append([]Item(nil), leaves...)
+	tampered[1].Val = absent
+	if VerifyMultiProof(env.hasher, smt.Root(), 16, tampered, proof) {
+		t.Fatal("multiproof of a tampered value should not verify")
+	}
+	if VerifyMultiProof(env.hasher, smt.Root(), 16, leaves[1:], proof) {
+		t.Fatal("multiproof of other keys should not verify")
+	}
+	if VerifyMultiProof(env.hasher, smt.Root(), 16, leaves, proof[1:]) {
+		t.Fatal("truncated multiproof should not verify")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// nodeCacheShards is the maximum number of LRU shards of a NodeCache, each shard
+// has a lock of its own so the concurrent Gets of different leaves rarely wait
+// for each other.
+const nodeCacheShards = 16
+
+// NodeCache is a read-through cache of the leaf nodes, which can be shared by
+// many trees of a process, such as the asset trees of the accounts, so that
+// the memory of the cached leaves is bounded by a single size instead of a
+// size per tree. Each tree caches its leaves under its own namespace.
+type NodeCache struct {
+	shards     []*lru.Cache
+	namespaces uint64
+	// shared is unset for the private cache of a tree
+	shared bool
+}
+
+// NewNodeCache returns a cache holding up to size leaf nodes in total.
+func NewNodeCache(size int) (*NodeCache, error) {
+	shards := nodeCacheShards
+	if size < shards {
+		shards = size
+	}
+	if shards <= 0 {
+		shards = 1
+	}
+	c := &NodeCache{shards: make([]*lru.Cache, 0, shards), shared: true}
+	for i := 0; i < shards; i++ {
+		shardSize := size / shards
+		if i < size%shards {
+			shardSize++
+		}
+		cache, err := lru.New(shardSize)
+		if err != nil {
+			return nil, err
+		}
+		c.shards = append(c.shards, cache)
+	}
+	return c, nil
+}
+
+// Len returns the number of cached leaf nodes of all the trees.
+func (c *NodeCache) Len() int {
+	n := 0
+	for _, shard := range c.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// namespace returns a namespace never handed out before.
+func (c *NodeCache) namespace() uint64 {
+	return atomic.AddUint64(&c.namespaces, 1)
+}
+
+func (c *NodeCache) shard(key leafCacheKey) *lru.Cache {
+	h := (key.path ^ key.namespace<<40) * 0x9e3779b97f4a7c15
+	return c.shards[(h>>32)%uint64(len(c.shards))]
+}
+
+type leafCacheKey struct {
+	namespace uint64
+	path      uint64
+}
+
+// leafCache is the view of a tree on a NodeCache.
+type leafCache struct {
+	cache     *NodeCache
+	namespace uint64
+}
+
+func newLeafCache(cache *NodeCache) *leafCache {
+	return &leafCache{cache: cache, namespace: cache.namespace()}
+}
+
+func (c *leafCache) key(path uint64) leafCacheKey {
+	return leafCacheKey{atomic.LoadUint64(&c.namespace), path}
+}
+
+func (c *leafCache) Get(path uint64) (*TreeNode, bool) {
+	key := c.key(path)
+	cached, ok := c.cache.shard(key).Get(key)
+	if !ok {
+		return nil, false
+	}
+	return cached.(*TreeNode), true
+}
+
+func (c *leafCache) Add(path uint64, node *TreeNode) {
+	key := c.key(path)
+	c.cache.shard(key).Add(key, node)
+}
+
+func (c *leafCache) Contains(path uint64) bool {
+	key := c.key(path)
+	return c.cache.shard(key).Contains(key)
+}
+
+func (c *leafCache) Remove(path uint64) {
+	key := c.key(path)
+	c.cache.shard(key).Remove(key)
+}
+
+// Purge drops the cached leaves of the tree. The leaves of a shared cache are
+// not removed one by one, the tree moves to a fresh namespace and the stale
+// entries are evicted in time by the entries in use.
+func (c *leafCache) Purge() {
+	if !c.cache.shared {
+		for _, shard := range c.cache.shards {
+			shard.Purge()
+		}
+		return
+	}
+	atomic.StoreUint64(&c.namespace, c.cache.namespace())
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_SharedNodeCache(t *testing.T) {
+	env := prepareEnv()[0]
+	items := prepareKVData(env.hasher)
+	size := 2 * len(items)
+	cache, err := NewNodeCache(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trees := make([]SparseMerkleTree, 3)
+	for i := range trees {
+		db, err := env.db()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, SharedNodeCache(cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the trees hold different values under the same keys
+		for _, item := range items {
+			if err := smt.Set(item.Key, env.hasher.Hash(item.Val, []byte{byte(i)})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		trees[i] = smt
+	}
+	if cache.Len() > size {
+		t.Fatalf("the cache should be bounded across the trees, got %d leaves", cache.Len())
+	}
+
+	for round := 0; round < 2; round++ {
+		for i, smt := range trees {
+			for _, item := range items {
+				val, err := smt.Get(item.Key, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(val, env.hasher.Hash(item.Val, []byte{byte(i)})) {
+					t.Fatalf("tree %d read the leaf %d of another tree", i, item.Key)
+				}
+			}
+		}
+	}
+	if cache.Len() > size || cache.Len() < size/2 {
+		t.Fatalf("the cache should be bounded across the trees, got %d leaves", cache.Len())
+	}
+
+	// a purge only drops the leaves of the tree itself
+	tree, other := trees[0].(*BNBSparseMerkleTree), trees[2].(*BNBSparseMerkleTree)
+	key := items[len(items)-1].Key
+	if _, err := tree.Get(key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get(key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.dbCache.Get(key); !ok {
+		t.Fatal("the last read leaf should be cached")
+	}
+	tree.dbCache.Purge()
+	if _, ok := tree.dbCache.Get(key); ok {
+		t.Fatal("the purged leaves should not be returned")
+	}
+	if _, ok := other.dbCache.Get(key); !ok {
+		t.Fatal("the leaves of the other trees should be kept")
+	}
+}
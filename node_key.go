@@ -0,0 +1,175 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// nodeKeyFormatKey is the key of the storage key format of the tree nodes,
+// an existing tree without the record uses standardNodeKeys.
+var nodeKeyFormatKey = []byte(`nodeKeyFormat`)
+
+// nodeKeyFormat is the storage key format of the tree nodes.
+type nodeKeyFormat byte
+
+const (
+	// standardNodeKeys is the format: t:${depth}:${path}
+	standardNodeKeys nodeKeyFormat = iota
+	// compactNodeKeys is the format: ${0x80|depth}${path}, the path is trimmed
+	// to the bytes spanned by the depth. The leading byte never collides with
+	// the ASCII metadata keys nor with standardNodeKeys.
+	compactNodeKeys
+)
+
+const (
+	compactNodeKeyTag = 0x80
+	// maxNodeKeySize is the size of the longest node key of any format.
+	maxNodeKeySize = 12
+	// nodeKeyChunk is the number of keys allocated at once by a nodeKeyArena.
+	nodeKeyChunk = 256
+)
+
+// appendKey appends the storage key of the node to buf.
+func (f nodeKeyFormat) appendKey(buf []byte, depth uint8, path uint64) []byte {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], path)
+	if f == compactNodeKeys {
+		buf = append(buf, compactNodeKeyTag|depth)
+		return append(buf, encoded[8-(int(depth)+7)/8:]...)
+	}
+	buf = append(buf, storageFullTreeNodePrefix...)
+	buf = append(buf, sep...)
+	buf = append(buf, depth)
+	buf = append(buf, sep...)
+	return append(buf, encoded[:]...)
+}
+
+// key returns the storage key of the node in a fresh allocation.
+func (f nodeKeyFormat) key(depth uint8, path uint64) []byte {
+	return f.appendKey(make([]byte, 0, maxNodeKeySize), depth, path)
+}
+
+// levelPrefix returns the prefix of the keys of the nodes at the depth.
+func (f nodeKeyFormat) levelPrefix(depth uint8) []byte {
+	if f == compactNodeKeys {
+		return []byte{compactNodeKeyTag | depth}
+	}
+	return []byte{storageFullTreeNodePrefix[0], sep[0], depth, sep[0]}
+}
+
+// prefixes returns the prefixes covering the keys of all the nodes of a tree.
+func (f nodeKeyFormat) prefixes(maxDepth uint8) [][]byte {
+	if f == standardNodeKeys {
+		return [][]byte{append(append([]byte(nil), storageFullTreeNodePrefix...), sep...)}
+	}
+	prefixes := make([][]byte, 0, maxDepth/4+1)
+	for depth := 0; depth <= int(maxDepth); depth += 4 {
+		prefixes = append(prefixes, f.levelPrefix(uint8(depth)))
+	}
+	return prefixes
+}
+
+// leafPath decodes the path of a leaf key iterated under levelPrefix(depth).
+func (f nodeKeyFormat) leafPath(key []byte, depth uint8) (uint64, bool) {
+	prefix := len(f.levelPrefix(depth))
+	size := 8
+	if f == compactNodeKeys {
+		size = (int(depth) + 7) / 8
+	}
+	if len(key) != prefix+size {
+		return 0, false
+	}
+	var encoded [8]byte
+	copy(encoded[8-size:], key[prefix:])
+	return binary.BigEndian.Uint64(encoded[:]), true
+}
+
+// nodeKeyPool keeps the scratch keys of the single node reads.
+var nodeKeyPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, maxNodeKeySize)
+		return &buf
+	},
+}
+
+// getNodeKey encodes the key of a node read into a pooled buffer, which is
+// handed back with putNodeKey once the read and the decoding are done.
+func getNodeKey(f nodeKeyFormat, depth uint8, path uint64) *[]byte {
+	buf := nodeKeyPool.Get().(*[]byte)
+	*buf = f.appendKey((*buf)[:0], depth, path)
+	return buf
+}
+
+func putNodeKey(buf *[]byte) {
+	nodeKeyPool.Put(buf)
+}
+
+// nodeKeyArena allocates the keys of a batch of nodes from shared chunks,
+// instead of a separate allocation per key. The keys stay valid as long as
+// they are referenced. An arena cannot be used concurrently.
+type nodeKeyArena struct {
+	format nodeKeyFormat
+	buf    []byte
+}
+
+// newNodeKeyArena returns an arena holding the keys of n nodes in a single chunk.
+func newNodeKeyArena(format nodeKeyFormat, n int) *nodeKeyArena {
+	return &nodeKeyArena{format: format, buf: make([]byte, 0, n*maxNodeKeySize)}
+}
+
+func (a *nodeKeyArena) key(depth uint8, path uint64) []byte {
+	if cap(a.buf)-len(a.buf) < maxNodeKeySize {
+		a.buf = make([]byte, 0, nodeKeyChunk*maxNodeKeySize)
+	}
+	start := len(a.buf)
+	a.buf = a.format.appendKey(a.buf, depth, path)
+	return a.buf[start:len(a.buf):len(a.buf)]
+}
+
+// initNodeKeyFormat adopts the persisted key format of an existing tree, and
+// persists the configured one for a new tree. It runs before any node is read.
+func (tree *BNBSparseMerkleTree) initNodeKeyFormat() error {
+	values, err := tree.db.MultiGet([][]byte{nodeKeyFormatKey, latestVersionKey})
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(values[0]) == 1:
+		tree.nodeKeys = nodeKeyFormat(values[0][0])
+		if tree.nodeKeys > compactNodeKeys {
+			return errors.Wrapf(ErrUnexpected, "unknown node key format %d", tree.nodeKeys)
+		}
+	case values[0] != nil:
+		return errors.Wrap(ErrUnexpected, "malformed node key format")
+	case values[1] != nil:
+		// the trees created before the format was recorded
+		tree.nodeKeys = standardNodeKeys
+	case tree.nodeKeys != standardNodeKeys && !tree.readOnly:
+		return tree.db.Set(nodeKeyFormatKey, []byte{byte(tree.nodeKeys)})
+	}
+	return nil
+}
+
+// readNode reads the stored record of a node, returning nil if it does not exist.
+func (tree *BNBSparseMerkleTree) readNode(depth uint8, path uint64) (*StorageTreeNode, error) {
+	key := getNodeKey(tree.nodeKeys, depth, path)
+	defer putNodeKey(key)
+
+	rlpBytes, err := tree.db.Get(*key)
+	if errors.Is(err, database.ErrDatabaseNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeStorageTreeNode(*key, rlpBytes)
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_NodeKeyFormat(t *testing.T) {
+	for _, depth := range []uint8{0, 4, 8, 36, 64} {
+		path := uint64(0xfedcba9876543210)
+		if depth < 64 {
+			path &= 1<<depth - 1
+		}
+		standard := standardNodeKeys.key(depth, path)
+		if !bytes.Equal(standard, storageFullTreeNodeKey(depth, path)) {
+			t.Fatalf("standard key of depth %d should be unchanged, %x", depth, standard)
+		}
+		compact := compactNodeKeys.key(depth, path)
+		if len(compact) != 1+(int(depth)+7)/8 {
+			t.Fatalf("compact key of depth %d has size %d", depth, len(compact))
+		}
+		for _, format := range []nodeKeyFormat{standardNodeKeys, compactNodeKeys} {
+			key := format.key(depth, path)
+			if !bytes.HasPrefix(key, format.levelPrefix(depth)) {
+				t.Fatalf("key %x should be under the level prefix", key)
+			}
+			if decoded, ok := format.leafPath(key, depth); !ok || decoded != path {
+				t.Fatalf("path of key %x decoded as %x", key, decoded)
+			}
+		}
+	}
+
+	arena := newNodeKeyArena(compactNodeKeys, 1)
+	first := arena.key(8, 1)
+	second := arena.key(8, 2)
+	if !bytes.Equal(first, compactNodeKeys.key(8, 1)) || !bytes.Equal(second, compactNodeKeys.key(8, 2)) {
+		t.Fatalf("arena keys should not overlap, %x %x", first, second)
+	}
+}
+
+func Test_BNBSparseMerkleTree_CompactNodeKeys(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+
+	items := prepareKVData(env.hasher)
+	smt, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash, CompactNodeKeys(), BloomFilter(uint64(len(items)), 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := memDB.Has(storageFullTreeNodeKey(8, items[0].Key)); has {
+		t.Fatal("nodes should not be stored under the standard keys")
+	}
+	if has, _ := memDB.Has(compactNodeKeys.key(8, items[0].Key)); !has {
+		t.Fatal("nodes should be stored under the compact keys")
+	}
+
+	// the persisted format is adopted, and the bloom filter is rebuilt from the compact keys
+	if err := memDB.Delete(bloomFilterKey); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash, BloomFilter(uint64(len(items)), 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.(*BNBSparseMerkleTree).nodeKeys != compactNodeKeys {
+		t.Fatal("the persisted key format should be adopted")
+	}
+	verifyItems(t, smt, reopened, items)
+
+	// an existing tree keeps the standard format
+	legacyDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacyDB.Close()
+	legacy, err := NewBNBSparseMerkleTree(env.hasher, legacyDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := legacyDB.Has(nodeKeyFormatKey); has {
+		t.Fatal("the standard format should not be recorded")
+	}
+	legacy, err = NewBNBSparseMerkleTree(env.hasher, legacyDB, 8, nilHash, CompactNodeKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.(*BNBSparseMerkleTree).nodeKeys != standardNodeKeys {
+		t.Fatal("an existing tree should keep the standard format")
+	}
+	verifyItems(t, smt, legacy, items)
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// opLogPrefix is the prefix of the operation log records, format: opLog:${version}
+var opLogPrefix = []byte(`opLog:`)
+
+func opLogKey(version Version) []byte {
+	return append(append([]byte(nil), opLogPrefix...), encodeVersion(version)...)
+}
+
+// Operation is a leaf write recorded in the operation log.
+type Operation struct {
+	Version Version
+	Key     uint64
+	// OldVal is the value before the version, empty if the leaf is created by the version.
+	OldVal []byte
+	NewVal []byte
+}
+
+// newOperation records the last write of the dirty leaf.
+func newOperation(leaf *TreeNode, version Version) *Operation {
+	leaf.mu.RLock()
+	defer leaf.mu.RUnlock()
+
+	op := &Operation{Version: version, Key: leaf.path, NewVal: leaf.root()}
+	if n := len(leaf.Versions); n > 1 {
+		op.OldVal = leaf.Versions[n-2].Hash
+	}
+	return op
+}
+
+// writeOperations appends the operations of the version to the log.
+func (tree *BNBSparseMerkleTree) writeOperations(batch database.Batcher, version Version, operations []*Operation) error {
+	sort.Slice(operations, func(i, j int) bool { return operations[i].Key < operations[j].Key })
+	data, err := rlp.EncodeToBytes(operations)
+	if err != nil {
+		return err
+	}
+	return batch.Set(opLogKey(version), data)
+}
+
+// ReadOperations reads back the operations of the versions in [from, to] from
+// the operation log, ordered by version and key. Only the versions committed
+// with the OperationLog option enabled are recorded, the log of the rolled back
+// versions is removed.
+func (tree *BNBSparseMerkleTree) ReadOperations(from, to Version) ([]*Operation, error) {
+	var operations []*Operation
+	err := tree.scanOperations(from, to, func(_ Version, ops []*Operation) error {
+		operations = append(operations, ops...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
+
+// scanOperations calls fn with the operations of every logged version in
+// [from, to], in ascending order of version, and stops at the first error.
+func (tree *BNBSparseMerkleTree) scanOperations(from, to Version, fn func(version Version, ops []*Operation) error) error {
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+	it := tree.db.NewIterator(opLogPrefix, encodeVersion(from))
+	defer it.Release()
+	for it.Next() {
+		version := Version(binary.BigEndian.Uint64(it.Key()[len(opLogPrefix):]))
+		if version > to {
+			break
+		}
+		var ops []*Operation
+		if err := rlp.DecodeBytes(it.Value(), &ops); err != nil {
+			return err
+		}
+		if err := fn(version, ops); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
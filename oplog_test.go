@@ -0,0 +1,66 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_OperationLog(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, OperationLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:3] {
+		if err := smt.Set(items[0].Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ops, err := tree.ReadOperations(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 4 {
+		t.Fatalf("expected 4 operations, got %d", len(ops))
+	}
+	for _, op := range ops {
+		if op.Key != items[0].Key {
+			continue
+		}
+		want := items[op.Version-2].Val
+		if !bytes.Equal(op.OldVal, want) || !bytes.Equal(op.NewVal, items[op.Version-1].Val) {
+			t.Fatalf("unexpected operation of version %d, %x -> %x", op.Version, op.OldVal, op.NewVal)
+		}
+	}
+
+	if err := smt.Rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	ops, err = tree.ReadOperations(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 || ops[0].Version != 1 || len(ops[0].OldVal) != 0 {
+		t.Fatalf("the log of the rolled back version should be removed, got %d operations", len(ops))
+	}
+}
@@ -6,7 +6,11 @@
 package bsmt
 
 import (
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/logger"
 	"github.com/bnb-chain/zkbnb-smt/metrics"
+	"github.com/bnb-chain/zkbnb-smt/tracing"
 	"github.com/panjf2000/ants/v2"
 )
 
@@ -31,12 +35,48 @@ func DBCacheSize(size int) Option {
 	}
 }
 
+// SharedNodeCache caches the leaves of the tree in a NodeCache shared with other
+// trees, instead of a cache of DBCacheSize leaves of its own.
+func SharedNodeCache(cache *NodeCache) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.nodeCache = cache
+	}
+}
+
 func GoRoutinePool(pool *ants.Pool) Option {
 	return func(smt *BNBSparseMerkleTree) {
 		smt.goroutinePool = pool
 	}
 }
 
+// CommitWorkers sets the number of workers preparing the dirty subtrees of a
+// commit, GOMAXPROCS by default. A commit uses at most 16 workers, one per
+// subtree of the root.
+func CommitWorkers(n int) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.commitWorkers = n
+	}
+}
+
+// ProofWorkers sets the number of workers building the proofs of GetProofs,
+// GOMAXPROCS by default.
+func ProofWorkers(n int) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.proofWorkers = n
+	}
+}
+
+// BloomFilter maintains a bloom filter over the committed leaf keys, sized for
+// expectedKeys keys at the falsePositiveRate. Get and Contains answer the keys
+// absent from the filter without reading the tree. The filter is persisted by
+// each commit adding keys, and rebuilt from the stored leaves on open if it is
+// missing or was sized differently.
+func BloomFilter(expectedKeys uint64, falsePositiveRate float64) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.bloom = newBloomFilter(expectedKeys, falsePositiveRate)
+	}
+}
+
 func GCThreshold(threshold uint64) Option {
 	return func(smt *BNBSparseMerkleTree) {
 		if smt.gcStatus != nil {
@@ -47,8 +87,278 @@ func GCThreshold(threshold uint64) Option {
 	}
 }
 
-func EnableMetrics(metrics metrics.Metrics) Option {
+// GCHardLimit caps the in-memory size of the tree after each commit, in the
+// bytes accounted by Size. Unlike GCThreshold, which releases the nodes not
+// updated by the recent versions, the limit is enforced even if all the nodes
+// were updated by the last commits: the nodes not updated by the latest
+// version are released first, then all the nodes below the root.
+// The limit is enforced by Commit, also if BackgroundGC is enabled.
+func GCHardLimit(limit uint64) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.gcHardLimit = limit
+	}
+}
+
+// MemoryCap caps the memory size of the tree, in the bytes accounted by Size,
+// including the dirty nodes waiting for the next commit. Once a commit leaves
+// the tree above the cap, the committed subtrees least recently set or proven
+// are released, they are loaded from the database again on demand. Once the
+// dirty nodes of Set or MultiSet exceed the cap, they are committed early as
+// the next version, as by Commit(nil), so the versions set by a caller must
+// fit under the cap to map to its own versions.
+func MemoryCap(limit uint64) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.memoryCap = limit
+		smt.access.used = make([]uint64, 1<<smt.evictDepth())
+	}
+}
+
+// PipelinedCommit moves the database write of a commit into the background,
+// so the sets of the next version overlap with it. Commit returns once the
+// dirty nodes are encoded, and the next operation reaching the database waits
+// for the write, including the next Commit. WaitCommit waits for the write
+// explicitly, before the database is closed. A failed write is reverted by the
+// next operation reaching the database, which fails with the commit error and
+// discards the changes set since the failed commit, see WaitCommit.
+func PipelinedCommit() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.pipeline = &commitPipeline{}
+	}
+}
+
+// BackgroundGC moves the release of the in-memory nodes of the pruned versions
+// out of Commit into a background worker. A sweep releases one subtree of the root
+// at a time, pausing for pace between the subtrees. The worker is stopped with StopGC.
+func BackgroundGC(pace time.Duration) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.gcAsync = true
+		smt.gcPace = pace
+	}
+}
+
+// RetainVersions keeps the last n committed versions queryable, and treats
+// the older ones as prunable when Commit is called without a recent version.
+// An explicit recent version passed to Commit takes precedence.
+func RetainVersions(n uint) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.retainVersions = n
+	}
+}
+
+// AutoPrune keeps pruning the node versions written by a Commit without a
+// recent version up to the current recent version, set by an earlier Commit
+// or Prune. Otherwise a Commit without a recent version prunes nothing.
+func AutoPrune() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.autoPrune = true
+	}
+}
+
+// MaxRollbackDepth sets the rollback window, the number of versions Rollback
+// can reach back from the latest version. The recent version is held back so
+// the versions of the window are never pruned, and Rollback refuses to go
+// deeper with ErrVersionTooOld. The window is persisted, and applies to the
+// tree opened later without the option as well.
+func MaxRollbackDepth(n uint64) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.maxRollbackDepth = n
+	}
+}
+
+// HashArena allocates the hashes computed by the tree out of chunks holding
+// hashesPerChunk hashes, a new chunk is started for every version. It cuts the
+// number of heap objects tracked by the Go GC, at the cost of the memory of a
+// chunk being held until all of its hashes are released.
+func HashArena(hashesPerChunk int) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		if hashesPerChunk > 0 {
+			smt.hasher = smt.hasher.withArena(newHashArena(hashesPerChunk))
+		}
+	}
+}
+
+// CompactNodeKeys stores the nodes under a shorter binary key, the depth
+// packed into the leading byte followed by the significant bytes of the path,
+// instead of t:${depth}:${path}. The format is persisted when the tree is
+// created, an existing tree keeps the format it was created with.
+func CompactNodeKeys() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.nodeKeys = compactNodeKeys
+	}
+}
+
+// ArchiveMode keeps every committed version queryable. The recent versions
+// passed to Commit and the RetainVersions policy are ignored, and the explicit
+// pruning calls fail with ErrArchiveMode. The in-memory nodes are still released
+// by the GC, and reloaded from the database on demand.
+func ArchiveMode() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.archive = true
+	}
+}
+
+// OffloadReleased moves the records of the nodes released from memory by the
+// GC to the cold tier, e.g. the objstore.Database the tree is stored in. The
+// released nodes have not been updated since the pruned versions, and are
+// downloaded again on demand. The nodes released by GCHardLimit are not offloaded.
+func OffloadReleased(tier Offloader) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.coldTier = tier
+	}
+}
+
+// ArchiveOnPrune hands the stored node records over to the sink before the
+// pruned versions are removed from them, so the full history can be reconstructed
+// offline while the database only retains the recent versions.
+func ArchiveOnPrune(sink ArchiveSink) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.archiveSink = sink
+	}
+}
+
+// PruneGate installs a hook consulted before any version is pruned, e.g. to
+// keep the versions which are not finalized on-chain yet. The recent version,
+// whether passed to Commit, derived from RetainVersions or requested by Prune,
+// is held back to the oldest version the gate returns false for.
+func PruneGate(gate func(v Version) bool) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.pruneGate = gate
+	}
+}
+
+// ReadOnly opens the tree without writing to the database, to inspect the
+// database of a running tree or of a crashed one: an interrupted commit is
+// neither finished nor rolled back but reported by InterruptedCommit, the node
+// key format, the rollback depth and the bloom filter are not recorded, and
+// the background GC is not started. Every write to the database fails with
+// database.ErrReadOnly, on any backend.
+func ReadOnly() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.readOnly = true
+	}
+}
+
+// OperationLog records the leaf writes of every commit as (key, old value,
+// new value, version) operations in an append-only log stored in the database,
+// which is read back with ReadOperations.
+func OperationLog() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.opLog = true
+	}
+}
+
+// AuditLog records the leaf writes of every commit with the tag set by
+// SetAuditTag, e.g. the operator who made the change, in an append-only log
+// stored in the database, which is read back with ReadAuditLog and ReadKeyAuditLog.
+func AuditLog() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.auditLog = true
+	}
+}
+
+// EnableMetrics reports the state of the tree to the metrics after each commit,
+// rollback and GC. If the metrics implement metrics.OperationMetrics, the
+// latencies of the commits and proofs, the GC runs and the node lookups are
+// reported as well.
+func EnableMetrics(m metrics.Metrics) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.metrics = m
+		smt.opMetrics, _ = m.(metrics.OperationMetrics)
+	}
+}
+
+// Tracing reports the spans of Commit, Rollback, GetProof and their database
+// batch writes to the tracer. CommitContext, RollbackContext and GetProofContext
+// start the spans as children of the span of the caller's context.
+func Tracing(tracer tracing.Tracer) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.tracer = tracer
+	}
+}
+
+// Logging reports the GC decisions, the repairs of interrupted commits, the
+// failed background writes and the slow operations to the logger.
+func Logging(l logger.Logger) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.log = l
+	}
+}
+
+// SlowOperationThreshold sets the duration the commits, rollbacks and proofs
+// taking longer are logged as slow at, default is one second. A negative
+// threshold disables the logging of the slow operations.
+func SlowOperationThreshold(threshold time.Duration) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.slowThreshold = threshold
+	}
+}
+
+// WriteBehind enables the asynchronous write-behind mode. A commit only writes
+// the dirty leaves as a single journal record together with the version marker,
+// and the nodes are materialized by a background writer. The commits journaled
+// by a previous process are rebuilt from their leaves when the tree is opened.
+// Commits block once maxLag journal records are waiting to be materialized.
+func WriteBehind(maxLag int) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.writeBehindLag = maxLag
+	}
+}
+
+// ProfileLabels tags the goroutines hashing, encoding, persisting, collecting
+// and building proofs for the tree with the pprof label "bsmt", whose value is
+// the Phase, so CPU profiles can be filtered by phase.
+func ProfileLabels() Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.profileLabels = true
+	}
+}
+
+// PhaseHook reports the duration of each phase of the tree operations. The
+// hook is called synchronously and may be called concurrently, the persist
+// phase of a PipelinedCommit is reported from the background writer.
+func PhaseHook(hook func(phase Phase, elapsed time.Duration)) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.phaseHook = hook
+	}
+}
+
+// MetricsWindow sets the sliding window of the statistics returned by Metrics,
+// one minute by default.
+func MetricsWindow(window time.Duration) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.statsWindow = window
+	}
+}
+
+// PreloadLevels loads the stored nodes of the top levels below the root when
+// the tree is opened, with a batched MultiGet per level instead of faulting
+// them in one read at a time. A level spans 4 bits of the keys, so the level n
+// holds up to 16^n nodes.
+func PreloadLevels(levels int) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.preloadLevels = levels
+	}
+}
+
+// StreamingRestore restores a tree whose nodes exceed the memory: the top
+// eagerLevels below the root are loaded when the tree is opened, as with
+// PreloadLevels, and the rest are faulted in by the operations reaching them.
+// A read faulting in the path of a key also prefetches the prefetchDepth levels
+// below the topmost faulted node with a batched read per level, so the keys
+// near a read one are served from memory. The nodes loaded are released by
+// the GC as usual.
+func StreamingRestore(eagerLevels, prefetchDepth int) Option {
+	return func(smt *BNBSparseMerkleTree) {
+		smt.preloadLevels = eagerLevels
+		smt.prefetchDepth = prefetchDepth
+	}
+}
+
+// MaxGCBacklog sets the number of prunable versions whose nodes have not been
+// released yet, beyond which HealthCheck fails with ErrGCBacklog. The backlog
+// is not checked by default.
+func MaxGCBacklog(n uint64) Option {
 	return func(smt *BNBSparseMerkleTree) {
-		smt.metrics = metrics
+		smt.maxGCBacklog = n
 	}
 }
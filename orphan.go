@@ -0,0 +1,215 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// orphanPrefix is the prefix of the orphan records, format: orphans:${version}
+// Each record lists the nodes rewritten by the version whose stored records
+// still keep versions superseded by it. Once the version becomes prunable,
+// the superseded versions are orphaned and trimmed from those exact records.
+var orphanPrefix = []byte(`orphans:`)
+
+// orphanEntrySize is the size of an orphaned node in a record, depth followed by path.
+const orphanEntrySize = 9
+
+func orphanKey(version Version) []byte {
+	return append(append([]byte(nil), orphanPrefix...), encodeVersion(version)...)
+}
+
+// encodeVersion encodes the version as the big-endian suffix of the versioned keys.
+func encodeVersion(version Version) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+	return buf
+}
+
+// orphans collects the nodes with superseded versions written by a commit.
+type orphans []byte
+
+func (o *orphans) add(node *TreeNode) {
+	var entry [orphanEntrySize]byte
+	entry[0] = node.depth
+	binary.BigEndian.PutUint64(entry[1:], node.path)
+	*o = append(*o, entry[:]...)
+}
+
+// keys decodes the storage keys of the nodes in a record.
+func (o orphans) keys(format nodeKeyFormat) ([][]byte, error) {
+	if len(o)%orphanEntrySize != 0 {
+		return nil, ErrUnexpected
+	}
+	arena := newNodeKeyArena(format, len(o)/orphanEntrySize)
+	keys := make([][]byte, 0, len(o)/orphanEntrySize)
+	for i := 0; i < len(o); i += orphanEntrySize {
+		keys = append(keys, arena.key(o[i], binary.BigEndian.Uint64(o[i+1:i+orphanEntrySize])))
+	}
+	return keys, nil
+}
+
+// orphanLookupLimit is the widest version range the orphan records are looked up
+// by key rather than iterated, iterating waits for the write-behind records.
+const orphanLookupLimit = 1024
+
+// pruneOrphans trims the orphaned versions from the stored nodes listed by
+// the orphan records of the versions in (from, to], and deletes the records
+// which no pinned version refers to.
+func (tree *BNBSparseMerkleTree) pruneOrphans(from, to Version) error {
+	records, keys, err := tree.collectOrphans(from, to)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	values, err := tree.db.MultiGet(keys)
+	if err != nil {
+		return err
+	}
+	batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		data, trimmed, err := trimStorageNode(keys[i], value, to, tree.pinned)
+		if err != nil {
+			return err
+		}
+		if !trimmed {
+			continue
+		}
+		if err := tree.archiveRecord(to, keys[i], value); err != nil {
+			return err
+		}
+		if err := batch.Set(keys[i], data); err != nil {
+			return err
+		}
+	}
+	for _, key := range records {
+		if tree.referencedByPins(orphanVersion(key)) {
+			continue
+		}
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// orphanVersion returns the version of an orphan record key.
+func orphanVersion(key []byte) Version {
+	return Version(binary.BigEndian.Uint64(key[len(orphanPrefix):]))
+}
+
+// referencedByPins reports whether a pinned version below the version may
+// refer to the node versions orphaned by it. The states of the pins are kept
+// by the pruning, the orphan record lists the nodes to trim once the pinned
+// versions referring to them are unpinned.
+func (tree *BNBSparseMerkleTree) referencedByPins(version Version) bool {
+	return len(tree.pinned) > 0 && tree.pinned[0] < version
+}
+
+// collectOrphans returns the keys of the orphan records of the versions in
+// (from, to], and the distinct storage keys of the nodes they list.
+func (tree *BNBSparseMerkleTree) collectOrphans(from, to Version) (records, keys [][]byte, err error) {
+	if tree.db == nil || to <= from {
+		return nil, nil, nil
+	}
+	seen := make(map[string]struct{})
+	collect := func(key, value []byte) error {
+		recordKeys, err := orphans(value).keys(tree.nodeKeys)
+		if err != nil {
+			return err
+		}
+		for _, key := range recordKeys {
+			if _, ok := seen[string(key)]; !ok {
+				seen[string(key)] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+		records = append(records, key)
+		return nil
+	}
+	if to-from <= orphanLookupLimit {
+		lookup := make([][]byte, 0, to-from)
+		for version := from + 1; version <= to; version++ {
+			lookup = append(lookup, orphanKey(version))
+		}
+		values, err := tree.db.MultiGet(lookup)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			if err := collect(lookup[i], value); err != nil {
+				return nil, nil, err
+			}
+		}
+		return records, keys, nil
+	}
+
+	it := tree.db.NewIterator(orphanPrefix, encodeVersion(from+1))
+	defer it.Release()
+	for it.Next() {
+		if Version(binary.BigEndian.Uint64(it.Key()[len(orphanPrefix):])) > to {
+			break
+		}
+		if err := collect(append([]byte(nil), it.Key()...), it.Value()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, nil, err
+	}
+	return records, keys, nil
+}
+
+// trimStorageNode removes the versions older than version, except the pinned ones,
+// from the stored node and its children, and reports whether any version was removed.
+func trimStorageNode(key, value []byte, version Version, pinned []Version) ([]byte, bool, error) {
+	node, err := decodeStorageTreeNode(key, value)
+	if err != nil {
+		return nil, false, err
+	}
+	trimmed := false
+	if versions := pruneVersions(node.Versions, version, pinned); len(versions) != len(node.Versions) {
+		node.Versions = versions
+		trimmed = true
+	}
+	for _, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		if versions := pruneVersions(child.Versions, version, pinned); len(versions) != len(child.Versions) {
+			child.Versions = versions
+			trimmed = true
+		}
+	}
+	if !trimmed {
+		return value, false, nil
+	}
+	data, err := encodeStorageTreeNode(node)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// discardVersionRecords deletes the records keyed by prefix and a version above
+// version, which is removed by a rollback.
+func (tree *BNBSparseMerkleTree) discardVersionRecords(db database.Batcher, prefix []byte, version Version) error {
+	it := tree.db.NewIterator(prefix, encodeVersion(version+1))
+	defer it.Release()
+	for it.Next() {
+		if err := db.Delete(append([]byte(nil), it.Key()...)); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
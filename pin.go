@@ -0,0 +1,177 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// pinnedVersionsKey is the key of the versions pinned against pruning.
+var pinnedVersionsKey = []byte(`pinnedVersions`)
+
+func decodePinnedVersions(data []byte) ([]Version, error) {
+	var pinned []Version
+	if err := rlp.DecodeBytes(data, &pinned); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// writePinnedVersions persists the pinned versions into the batch.
+func writePinnedVersions(batch database.Batcher, pinned []Version) error {
+	if len(pinned) == 0 {
+		return batch.Delete(pinnedVersionsKey)
+	}
+	data, err := rlp.EncodeToBytes(pinned)
+	if err != nil {
+		return err
+	}
+	return batch.Set(pinnedVersionsKey, data)
+}
+
+// isPinned reports whether the version is pinned against pruning.
+func (tree *BNBSparseMerkleTree) isPinned(version Version) bool {
+	i := sort.Search(len(tree.pinned), func(i int) bool { return tree.pinned[i] >= version })
+	return i < len(tree.pinned) && tree.pinned[i] == version
+}
+
+// savePinnedVersions persists the pinned versions and installs them.
+func (tree *BNBSparseMerkleTree) savePinnedVersions(pinned []Version) error {
+	batch := tree.db.NewBatch()
+	if err := writePinnedVersions(batch, pinned); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	tree.pinned = pinned
+	return nil
+}
+
+// PinVersion protects the version from pruning, e.g. an exit root or an audit
+// checkpoint. The state of a pinned version stays queryable after the recent
+// version passes it, regardless of the retention policy. The pins are persisted,
+// and removed by a rollback below them.
+func (tree *BNBSparseMerkleTree) PinVersion(version Version) error {
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+
+	// the write of a pipelined commit reads the pins
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+
+	if version < tree.recentVersion {
+		return ErrVersionTooOld
+	}
+	if version > tree.version {
+		return ErrVersionTooHigh
+	}
+	if tree.isPruned(version) {
+		return ErrVersionPruned
+	}
+	if tree.isPinned(version) {
+		return nil
+	}
+	pinned := append(append([]Version(nil), tree.pinned...), version)
+	sort.Slice(pinned, func(i, j int) bool { return pinned[i] < pinned[j] })
+	return tree.savePinnedVersions(pinned)
+}
+
+// UnpinVersion removes the protection of the version. An unpinned version
+// older than the recent version can no longer be queried, and the node versions
+// no other retained version refers to are reclaimed: the stored nodes listed by
+// the orphan records of the versions above the unpinned one are trimmed, and
+// the orphan records no pinned version refers to anymore are deleted.
+func (tree *BNBSparseMerkleTree) UnpinVersion(version Version) error {
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+
+	// the write of a pipelined commit reads the pins
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+
+	if !tree.isPinned(version) {
+		return nil
+	}
+	pinned := make([]Version, 0, len(tree.pinned)-1)
+	for _, v := range tree.pinned {
+		if v != version {
+			pinned = append(pinned, v)
+		}
+	}
+	if err := tree.savePinnedVersions(pinned); err != nil {
+		return err
+	}
+	return tree.reclaimUnpinned(version)
+}
+
+// reclaimUnpinned trims the node versions kept for the unpinned version, which
+// are orphaned by the versions in (version, recent version], from the stored
+// and the in-memory nodes.
+func (tree *BNBSparseMerkleTree) reclaimUnpinned(version Version) error {
+	if tree.db == nil || version >= tree.recentVersion {
+		return nil
+	}
+	records, keys, err := tree.collectOrphans(version, tree.recentVersion)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	values, err := tree.db.MultiGet(keys)
+	if err != nil {
+		return err
+	}
+	batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		data, trimmed, err := trimStorageNode(keys[i], value, tree.recentVersion, tree.pinned)
+		if err != nil {
+			return err
+		}
+		if !trimmed {
+			continue
+		}
+		if err := tree.archiveRecord(tree.recentVersion, keys[i], value); err != nil {
+			return err
+		}
+		if err := batch.Set(keys[i], data); err != nil {
+			return err
+		}
+	}
+	for _, key := range records {
+		if tree.referencedByPins(orphanVersion(key)) {
+			continue
+		}
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	// the loaded nodes would write the reclaimed versions back
+	tree.root.trimLoaded(tree.recentVersion, tree.pinned)
+	if tree.lastSaveRoot != nil && tree.lastSaveRoot != tree.root {
+		tree.lastSaveRoot.trimLoaded(tree.recentVersion, tree.pinned)
+	}
+	tree.dbCache.Purge()
+	return nil
+}
+
+// PinnedVersions returns the pinned versions in ascending order.
+func (tree *BNBSparseMerkleTree) PinnedVersions() []Version {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	return append([]Version(nil), tree.pinned...)
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+// PinKeys keeps the nodes on the paths of the hot keys, such as the fee and
+// operator accounts, in memory: they are loaded right away and are never
+// released by the GC, GCHardLimit nor MemoryCap, so the proofs and updates of
+// the keys never read the database. The siblings of the paths are released as
+// usual. The pins are kept by the updated nodes, but not persisted, a reopened
+// tree must pin the keys again. Like Set, PinKeys must not be called
+// concurrently with the other writes.
+func (tree *BNBSparseMerkleTree) PinKeys(keys []uint64) error {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	for _, key := range keys {
+		if key >= 1<<tree.maxDepth {
+			return ErrInvalidKey
+		}
+	}
+	if err := tree.loadPaths(keys, cacheOpCounted); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		node := tree.root
+		for depth := 4; depth <= int(tree.maxDepth); depth += 4 {
+			node = tree.child(node, key>>(int(tree.maxDepth)-depth)&0xf)
+			node.mu.Lock()
+			node.pinned = true
+			node.mu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_PinKeys(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &readCountingDB{TreeDB: memDB}
+
+	const limit = 16 * 1024
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash, GCHardLimit(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	hot := []uint64{0x0001, 0xfffe}
+	for _, key := range hot {
+		if err := smt.Set(key, env.hasher.Hash([]byte{byte(key)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.PinKeys(append(hot, 1<<16)); err != ErrInvalidKey {
+		t.Fatalf("an invalid key should be rejected, got %v", err)
+	}
+	if err := tree.PinKeys(hot); err != nil {
+		t.Fatal(err)
+	}
+
+	// the commits update all the other subtrees, and release them
+	for round := 0; round < 3; round++ {
+		for key := uint64(0x100 + round); key < 0xff00; key += 0x100 {
+			if err := smt.Set(key, env.hasher.Hash([]byte{byte(round), byte(key >> 8)})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if smt.Size() > limit {
+		t.Fatalf("the size %d should be within the hard limit", smt.Size())
+	}
+
+	nodes := db.nodes
+	for _, key := range hot {
+		proof, err := smt.GetProof(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !smt.VerifyProof(key, proof) {
+			t.Fatalf("proof of the pinned key %d should verify", key)
+		}
+	}
+	if db.nodes != nodes {
+		t.Fatalf("the proofs of the pinned keys should not read the database, got %d nodes", db.nodes-nodes)
+	}
+
+	// the pins survive the updates of the keys
+	if err := smt.Set(hot[0], env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Prune(smt.LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+	nodes = db.nodes
+	if _, err := smt.GetProof(hot[0]); err != nil {
+		t.Fatal(err)
+	}
+	if db.nodes != nodes {
+		t.Fatalf("the updated pinned key should stay in memory, got %d nodes", db.nodes-nodes)
+	}
+	if _, err := smt.GetProof(0x0101); err != nil {
+		t.Fatal(err)
+	}
+	if db.nodes == nodes {
+		t.Fatal("the other keys should be released")
+	}
+}
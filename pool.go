@@ -0,0 +1,88 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// recordBuffer is the scratch space of encoding a node record.
+type recordBuffer struct {
+	node   StorageTreeNode
+	leaves [16]StorageLeafNode
+	buf    bytes.Buffer
+}
+
+var (
+	recordBufferPool = sync.Pool{
+		New: func() interface{} {
+			return new(recordBuffer)
+		},
+	}
+
+	// pathNodesPool keeps the scratch slices of the nodes on the path of a key.
+	pathNodesPool = sync.Pool{
+		New: func() interface{} {
+			nodes := make([]*TreeNode, 0, 16)
+			return &nodes
+		},
+	}
+)
+
+// encodeTreeNode encodes the storage record of the node like
+// encodeStorageTreeNode(node.ToStorageTreeNode()), reusing the scratch space.
+func encodeTreeNode(node *TreeNode) ([]byte, error) {
+	rb := recordBufferPool.Get().(*recordBuffer)
+	defer func() {
+		rb.node = StorageTreeNode{}
+		rb.leaves = [16]StorageLeafNode{}
+		rb.buf.Reset()
+		recordBufferPool.Put(rb)
+	}()
+
+	node.mu.RLock()
+	for i := 0; i < 16; i++ {
+		if node.Children[i] != nil {
+			rb.leaves[i].Versions = node.Children[i].Versions
+			rb.node.Children[i] = &rb.leaves[i]
+		}
+	}
+	rb.node.Internals = node.internalHashes()
+	rb.node.Versions = node.Versions
+	rb.node.Path = node.path
+	err := rlp.Encode(&rb.buf, &rb.node)
+	node.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return appendChecksum(rb.buf.Bytes()), nil
+}
+
+// appendChecksum returns a copy of the encoding followed by its CRC-32C checksum.
+func appendChecksum(data []byte) []byte {
+	record := make([]byte, len(data)+checksumSize)
+	copy(record, data)
+	binary.BigEndian.PutUint32(record[len(data):], crc32.Checksum(data, crc32Table))
+	return record
+}
+
+func getPathNodes() *[]*TreeNode {
+	return pathNodesPool.Get().(*[]*TreeNode)
+}
+
+func putPathNodes(nodes *[]*TreeNode) {
+	*nodes = (*nodes)[:cap(*nodes)]
+	for i := range *nodes {
+		(*nodes)[i] = nil
+	}
+	*nodes = (*nodes)[:0]
+	pathNodesPool.Put(nodes)
+}
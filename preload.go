@@ -0,0 +1,71 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+// preloadBatch is the number of nodes read by a single MultiGet of preload.
+const preloadBatch = 4096
+
+// preload loads the stored nodes of the levels below the root breadth-first,
+// the children of each level are read with batched MultiGets keyed off the
+// nodes of the level above, instead of a read per node. On a remote database
+// such as Redis, the MultiGets are served by MGET or pipelined GETs, so the
+// top of a large tree is restored in a few round trips.
+func (tree *BNBSparseMerkleTree) preload(levels int) error {
+	return tree.preloadFrom([]*TreeNode{tree.root}, levels)
+}
+
+// preloadFrom loads the stored nodes of the levels below the parents, as
+// preload does from the root. The nodes faulted in meanwhile by the reads are
+// kept in place.
+func (tree *BNBSparseMerkleTree) preloadFrom(parents []*TreeNode, levels int) error {
+	type child struct {
+		parent *TreeNode
+		nibble uint64
+	}
+	for level := 0; level < levels && len(parents) > 0; level++ {
+		var children []child
+		for _, parent := range parents {
+			if parent.depth == tree.maxDepth {
+				continue
+			}
+			for nibble := uint64(0); nibble < 16; nibble++ {
+				if c := tree.child(parent, nibble); c != nil && c.IsTemporary() {
+					children = append(children, child{parent, nibble})
+				}
+			}
+		}
+
+		var loaded []*TreeNode
+		for from := 0; from < len(children); from += preloadBatch {
+			to := from + preloadBatch
+			if to > len(children) {
+				to = len(children)
+			}
+			arena := newNodeKeyArena(tree.nodeKeys, to-from)
+			keys := make([][]byte, to-from)
+			for i, c := range children[from:to] {
+				keys[i] = arena.key(c.parent.depth+4, c.parent.path<<4+c.nibble)
+			}
+			values, err := tree.db.MultiGet(keys)
+			if err != nil {
+				return err
+			}
+			for i, c := range children[from:to] {
+				if values[i] == nil {
+					continue
+				}
+				storageTreeNode, err := decodeStorageTreeNode(keys[i], values[i])
+				if err != nil {
+					return err
+				}
+				node := storageTreeNode.ToTreeNode(c.parent.depth+4, tree.nilHashes, tree.hasher)
+				loaded = append(loaded, tree.attachChild(c.parent, c.nibble, node))
+			}
+		}
+		parents = loaded
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// profileLabel is the pprof label key the goroutines working for the tree are tagged with.
+const profileLabel = "bsmt"
+
+// Phase is a phase of the tree operations, reported to the PhaseHook and used
+// as the pprof label of the goroutines working on it.
+type Phase int
+
+const (
+	// PhaseHash is the hashing of the paths by Set and MultiSet.
+	PhaseHash Phase = iota
+	// PhaseEncode is the pruning and encoding of the dirty nodes by Commit.
+	PhaseEncode
+	// PhasePersist is the write of the commit batch, in the background with PipelinedCommit.
+	PhasePersist
+	// PhaseGC is the release of the in-memory nodes by the GC.
+	PhaseGC
+	// PhaseProof is the construction of proofs.
+	PhaseProof
+)
+
+var phaseNames = [...]string{"hash", "encode", "persist", "gc", "proof"}
+
+func (p Phase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return "unknown"
+	}
+	return phaseNames[p]
+}
+
+// labeled runs f with the pprof label of the phase, if ProfileLabels is enabled.
+// The goroutines of the pool do not inherit the labels of the submitter, so the
+// tasks submitted to the pool are labeled themselves.
+func (tree *BNBSparseMerkleTree) labeled(phase Phase, f func()) {
+	if !tree.profileLabels {
+		f()
+		return
+	}
+	pprof.Do(context.Background(), pprof.Labels(profileLabel, phase.String()), func(context.Context) {
+		f()
+	})
+}
+
+// phaseStart returns the start time of a phase, if a PhaseHook is set.
+func (tree *BNBSparseMerkleTree) phaseStart() time.Time {
+	if tree.phaseHook == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe reports the duration of the phase started at start to the PhaseHook,
+// the proofs are also recorded in the Metrics.
+func (tree *BNBSparseMerkleTree) observe(phase Phase, start time.Time) {
+	if tree.phaseHook == nil && phase != PhaseProof {
+		return
+	}
+	elapsed := time.Since(start)
+	if phase == PhaseProof {
+		tree.opStats.proof(elapsed)
+		if tree.opMetrics != nil {
+			tree.opMetrics.ProofDuration(elapsed)
+		}
+	}
+	if tree.phaseHook != nil {
+		tree.phaseHook(phase, elapsed)
+	}
+}
+
+// recordGC records a GC release in the statistics and reports it to the PhaseHook.
+func (tree *BNBSparseMerkleTree) recordGC(start time.Time, version Version, released int, before, after uint64) {
+	tree.gcStats.record(start, version, released, before, after)
+	tree.log.Debug("released the in-memory nodes", logger.F("version", version),
+		logger.F("released", released), logger.F("before", before), logger.F("after", after),
+		logger.F("duration", time.Since(start)))
+	if tree.opMetrics != nil {
+		var reclaimed uint64
+		if before > after {
+			reclaimed = before - after
+		}
+		tree.opMetrics.GCRun(released, reclaimed, time.Since(start))
+	}
+	tree.observe(PhaseGC, start)
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_BNBSparseMerkleTree_PhaseHook(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		mu       sync.Mutex
+		observed = make(map[Phase]int)
+	)
+	hook := func(phase Phase, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if elapsed < 0 {
+			t.Errorf("negative duration of phase %s", phase)
+		}
+		observed[phase]++
+	}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, ProfileLabels(), PhaseHook(hook), ProofWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GetProofs([]uint64{items[0].Key, items[1].Key}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GetMultiProof([]uint64{items[0].Key, items[1].Key}); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.Set(items[1].Key, env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Prune(smt.LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[Phase]int{PhaseHash: 3, PhaseEncode: 2, PhasePersist: 2, PhaseProof: 2, PhaseGC: 1}
+	for phase, count := range expected {
+		if observed[phase] != count {
+			t.Fatalf("phase %s should be reported %d times, got %d", phase, count, observed[phase])
+		}
+	}
+}
@@ -5,4 +5,119 @@
 
 package bsmt
 
+import (
+	"bytes"
+	"hash"
+	"sync"
+	"time"
+)
+
 type Proof [][]byte
+
+// GetProofs returns the proofs of the keys, in the order of the keys.
+// The missing paths of all the keys are loaded first with a single read, then
+// the proofs are built by up to ProofWorkers workers.
+func (tree *BNBSparseMerkleTree) GetProofs(keys []uint64) ([]Proof, error) {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	defer tree.observe(PhaseProof, time.Now())
+
+	if !tree.IsEmpty() {
+		for _, key := range keys {
+			if key >= 1<<tree.maxDepth {
+				return nil, ErrInvalidKey
+			}
+		}
+		if err := tree.loadPaths(keys, cacheOpProof); err != nil {
+			return nil, err
+		}
+	}
+
+	proofs := make([]Proof, len(keys))
+	workers := workerCount(tree.proofWorkers, len(keys))
+	if workers <= 1 {
+		for i, key := range keys {
+			proof, err := tree.getProof(key)
+			if err != nil {
+				return nil, err
+			}
+			proofs[i] = proof
+		}
+		return proofs, nil
+	}
+
+	errs := make([]error, workers)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(1)
+		err := tree.goroutinePool.Submit(func() {
+			defer wg.Done()
+			tree.labeled(PhaseProof, func() {
+				for i := w; i < len(keys); i += workers {
+					if proofs[i], errs[w] = tree.getProof(keys[i]); errs[w] != nil {
+						return
+					}
+				}
+			})
+		})
+		if err != nil {
+			wg.Done()
+			errs[w] = err
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return proofs, nil
+}
+
+// proofScratchPool keeps the buffers the hashes of a verified path are computed in.
+var proofScratchPool = sync.Pool{
+	New: func() interface{} {
+		return new([64]byte)
+	},
+}
+
+// VerifyProof verifies the proof of the value of the key against the root of a
+// tree of maxDepth, without access to the tree. The value of an absent key is
+// the nil hash of the leaves. The verification does not allocate.
+func VerifyProof(hasher *Hasher, root []byte, maxDepth uint8, key uint64, val []byte, proof Proof) bool {
+	if maxDepth == 0 || maxDepth%4 != 0 || maxDepth > 64 {
+		return false
+	}
+	if maxDepth < 64 && key >= 1<<maxDepth {
+		return false
+	}
+	return hasher.verifyPath(root, maxDepth, key, val, proof)
+}
+
+// verifyPath hashes the leaf up to the root along the proof. The sibling of
+// the i-th level from the leaves is on the left if the i-th bit of the key is set.
+func (h *Hasher) verifyPath(root []byte, maxDepth uint8, key uint64, leaf []byte, proof Proof) bool {
+	if len(proof) != int(maxDepth) {
+		return false
+	}
+	hasher := h.pool.Get().(hash.Hash)
+	defer h.pool.Put(hasher)
+	scratch := proofScratchPool.Get().(*[64]byte)
+	defer proofScratchPool.Put(scratch)
+
+	node := leaf
+	for i := 0; i < len(proof); i++ {
+		hasher.Reset()
+		if key>>i&1 == 0 {
+			hasher.Write(node)
+			hasher.Write(proof[i])
+		} else {
+			hasher.Write(proof[i])
+			hasher.Write(node)
+		}
+		// the input is consumed already, the buffer can be overwritten
+		node = hasher.Sum(scratch[:0])
+	}
+	return bytes.Equal(root, node)
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// prunedRangesKey is the key of the version ranges removed by PruneRange.
+var prunedRangesKey = []byte(`prunedRanges`)
+
+// versionRange is an inclusive range of versions.
+type versionRange struct {
+	From Version
+	To   Version
+}
+
+func decodePrunedRanges(data []byte) ([]versionRange, error) {
+	var ranges []versionRange
+	if err := rlp.DecodeBytes(data, &ranges); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// isPruned reports whether the version is removed by PruneRange.
+func (tree *BNBSparseMerkleTree) isPruned(version Version) bool {
+	for _, r := range tree.prunedRanges {
+		if version >= r.From && version <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// writePrunedRanges persists the ranges into the batch.
+func writePrunedRanges(batch database.Batcher, ranges []versionRange) error {
+	if len(ranges) == 0 {
+		return batch.Delete(prunedRangesKey)
+	}
+	data, err := rlp.EncodeToBytes(ranges)
+	if err != nil {
+		return err
+	}
+	return batch.Set(prunedRangesKey, data)
+}
+
+// pruneVersionRange removes the versions in [from, to], except the last of them
+// which the later versions may still be based on.
+func pruneVersionRange(versions []*VersionInfo, from, to Version) []*VersionInfo {
+	last := -1
+	for i, v := range versions {
+		if v.Ver >= from && v.Ver <= to {
+			last = i
+		}
+	}
+	if last < 0 {
+		return versions
+	}
+	pruned := make([]*VersionInfo, 0, len(versions))
+	for i, v := range versions {
+		if i == last || v.Ver < from || v.Ver > to {
+			pruned = append(pruned, v)
+		}
+	}
+	return pruned
+}
+
+// trimRange removes the versions in [from, to] from the in-memory subtree.
+func (node *TreeNode) trimRange(from, to Version) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	node.Versions = pruneVersionRange(node.Versions, from, to)
+	for _, child := range node.Children {
+		if child != nil {
+			child.trimRange(from, to)
+		}
+	}
+}
+
+// PruneRange removes the versions in [from, to] while keeping both the older and
+// the newer history intact, e.g. the versions of an abandoned fork. The removed
+// versions can no longer be queried or rolled back to, ErrVersionPruned is returned.
+// The range must be above the recent version and below the latest version.
+//
+// The stored nodes rewritten by several versions of the range are trimmed, as
+// listed by the orphan records.
+func (tree *BNBSparseMerkleTree) PruneRange(from, to Version) error {
+	if tree.archive {
+		return ErrArchiveMode
+	}
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+
+	if from > to {
+		return ErrInvalidVersionRange
+	}
+	if from <= tree.recentVersion {
+		return ErrVersionTooOld
+	}
+	if to >= tree.version {
+		return ErrVersionTooHigh
+	}
+	if tree.maxRollbackDepth > 0 && uint64(tree.version-to) <= tree.maxRollbackDepth {
+		return ErrVersionProtected
+	}
+	if tree.journal.len() > 0 {
+		return ErrPendingChanges
+	}
+	for v := from; v <= to; v++ {
+		if tree.isPinned(v) || (tree.pruneGate != nil && !tree.pruneGate(v)) {
+			return ErrVersionProtected
+		}
+	}
+
+	_, keys, err := tree.collectOrphans(from, to)
+	if err != nil {
+		return err
+	}
+	values, err := tree.db.MultiGet(keys)
+	if err != nil {
+		return err
+	}
+	batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		node, err := decodeStorageTreeNode(keys[i], value)
+		if err != nil {
+			return err
+		}
+		node.Versions = pruneVersionRange(node.Versions, from, to)
+		for _, child := range node.Children {
+			if child != nil {
+				child.Versions = pruneVersionRange(child.Versions, from, to)
+			}
+		}
+		data, err := encodeStorageTreeNode(node)
+		if err != nil {
+			return err
+		}
+		if err := tree.archiveRecord(to, keys[i], value); err != nil {
+			return err
+		}
+		if err := batch.Set(keys[i], data); err != nil {
+			return err
+		}
+	}
+	for v := from; v <= to; v++ {
+		if err := batch.Delete(versionTimeKey(v)); err != nil {
+			return err
+		}
+		if err := batch.Delete(versionInfoKey(v)); err != nil {
+			return err
+		}
+	}
+	ranges := append(append([]versionRange(nil), tree.prunedRanges...), versionRange{From: from, To: to})
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].From < ranges[j].From })
+	if err := writePrunedRanges(batch, ranges); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	tree.prunedRanges = ranges
+	tree.root.trimRange(from, to)
+	tree.dbCache.Purge()
+	return nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// RebuildReport describes a tree rebuilt by RebuildFromLeaves.
+type RebuildReport struct {
+	// Version is the latest version of the rebuilt tree.
+	Version Version
+	// Leaves is the number of the stored leaves the tree is rebuilt from.
+	Leaves int
+	// TrimmedLeaves is the number of the leaves rewritten without the versions
+	// above the latest version, left by an interrupted commit.
+	TrimmedLeaves int
+	// Nodes is the number of the internal nodes written.
+	Nodes int
+	// Removed is the number of the stored internal nodes removed before the rebuild.
+	Removed int
+}
+
+// rebuildNode is an internal node open during a rebuild, with the version
+// histories of its children.
+type rebuildNode struct {
+	depth    uint8
+	path     uint64
+	children [16][]*VersionInfo
+}
+
+// RebuildFromLeaves recovers a tree whose internal nodes are lost or corrupted,
+// but whose leaves survive: every internal node is re-derived from the version
+// histories of the stored leaves, for every version they retain, and rewritten.
+// The versions of the leaves above the latest version are dropped. The tree
+// must be stopped, the database is written directly since a tree with a corrupted
+// root cannot be opened. The options configure the node key format, the
+// batch size and the logger, as for NewBNBSparseMerkleTree.
+//
+// The internal nodes are removed before they are rebuilt, if the rebuild is
+// interrupted it must be run again before the tree is opened.
+func RebuildFromLeaves(hasher *Hasher, db database.TreeDB, maxDepth uint8, nilHash []byte, opts ...Option) (*RebuildReport, error) {
+	if maxDepth == 0 || maxDepth%4 != 0 {
+		return nil, ErrInvalidDepth
+	}
+	tree := &BNBSparseMerkleTree{
+		maxDepth:       maxDepth,
+		nilHashes:      constructNilHashes(maxDepth, nilHash, hasher),
+		hasher:         hasher,
+		db:             db,
+		batchSizeLimit: 100 * 1024,
+		log:            logger.Nop(),
+	}
+	for _, opt := range opts {
+		opt(tree)
+	}
+	if err := tree.initNodeKeyFormat(); err != nil {
+		return nil, err
+	}
+	values, err := db.MultiGet([][]byte{latestVersionKey, recentVersionNumberKey, pinnedVersionsKey})
+	if err != nil {
+		return nil, err
+	}
+	report := &RebuildReport{}
+	if len(values[0]) == 0 {
+		return report, nil
+	}
+	report.Version = Version(binary.BigEndian.Uint64(values[0]))
+	if len(values[1]) > 0 {
+		tree.recentVersion = Version(binary.BigEndian.Uint64(values[1]))
+	}
+	if values[2] != nil {
+		if tree.pinned, err = decodePinnedVersions(values[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	batch := database.NewAutoFlushBatch(db.NewBatch(), tree.batchSizeLimit)
+	for depth := uint8(0); depth < maxDepth; depth += 4 {
+		n, err := deletePrefix(db, batch, tree.nodeKeys.levelPrefix(depth))
+		if err != nil {
+			return nil, err
+		}
+		report.Removed += n
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	batch.Reset()
+
+	if err := tree.rebuildInternals(batch, report); err != nil {
+		return nil, err
+	}
+	// the interrupted commit is rolled back by the rebuild
+	if err := batch.Delete(commitIntentKey); err != nil {
+		return nil, err
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	tree.log.Warn("rebuilt the internal nodes from the leaves", logger.F("version", report.Version),
+		logger.F("leaves", report.Leaves), logger.F("nodes", report.Nodes))
+	return report, nil
+}
+
+// rebuildInternals streams the stored leaves in key order and writes the
+// internal nodes above them, a node is written once the stream moves past its
+// subtree. Only the nodes on the path of the current leaf are held in memory.
+func (tree *BNBSparseMerkleTree) rebuildInternals(batch database.Batcher, report *RebuildReport) error {
+	levels := int(tree.maxDepth) / 4
+	open := make([]*rebuildNode, levels) // open[i] is the open node at depth 4*i
+	open[0] = &rebuildNode{}
+	closeFrom := func(level int) error {
+		for i := levels - 1; i >= level; i-- {
+			if open[i] == nil {
+				continue
+			}
+			versions, err := tree.writeRebuilt(batch, open[i], report)
+			if err != nil {
+				return err
+			}
+			open[i-1].children[open[i].path&0xf] = versions
+			open[i] = nil
+		}
+		return nil
+	}
+
+	it := tree.db.NewIterator(tree.nodeKeys.levelPrefix(tree.maxDepth), nil)
+	defer it.Release()
+	for it.Next() {
+		key, ok := tree.nodeKeys.leafPath(it.Key(), tree.maxDepth)
+		if !ok {
+			continue
+		}
+		leaf, err := decodeStorageTreeNode(it.Key(), it.Value())
+		if err != nil {
+			return err
+		}
+		versions := leaf.Versions
+		for len(versions) > 0 && versions[len(versions)-1].Ver > report.Version {
+			versions = versions[:len(versions)-1]
+		}
+		if len(versions) != len(leaf.Versions) {
+			report.TrimmedLeaves++
+			dbKey := append([]byte(nil), it.Key()...)
+			if len(versions) == 0 {
+				// the leaf is created by the interrupted commit
+				if err := batch.Delete(dbKey); err != nil {
+					return err
+				}
+				continue
+			}
+			leaf.Versions = versions
+			data, err := encodeStorageTreeNode(leaf)
+			if err != nil {
+				return err
+			}
+			if err := batch.Set(dbKey, data); err != nil {
+				return err
+			}
+		}
+		report.Leaves++
+
+		// the first level the path of the leaf diverges from the open nodes
+		level := 1
+		for level < levels && open[level] != nil && open[level].path == key>>(int(tree.maxDepth)-4*level) {
+			level++
+		}
+		if err := closeFrom(level); err != nil {
+			return err
+		}
+		for i := level; i < levels; i++ {
+			depth := uint8(4 * i)
+			open[i] = &rebuildNode{depth: depth, path: key >> (int(tree.maxDepth) - int(depth))}
+		}
+		open[levels-1].children[key&0xf] = versions
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := closeFrom(1); err != nil {
+		return err
+	}
+	if report.Leaves == 0 {
+		return nil
+	}
+	_, err := tree.writeRebuilt(batch, open[0], report)
+	return err
+}
+
+// writeRebuilt computes the hashes of the node at every version any of its
+// children changed in, writes the node and returns its versions.
+func (tree *BNBSparseMerkleTree) writeRebuilt(batch database.Batcher, node *rebuildNode, report *RebuildReport) ([]*VersionInfo, error) {
+	var changed []Version
+	seen := make(map[Version]bool)
+	for _, child := range node.children {
+		for _, info := range child {
+			if !seen[info.Ver] {
+				seen[info.Ver] = true
+				changed = append(changed, info.Ver)
+			}
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+
+	stored := &StorageTreeNode{Path: node.path}
+	nilChildHash := tree.nilHashes.Get(node.depth + 4)
+	for _, version := range changed {
+		for i := 0; i < 16; i += 2 {
+			left, right := hashAt(node.children[i], version), hashAt(node.children[i+1], version)
+			if left == nil {
+				left = nilChildHash
+			}
+			if right == nil {
+				right = nilChildHash
+			}
+			stored.Internals[6+i/2] = tree.hasher.Hash(left, right)
+		}
+		for i := 13; i > 1; i -= 2 {
+			stored.Internals[i/2-1] = tree.hasher.Hash(stored.Internals[i-1], stored.Internals[i])
+		}
+		stored.Versions = append(stored.Versions, &VersionInfo{
+			Ver:  version,
+			Hash: tree.hasher.Hash(stored.Internals[0], stored.Internals[1]),
+		})
+	}
+	stored.Versions = pruneVersions(stored.Versions, tree.recentVersion, tree.pinned)
+	for i, child := range node.children {
+		if len(child) > 0 {
+			stored.Children[i] = &StorageLeafNode{Versions: child}
+		}
+	}
+	data, err := encodeStorageTreeNode(stored)
+	if err != nil {
+		return nil, err
+	}
+	if err := batch.Set(tree.nodeKeys.key(node.depth, node.path), data); err != nil {
+		return nil, err
+	}
+	report.Nodes++
+	return stored.Versions, nil
+}
+
+// deletePrefix deletes the records under the prefix, and returns their number.
+func deletePrefix(db database.TreeDB, batch database.Batcher, prefix []byte) (int, error) {
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+	n := 0
+	for it.Next() {
+		if err := batch.Delete(append([]byte(nil), it.Key()...)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, it.Error()
+}
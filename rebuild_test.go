@@ -0,0 +1,103 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_RebuildFromLeaves(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := prepareKVData(env.hasher)
+			roots := make(map[Version][]byte)
+			for i := 0; i < len(items); i += 5 {
+				end := i + 5
+				if end > len(items) {
+					end = len(items)
+				}
+				if err := smt.MultiSet(items[i:end]); err != nil {
+					t.Fatal(err)
+				}
+				if err := smt.Set(items[0].Key, items[i].Val); err != nil {
+					t.Fatal(err)
+				}
+				recent := smt.LatestVersion()
+				version, err := smt.Commit(&recent)
+				if err != nil {
+					t.Fatal(err)
+				}
+				roots[version] = smt.Root()
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			recent := tree.RecentVersion()
+			latest := tree.LatestVersion()
+			tree.StopGC()
+
+			// the root is corrupted and an internal node is lost
+			if err := db.Set(tree.nodeKeys.key(0, 0), []byte("garbage")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Delete(tree.nodeKeys.key(4, items[0].Key>>4)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash); err == nil {
+				t.Fatal("expected the corrupted root to fail the reopening")
+			}
+
+			report, err := RebuildFromLeaves(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Version != latest || report.Leaves != len(items) || report.Nodes == 0 || report.TrimmedLeaves != 0 {
+				t.Fatalf("unexpected report %+v", report)
+			}
+
+			smt, err = NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rebuilt := smt.(*BNBSparseMerkleTree)
+			defer rebuilt.StopGC()
+			for version := recent; version <= latest; version++ {
+				root, err := rebuilt.RootAt(version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(root, roots[version]) {
+					t.Fatalf("root of version %d is %x, expected %x", version, root, roots[version])
+				}
+			}
+			check, err := rebuilt.CheckStorage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !check.OK() {
+				t.Fatalf("unexpected storage check %+v", check)
+			}
+			for _, item := range items[1:] {
+				proof, err := rebuilt.GetProof(item.Key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !rebuilt.VerifyProof(item.Key, proof) {
+					t.Fatalf("invalid proof of key %d", item.Key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// commitIntentKey is the key of the intent record written before the nodes of
+// a commit, format: ${previous version}${previous recent version}${recent version}${version}${nodes}
+// The record is removed once the commit is written, a record found on startup
+// denotes an interrupted commit.
+var commitIntentKey = []byte(`commitIntent`)
+
+const commitIntentHeaderSize = 32
+
+// RepairReport describes an interrupted commit repaired on startup.
+type RepairReport struct {
+	// Version is the version of the interrupted commit.
+	Version Version
+	// RolledBack reports whether the partial commit was rolled back to the
+	// previous version. Otherwise the commit turned out to be complete and was finished.
+	RolledBack bool
+	// Nodes is the number of the stored nodes rewritten or removed by the rollback.
+	Nodes int
+}
+
+// commitIntent is the decoded intent record of a commit.
+type commitIntent struct {
+	prev       Version
+	prevRecent Version
+	// recent is the recent version of the commit, the versions below it may be
+	// pruned from the written nodes already
+	recent  Version
+	version Version
+	nodes   orphans
+}
+
+func encodeCommitIntent(intent *commitIntent) []byte {
+	buf := make([]byte, commitIntentHeaderSize, commitIntentHeaderSize+len(intent.nodes))
+	binary.BigEndian.PutUint64(buf, uint64(intent.prev))
+	binary.BigEndian.PutUint64(buf[8:], uint64(intent.prevRecent))
+	binary.BigEndian.PutUint64(buf[16:], uint64(intent.recent))
+	binary.BigEndian.PutUint64(buf[24:], uint64(intent.version))
+	return append(buf, intent.nodes...)
+}
+
+func decodeCommitIntent(buf []byte) (*commitIntent, error) {
+	if len(buf) < commitIntentHeaderSize {
+		return nil, ErrUnexpected
+	}
+	return &commitIntent{
+		prev:       Version(binary.BigEndian.Uint64(buf)),
+		prevRecent: Version(binary.BigEndian.Uint64(buf[8:])),
+		recent:     Version(binary.BigEndian.Uint64(buf[16:])),
+		version:    Version(binary.BigEndian.Uint64(buf[24:])),
+		nodes:      orphans(buf[commitIntentHeaderSize:]),
+	}, nil
+}
+
+// writeCommitIntent records the nodes of the journal before they are written.
+func (tree *BNBSparseMerkleTree) writeCommitIntent(newVer Version, recentVersion *Version) error {
+	intent, err := tree.commitIntent(newVer, recentVersion)
+	if err != nil {
+		return err
+	}
+	return tree.db.Set(commitIntentKey, intent)
+}
+
+// commitIntent returns the encoded intent record of the pending commit.
+func (tree *BNBSparseMerkleTree) commitIntent(newVer Version, recentVersion *Version) ([]byte, error) {
+	intent := &commitIntent{prev: tree.version, prevRecent: tree.recentVersion, recent: tree.recentVersion, version: newVer}
+	if recentVersion != nil && *recentVersion > intent.recent {
+		intent.recent = *recentVersion
+	}
+	err := tree.journal.iterate(func(key journalKey, node *TreeNode) error {
+		intent.nodes.add(node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encodeCommitIntent(intent), nil
+}
+
+// InterruptedCommit returns the version of the interrupted commit found by a
+// read-only open, which is repaired by the next open which is not read-only.
+func (tree *BNBSparseMerkleTree) InterruptedCommit() (Version, bool) {
+	return tree.interrupted, tree.interrupted > 0
+}
+
+// StartupRepair returns the report of the interrupted commit repaired when
+// the tree was opened, nil if there was none.
+func (tree *BNBSparseMerkleTree) StartupRepair() *RepairReport {
+	return tree.repaired
+}
+
+// repair detects a commit interrupted by a crash, which left the version marker
+// without the complete node set or the nodes without the version marker.
+// A complete commit is finished, a partial commit is rolled back to the previous
+// version. The written nodes may be pruned up to the recent version of the
+// commit already, which is kept by the rollback, so the versions below it are
+// no longer readable.
+func (tree *BNBSparseMerkleTree) repair() error {
+	buf, err := tree.db.Get(commitIntentKey)
+	if errors.Is(err, database.ErrDatabaseNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	intent, err := decodeCommitIntent(buf)
+	if err != nil {
+		return err
+	}
+	if tree.readOnly {
+		// the versions above the version marker are not read
+		tree.log.Warn("found an interrupted commit, left for repair", logger.F("version", intent.version))
+		tree.interrupted = intent.version
+		return nil
+	}
+	keys, err := intent.nodes.keys(tree.nodeKeys)
+	if err != nil {
+		return err
+	}
+	values, err := tree.db.MultiGet(append([][]byte{latestVersionKey}, keys...))
+	if err != nil {
+		return err
+	}
+	var latest Version
+	if len(values[0]) > 0 {
+		latest = Version(binary.BigEndian.Uint64(values[0]))
+	}
+	values = values[1:]
+
+	report := &RepairReport{Version: intent.version}
+	nodes := make([]*TreeNode, len(keys))
+	// the version marker is the last record of a commit, the version records are written once it is
+	complete := latest == intent.version
+	for i, value := range values {
+		if value == nil {
+			complete = false
+			continue
+		}
+		storageTreeNode, err := decodeStorageTreeNode(keys[i], value)
+		if err != nil {
+			return err
+		}
+		// the entry of the node starts with its depth
+		depth := intent.nodes[i*orphanEntrySize]
+		nodes[i] = storageTreeNode.ToTreeNode(depth, tree.nilHashes, tree.hasher)
+		if nodes[i].latestVersion() <= intent.prev {
+			complete = false
+		}
+	}
+	if complete {
+		tree.log.Warn("finished an interrupted commit", logger.F("version", intent.version))
+		tree.repaired = report
+		return tree.db.Delete(commitIntentKey)
+	}
+
+	// roll the written nodes back, every node is rolled back on its own since
+	// its parent may not be written
+	batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	for i, node := range nodes {
+		if node == nil {
+			continue
+		}
+		next, _ := node.Rollback(intent.prev)
+		for _, child := range node.Children {
+			if child != nil {
+				if n, _ := child.Rollback(intent.prev); n {
+					next = true
+				}
+			}
+		}
+		if !next {
+			continue
+		}
+		report.Nodes++
+		if len(node.Versions) == 0 {
+			// the node is created by the interrupted commit
+			if err := batch.Delete(keys[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		if node.depth < tree.maxDepth {
+			node.ComputeInternalHash()
+		}
+		data, err := encodeTreeNode(node)
+		if err != nil {
+			return err
+		}
+		if err := batch.Set(keys[i], data); err != nil {
+			return err
+		}
+	}
+	buf = make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(intent.prev))
+	if err := batch.Set(latestVersionKey, buf); err != nil {
+		return err
+	}
+	buf = make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(intent.recent))
+	if err := batch.Set(recentVersionNumberKey, buf); err != nil {
+		return err
+	}
+	if err := tree.discardAuditRecord(batch, intent.version); err != nil {
+		return err
+	}
+	for _, key := range [][]byte{versionTimeKey(intent.version), orphanKey(intent.version), opLogKey(intent.version), versionInfoKey(intent.version), commitIntentKey} {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	report.RolledBack = true
+	tree.log.Warn("rolled back an interrupted commit", logger.F("version", intent.version),
+		logger.F("previous", intent.prev), logger.F("nodes", report.Nodes))
+	tree.repaired = report
+	return nil
+}
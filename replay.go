@@ -0,0 +1,80 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sort"
+)
+
+// rolledBack retains the leaf writes of the versions removed by Rollback,
+// so they can be re-applied selectively, e.g. to handle a reorg.
+type rolledBack map[Version][]Item
+
+// retain records the versions of the leaf newer than version.
+func (r rolledBack) retain(leaf *TreeNode, version Version) {
+	for _, v := range leaf.Versions {
+		if v.Ver > version {
+			r[v.Ver] = append(r[v.Ver], Item{Key: leaf.path, Val: v.Hash})
+		}
+	}
+}
+
+// versions returns the retained versions in ascending order.
+func (r rolledBack) versions() []Version {
+	versions := make([]Version, 0, len(r))
+	for version := range r {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// RolledBackVersions returns the versions removed by the last rollbacks, the
+// writes of which are retained until the next commit and can be re-applied
+// with ReplayRolledBack.
+func (tree *BNBSparseMerkleTree) RolledBackVersions() []Version {
+	return tree.rolledBack.versions()
+}
+
+// ReplayRolledBack re-applies the retained versions up to the version to, except
+// the skipped ones, committing each of them with its original version number.
+// The versions above to stay retained. It returns the latest version afterwards.
+func (tree *BNBSparseMerkleTree) ReplayRolledBack(to Version, skip ...Version) (Version, error) {
+	if tree.journal.len() > 0 {
+		return tree.version, ErrPendingChanges
+	}
+	skipped := make(map[Version]struct{}, len(skip))
+	for _, version := range skip {
+		skipped[version] = struct{}{}
+	}
+
+	// the commits discard the retained versions, take them over meanwhile
+	retained := tree.rolledBack
+	tree.rolledBack = nil
+	defer func() {
+		tree.rolledBack = retained
+	}()
+	for _, version := range retained.versions() {
+		if version > to {
+			break
+		}
+		if _, ok := skipped[version]; !ok {
+			items := retained[version]
+			sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+			if err := tree.MultiSetWithVersion(items, version); err != nil {
+				tree.Reset()
+				return tree.version, err
+			}
+			ver := version
+			if _, err := tree.CommitWithNewVersion(nil, &ver); err != nil {
+				tree.Reset()
+				return tree.version, err
+			}
+		}
+		delete(retained, version)
+	}
+	return tree.version, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// errReplayDiverged stops the scan of the operation log at the divergence.
+var errReplayDiverged = errors.New("the replay diverged")
+
+// ReplayDivergence is the first point a replay of the operation log diverges at.
+type ReplayDivergence struct {
+	Version Version
+	// Operation is the logged write whose old value is not the replayed value of
+	// its leaf, the log misses a write then. It is nil if the root diverges.
+	Operation *Operation
+	// Expected is the logged old value of the operation, or the recorded root.
+	Expected []byte
+	// Actual is the replayed value of the leaf, or the replayed root.
+	Actual []byte
+}
+
+// ReplayReport describes a replay of the operation log by ReplayOperationLog.
+type ReplayReport struct {
+	// From and To are the first and the last versions replayed.
+	From, To Version
+	// Versions is the number of the versions replayed.
+	Versions int
+	// Checked is the number of the replayed roots asserted against a recorded root.
+	Checked int
+	// Divergence is the first divergence, nil if the replay matches.
+	Divergence *ReplayDivergence
+}
+
+// ReplayOperationLog reconstructs the logged versions of the tree above the
+// latest version of the target, up to the version to, by applying their
+// operations to the target and committing each of them with its original
+// version number. The logged old value of every write is asserted against the
+// replayed one, and the root of every replayed version against the root
+// returned by roots, the versions roots returns false for are not checked.
+// A nil roots checks the roots the tree still retains.
+//
+// The target is an empty tree, or a tree restored at the version preceding the
+// replayed ones, e.g. from a snapshot, stored in another database. The replay
+// stops at the first divergence, which is returned by the report, the target
+// is left as replayed up to the divergence for inspection then.
+func (tree *BNBSparseMerkleTree) ReplayOperationLog(target SparseMerkleTree, to Version, roots func(version Version) ([]byte, bool)) (*ReplayReport, error) {
+	if roots == nil {
+		roots = func(version Version) ([]byte, bool) {
+			root, err := tree.RootAt(version)
+			return root, err == nil
+		}
+	}
+	report := &ReplayReport{}
+	err := tree.scanOperations(target.LatestVersion()+1, to, func(version Version, ops []*Operation) error {
+		items := make([]Item, 0, len(ops))
+		for _, op := range ops {
+			actual, err := replayedValue(target, op.Key)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(actual, op.OldVal) {
+				report.Divergence = &ReplayDivergence{Version: version, Operation: op, Expected: op.OldVal, Actual: actual}
+				return errReplayDiverged
+			}
+			items = append(items, Item{Key: op.Key, Val: op.NewVal})
+		}
+		if err := target.MultiSetWithVersion(items, version); err != nil {
+			target.Reset()
+			return err
+		}
+		ver := version
+		if _, err := target.CommitWithNewVersion(nil, &ver); err != nil {
+			target.Reset()
+			return err
+		}
+		if report.Versions == 0 {
+			report.From = version
+		}
+		report.To = version
+		report.Versions++
+
+		expected, ok := roots(version)
+		if !ok {
+			return nil
+		}
+		report.Checked++
+		if actual := target.Root(); !bytes.Equal(actual, expected) {
+			report.Divergence = &ReplayDivergence{Version: version, Expected: expected, Actual: actual}
+			return errReplayDiverged
+		}
+		return nil
+	})
+	if err != nil && err != errReplayDiverged {
+		return report, err
+	}
+	return report, nil
+}
+
+// replayedValue returns the value of the leaf in the latest version of the
+// target, empty if the leaf was never written, as the operation log records it.
+func replayedValue(target SparseMerkleTree, key uint64) ([]byte, error) {
+	val, err := target.Get(key, nil)
+	if err == ErrEmptyRoot || err == ErrNodeNotFound {
+		return nil, nil
+	}
+	return val, err
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func Test_BNBSparseMerkleTree_ReplayOperationLog(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, OperationLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	defer tree.StopGC()
+	items := prepareKVData(env.hasher)
+	roots := make(map[Version][]byte)
+	for i := 0; i < len(items); i += 8 {
+		end := i + 8
+		if end > len(items) {
+			end = len(items)
+		}
+		if err := smt.MultiSet(items[i:end]); err != nil {
+			t.Fatal(err)
+		}
+		// every version rewrites the first leaf
+		if err := smt.Set(items[0].Key, items[i].Val); err != nil {
+			t.Fatal(err)
+		}
+		version, err := smt.Commit(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots[version] = smt.Root()
+	}
+	latest := tree.LatestVersion()
+
+	newTarget := func() *BNBSparseMerkleTree {
+		target, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return target.(*BNBSparseMerkleTree)
+	}
+	target := newTarget()
+	report, err := tree.ReplayOperationLog(target, latest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Divergence != nil || report.From != 1 || report.To != latest || report.Versions != int(latest) || report.Checked != int(latest) {
+		t.Fatalf("unexpected report %+v, divergence %+v", report, report.Divergence)
+	}
+	if !bytes.Equal(target.Root(), smt.Root()) {
+		t.Fatalf("replayed root %x, expected %x", target.Root(), smt.Root())
+	}
+	target.StopGC()
+
+	// a recorded root the replay diverges from
+	target = newTarget()
+	defer target.StopGC()
+	recorded := func(version Version) ([]byte, bool) {
+		if version == 2 {
+			return nilHash, true
+		}
+		return roots[version], true
+	}
+	if report, err = tree.ReplayOperationLog(target, latest, recorded); err != nil {
+		t.Fatal(err)
+	}
+	divergence := report.Divergence
+	if divergence == nil || divergence.Version != 2 || divergence.Operation != nil || !bytes.Equal(divergence.Actual, roots[2]) {
+		t.Fatalf("unexpected divergence %+v", divergence)
+	}
+	if target.LatestVersion() != 2 || report.Checked != 2 {
+		t.Fatalf("the replay should stop at the divergence, replayed up to %d", target.LatestVersion())
+	}
+
+	// the log misses a version, the next write of the first leaf diverges
+	if err := db.Delete(opLogKey(2)); err != nil {
+		t.Fatal(err)
+	}
+	target = newTarget()
+	defer target.StopGC()
+	if report, err = tree.ReplayOperationLog(target, latest, nil); err != nil {
+		t.Fatal(err)
+	}
+	divergence = report.Divergence
+	if divergence == nil || divergence.Version != 3 || divergence.Operation == nil || divergence.Operation.Key != items[0].Key ||
+		!bytes.Equal(divergence.Expected, items[8].Val) || !bytes.Equal(divergence.Actual, items[0].Val) {
+		t.Fatalf("unexpected divergence %+v", divergence)
+	}
+	if target.LatestVersion() != 1 {
+		t.Fatalf("the diverging version should not be committed, latest version %d", target.LatestVersion())
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_ReplayRolledBack(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	roots := make(map[Version][]byte)
+	for i, item := range items[:5] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if i == 3 {
+			// the write of items[0] is replayed with version 4
+			if err := smt.Set(items[0].Key, item.Val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		version, err := smt.Commit(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots[version] = smt.Root()
+	}
+
+	if err := smt.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if versions := tree.RolledBackVersions(); len(versions) != 4 || versions[0] != 2 || versions[3] != 5 {
+		t.Fatalf("the rolled back versions should be retained, got %v", versions)
+	}
+
+	latest, err := tree.ReplayRolledBack(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != 3 || !bytes.Equal(smt.Root(), roots[3]) {
+		t.Fatalf("the replayed versions should restore the state of version 3, got version %d", latest)
+	}
+	if versions := tree.RolledBackVersions(); len(versions) != 2 {
+		t.Fatalf("the versions above the replayed ones should stay retained, got %v", versions)
+	}
+
+	// skip the bad block 4
+	latest, err = tree.ReplayRolledBack(5, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != 5 {
+		t.Fatalf("the latest version should be 5, got %d", latest)
+	}
+	val, err := smt.Get(items[0].Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[0].Val) {
+		t.Fatalf("the write of the skipped version should not be applied, got %x", val)
+	}
+	val, err = smt.Get(items[3].Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, tree.nilHashes.Get(8)) {
+		t.Fatalf("the write of the skipped version should not be applied, got %x", val)
+	}
+	val, err = smt.Get(items[4].Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[4].Val) {
+		t.Fatalf("leaf node does not match the origin, %x, %x\n", val, items[4].Val)
+	}
+	if versions := tree.RolledBackVersions(); len(versions) != 0 {
+		t.Fatalf("the replayed versions should be dropped, got %v", versions)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+)
+
+// writtenNode is a dirty node written by a commit, with its versions before
+// the commit pruned them.
+type writtenNode struct {
+	node     *TreeNode
+	versions []*VersionInfo
+}
+
+// revertCommit reverts a failed commit of newVer, the writes of which may be
+// persisted partially, e.g. by an automatic flush or by the shards of the
+// database which succeeded. The written nodes are rolled back to the latest
+// version both in the database and in memory, and the pending changes are discarded.
+// It returns the commit error, annotated if the revert fails as well.
+func (tree *BNBSparseMerkleTree) revertCommit(written []writtenNode, newVer Version, recentWritten bool, cause error) error {
+	// restore the versions pruned by the commit
+	for _, w := range written {
+		w.node.mu.Lock()
+		w.node.Versions = w.versions
+		w.node.mu.Unlock()
+		if w.node.depth == tree.maxDepth {
+			tree.dbCache.Remove(w.node.path)
+		}
+	}
+	// the writes of the failed commit are not retained for replaying
+	retained := tree.rolledBack
+	tree.rolledBack = make(rolledBack)
+	defer func() {
+		tree.rolledBack = retained
+		tree.reset()
+	}()
+
+	tree.log.Error("commit failed, reverting the written nodes",
+		logger.F("version", newVer), logger.F("nodes", len(written)), logger.F("error", cause))
+	batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+	if _, err := tree.rollback(tree.root, tree.version, batch); err != nil {
+		return errors.Wrapf(cause, "reverting the commit failed: %v", err)
+	}
+	if err := tree.revertVersionRecords(batch, newVer, recentWritten); err != nil {
+		return errors.Wrapf(cause, "reverting the commit failed: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		return errors.Wrapf(cause, "reverting the commit failed: %v", err)
+	}
+	return cause
+}
+
+// revertVersionRecords restores the version records overwritten by the failed
+// commit of newVer, and deletes the ones it created.
+func (tree *BNBSparseMerkleTree) revertVersionRecords(batch database.Batcher, newVer Version, recentWritten bool) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(tree.version))
+	if err := batch.Set(latestVersionKey, buf); err != nil {
+		return err
+	}
+	if recentWritten {
+		buf = make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(tree.recentVersion))
+		if err := batch.Set(recentVersionNumberKey, buf); err != nil {
+			return err
+		}
+	}
+	if err := tree.discardAuditRecord(batch, newVer); err != nil {
+		return err
+	}
+	for _, key := range [][]byte{versionTimeKey(newVer), orphanKey(newVer), opLogKey(newVer), versionInfoKey(newVer), commitIntentKey} {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,511 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+var errInjected = errors.New("injected write failure")
+
+// faultyDB fails the batch writes once armed, after letting the given number of writes through.
+// A sticky failure keeps failing the writes afterwards, as if the process crashed.
+// A batch setting the cutAfter key is written up to that key only, then the process crashes.
+type faultyDB struct {
+	database.TreeDB
+	armed    bool
+	sticky   bool
+	writes   int
+	cutAfter []byte
+}
+
+func (db *faultyDB) NewBatch() database.Batcher {
+	return &faultyBatch{Batcher: db.TreeDB.NewBatch(), db: db}
+}
+
+type faultyBatch struct {
+	database.Batcher
+	db  *faultyDB
+	cut bool
+}
+
+func (b *faultyBatch) Set(key, value []byte) error {
+	if b.cut {
+		return nil
+	}
+	b.cut = b.db.cutAfter != nil && bytes.Equal(key, b.db.cutAfter)
+	return b.Batcher.Set(key, value)
+}
+
+func (b *faultyBatch) Delete(key []byte) error {
+	if b.cut {
+		return nil
+	}
+	return b.Batcher.Delete(key)
+}
+
+func (b *faultyBatch) Write() error {
+	if b.cut {
+		b.cut = false
+		b.db.armed, b.db.sticky, b.db.writes, b.db.cutAfter = true, true, 0, nil
+		if err := b.Batcher.Write(); err != nil {
+			return err
+		}
+		return errInjected
+	}
+	if b.db.armed {
+		if b.db.writes == 0 {
+			b.db.armed = b.db.sticky
+			return errInjected
+		}
+		b.db.writes--
+	}
+	return b.Batcher.Write()
+}
+
+func Test_BNBSparseMerkleTree_CommitRevert(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	// a small batch size limit flushes the commit partially before the failure
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BatchSizeLimit(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:8] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+
+	for _, item := range items[8:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.armed, db.writes = true, 2
+	if _, err := smt.Commit(nil); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+	if smt.LatestVersion() != 1 || !bytes.Equal(smt.Root(), root) {
+		t.Fatal("the failed commit should be reverted in memory")
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.LatestVersion() != 1 || !bytes.Equal(reopened.Root(), root) {
+		t.Fatal("the failed commit should be reverted in the database")
+	}
+	val, err := reopened.Get(items[len(items)-1].Key, nil)
+	if err != ErrNodeNotFound && !bytes.Equal(val, reopened.(*BNBSparseMerkleTree).nilHashes.Get(8)) {
+		t.Fatalf("the writes of the failed commit should be reverted, got %x %v", val, err)
+	}
+
+	// the tree keeps working after the revert
+	for _, item := range items[8:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err = NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, smt, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_StartupRepair(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BatchSizeLimit(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:8] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+
+	// crash in the middle of the second commit, the revert fails as well
+	for _, item := range items[8:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.armed, db.sticky, db.writes = true, true, 2
+	if _, err := smt.Commit(nil); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+
+	// a read-only open leaves the interrupted commit in place
+	inspected, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash, ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, ok := inspected.(*BNBSparseMerkleTree).InterruptedCommit(); !ok || version != 2 {
+		t.Fatalf("expected the interrupted commit of version 2, got %d", version)
+	}
+	if inspected.LatestVersion() != 1 || !bytes.Equal(inspected.Root(), root) || inspected.(*BNBSparseMerkleTree).StartupRepair() != nil {
+		t.Fatal("the read-only tree should be read as of the previous version")
+	}
+	if err := inspected.Set(items[0].Key, items[1].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inspected.Commit(nil); !errors.Is(err, database.ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if has, _ := memDB.Has(commitIntentKey); !has {
+		t.Fatal("the commit intent should be left for the repair")
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := reopened.(*BNBSparseMerkleTree).StartupRepair()
+	if report == nil || !report.RolledBack || report.Version != 2 || report.Nodes == 0 {
+		t.Fatalf("the partial commit should be rolled back, got %+v", report)
+	}
+	if reopened.LatestVersion() != 1 || !bytes.Equal(reopened.Root(), root) {
+		t.Fatal("the tree should be repaired to the previous version")
+	}
+	for _, item := range items[8:] {
+		if err := reopened.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := reopened.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.(*BNBSparseMerkleTree).StartupRepair() != nil {
+		t.Fatal("a complete commit should leave nothing to repair")
+	}
+	verifyItems(t, reopened, rebuilt, items)
+
+	// an intent left by a complete commit is finished
+	intent := &commitIntent{prev: 1, version: 2}
+	intent.nodes.add(rebuilt.(*BNBSparseMerkleTree).root)
+	if err := memDB.Set(commitIntentKey, encodeCommitIntent(intent)); err != nil {
+		t.Fatal(err)
+	}
+	finished, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report = finished.(*BNBSparseMerkleTree).StartupRepair()
+	if report == nil || report.RolledBack {
+		t.Fatalf("the complete commit should be finished, got %+v", report)
+	}
+	if finished.LatestVersion() != 2 || !bytes.Equal(finished.Root(), rebuilt.Root()) {
+		t.Fatal("the finished commit should be kept")
+	}
+}
+
+func Test_BNBSparseMerkleTree_RepairVersionMarker(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:8] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// crash right after the version marker of the second commit is written
+	for _, item := range items {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.cutAfter = latestVersionKey
+	if _, err := smt.Commit(nil); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := reopened.(*BNBSparseMerkleTree).StartupRepair()
+	if report == nil || report.RolledBack || report.Version != 2 {
+		t.Fatalf("the commit should be finished, got %+v", report)
+	}
+	// the records of the version are written ahead of the version marker
+	for _, key := range [][]byte{orphanKey(2), versionTimeKey(2), versionInfoKey(2)} {
+		if has, _ := memDB.Has(key); !has {
+			t.Fatalf("the finished commit should have its record %q", key)
+		}
+	}
+	expectedDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer expectedDB.Close()
+	expected, err := NewBNBSparseMerkleTree(env.hasher, expectedDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if err := expected.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := expected.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, expected, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_RepairRecentVersion(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, BatchSizeLimit(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:8] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range items[:8] {
+		if err := smt.Set(item.Key, items[i+1].Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// crash in the middle of a commit pruning the version 1 of the written nodes
+	for i, item := range items[:8] {
+		if err := smt.Set(item.Key, items[i+2].Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.armed, db.sticky, db.writes = true, true, 2
+	recent := Version(2)
+	if _, err := smt.Commit(&recent); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := reopened.(*BNBSparseMerkleTree).StartupRepair(); report == nil || !report.RolledBack {
+		t.Fatalf("the partial commit should be rolled back, got %+v", report)
+	}
+	if reopened.LatestVersion() != 2 || reopened.RecentVersion() != 2 {
+		t.Fatalf("the recent version of the interrupted commit should be kept, got %d", reopened.RecentVersion())
+	}
+	version := Version(1)
+	if _, err := reopened.Get(items[0].Key, &version); !errors.Is(err, ErrVersionTooOld) {
+		t.Fatalf("the pruned version should not be readable, got %v", err)
+	}
+	for i, item := range items[:8] {
+		val, err := reopened.Get(item.Key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, items[i+1].Val) {
+			t.Fatalf("the key %d should be read as of the version 2", i)
+		}
+	}
+}
+
+func Test_BNBSparseMerkleTree_PipelinedCommit(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, PipelinedCommit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for i, item := range items[:16] {
+		// the sets overlap with the write of the previous version
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if i%4 == 3 {
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tree.WaitCommit(); err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, smt, reopened, items[:16])
+
+	// a failed write is reverted by the next operation
+	for _, item := range items[16:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.armed, db.writes = true, 0
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.WaitCommit(); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+	if smt.LatestVersion() != 4 || !bytes.Equal(smt.Root(), root) {
+		t.Fatal("the failed commit should be reverted in memory")
+	}
+	reopened, err = NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.LatestVersion() != 4 || !bytes.Equal(reopened.Root(), root) {
+		t.Fatal("the failed commit should be reverted in the database")
+	}
+
+	// the tree keeps working after the revert
+	for _, item := range items[16:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.WaitCommit(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err = NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, smt, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_PipelinedCommitRevertFailure(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, PipelinedCommit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:8] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.WaitCommit(); err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+
+	// the revert fails as well, the failure is kept until the tree is reopened
+	for _, item := range items[8:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.armed, db.sticky, db.writes = true, true, 0
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.WaitCommit(); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+	if _, err := smt.Commit(nil); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+
+	db.armed = false
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.LatestVersion() != 1 || !bytes.Equal(reopened.Root(), root) {
+		t.Fatal("the failed commit should be repaired on startup")
+	}
+}
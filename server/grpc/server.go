@@ -0,0 +1,256 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package grpc exposes a sparse merkle tree over gRPC, the messages are
+// defined by the versioned smtv1 package.
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/server/grpc/smtv1"
+)
+
+// The full names of the methods, as passed to an Authenticator.
+const (
+	MethodGet      = "/zkbnb.smt.v1.SparseMerkleTree/Get"
+	MethodSet      = "/zkbnb.smt.v1.SparseMerkleTree/Set"
+	MethodCommit   = "/zkbnb.smt.v1.SparseMerkleTree/Commit"
+	MethodGetProof = "/zkbnb.smt.v1.SparseMerkleTree/GetProof"
+	MethodRollback = "/zkbnb.smt.v1.SparseMerkleTree/Rollback"
+)
+
+// Authenticator authorizes a call of the method, it returns the context the
+// call is served with, or an error rejecting it. The errors without a gRPC
+// status are reported as Unauthenticated.
+type Authenticator func(ctx context.Context, fullMethod string) (context.Context, error)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAuthenticator sets the authenticator run before every call.
+func WithAuthenticator(auth Authenticator) Option {
+	return func(s *Server) {
+		s.auth = auth
+	}
+}
+
+// ReadOnly rejects the calls of Set, Commit and Rollback.
+func ReadOnly() Option {
+	return func(s *Server) {
+		s.readOnly = true
+	}
+}
+
+// IsWrite reports whether the method changes the tree.
+func IsWrite(fullMethod string) bool {
+	switch fullMethod {
+	case MethodSet, MethodCommit, MethodRollback:
+		return true
+	}
+	return false
+}
+
+// BearerToken returns an authenticator accepting the calls carrying the token
+// in the "authorization: Bearer <token>" metadata.
+func BearerToken(token string) Authenticator {
+	return func(ctx context.Context, _ string) (context.Context, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			got := strings.TrimPrefix(v, "Bearer ")
+			if got != v && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				return ctx, nil
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+}
+
+// Server serves a single tree. The reads run concurrently, the writes are
+// serialized and exclude the reads, so a Get never observes a half applied
+// Set or Rollback.
+type Server struct {
+	smtv1.UnimplementedSparseMerkleTreeServer
+
+	mu       sync.RWMutex
+	tree     *bsmt.BNBSparseMerkleTree
+	nilHash  []byte
+	auth     Authenticator
+	readOnly bool
+}
+
+// NewServer returns a server of the tree, the nil hash is the value returned
+// for the absent leaves and must be the one the tree was created with.
+func NewServer(tree *bsmt.BNBSparseMerkleTree, nilHash []byte, opts ...Option) *Server {
+	s := &Server{tree: tree, nilHash: nilHash}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers the service on a gRPC server.
+func (s *Server) Register(registrar gogrpc.ServiceRegistrar) {
+	smtv1.RegisterSparseMerkleTreeServer(registrar, s)
+}
+
+// authorize runs the authenticator of the server for a call of the method.
+func (s *Server) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if s.auth != nil {
+		authCtx, err := s.auth(ctx, fullMethod)
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if authCtx != nil {
+			ctx = authCtx
+		}
+	}
+	if s.readOnly && IsWrite(fullMethod) {
+		return nil, status.Error(codes.PermissionDenied, "the server is read-only")
+	}
+	return ctx, nil
+}
+
+// Get returns the value of a leaf at a version.
+func (s *Server) Get(ctx context.Context, req *smtv1.GetRequest) (*smtv1.GetResponse, error) {
+	if _, err := s.authorize(ctx, MethodGet); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	version := bsmt.Version(req.Version)
+	if version == 0 {
+		version = s.tree.LatestVersion()
+	}
+	val, err := s.tree.Get(req.Key, &version)
+	if errors.Is(err, bsmt.ErrNodeNotFound) || errors.Is(err, bsmt.ErrEmptyRoot) {
+		val, err = s.nilHash, nil
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &smtv1.GetResponse{Value: val, Version: uint64(version)}, nil
+}
+
+// Set sets the values of the leaves in the next version.
+func (s *Server) Set(ctx context.Context, req *smtv1.SetRequest) (*smtv1.SetResponse, error) {
+	if _, err := s.authorize(ctx, MethodSet); err != nil {
+		return nil, err
+	}
+	items := make([]bsmt.Item, len(req.Leaves))
+	for i, leaf := range req.Leaves {
+		if len(leaf.Value) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "empty value of key %d", leaf.Key)
+		}
+		items[i] = bsmt.Item{Key: leaf.Key, Val: leaf.Value}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.tree.MultiSet(items); err != nil {
+		return nil, statusError(err)
+	}
+	return &smtv1.SetResponse{Root: s.tree.Root()}, nil
+}
+
+// Commit persists the pending changes as a new version.
+func (s *Server) Commit(ctx context.Context, req *smtv1.CommitRequest) (*smtv1.CommitResponse, error) {
+	ctx, err := s.authorize(ctx, MethodCommit)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var recentVersion *bsmt.Version
+	if req.RecentVersion != 0 {
+		v := bsmt.Version(req.RecentVersion)
+		recentVersion = &v
+	}
+	version, err := s.tree.CommitContext(ctx, recentVersion)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &smtv1.CommitResponse{Version: uint64(version), Root: s.tree.Root()}, nil
+}
+
+// GetProof returns the proof of a leaf in the latest version.
+func (s *Server) GetProof(ctx context.Context, req *smtv1.GetProofRequest) (*smtv1.GetProofResponse, error) {
+	ctx, err := s.authorize(ctx, MethodGetProof)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	proof, err := s.tree.GetProofContext(ctx, req.Key)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	val, err := s.tree.Get(req.Key, nil)
+	if errors.Is(err, bsmt.ErrNodeNotFound) || errors.Is(err, bsmt.ErrEmptyRoot) {
+		val, err = s.nilHash, nil
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &smtv1.GetProofResponse{
+		Root:    s.tree.Root(),
+		Version: uint64(s.tree.LatestVersion()),
+		Value:   val,
+		Proof:   proof,
+	}, nil
+}
+
+// Rollback discards the versions after a version.
+func (s *Server) Rollback(ctx context.Context, req *smtv1.RollbackRequest) (*smtv1.RollbackResponse, error) {
+	ctx, err := s.authorize(ctx, MethodRollback)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.tree.RollbackContext(ctx, bsmt.Version(req.Version)); err != nil {
+		return nil, statusError(err)
+	}
+	return &smtv1.RollbackResponse{Version: uint64(s.tree.LatestVersion()), Root: s.tree.Root()}, nil
+}
+
+// statusError maps the errors of the tree to gRPC status codes.
+func statusError(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, bsmt.ErrInvalidKey), errors.Is(err, bsmt.ErrInvalidVersionRange):
+		code = codes.InvalidArgument
+	case errors.Is(err, bsmt.ErrVersionTooOld), errors.Is(err, bsmt.ErrVersionTooHigh),
+		errors.Is(err, bsmt.ErrVersionTooLow), errors.Is(err, bsmt.ErrVersionPruned):
+		code = codes.OutOfRange
+	case errors.Is(err, bsmt.ErrPendingChanges), errors.Is(err, bsmt.ErrVersionConflict),
+		errors.Is(err, bsmt.ErrVersionProtected), errors.Is(err, bsmt.ErrArchiveMode):
+		code = codes.FailedPrecondition
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
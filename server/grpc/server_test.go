@@ -0,0 +1,139 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net"
+	"testing"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/server/grpc/smtv1"
+)
+
+// startServer serves a new tree of depth 8 over an in-memory connection.
+func startServer(t *testing.T, opts ...Option) (smtv1.SparseMerkleTreeClient, *bsmt.Hasher, []byte) {
+	hasher := bsmt.NewHasherPool(sha256.New)
+	nilHash := hasher.Hash([]byte("nilHash"))
+	tree, err := bsmt.NewBNBSparseMerkleTree(hasher, memory.NewMemoryDB(), 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := gogrpc.NewServer()
+	NewServer(tree.(*bsmt.BNBSparseMerkleTree), nilHash, opts...).Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := gogrpc.Dial("bufnet", gogrpc.WithInsecure(),
+		gogrpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return smtv1.NewSparseMerkleTreeClient(conn), hasher, nilHash
+}
+
+func TestServer(t *testing.T) {
+	client, hasher, nilHash := startServer(t)
+	ctx := context.Background()
+
+	got, err := client.Get(ctx, &smtv1.GetRequest{Key: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Value, nilHash) {
+		t.Fatalf("expected the nil hash of an empty tree, got %x", got.Value)
+	}
+
+	for v := byte(1); v <= 2; v++ {
+		set, err := client.Set(ctx, &smtv1.SetRequest{Leaves: []*smtv1.Leaf{
+			{Key: 1, Value: hasher.Hash([]byte{v})},
+			{Key: 7, Value: hasher.Hash([]byte{v, v})},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit, err := client.Commit(ctx, &smtv1.CommitRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit.Version != uint64(v) || !bytes.Equal(commit.Root, set.Root) {
+			t.Fatalf("unexpected commit %d %x, expected %d %x", commit.Version, commit.Root, v, set.Root)
+		}
+	}
+
+	got, err = client.Get(ctx, &smtv1.GetRequest{Key: 1, Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 1 || !bytes.Equal(got.Value, hasher.Hash([]byte{1})) {
+		t.Fatalf("unexpected value %x at version %d", got.Value, got.Version)
+	}
+
+	for _, key := range []uint64{7, 9} {
+		proof, err := client.GetProof(ctx, &smtv1.GetProofRequest{Key: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bsmt.VerifyProof(hasher, proof.Root, 8, key, proof.Value, proof.Proof) {
+			t.Fatalf("invalid proof of key %d", key)
+		}
+	}
+
+	rollback, err := client.Rollback(ctx, &smtv1.RollbackRequest{Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = client.Get(ctx, &smtv1.GetRequest{Key: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollback.Version != 1 || got.Version != 1 || !bytes.Equal(got.Value, hasher.Hash([]byte{1, 1})) {
+		t.Fatalf("unexpected value %x at version %d after the rollback", got.Value, got.Version)
+	}
+
+	_, err = client.Get(ctx, &smtv1.GetRequest{Key: 1, Version: 5})
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatalf("expected OutOfRange, got %v", err)
+	}
+	_, err = client.Get(ctx, &smtv1.GetRequest{Key: 256})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	client, hasher, _ := startServer(t, WithAuthenticator(BearerToken("secret")), ReadOnly())
+	set := &smtv1.SetRequest{Leaves: []*smtv1.Leaf{{Key: 1, Value: hasher.Hash([]byte{1})}}}
+
+	_, err := client.Get(context.Background(), &smtv1.GetRequest{Key: 1})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+	wrong := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer public")
+	if _, err = client.Get(wrong, &smtv1.GetRequest{Key: 1}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err = client.Get(ctx, &smtv1.GetRequest{Key: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Set(ctx, set); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package http serves the read-only queries of a sparse merkle tree as JSON
+// over HTTP, the hashes encoded in 0x prefixed hex. The responses carry an
+// ETag of the root they were read from and a Cache-Control header, so the
+// public proof queries can be served by a CDN:
+//
+//	GET /v1/root[?version=N]            {"version", "root"}
+//	GET /v1/leaves/{key}[?version=N]    {"key", "version", "value"}
+//	GET /v1/proof/{key}                 {"root", "key", "value", "version", "proof"}
+//	GET /v1/versions                    {"latest", "recent", "versions"}
+//
+// The keys and versions are decimal, or hex with a 0x prefix.
+package http
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// defaultMaxAge is the max-age of the responses at an explicit version, unless
+// set by VersionedMaxAge.
+const defaultMaxAge = time.Minute
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithReadLock serves the queries holding the lock, such as the read lock of
+// the mutex guarding the writes of the tree, so a query never reads a tree
+// with changes pending.
+func WithReadLock(l sync.Locker) Option {
+	return func(s *Server) {
+		s.lock = l
+	}
+}
+
+// LatestMaxAge sets the max-age of the responses of the latest version, which
+// change with every commit. Zero, the default, lets the caches store them but
+// revalidate them with the ETag on each request.
+func LatestMaxAge(d time.Duration) Option {
+	return func(s *Server) {
+		s.latestMaxAge = d
+	}
+}
+
+// VersionedMaxAge sets the max-age of the responses at an explicit version,
+// one minute by default. A committed version only changes when it is rolled
+// back and committed again.
+func VersionedMaxAge(d time.Duration) Option {
+	return func(s *Server) {
+		s.versionedMaxAge = d
+	}
+}
+
+// Server is the http.Handler of the queries of a tree.
+type Server struct {
+	tree            *bsmt.BNBSparseMerkleTree
+	nilHash         []byte
+	lock            sync.Locker
+	latestMaxAge    time.Duration
+	versionedMaxAge time.Duration
+	mux             *nethttp.ServeMux
+}
+
+// NewServer returns a server of the tree, the nil hash is the value returned
+// for the absent leaves and must be the one the tree was created with.
+func NewServer(tree *bsmt.BNBSparseMerkleTree, nilHash []byte, opts ...Option) *Server {
+	s := &Server{
+		tree:            tree,
+		nilHash:         nilHash,
+		lock:            noLock{},
+		versionedMaxAge: defaultMaxAge,
+		mux:             nethttp.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("/v1/root", s.handleRoot)
+	s.mux.HandleFunc("/v1/leaves/", s.handleLeaf)
+	s.mux.HandleFunc("/v1/proof/", s.handleProof)
+	s.mux.HandleFunc("/v1/versions", s.handleVersions)
+	return s
+}
+
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if r.Method != nethttp.MethodGet && r.Method != nethttp.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, nethttp.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+type rootJSON struct {
+	Version uint64 `json:"version"`
+	Root    string `json:"root"`
+}
+
+type leafJSON struct {
+	Key     uint64 `json:"key"`
+	Version uint64 `json:"version"`
+	Value   string `json:"value"`
+}
+
+// proofJSON is the format of the proofs read by smtcli verify-proof.
+type proofJSON struct {
+	Root    string   `json:"root"`
+	Key     uint64   `json:"key"`
+	Value   string   `json:"value"`
+	Version uint64   `json:"version"`
+	Proof   []string `json:"proof"`
+}
+
+type versionsJSON struct {
+	Latest   uint64   `json:"latest"`
+	Recent   uint64   `json:"recent"`
+	Versions []uint64 `json:"versions"`
+}
+
+func (s *Server) handleRoot(w nethttp.ResponseWriter, r *nethttp.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	version, explicit, err := s.version(r)
+	if err != nil {
+		writeError(w, nethttp.StatusBadRequest, err)
+		return
+	}
+	root, err := s.tree.RootAt(version)
+	if err != nil {
+		writeTreeError(w, err)
+		return
+	}
+	s.write(w, r, root, explicit, rootJSON{Version: uint64(version), Root: encodeHex(root)})
+}
+
+func (s *Server) handleLeaf(w nethttp.ResponseWriter, r *nethttp.Request) {
+	key, err := parseUint(strings.TrimPrefix(r.URL.Path, "/v1/leaves/"))
+	if err != nil {
+		writeError(w, nethttp.StatusBadRequest, errors.Wrap(err, "invalid key"))
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	version, explicit, err := s.version(r)
+	if err != nil {
+		writeError(w, nethttp.StatusBadRequest, err)
+		return
+	}
+	root, err := s.tree.RootAt(version)
+	if err != nil {
+		writeTreeError(w, err)
+		return
+	}
+	val, err := s.get(key, version)
+	if err != nil {
+		writeTreeError(w, err)
+		return
+	}
+	s.write(w, r, root, explicit, leafJSON{Key: key, Version: uint64(version), Value: encodeHex(val)})
+}
+
+func (s *Server) handleProof(w nethttp.ResponseWriter, r *nethttp.Request) {
+	key, err := parseUint(strings.TrimPrefix(r.URL.Path, "/v1/proof/"))
+	if err != nil {
+		writeError(w, nethttp.StatusBadRequest, errors.Wrap(err, "invalid key"))
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	version := s.tree.LatestVersion()
+	proof, err := s.tree.GetProofContext(r.Context(), key)
+	if err != nil {
+		writeTreeError(w, err)
+		return
+	}
+	val, err := s.get(key, version)
+	if err != nil {
+		writeTreeError(w, err)
+		return
+	}
+	root := s.tree.Root()
+	encoded := proofJSON{
+		Root:    encodeHex(root),
+		Key:     key,
+		Value:   encodeHex(val),
+		Version: uint64(version),
+		Proof:   make([]string, len(proof)),
+	}
+	for i, hash := range proof {
+		encoded.Proof[i] = encodeHex(hash)
+	}
+	s.write(w, r, root, false, encoded)
+}
+
+func (s *Server) handleVersions(w nethttp.ResponseWriter, r *nethttp.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	latest := s.tree.LatestVersion()
+	encoded := versionsJSON{
+		Latest:   uint64(latest),
+		Recent:   uint64(s.tree.RecentVersion()),
+		Versions: []uint64{},
+	}
+	for _, v := range s.tree.Versions() {
+		encoded.Versions = append(encoded.Versions, uint64(v))
+	}
+	root, err := s.tree.RootAt(latest)
+	if err != nil {
+		writeTreeError(w, err)
+		return
+	}
+	s.write(w, r, root, false, encoded)
+}
+
+// version returns the version queried, and whether it is set explicitly.
+func (s *Server) version(r *nethttp.Request) (bsmt.Version, bool, error) {
+	param := r.URL.Query().Get("version")
+	if param == "" {
+		return s.tree.LatestVersion(), false, nil
+	}
+	v, err := parseUint(param)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "invalid version")
+	}
+	return bsmt.Version(v), true, nil
+}
+
+// get returns the value of the leaf at the version, the nil hash if absent.
+func (s *Server) get(key uint64, version bsmt.Version) ([]byte, error) {
+	val, err := s.tree.Get(key, &version)
+	if errors.Is(err, bsmt.ErrNodeNotFound) || errors.Is(err, bsmt.ErrEmptyRoot) {
+		return s.nilHash, nil
+	}
+	return val, err
+}
+
+// write writes the JSON response read from the root, or Not Modified if the
+// request is conditional on the same root.
+func (s *Server) write(w nethttp.ResponseWriter, r *nethttp.Request, root []byte, explicit bool, v interface{}) {
+	maxAge := s.latestMaxAge
+	if explicit {
+		maxAge = s.versionedMaxAge
+	}
+	etag := fmt.Sprintf("%q", hex.EncodeToString(root))
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	h.Set("Vary", "Accept-Encoding")
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+		w.WriteHeader(nethttp.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	if r.Method == nethttp.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+func writeError(w nethttp.ResponseWriter, code int, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(errorJSON{Error: err.Error()})
+}
+
+// writeTreeError maps the errors of the tree to HTTP status codes.
+func writeTreeError(w nethttp.ResponseWriter, err error) {
+	code := nethttp.StatusInternalServerError
+	switch {
+	case errors.Is(err, bsmt.ErrInvalidKey):
+		code = nethttp.StatusBadRequest
+	case errors.Is(err, bsmt.ErrVersionTooHigh), errors.Is(err, bsmt.ErrVersionTooOld),
+		errors.Is(err, bsmt.ErrVersionPruned):
+		code = nethttp.StatusNotFound
+	}
+	writeError(w, code, err)
+}
+
+func parseUint(s string) (uint64, error) {
+	return strconv.ParseUint(s, 0, 64)
+}
+
+func encodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
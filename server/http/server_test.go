@@ -0,0 +1,166 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+// prepareServer serves a tree of depth 8 with the leaf 1 committed in two
+// versions, and the leaf 7 in the second.
+func prepareServer(t *testing.T, opts ...Option) (*httptest.Server, *bsmt.BNBSparseMerkleTree, *bsmt.Hasher) {
+	hasher := bsmt.NewHasherPool(sha256.New)
+	nilHash := hasher.Hash([]byte("nilHash"))
+	smt, err := bsmt.NewBNBSparseMerkleTree(hasher, memory.NewMemoryDB(), 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*bsmt.BNBSparseMerkleTree)
+	for v, keys := range [][]uint64{{1}, {1, 7}} {
+		for _, key := range keys {
+			if err := tree.Set(key, hasher.Hash([]byte{byte(key), byte(v)})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := tree.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(NewServer(tree, nilHash, opts...))
+	t.Cleanup(srv.Close)
+	return srv, tree, hasher
+}
+
+func getJSON(t *testing.T, url string, v interface{}) *nethttp.Response {
+	resp, err := nethttp.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == nethttp.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestServer(t *testing.T) {
+	srv, tree, hasher := prepareServer(t)
+
+	var root rootJSON
+	getJSON(t, srv.URL+"/v1/root", &root)
+	if root.Version != 2 || root.Root != encodeHex(tree.Root()) {
+		t.Fatalf("unexpected root %+v", root)
+	}
+
+	var leaf leafJSON
+	resp := getJSON(t, srv.URL+"/v1/leaves/0x1?version=1", &leaf)
+	if leaf.Version != 1 || leaf.Value != encodeHex(hasher.Hash([]byte{1, 0})) {
+		t.Fatalf("unexpected leaf %+v", leaf)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "public, max-age=60" {
+		t.Fatalf("unexpected Cache-Control %q", got)
+	}
+	getJSON(t, srv.URL+"/v1/leaves/7?version=1", &leaf)
+	if leaf.Value != encodeHex(hasher.Hash([]byte("nilHash"))) {
+		t.Fatalf("expected the nil hash of an absent leaf, got %+v", leaf)
+	}
+
+	for _, key := range []string{"7", "9"} {
+		var proof proofJSON
+		resp = getJSON(t, srv.URL+"/v1/proof/"+key, &proof)
+		hashes := make(bsmt.Proof, len(proof.Proof))
+		for i, hash := range proof.Proof {
+			hashes[i] = decodeHex(t, hash)
+		}
+		if !bsmt.VerifyProof(hasher, decodeHex(t, proof.Root), 8, proof.Key, decodeHex(t, proof.Value), hashes) {
+			t.Fatalf("invalid proof of key %s", key)
+		}
+		if got := resp.Header.Get("Cache-Control"); got != "public, max-age=0" {
+			t.Fatalf("unexpected Cache-Control %q", got)
+		}
+	}
+
+	var versions versionsJSON
+	getJSON(t, srv.URL+"/v1/versions", &versions)
+	if versions.Latest != 2 || len(versions.Versions) != 2 {
+		t.Fatalf("unexpected versions %+v", versions)
+	}
+
+	for url, code := range map[string]int{
+		"/v1/root?version=3":   nethttp.StatusNotFound,
+		"/v1/leaves/256":       nethttp.StatusBadRequest,
+		"/v1/leaves/x":         nethttp.StatusBadRequest,
+		"/v1/unknown":          nethttp.StatusNotFound,
+		"/v1/root?version=0x2": nethttp.StatusOK,
+	} {
+		if resp := getJSON(t, srv.URL+url, nil); resp.StatusCode != code {
+			t.Fatalf("expected status %d of %s, got %d", code, url, resp.StatusCode)
+		}
+	}
+
+	resp, err := nethttp.Post(srv.URL+"/v1/root", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != nethttp.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", nethttp.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestServerConditionalRequest(t *testing.T) {
+	srv, tree, hasher := prepareServer(t, VersionedMaxAge(0))
+
+	resp := getJSON(t, srv.URL+"/v1/proof/1", nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	req, _ := nethttp.NewRequest(nethttp.MethodGet, srv.URL+"/v1/proof/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err := nethttp.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != nethttp.StatusNotModified {
+		t.Fatalf("expected status %d, got %d", nethttp.StatusNotModified, resp.StatusCode)
+	}
+
+	if err := tree.Set(1, hasher.Hash([]byte{1, 2})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = nethttp.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != nethttp.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Fatalf("expected a new proof after the commit, got status %d", resp.StatusCode)
+	}
+}
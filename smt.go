@@ -7,32 +7,35 @@ package bsmt
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/bnb-chain/zkbnb-smt/database"
 	"github.com/bnb-chain/zkbnb-smt/database/memory"
+	"github.com/bnb-chain/zkbnb-smt/database/readonly"
+	"github.com/bnb-chain/zkbnb-smt/logger"
 	"github.com/bnb-chain/zkbnb-smt/metrics"
+	"github.com/bnb-chain/zkbnb-smt/tracing"
 	"github.com/bnb-chain/zkbnb-smt/utils"
-	"github.com/ethereum/go-ethereum/rlp"
-	lru "github.com/hashicorp/golang-lru"
 	"github.com/panjf2000/ants/v2"
 	sysMemory "github.com/pbnjay/memory"
 	"github.com/pkg/errors"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	latestVersionKey          = []byte(`latestVersion`)
 	recentVersionNumberKey    = []byte(`recentVersionNumber`)
+	maxRollbackDepthKey       = []byte(`maxRollbackDepth`)
 	storageFullTreeNodePrefix = []byte(`t`)
 	sep                       = []byte(`:`)
 )
 
 // Encode key, format: t:${depth}:${path}
 func storageFullTreeNodeKey(depth uint8, path uint64) []byte {
-	pathBuf := make([]byte, 8)
-	binary.BigEndian.PutUint64(pathBuf, path)
-	return bytes.Join([][]byte{storageFullTreeNodePrefix, {depth}, pathBuf}, sep)
+	return standardNodeKeys.key(depth, path)
 }
 
 var _ SparseMerkleTree = (*BNBSparseMerkleTree)(nil)
@@ -49,6 +52,7 @@ func NewSparseMerkleTree(hasher *Hasher, db database.TreeDB, maxDepth uint8, has
 		hasher:         hasher,
 		batchSizeLimit: 100000 * 1024,
 		dbCacheSize:    100 * 1024 * 1024,
+		log:            logger.Nop(),
 		gcStatus: &gcStatus{
 			threshold: sysMemory.TotalMemory() / 8,
 			segment:   sysMemory.TotalMemory() / 8 / 10,
@@ -66,20 +70,34 @@ func NewSparseMerkleTree(hasher *Hasher, db database.TreeDB, maxDepth uint8, has
 	}
 
 	smt.db = db
+	if smt.readOnly {
+		smt.db = readonly.Wrap(db)
+		smt.writeBehindLag = 0
+		smt.gcAsync = false
+	}
 	err := smt.initFromStorage()
 	if err != nil {
 		return nil, err
 	}
 	smt.lastSaveRoot = smt.root
+	if smt.preloadLevels > 0 {
+		if err := smt.preload(smt.preloadLevels); err != nil {
+			return nil, err
+		}
+	}
 
 	if smt.metrics != nil {
 		smt.metrics.GCThreshold(smt.gcStatus.threshold)
 	}
 
-	smt.dbCache, err = lru.New(smt.dbCacheSize)
-	if err != nil {
-		return nil, err
+	if smt.nodeCache == nil {
+		smt.nodeCache, err = NewNodeCache(smt.dbCacheSize)
+		if err != nil {
+			return nil, err
+		}
+		smt.nodeCache.shared = false
 	}
+	smt.dbCache = newLeafCache(smt.nodeCache)
 
 	if smt.goroutinePool == nil {
 		smt.goroutinePool, err = ants.NewPool(128)
@@ -88,6 +106,17 @@ func NewSparseMerkleTree(hasher *Hasher, db database.TreeDB, maxDepth uint8, has
 		}
 	}
 
+	if smt.writeBehindLag > 0 {
+		// the commits of a previous process are rebuilt before the writes are deferred
+		if err := smt.replayWriteBehind(); err != nil {
+			return nil, err
+		}
+		smt.db = newWriteBehindDB(db, smt.writeBehindLag, smt.log)
+	}
+
+	if smt.gcAsync {
+		smt.gc = newGCWorker(smt, smt.gcPace)
+	}
 	return smt, nil
 }
 
@@ -105,6 +134,7 @@ func NewBNBSparseMerkleTree(hasher *Hasher, db database.TreeDB, maxDepth uint8,
 		hasher:         hasher,
 		batchSizeLimit: 100 * 1024,
 		dbCacheSize:    2048,
+		log:            logger.Nop(),
 		gcStatus: &gcStatus{
 			threshold: sysMemory.TotalMemory() / 8,
 			segment:   sysMemory.TotalMemory() / 8 / 10,
@@ -122,20 +152,34 @@ func NewBNBSparseMerkleTree(hasher *Hasher, db database.TreeDB, maxDepth uint8,
 	}
 
 	smt.db = db
+	if smt.readOnly {
+		smt.db = readonly.Wrap(db)
+		smt.writeBehindLag = 0
+		smt.gcAsync = false
+	}
 	err := smt.initFromStorage()
 	if err != nil {
 		return nil, err
 	}
 	smt.lastSaveRoot = smt.root
+	if smt.preloadLevels > 0 {
+		if err := smt.preload(smt.preloadLevels); err != nil {
+			return nil, err
+		}
+	}
 
 	if smt.metrics != nil {
 		smt.metrics.GCThreshold(smt.gcStatus.threshold)
 	}
 
-	smt.dbCache, err = lru.New(smt.dbCacheSize)
-	if err != nil {
-		return nil, err
+	if smt.nodeCache == nil {
+		smt.nodeCache, err = NewNodeCache(smt.dbCacheSize)
+		if err != nil {
+			return nil, err
+		}
+		smt.nodeCache.shared = false
 	}
+	smt.dbCache = newLeafCache(smt.nodeCache)
 
 	if smt.goroutinePool == nil {
 		smt.goroutinePool, err = ants.NewPool(128)
@@ -144,6 +188,17 @@ func NewBNBSparseMerkleTree(hasher *Hasher, db database.TreeDB, maxDepth uint8,
 		}
 	}
 
+	if smt.writeBehindLag > 0 {
+		// the commits of a previous process are rebuilt before the writes are deferred
+		if err := smt.replayWriteBehind(); err != nil {
+			return nil, err
+		}
+		smt.db = newWriteBehindDB(db, smt.writeBehindLag, smt.log)
+	}
+
+	if smt.gcAsync {
+		smt.gc = newGCWorker(smt, smt.gcPace)
+	}
 	return smt, nil
 }
 
@@ -224,13 +279,22 @@ func (j *journal) iterate(callback func(key journalKey, val *TreeNode) error) er
 	return nil
 }
 
-func (j *journal) setIfNotExist(jk journalKey, target *TreeNode) *TreeNode {
+// setIfNotExist keeps a copy of the node on the path of a leaf set in the
+// version, unless the node is kept already, and returns the kept node.
+func (j *journal) setIfNotExist(jk journalKey, target *TreeNode, version Version) *TreeNode {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
 	node, exist := j.data[jk]
 	if !exist {
-		j.data[jk] = target.Copy()
+		cp := target.Copy()
+		// a node set earlier in the same version must not look recomputed to
+		// the siblings, its hash of the version is dropped until recomputed
+		if n := len(cp.Versions); n > 0 && cp.Versions[n-1].Ver == version {
+			cp.Versions = cp.Versions[: n-1 : n-1]
+		}
+		cp.beginRecompute()
+		j.data[jk] = cp
 		if p, e := j.data[journalKey{depth: target.depth - 4, path: target.path >> 4}]; e {
 			p.Children[target.path&0xf] = j.data[jk]
 		}
@@ -314,90 +378,293 @@ type BNBSparseMerkleTree struct {
 	hasher           *Hasher
 	db               database.TreeDB
 	dbCacheSize      int
-	dbCache          *lru.Cache
+	dbCache          *leafCache
+	nodeCache        *NodeCache
 	batchSizeLimit   int
 	gcStatus         *gcStatus
 	goroutinePool    *ants.Pool
 	metrics          metrics.Metrics
+	opMetrics        metrics.OperationMetrics
+	tracer           tracing.Tracer
+	log              logger.Logger
+	slowThreshold    time.Duration
+	writeBehindLag   int
+	retainVersions   uint
+	autoPrune        bool
+	coldTier         Offloader
+	rolledBack       rolledBack
+	opLog            bool
+	readOnly         bool
+	auditLog         bool
+	auditTags        auditTags
+	versionMetadata  versionMetadata
+	pruneGate        func(Version) bool
+	archive          bool
+	prunedRanges     []versionRange
+	pinned           []Version
+	repaired         *RepairReport
+	interrupted      Version // the interrupted commit left by a read-only open
+	archiveSink      ArchiveSink
+	maxRollbackDepth uint64
+	commitWorkers    int
+	bloom            *bloomFilter
+	pipeline         *commitPipeline
+	gcHardLimit      uint64
+	cacheCounters    cacheCounters
+	proofWorkers     int
+	subtreeLocks     subtreeLocks
+	nodeKeys         nodeKeyFormat
+	profileLabels    bool
+	phaseHook        func(Phase, time.Duration)
+	opStats          operationStats
+	statsWindow      time.Duration
+	preloadLevels    int
+	prefetchDepth    int
+	memoryCap        uint64
+	access           accessClock
+	maxGCBacklog     uint64
+
+	// gcMu excludes the tree operations from the steps of a background GC sweep,
+	// the operations themselves only take the read lock.
+	gcMu    sync.RWMutex
+	gc      *gcWorker
+	gcStats gcStats
+	gcPace  time.Duration
+	gcAsync bool
 }
 
+// initFromStorage restores the version metadata and the root node. The nodes
+// below the root are not read, they are faulted in by the operations reaching
+// them, so opening a tree takes the same few reads regardless of its size.
 func (tree *BNBSparseMerkleTree) initFromStorage() error {
 	tree.root = NewTreeNode(0, 0, tree.nilHashes, tree.hasher)
-	// recovery version info
-	buf, err := tree.db.Get(latestVersionKey)
-	if errors.Is(err, database.ErrDatabaseNotFound) {
-		return nil
+	if err := tree.initNodeKeyFormat(); err != nil {
+		return err
 	}
-	if err != nil {
+	if err := tree.repair(); err != nil {
 		return err
 	}
-	if len(buf) > 0 {
-		tree.version = Version(binary.BigEndian.Uint64(buf))
+	// recovery version info and root node with a single read
+	rootKey := tree.nodeKeys.key(0, 0)
+	values, err := tree.db.MultiGet([][]byte{latestVersionKey, recentVersionNumberKey, rootKey, prunedRangesKey, pinnedVersionsKey, maxRollbackDepthKey})
+	if err != nil {
+		return err
 	}
-
-	buf, err = tree.db.Get(recentVersionNumberKey)
-	if err != nil && !errors.Is(err, database.ErrDatabaseNotFound) {
+	if err := tree.initMaxRollbackDepth(values[5]); err != nil {
 		return err
 	}
-	if len(buf) > 0 {
-		tree.recentVersion = Version(binary.BigEndian.Uint64(buf))
+	if values[0] == nil {
+		return nil
+	}
+	if len(values[0]) > 0 {
+		tree.version = Version(binary.BigEndian.Uint64(values[0]))
+	}
+	if len(values[1]) > 0 {
+		tree.recentVersion = Version(binary.BigEndian.Uint64(values[1]))
+	}
+	if values[3] != nil {
+		if tree.prunedRanges, err = decodePrunedRanges(values[3]); err != nil {
+			return err
+		}
+	}
+	if values[4] != nil {
+		if tree.pinned, err = decodePinnedVersions(values[4]); err != nil {
+			return err
+		}
 	}
 
 	// recovery root node from storage
-	rlpBytes, err := tree.db.Get(storageFullTreeNodeKey(0, 0))
-	if errors.Is(err, database.ErrDatabaseNotFound) {
+	if values[2] == nil {
 		return nil
 	}
-	if err != nil {
-		return err
-	}
-	storageTreeNode := &StorageTreeNode{}
-	err = rlp.DecodeBytes(rlpBytes, storageTreeNode)
+	storageTreeNode, err := decodeStorageTreeNode(rootKey, values[2])
 	if err != nil {
 		return err
 	}
 	tree.root = storageTreeNode.ToTreeNode(0, tree.nilHashes, tree.hasher)
 
-	tree.rootSize = tree.root.Size()
+	size := tree.root.Size()
 	for i := 0; i < len(tree.root.Children); i++ {
 		if tree.root.Children[i] != nil {
-			tree.rootSize += uint64(versionSize * len(tree.root.Children[i].Versions))
+			size += uint64(versionSize * len(tree.root.Children[i].Versions))
 		}
 	}
+	tree.setSize(size)
 
-	return nil
+	return tree.initBloomFilter()
 }
 
-func (tree *BNBSparseMerkleTree) extendNode(node *TreeNode, nibble, path uint64, depth uint8, isCreated bool) error {
-	if node.Children[nibble] != nil &&
-		!node.Children[nibble].IsTemporary() {
+func (tree *BNBSparseMerkleTree) extendNode(node *TreeNode, nibble, path uint64, depth uint8, isCreated bool, op cacheOp) error {
+	if child := tree.child(node, nibble); child != nil && !child.IsTemporary() {
+		tree.cacheCounters.hit(op, 1)
 		return nil
 	}
+	tree.cacheCounters.fault(op, 1)
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
 
-	rlpBytes, err := tree.db.Get(storageFullTreeNodeKey(depth, path))
-	if errors.Is(err, database.ErrDatabaseNotFound) {
+	storageTreeNode, err := tree.readNode(depth, path)
+	if err != nil {
+		return err
+	}
+	if storageTreeNode == nil {
 		if isCreated {
-			node.Children[nibble] = NewTreeNode(depth, path, tree.nilHashes, tree.hasher)
+			tree.attachChild(node, nibble, NewTreeNode(depth, path, tree.nilHashes, tree.hasher))
 		}
 		return nil
 	}
-	if err != nil {
+	tree.attachChild(node, nibble, storageTreeNode.ToTreeNode(depth, tree.nilHashes, tree.hasher))
+
+	return nil
+}
+
+// loadChildren loads the children of the node at the nibbles which are not in
+// memory yet with a single MultiGet. The children missing in the database are
+// left as they are, as extendNode does without creating them.
+func (tree *BNBSparseMerkleTree) loadChildren(node *TreeNode, nibbles []int, op cacheOp) error {
+	var missing []int
+	for _, nibble := range nibbles {
+		if child := node.Children[nibble]; child == nil || child.IsTemporary() {
+			missing = append(missing, nibble)
+		}
+	}
+	tree.cacheCounters.hit(op, len(nibbles)-len(missing))
+	if len(missing) == 0 {
+		return nil
+	}
+	tree.cacheCounters.fault(op, len(missing))
+	if err := tree.awaitCommit(); err != nil {
 		return err
 	}
 
-	storageTreeNode := &StorageTreeNode{}
-	err = rlp.DecodeBytes(rlpBytes, storageTreeNode)
+	depth := node.depth + 4
+	arena := newNodeKeyArena(tree.nodeKeys, len(missing))
+	keys := make([][]byte, len(missing))
+	for i, nibble := range missing {
+		keys[i] = arena.key(depth, node.path<<4+uint64(nibble))
+	}
+	values, err := tree.db.MultiGet(keys)
 	if err != nil {
 		return err
 	}
-	node.Children[nibble] = storageTreeNode.ToTreeNode(
-		depth, tree.nilHashes, tree.hasher)
+	for i, nibble := range missing {
+		if values[i] == nil {
+			continue
+		}
+		storageTreeNode, err := decodeStorageTreeNode(keys[i], values[i])
+		if err != nil {
+			return err
+		}
+		node.Children[nibble] = storageTreeNode.ToTreeNode(depth, tree.nilHashes, tree.hasher)
+	}
+	return nil
+}
+
+// loadPath loads the nodes on the path of the key which are not in memory yet
+// with a single MultiGet, instead of reading them level by level.
+// The missing nodes are created, as extendNode does.
+func (tree *BNBSparseMerkleTree) loadPath(key uint64, op cacheOp) error {
+	return tree.loadPaths([]uint64{key}, op)
+}
+
+// loadPaths loads the nodes on the paths of the keys which are not in memory
+// yet with a single MultiGet. The nodes shared by several paths are read once.
+func (tree *BNBSparseMerkleTree) loadPaths(keys []uint64, op cacheOp) error {
+	levels := int(tree.maxDepth) / 4
+	var (
+		missing []journalKey
+		seen    = make(map[journalKey]int)
+		// the topmost faulted nodes, whose subtrees are prefetched
+		faulted = make(map[journalKey]bool)
+	)
+	for _, key := range keys {
+		node := tree.root
+		level := 0
+		for ; level < levels; level++ {
+			path := key >> (int(tree.maxDepth) - (level+1)*4)
+			child := tree.child(node, path&0x000000000000000f)
+			if child == nil || child.IsTemporary() {
+				break
+			}
+			node = child
+		}
+		tree.cacheCounters.hit(op, level)
+		if tree.prefetchDepth > 0 && level < levels {
+			depth := uint8(level+1) * 4
+			faulted[journalKey{depth, key >> (int(tree.maxDepth) - int(depth))}] = true
+		}
+		for i := level; i < levels; i++ {
+			depth := uint8(i+1) * 4
+			jk := journalKey{depth, key >> (int(tree.maxDepth) - int(depth))}
+			if _, ok := seen[jk]; !ok {
+				seen[jk] = len(missing)
+				missing = append(missing, jk)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	tree.cacheCounters.fault(op, len(missing))
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
 
+	arena := newNodeKeyArena(tree.nodeKeys, len(missing))
+	dbKeys := make([][]byte, len(missing))
+	for i, jk := range missing {
+		dbKeys[i] = arena.key(jk.depth, jk.path)
+	}
+	values, err := tree.db.MultiGet(dbKeys)
+	if err != nil {
+		return err
+	}
+	loaded := make([]*TreeNode, len(missing))
+	for i, jk := range missing {
+		if values[i] == nil {
+			loaded[i] = NewTreeNode(jk.depth, jk.path, tree.nilHashes, tree.hasher)
+			continue
+		}
+		storageTreeNode, err := decodeStorageTreeNode(dbKeys[i], values[i])
+		if err != nil {
+			return err
+		}
+		loaded[i] = storageTreeNode.ToTreeNode(jk.depth, tree.nilHashes, tree.hasher)
+	}
+
+	// attach the nodes from the top, so the paths sharing a node are attached to the same one
+	var prefetch []*TreeNode
+	for _, key := range keys {
+		node := tree.root
+		for level := 0; level < levels; level++ {
+			depth := uint8(level+1) * 4
+			path := key >> (int(tree.maxDepth) - int(depth))
+			nibble := path & 0x000000000000000f
+			node = tree.attachChild(node, nibble, loaded[seen[journalKey{depth, path}]])
+			if jk := (journalKey{depth, path}); faulted[jk] {
+				delete(faulted, jk)
+				prefetch = append(prefetch, node)
+			}
+		}
+	}
+	if len(prefetch) > 0 {
+		return tree.preloadFrom(prefetch, tree.prefetchDepth)
+	}
 	return nil
 }
 
+// Size returns the memory size, in bytes, of the in-memory nodes the GC
+// threshold applies to. The size is maintained incrementally by the commits
+// and the GC runs, Size only loads it and can be called from any goroutine.
 func (tree *BNBSparseMerkleTree) Size() uint64 {
-	return tree.rootSize
+	return atomic.LoadUint64(&tree.rootSize)
+}
+
+// setSize updates the size of the in-memory nodes. The size is only changed by
+// the writers of the tree, it is stored atomically for the concurrent Size calls.
+func (tree *BNBSparseMerkleTree) setSize(size uint64) {
+	atomic.StoreUint64(&tree.rootSize, size)
 }
 
 func (tree *BNBSparseMerkleTree) Get(key uint64, version *Version) ([]byte, error) {
@@ -413,7 +680,7 @@ func (tree *BNBSparseMerkleTree) Get(key uint64, version *Version) ([]byte, erro
 		version = &tree.version
 	}
 
-	if tree.recentVersion > *version {
+	if tree.recentVersion > *version && !tree.isPinned(*version) {
 		return nil, ErrVersionTooOld
 	}
 
@@ -421,30 +688,37 @@ func (tree *BNBSparseMerkleTree) Get(key uint64, version *Version) ([]byte, erro
 		return nil, ErrVersionTooHigh
 	}
 
+	if tree.isPruned(*version) {
+		return nil, ErrVersionPruned
+	}
+
+	// the keys never committed are not in the tree
+	if tree.bloom != nil && !tree.bloom.has(key) {
+		return nil, ErrNodeNotFound
+	}
+
 	// read from cache
-	cached, ok := tree.dbCache.Get(key)
-	if ok {
-		node := cached.(*TreeNode)
+	if node, ok := tree.dbCache.Get(key); ok {
 		for i := len(node.Versions) - 1; i >= 0; i-- {
 			if node.Versions[i].Ver <= *version {
+				tree.cacheCounters.hit(cacheOpGet, 1)
 				return node.Versions[i].Hash, nil
 			}
 		}
 	}
 
 	// read from db if cache miss
-	rlpBytes, err := tree.db.Get(storageFullTreeNodeKey(tree.maxDepth, key))
-	if errors.Is(err, database.ErrDatabaseNotFound) {
-		return nil, ErrNodeNotFound
-	}
-	if err != nil {
+	tree.cacheCounters.fault(cacheOpGet, 1)
+	if err := tree.awaitCommit(); err != nil {
 		return nil, err
 	}
-	storageTreeNode := &StorageTreeNode{}
-	err = rlp.DecodeBytes(rlpBytes, storageTreeNode)
+	storageTreeNode, err := tree.readNode(tree.maxDepth, key)
 	if err != nil {
 		return nil, err
 	}
+	if storageTreeNode == nil {
+		return nil, ErrNodeNotFound
+	}
 
 	// cache node that read from db
 	tree.dbCache.Add(key, storageTreeNode.ToTreeNode(tree.maxDepth, tree.nilHashes, tree.hasher))
@@ -458,29 +732,43 @@ func (tree *BNBSparseMerkleTree) Get(key uint64, version *Version) ([]byte, erro
 	return tree.nilHashes.Get(tree.maxDepth), nil
 }
 
+// Set sets the value of the key in the next version. The hashes on the path of
+// the key are recomputed right away, so Root reflects the change before Commit,
+// and Commit is left with persisting the dirty nodes.
 func (tree *BNBSparseMerkleTree) Set(key uint64, val []byte) error {
-	return tree.SetWithVersion(key, val, tree.version+1)
+	if err := tree.SetWithVersion(key, val, tree.version+1); err != nil {
+		return err
+	}
+	return tree.flushIfCapped()
 }
 
 // SetWithVersion sets key, value pair with a specific version.
 func (tree *BNBSparseMerkleTree) SetWithVersion(key uint64, val []byte, newVersion Version) error {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
 	if key >= 1<<tree.maxDepth {
 		return ErrInvalidKey
 	}
 	if newVersion <= tree.version {
 		return ErrVersionTooLow
 	}
+	tree.touch(key)
+	tree.tagWrite(key)
 
 	targetNode := tree.root
 	var depth uint8 = 4
-	var parentNodes = make([]*TreeNode, 0, tree.maxDepth/4)
+	scratch := getPathNodes()
+	defer putPathNodes(scratch)
+	parentNodes := *scratch
 	for i := 0; i < int(tree.maxDepth)/4; i++ {
 		// path <= 2^maxDepth - 1
 		path := key >> (int(tree.maxDepth) - (i+1)*4)
 		// position in treeNode, nibble <= 0xf
 		nibble := path & 0x000000000000000f
 		parentNodes = append(parentNodes, targetNode.Copy())
-		if err := tree.extendNode(targetNode, nibble, path, depth, true); err != nil {
+		*scratch = parentNodes
+		if err := tree.extendNode(targetNode, nibble, path, depth, true, cacheOpSet); err != nil {
 			return err
 		}
 		targetNode = targetNode.Children[nibble]
@@ -491,6 +779,7 @@ func (tree *BNBSparseMerkleTree) SetWithVersion(key uint64, val []byte, newVersi
 	targetNode.Set(val, newVersion) // update hash of leaf node
 	tree.journal.set(journalKey{targetNode.depth, targetNode.path}, targetNode)
 	// recompute root hash of middle nodes
+	defer tree.observe(PhaseHash, tree.phaseStart())
 	for i := len(parentNodes) - 1; i >= 0; i-- {
 		childNibble := key >> (int(tree.maxDepth) - (i+1)*4) & 0x000000000000000f
 		parentNodes[i].SetChildren(targetNode, int(childNibble), newVersion)
@@ -504,7 +793,10 @@ func (tree *BNBSparseMerkleTree) SetWithVersion(key uint64, val []byte, newVersi
 
 // MultiSet sets k,v pairs in parallel
 func (tree *BNBSparseMerkleTree) MultiSet(items []Item) error {
-	return tree.MultiSetWithVersion(items, tree.version+1)
+	if err := tree.MultiSetWithVersion(items, tree.version+1); err != nil {
+		return err
+	}
+	return tree.flushIfCapped()
 }
 
 // MultiSetWithVersion sets k,v pairs in parallel with a specific version.
@@ -513,6 +805,9 @@ func (tree *BNBSparseMerkleTree) MultiSet(items []Item) error {
 // 2. set all leaves, without lock;
 // 3. re-compute hash, from leaves to root
 func (tree *BNBSparseMerkleTree) MultiSetWithVersion(items []Item, newVersion Version) error {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
 	size := len(items)
 	if size == 0 {
 		return nil
@@ -531,6 +826,8 @@ func (tree *BNBSparseMerkleTree) MultiSetWithVersion(items []Item, newVersion Ve
 		if it.Key >= maxKey {
 			return ErrInvalidKey
 		}
+		tree.touch(it.Key)
+		tree.tagWrite(it.Key)
 		wg.Add(1)
 		tree.goroutinePool.Submit(func() {
 			defer wg.Done()
@@ -552,12 +849,15 @@ func (tree *BNBSparseMerkleTree) MultiSetWithVersion(items []Item, newVersion Ve
 		}
 	}
 
+	start := tree.phaseStart()
 	wg.Add(leavesJournal.len())
 	// For treeNode, the concurrency set to the number of leaf nodes
 	err := leavesJournal.iterate(func(k journalKey, v *TreeNode) error {
 		err := tree.goroutinePool.Submit(func() {
 			defer wg.Done()
-			tree.recompute(v, tmpJournal)
+			tree.labeled(PhaseHash, func() {
+				tree.recompute(v, tmpJournal)
+			})
 		})
 		if err != nil {
 			return err
@@ -568,6 +868,13 @@ func (tree *BNBSparseMerkleTree) MultiSetWithVersion(items []Item, newVersion Ve
 		return ErrUnexpected
 	}
 	wg.Wait()
+	tree.observe(PhaseHash, start)
+
+	// pack the recomputed hashes before the nodes are reachable from the root
+	_ = tmpJournal.iterate(func(_ journalKey, node *TreeNode) error {
+		node.endRecompute()
+		return nil
+	})
 
 	// point root node to the new one
 	newRoot, exist := tmpJournal.get(journalKey{tree.root.depth, tree.root.path})
@@ -604,11 +911,11 @@ func (tree *BNBSparseMerkleTree) setIntermediateAndLeaves(tmpJournal *journal, i
 
 		// skip existed node
 		jk := journalKey{targetNode.depth, targetNode.path}
-		cp := tmpJournal.setIfNotExist(jk, targetNode)
+		cp := tmpJournal.setIfNotExist(jk, targetNode, newVer)
 		cp.mark(int(nibble))
 
 		// create a new treeNode in targetNode
-		if err := tree.extendNode(targetNode, nibble, path, depth, true); err != nil {
+		if err := tree.extendNode(targetNode, nibble, path, depth, true, cacheOpSet); err != nil {
 			return nil, fmt.Errorf("%w: %s", ErrExtendNode, err.Error())
 		}
 		targetNode = targetNode.Children[nibble]
@@ -632,7 +939,39 @@ func (tree *BNBSparseMerkleTree) Root() []byte {
 	return tree.root.Root()
 }
 
+// RootAt returns the root committed at the version, without the pending changes.
+func (tree *BNBSparseMerkleTree) RootAt(version Version) ([]byte, error) {
+	if version > tree.version {
+		return nil, ErrVersionTooHigh
+	}
+	if tree.recentVersion > version && !tree.isPinned(version) {
+		return nil, ErrVersionTooOld
+	}
+	if tree.isPruned(version) {
+		return nil, ErrVersionPruned
+	}
+	return tree.rootAt(version), nil
+}
+
 func (tree *BNBSparseMerkleTree) GetProof(key uint64) (Proof, error) {
+	return tree.GetProofContext(context.Background(), key)
+}
+
+func (tree *BNBSparseMerkleTree) getProofOf(key uint64) (Proof, error) {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+	defer tree.observe(PhaseProof, time.Now())
+
+	if !tree.IsEmpty() && key < 1<<tree.maxDepth {
+		if err := tree.loadPath(key, cacheOpProof); err != nil {
+			return nil, err
+		}
+	}
+	return tree.getProof(key)
+}
+
+// getProof builds the proof of the key, whose path is loaded already.
+func (tree *BNBSparseMerkleTree) getProof(key uint64) (Proof, error) {
 	proofs := make([][]byte, 0, tree.maxDepth)
 	if tree.IsEmpty() {
 		for i := tree.maxDepth; i > 0; i-- {
@@ -644,6 +983,7 @@ func (tree *BNBSparseMerkleTree) GetProof(key uint64) (Proof, error) {
 	if key >= 1<<tree.maxDepth {
 		return nil, ErrInvalidKey
 	}
+	tree.touch(key)
 
 	targetNode := tree.root
 	var neighborNode *TreeNode
@@ -652,7 +992,7 @@ func (tree *BNBSparseMerkleTree) GetProof(key uint64) (Proof, error) {
 	for i := 0; i < int(tree.maxDepth)/4; i++ {
 		path := key >> (int(tree.maxDepth) - (i+1)*4)
 		nibble := path & 0x000000000000000f
-		if err := tree.extendNode(targetNode, nibble, path, depth, true); err != nil {
+		if err := tree.extendNode(targetNode, nibble, path, depth, true, cacheOpCounted); err != nil {
 			return nil, err
 		}
 		index := 0
@@ -661,12 +1001,12 @@ func (tree *BNBSparseMerkleTree) GetProof(key uint64) (Proof, error) {
 			// nibble / 4
 			// nibble / 2
 			inc := int(nibble) / (1 << (3 - j))
-			proofs = append(proofs, targetNode.Internals[(index+inc)^1])
+			proofs = append(proofs, targetNode.internal((index+inc)^1))
 			index += 1 << (j + 1)
 		}
 
-		neighborNode = targetNode.Children[nibble^1]
-		targetNode = targetNode.Children[nibble]
+		neighborNode = tree.child(targetNode, nibble^1)
+		targetNode = tree.child(targetNode, nibble)
 		if neighborNode == nil {
 			proofs = append(proofs, tree.nilHashes.Get(depth))
 		} else {
@@ -692,49 +1032,7 @@ func (tree *BNBSparseMerkleTree) VerifyProof(key uint64, proof Proof) bool {
 		keyVal = tree.nilHashes.Get(tree.maxDepth)
 	}
 
-	var depth uint8 = 4
-	var helpers = make([]int, 0, tree.maxDepth)
-
-	for i := 0; i < int(tree.maxDepth)/4; i++ {
-		path := key >> (int(tree.maxDepth) - (i+1)*4)
-		nibble := path & 0x000000000000000f
-
-		if i > 0 { // ignore the root node
-			helpers = append(helpers, int(path)/16%2)
-		}
-
-		index := 0
-		for j := 0; j < 3; j++ {
-			// nibble / 8
-			// nibble / 4
-			// nibble / 2
-			inc := int(nibble) / (1 << (3 - j))
-			helpers = append(helpers, inc%2)
-			index += 1 << (j + 1)
-		}
-
-		depth += 4
-	}
-	helpers = append(helpers, int(key)%2)
-	helpers = utils.ReverseInts(helpers)
-	if len(proof) != len(helpers) {
-		return false
-	}
-
-	root := tree.Root()
-	node := keyVal
-	for i := 0; i < len(proof); i++ {
-		switch helpers[i] {
-		case 0:
-			node = tree.hasher.Hash(node, proof[i])
-		case 1:
-			node = tree.hasher.Hash(proof[i], node)
-		default:
-			return false
-		}
-	}
-
-	return bytes.Equal(root, node)
+	return tree.hasher.verifyPath(tree.Root(), tree.maxDepth, key, keyVal, proof)
 }
 
 func (tree *BNBSparseMerkleTree) LatestVersion() Version {
@@ -750,56 +1048,76 @@ func (tree *BNBSparseMerkleTree) Versions() []Version {
 	defer tree.root.mu.RUnlock()
 	var versions []Version
 	for _, v := range tree.root.Versions {
-		versions = append(versions, v.Ver)
+		if !tree.isPruned(v.Ver) {
+			versions = append(versions, v.Ver)
+		}
 	}
 	return versions
 }
 
 func (tree *BNBSparseMerkleTree) Reset() {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	tree.reset()
+}
+
+func (tree *BNBSparseMerkleTree) reset() {
 	tree.journal.flush()
+	tree.discardTags()
+	tree.discardMetadata()
 	tree.root = tree.lastSaveRoot
-	tree.rootSize = tree.lastSaveRootSize
+	tree.setSize(tree.lastSaveRootSize)
 }
 
-func (tree *BNBSparseMerkleTree) writeNode(db database.Batcher, fullNode *TreeNode, version Version, recentVersion *Version) (uint64, error) {
-	changed := uint64(0)
-	if fullNode.PreviousVersion() > tree.gcStatus.latestGCVersion {
-		// If the previous version is greater than the last GC version,
-		// the node has a high probability of existing in memory
-		changed = versionSize
-	} else {
-		changed = fullNode.Size()
-	}
-	// prune versions
-	if recentVersion != nil {
-		changed -= fullNode.Prune(*recentVersion)
-	}
+// Commit persists the dirty nodes as a new version. The hashes are computed by
+// Set and MultiSet already, so no hashing but the record checksums is left to
+// the commit.
+func (tree *BNBSparseMerkleTree) Commit(recentVersion *Version) (Version, error) {
+	return tree.CommitWithNewVersion(recentVersion, nil)
+}
 
-	// persist tree
-	rlpBytes, err := rlp.EncodeToBytes(fullNode.ToStorageTreeNode())
-	if err != nil {
-		return changed, err
+// CommitExpecting commits SMT like Commit(nil), if the latest version is prev both
+// in memory and in the database. Otherwise a *VersionConflictError is returned
+// and nothing is written, which protects a tree namespace from being written
+// by several processes by accident. The check is not atomic with the write,
+// the processes racing between them are not detected.
+func (tree *BNBSparseMerkleTree) CommitExpecting(prev Version) (Version, error) {
+	if tree.version != prev {
+		return tree.version, &VersionConflictError{Expected: prev, Actual: tree.version}
 	}
-	err = db.Set(storageFullTreeNodeKey(fullNode.depth, fullNode.path), rlpBytes)
-	if err != nil {
-		return changed, err
+	if err := tree.awaitCommit(); err != nil {
+		return tree.version, err
 	}
-	if db.ValueSize() > tree.batchSizeLimit {
-		if err := db.Write(); err != nil {
-			return changed, err
+	if tree.db != nil {
+		buf, err := tree.db.Get(latestVersionKey)
+		if err != nil && !errors.Is(err, database.ErrDatabaseNotFound) {
+			return tree.version, err
+		}
+		var persisted Version
+		if len(buf) > 0 {
+			persisted = Version(binary.BigEndian.Uint64(buf))
+		}
+		if persisted != prev {
+			return tree.version, &VersionConflictError{Expected: prev, Actual: persisted}
 		}
-		db.Reset()
 	}
-
-	return changed, nil
-}
-
-func (tree *BNBSparseMerkleTree) Commit(recentVersion *Version) (Version, error) {
-	return tree.CommitWithNewVersion(recentVersion, nil)
+	return tree.CommitWithNewVersion(nil, nil)
 }
 
 // CommitWithNewVersion commits SMT with specified version.
 func (tree *BNBSparseMerkleTree) CommitWithNewVersion(recentVersion *Version, newVersion *Version) (Version, error) {
+	return tree.commitContext(context.Background(), recentVersion, newVersion)
+}
+
+func (tree *BNBSparseMerkleTree) commitWithNewVersion(ctx context.Context, recentVersion *Version, newVersion *Version) (Version, error) {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	if err := tree.awaitCommit(); err != nil {
+		return tree.version, err
+	}
+
 	var newVer Version
 	if newVersion == nil {
 		newVer = tree.version + 1
@@ -815,63 +1133,93 @@ func (tree *BNBSparseMerkleTree) CommitWithNewVersion(recentVersion *Version, ne
 	if recentVersion == nil && newVer <= tree.version {
 		return tree.version, ErrVersionTooLow
 	}
-
-	size := uint64(0)
-	journalSize := tree.journal.len()
-	if tree.db != nil {
-		// write tree nodes, prune old version
-		batch := tree.db.NewBatch()
-		err := tree.journal.iterate(func(key journalKey, node *TreeNode) error {
-			changed, err := tree.writeNode(batch, node, newVer, recentVersion)
-			if err != nil {
-				return err
-			}
-			size += changed
-			if node.depth == tree.maxDepth { // leaf node
-				tree.dbCache.Add(node.path, node)
-			}
-			return nil
-		})
-		if err != nil {
-			return tree.version, err
-		}
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, uint64(newVer))
-		err = batch.Set(latestVersionKey, buf)
-		if err != nil {
-			return tree.version, err
+	// the archive mode keeps every version
+	if tree.archive {
+		recentVersion = nil
+	}
+	// retain the last versions according to the retention policy
+	if recentVersion == nil && !tree.archive && tree.retainVersions > 0 && uint64(newVer) >= uint64(tree.retainVersions) {
+		if recent := newVer - Version(tree.retainVersions) + 1; recent > tree.recentVersion {
+			recentVersion = &recent
 		}
-
-		if recentVersion != nil {
-			buf = make([]byte, 8)
-			binary.BigEndian.PutUint64(buf, uint64(*recentVersion))
-			err = batch.Set(recentVersionNumberKey, buf)
-			if err != nil {
-				return tree.version, err
+	}
+	// hold back the versions blocked by the prune gate or within the rollback window
+	if recentVersion != nil {
+		if recent := tree.gatePrune(*recentVersion, newVer); recent != *recentVersion {
+			recentVersion = nil
+			if recent > tree.recentVersion {
+				recentVersion = &recent
 			}
 		}
+	}
+	// keep pruning the node versions up to the latest recent version if asked to
+	if recentVersion == nil && tree.autoPrune && !tree.archive && tree.recentVersion > 0 {
+		recent := tree.recentVersion
+		recentVersion = &recent
+	}
 
-		err = batch.Write()
+	start := time.Now()
+	size := uint64(0)
+	journalSize := tree.journal.len()
+	leaves := 0
+	_ = tree.journal.iterate(func(key journalKey, _ *TreeNode) error {
+		if key.depth == tree.maxDepth {
+			leaves++
+		}
+		return nil
+	})
+	if tree.db != nil {
+		var err error
+		size, err = tree.persistVersion(ctx, newVer, recentVersion)
 		if err != nil {
 			return tree.version, err
 		}
-		batch.Reset()
 	}
 
 	tree.version = newVer
+	tree.rolledBack = nil
+	if tree.hasher.arena != nil {
+		tree.hasher.arena.reset()
+	}
 	if recentVersion != nil {
 		tree.recentVersion = *recentVersion
 	}
 	originSize := tree.rootSize
 	currentSize := tree.rootSize + size
 	if releaseVersion := tree.gcStatus.pop(currentSize); releaseVersion > 0 {
-		currentSize = tree.root.Release(releaseVersion)
+		tree.log.Info("releasing the in-memory nodes over the gc threshold",
+			logger.F("version", releaseVersion), logger.F("size", currentSize),
+			logger.F("threshold", tree.gcStatus.threshold))
+		if tree.gc != nil {
+			tree.gc.trigger(releaseVersion)
+		} else {
+			start, before := time.Now(), currentSize
+			var released int
+			cold := tree.coldKeys()
+			currentSize, released = tree.root.release(releaseVersion, cold)
+			tree.offload(cold)
+			tree.recordGC(start, releaseVersion, released, before, currentSize)
+		}
+	}
+	// the regular GC cannot release the nodes of a burst of large commits
+	if tree.gcHardLimit > 0 && currentSize > tree.gcHardLimit {
+		tree.log.Warn("the in-memory nodes exceed the gc hard limit",
+			logger.F("size", currentSize), logger.F("limit", tree.gcHardLimit))
+		currentSize = tree.enforceGCHardLimit(currentSize)
+	}
+	if tree.memoryCap > 0 && currentSize > tree.memoryCap {
+		tree.log.Info("evicting the subtrees over the memory cap",
+			logger.F("size", currentSize), logger.F("cap", tree.memoryCap))
+		currentSize = tree.evictSubtrees(currentSize)
 	}
 	tree.gcStatus.add(tree.version, currentSize)
 	tree.journal.flush()
+	tree.discardTags()
+	tree.discardMetadata()
 	tree.lastSaveRoot = tree.root
 	tree.lastSaveRootSize = originSize
-	tree.rootSize = currentSize
+	tree.setSize(currentSize)
+	tree.opStats.commit(start, leaves, journalSize)
 
 	if tree.metrics != nil {
 		tree.metrics.CommitNum(journalSize)
@@ -881,11 +1229,205 @@ func (tree *BNBSparseMerkleTree) CommitWithNewVersion(recentVersion *Version, ne
 		tree.metrics.PrunedVersion(uint64(tree.recentVersion))
 		tree.collectGCMetrics()
 	}
+	if tree.opMetrics != nil {
+		tree.opMetrics.CommitDuration(time.Since(start))
+		tree.reportCacheLookups()
+	}
 
 	return newVer, nil
 }
 
+// persistVersion writes the dirty nodes and the version records of the new version.
+// If the write fails partway, the new version is reverted in memory and in the
+// database, so the tree is left at the previous committed version.
+func (tree *BNBSparseMerkleTree) persistVersion(ctx context.Context, newVer Version, recentVersion *Version) (size uint64, err error) {
+	var written []writtenNode
+	defer func() {
+		if err != nil {
+			err = tree.revertCommit(written, newVer, recentVersion != nil, err)
+		}
+	}()
+
+	// write tree nodes, prune old version
+	var batch database.Batcher
+	wb, writeBehind := tree.db.(*writeBehindDB)
+	if writeBehind {
+		// the commit is journaled by its leaves, its intent is written ahead of
+		// the nodes once they are materialized
+		var intent []byte
+		if intent, err = tree.commitIntent(newVer, recentVersion); err != nil {
+			return size, err
+		}
+		var commit *writeBehindCommit
+		if commit, err = tree.writeBehindCommit(newVer, recentVersion); err != nil {
+			return size, err
+		}
+		batch = tree.traceBatch(ctx, wb.newCommitBatch(commit, intent))
+	} else {
+		// record the nodes to be written, so an interrupted commit is repaired on startup
+		if err = tree.writeCommitIntent(newVer, recentVersion); err != nil {
+			return size, err
+		}
+		batch = tree.newBatch(ctx)
+	}
+	var orphaned orphans
+	var operations []*Operation
+	var audited []auditEntry
+	var changedKeys uint64
+	nodes := make([]*TreeNode, 0, tree.journal.len())
+	err = tree.journal.iterate(func(key journalKey, node *TreeNode) error {
+		if node.depth == tree.maxDepth {
+			changedKeys++
+		}
+		if tree.opLog && node.depth == tree.maxDepth {
+			operations = append(operations, newOperation(node, newVer))
+		}
+		if tree.auditLog && node.depth == tree.maxDepth {
+			audited = append(audited, auditEntry{Key: node.path, Tag: tree.writtenTag(node.path)})
+		}
+		written = append(written, writtenNode{node: node, versions: node.Versions})
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return size, err
+	}
+	if tree.bloom != nil {
+		for _, node := range nodes {
+			if node.depth == tree.maxDepth {
+				tree.bloom.add(node.path)
+			}
+		}
+		// the filter is written ahead of the leaves, in case the batch is flushed partially
+		if record := tree.bloom.encodeIfDirty(); record != nil {
+			if err = batch.Set(bloomFilterKey, record); err != nil {
+				return size, err
+			}
+		}
+	}
+	var prepared []preparedNode
+	start := tree.phaseStart()
+	tree.labeled(PhaseEncode, func() {
+		prepared, err = tree.prepareNodes(nodes, recentVersion)
+	})
+	if err != nil {
+		return size, err
+	}
+	tree.observe(PhaseEncode, start)
+	for _, p := range prepared {
+		if err = batch.Set(p.key, p.record); err != nil {
+			return size, err
+		}
+		size += p.changed
+		if len(p.node.Versions) > 1 {
+			// the previous versions are orphaned once newVer becomes prunable
+			orphaned.add(p.node)
+		}
+		if p.node.depth == tree.maxDepth { // leaf node
+			tree.dbCache.Add(p.node.path, p.node)
+		}
+	}
+	commitTime := encodeVersionTime(time.Now())
+	err = batch.Set(versionTimeKey(newVer), commitTime)
+	if err != nil {
+		return size, err
+	}
+	err = writeVersionInfo(batch, newVer, &versionInfo{ChangedKeys: changedKeys, Metadata: tree.pendingMetadata()})
+	if err != nil {
+		return size, err
+	}
+	if len(audited) > 0 {
+		// written after the commit time, which a failed commit finds it by
+		err = tree.writeAuditRecord(batch, newVer, commitTime, audited)
+		if err != nil {
+			return size, err
+		}
+	}
+	if len(operations) > 0 {
+		err = tree.writeOperations(batch, newVer, operations)
+		if err != nil {
+			return size, err
+		}
+	}
+	if len(orphaned) > 0 {
+		err = batch.Set(orphanKey(newVer), orphaned)
+		if err != nil {
+			return size, err
+		}
+	}
+
+	if recentVersion != nil {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(*recentVersion))
+		err = batch.Set(recentVersionNumberKey, buf)
+		if err != nil {
+			return size, err
+		}
+	}
+	// the version marker is the last record, a batch flushed partially before it
+	// is rolled back on startup, the version records are complete once it is written
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(newVer))
+	err = batch.Set(latestVersionKey, buf)
+	if err != nil {
+		return size, err
+	}
+
+	prevRecent := tree.recentVersion
+	write := func() error {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		// the version is committed already, a leftover intent is finished on startup,
+		// the intent of a write-behind commit is removed once it is materialized
+		if !writeBehind {
+			if err := tree.db.Delete(commitIntentKey); err != nil {
+				tree.log.Warn("failed to delete the commit intent, it is finished on startup",
+					logger.F("version", newVer), logger.F("error", err))
+			}
+		}
+
+		if recentVersion != nil && *recentVersion > prevRecent {
+			// the version is committed already, the orphans left by a failure
+			// are trimmed by Compact
+			if err := tree.pruneOrphans(prevRecent, *recentVersion); err != nil {
+				tree.log.Warn("failed to prune the orphaned node versions, they are trimmed by Compact",
+					logger.F("version", newVer), logger.F("recent", *recentVersion), logger.F("error", err))
+			}
+		}
+		return nil
+	}
+	persist := func() (err error) {
+		start := tree.phaseStart()
+		tree.labeled(PhasePersist, func() {
+			err = write()
+		})
+		if err == nil {
+			tree.observe(PhasePersist, start)
+		} else if tree.pipeline != nil {
+			tree.log.Error("pipelined commit write failed, reverting it on the next operation",
+				logger.F("version", newVer), logger.F("error", err))
+		}
+		return err
+	}
+	if tree.pipeline != nil {
+		prevVersion := tree.version
+		tree.pipeline.start(persist, func(cause error) error {
+			// the tree is at newVer already, it is moved back to the previous
+			// version before the commit is reverted as a synchronous one
+			tree.version, tree.recentVersion = prevVersion, prevRecent
+			return tree.revertCommit(written, newVer, recentVersion != nil, cause)
+		})
+		return size, nil
+	}
+	return size, persist()
+}
+
 func (tree *BNBSparseMerkleTree) rollback(child *TreeNode, oldVersion Version, db database.Batcher) (uint64, error) {
+	if child.depth == tree.maxDepth {
+		tree.rolledBack.retain(child, oldVersion)
+	}
 	// remove value nodes
 	next, changed := child.Rollback(oldVersion)
 	if !next {
@@ -897,43 +1439,55 @@ func (tree *BNBSparseMerkleTree) rollback(child *TreeNode, oldVersion Version, d
 		tree.dbCache.Add(child.path, child)
 	}
 
+	// only the children written by the removed versions are read and rolled back,
+	// the versions of a child not in memory are known from the parent record
+	var touched []int
 	for nibble, subChild := range child.Children {
-		if subChild != nil {
-			subDepth := child.depth + 4
-			err := tree.extendNode(child, uint64(nibble), subChild.path, subDepth, false)
-			if err != nil {
-				return changed, err
-			}
-
-			subChanged, err := tree.rollback(child.Children[nibble], oldVersion, db)
-			if err != nil {
-				return changed, err
-			}
-			changed += subChanged
+		if subChild != nil && subChild.latestVersionWithLock() > oldVersion {
+			touched = append(touched, nibble)
+		}
+	}
+	if err := tree.loadChildren(child, touched, cacheOpRollback); err != nil {
+		return changed, err
+	}
+	for _, nibble := range touched {
+		subChanged, err := tree.rollback(child.Children[nibble], oldVersion, db)
+		if err != nil {
+			return changed, err
 		}
-		child.ComputeInternalHash()
+		changed += subChanged
 	}
+	child.ComputeInternalHash()
 
-	// persist tree
-	rlpBytes, err := rlp.EncodeToBytes(child.ToStorageTreeNode())
+	// persist tree, the internal node created by the removed versions is no
+	// longer referenced by any version and is reclaimed, the leaf is kept so the
+	// key reads as empty rather than never written
+	if len(child.Versions) == 0 && child.depth < tree.maxDepth {
+		return changed, db.Delete(tree.nodeKeys.key(child.depth, child.path))
+	}
+	rlpBytes, err := encodeTreeNode(child)
 	if err != nil {
 		return changed, err
 	}
-	err = db.Set(storageFullTreeNodeKey(child.depth, child.path), rlpBytes)
+	err = db.Set(tree.nodeKeys.key(child.depth, child.path), rlpBytes)
 	if err != nil {
 		return changed, err
 	}
-	if db.ValueSize() > tree.batchSizeLimit {
-		if err := db.Write(); err != nil {
-			return changed, err
-		}
-		db.Reset()
-	}
-
 	return changed, nil
 }
 
 func (tree *BNBSparseMerkleTree) Rollback(version Version) error {
+	return tree.RollbackContext(context.Background(), version)
+}
+
+func (tree *BNBSparseMerkleTree) rollbackTo(ctx context.Context, version Version) error {
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+
 	if tree.recentVersion > version {
 		return ErrVersionTooOld
 	}
@@ -942,18 +1496,57 @@ func (tree *BNBSparseMerkleTree) Rollback(version Version) error {
 		return ErrVersionTooHigh
 	}
 
-	tree.Reset()
+	if tree.isPruned(version) {
+		return ErrVersionPruned
+	}
+
+	if tree.maxRollbackDepth > 0 && uint64(tree.version-version) > tree.maxRollbackDepth {
+		return ErrVersionTooOld
+	}
+
+	tree.reset()
+	// the ranges above the version are rolled back entirely
+	var ranges []versionRange
+	for _, r := range tree.prunedRanges {
+		if r.To < version {
+			ranges = append(ranges, r)
+		}
+	}
+	var pinned []Version
+	for _, v := range tree.pinned {
+		if v <= version {
+			pinned = append(pinned, v)
+		}
+	}
+	if tree.rolledBack == nil {
+		tree.rolledBack = make(rolledBack)
+	}
 
 	newVersion := version
 	originSize := tree.rootSize
 	size := tree.rootSize
 	if tree.db != nil {
-		batch := tree.db.NewBatch()
+		batch := tree.newBatch(ctx)
 		changed, err := tree.rollback(tree.root, version, batch)
 		if err != nil {
 			return err
 		}
 		size -= changed
+		if err := tree.discardVersionRecords(batch, orphanPrefix, version); err != nil {
+			return err
+		}
+		if err := tree.discardVersionRecords(batch, opLogPrefix, version); err != nil {
+			return err
+		}
+		if err := tree.discardVersionRecords(batch, versionInfoPrefix, version); err != nil {
+			return err
+		}
+		if err := writePrunedRanges(batch, ranges); err != nil {
+			return err
+		}
+		if err := writePinnedVersions(batch, pinned); err != nil {
+			return err
+		}
 		buf := make([]byte, 8)
 		binary.BigEndian.PutUint64(buf, uint64(newVersion))
 		err = batch.Set(latestVersionKey, buf)
@@ -969,7 +1562,9 @@ func (tree *BNBSparseMerkleTree) Rollback(version Version) error {
 	}
 
 	tree.version = newVersion
-	tree.rootSize = size
+	tree.setSize(size)
+	tree.prunedRanges = ranges
+	tree.pinned = pinned
 
 	if tree.metrics != nil {
 		tree.metrics.ChangeSize(originSize - size)
@@ -977,6 +1572,21 @@ func (tree *BNBSparseMerkleTree) Rollback(version Version) error {
 		tree.metrics.Version(uint64(tree.version))
 		tree.metrics.PrunedVersion(uint64(tree.recentVersion))
 	}
+	if tree.opMetrics != nil {
+		tree.reportCacheLookups()
+	}
+	return nil
+}
+
+// FlushWriteBehind blocks until the committed versions are materialized
+// in the database when the write-behind mode is enabled.
+func (tree *BNBSparseMerkleTree) FlushWriteBehind() error {
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+	if wb, ok := tree.db.(*writeBehindDB); ok {
+		return wb.flush()
+	}
 	return nil
 }
 
@@ -834,6 +834,34 @@ func Test_SingleMultiSet(t *testing.T) {
 	testMultiSet(t, memEnv, items, 8)
 }
 
+// The MultiSets of a version before its commit must yield the root of a single
+// MultiSet, the nodes set by the first one are not taken as recomputed by the
+// siblings in the second one.
+func Test_BNBSparseMerkleTree_MultiSetTwice(t *testing.T) {
+	env := prepareEnv()[0]
+	a, b := env.hasher.Hash([]byte("a")), env.hasher.Hash([]byte("b"))
+	roots := make([][]byte, 2)
+	for i := range roots {
+		smt, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 16, nilHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			err = smt.MultiSet([]Item{{241, a}, {387, a}, {36, b}})
+		} else if err = smt.MultiSet([]Item{{241, a}}); err == nil {
+			err = smt.MultiSet([]Item{{387, a}, {36, b}})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := smt.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		roots[i] = smt.Root()
+	}
+	assert.Equal(t, roots[0], roots[1])
+}
+
 func Test_BNBSparseMerkleTree_Set(t *testing.T) {
 	for _, env := range prepareEnv() {
 		t.Logf("test [%s]", env.tag)
@@ -886,6 +914,15 @@ func testVersions(t *testing.T, env testEnv, depth uint8) {
 	_ = smt.Set(data[1].Key, data[1].Val)
 	_, err = smt.Commit(&version)
 	assert.ElementsMatchf(t, smt.Versions(), []Version{Version(4), Version(5)}, "versions not match")
+
+	tree := smt.(*BNBSparseMerkleTree)
+	root, err := tree.RootAt(5)
+	assert.NoError(t, err)
+	assert.Equal(t, smt.Root(), root)
+	_, err = tree.RootAt(1)
+	assert.ErrorIs(t, err, ErrVersionTooOld)
+	_, err = tree.RootAt(6)
+	assert.ErrorIs(t, err, ErrVersionTooHigh)
 }
 
 func Test_BNBSparseMerkleTree_SetWithVersion(t *testing.T) {
@@ -1172,3 +1209,575 @@ func benchmarkMultiset(b *testing.B, env testEnv, depth uint8, items []Item) {
 		}
 	}
 }
+
+func Test_BNBSparseMerkleTree_CommitExpecting(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.Set(items[0].Key, items[0].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.(*BNBSparseMerkleTree).CommitExpecting(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other process is not aware of the version written meanwhile
+	if err := other.Set(items[1].Key, items[1].Val); err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.(*BNBSparseMerkleTree).CommitExpecting(0)
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Expected != 0 || conflict.Actual != 1 {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("the conflict should match ErrVersionConflict")
+	}
+	if _, err := smt.(*BNBSparseMerkleTree).CommitExpecting(0); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_RollbackReclaimsNodes(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.Set(items[0].Key, items[0].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	// the key 200 is the only one below its node of depth 4
+	key := items[14].Key
+	if err := smt.Set(key, items[1].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := smt.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := db.Has(storageFullTreeNodeKey(4, key>>4)); has {
+		t.Fatal("the internal node no longer referenced by any version should be reclaimed")
+	}
+	if has, _ := db.Has(storageFullTreeNodeKey(4, items[0].Key>>4)); !has {
+		t.Fatal("the internal node referenced by the remaining version should be kept")
+	}
+	val, err := smt.Get(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, smt.(*BNBSparseMerkleTree).nilHashes.Get(8)) {
+		t.Fatalf("the rolled back key should read as empty, got %x", val)
+	}
+}
+
+func Test_BNBSparseMerkleTree_RollbackReadsChangedPaths(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]Item, 0, 512)
+	for key := uint64(0); key < 1<<16; key += 128 {
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8)})})
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+	if err := smt.Set(items[7].Key, env.hasher.Hash([]byte("changed"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &readCountingDB{TreeDB: db}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, counting, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := counting.nodes
+	if err := reopened.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	// one node per level below the root on the path of the changed key
+	if read := counting.nodes - nodes; read != 4 {
+		t.Fatalf("only the changed path should be read, got %d nodes", read)
+	}
+	if !bytes.Equal(reopened.Root(), root) {
+		t.Fatalf("root hash does not match the rolled back version, %x, %x", reopened.Root(), root)
+	}
+	if val, err := reopened.Get(items[7].Key, nil); err != nil || !bytes.Equal(val, items[7].Val) {
+		t.Fatalf("the rolled back value should be restored, got %x %v", val, err)
+	}
+}
+
+func Test_BNBSparseMerkleTree_ParallelCommit(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// spread the keys over all the subtrees of the root
+	var items []Item
+	for i := uint64(0); i < 4*parallelCommitThreshold; i++ {
+		key := i*0x1000%0x10000 + i
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8), byte(key)})})
+	}
+	for round := 0; round < 3; round++ {
+		for _, item := range items[round:] {
+			if err := smt.Set(item.Key, item.Val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		recent := smt.LatestVersion()
+		if _, err := smt.Commit(&recent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyItems(t, smt, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_GetProofs(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, CommitWorkers(2), ProofWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &readCountingDB{TreeDB: db}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, counting, 8, nilHash, ProofWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []uint64{0, 255}
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	multiGets := counting.multiGets
+	proofs, err := reopened.(*BNBSparseMerkleTree).GetProofs(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counting.multiGets != multiGets+1 {
+		t.Fatalf("the paths should be read at once, got %d reads", counting.multiGets-multiGets)
+	}
+	for i, key := range keys {
+		proof, err := smt.GetProof(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proofs[i]) != len(proof) {
+			t.Fatalf("proof of key %d does not match", key)
+		}
+		for j := range proof {
+			if !bytes.Equal(proofs[i][j], proof[j]) {
+				t.Fatalf("proof of key %d does not match", key)
+			}
+		}
+		if !reopened.VerifyProof(key, proofs[i]) {
+			t.Fatalf("verify proof of key %d failed", key)
+		}
+	}
+}
+
+func Benchmark_SparseMerkleTree_Commit_memoryDB(b *testing.B) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		b.Fatal(err)
+	}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash,
+		GCThreshold(1024*10))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for key := uint64(0); key < 256; key++ {
+			if err := smt.Set(key*0x100+uint64(i)%0x100, env.hasher.Hash([]byte{byte(i), byte(key)})); err != nil {
+				b.Fatal(err)
+			}
+		}
+		recent := smt.LatestVersion()
+		if _, err := smt.Commit(&recent); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// readCountingDB counts the reads of the database.
+type readCountingDB struct {
+	database.TreeDB
+	nodes     int
+	multiGets int
+	iterators int
+}
+
+func (db *readCountingDB) count(key []byte) {
+	if bytes.HasPrefix(key, storageFullTreeNodePrefix) {
+		db.nodes++
+	}
+}
+
+func (db *readCountingDB) Get(key []byte) ([]byte, error) {
+	db.count(key)
+	return db.TreeDB.Get(key)
+}
+
+func (db *readCountingDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	db.multiGets++
+	for _, key := range keys {
+		db.count(key)
+	}
+	return db.TreeDB.MultiGet(keys)
+}
+
+func (db *readCountingDB) NewIterator(prefix []byte, start []byte) database.Iterator {
+	db.iterators++
+	return db.TreeDB.NewIterator(prefix, start)
+}
+
+func Test_BNBSparseMerkleTree_LazyRestore(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, memDB, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for key := uint64(0); key < 0x10000; key += 0x101 {
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8), byte(key)})})
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db := &readCountingDB{TreeDB: memDB}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.nodes != 1 || db.iterators != 0 {
+		t.Fatalf("only the root should be read on open, got %d nodes and %d iterators", db.nodes, db.iterators)
+	}
+	val, err := reopened.Get(items[1].Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, items[1].Val) {
+		t.Fatalf("leaf node does not match the origin, %x, %x\n", val, items[1].Val)
+	}
+	if db.nodes == 1 {
+		t.Fatal("the path of the key should be faulted in on demand")
+	}
+}
+
+func Test_BNBSparseMerkleTree_PreloadLevels(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, memDB, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for key := uint64(0); key < 0x10000; key += 0x101 {
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8), byte(key)})})
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lazy := &readCountingDB{TreeDB: memDB}
+	if _, err := NewBNBSparseMerkleTree(env.hasher, lazy, 16, nilHash); err != nil {
+		t.Fatal(err)
+	}
+	db := &readCountingDB{TreeDB: memDB}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash, PreloadLevels(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 16 nodes of the first level and the 256 nodes of the second one
+	if db.multiGets != lazy.multiGets+2 || db.nodes != lazy.nodes+16+256 {
+		t.Fatalf("each level should be read with a single MultiGet, got %d MultiGets of %d nodes", db.multiGets-lazy.multiGets, db.nodes-lazy.nodes)
+	}
+	if !bytes.Equal(reopened.Root(), smt.Root()) {
+		t.Fatalf("root hash does not match, %x, %x", reopened.Root(), smt.Root())
+	}
+
+	nodes := db.nodes
+	proof, err := reopened.GetProof(items[1].Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.nodes != nodes+2 {
+		t.Fatalf("only the levels below the preloaded ones should be read, got %d nodes", db.nodes-nodes)
+	}
+	if !reopened.VerifyProof(items[1].Key, proof) {
+		t.Fatal("the proof should verify against the preloaded nodes")
+	}
+	verifyItems(t, smt, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_StreamingRestore(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, memDB, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for key := uint64(0); key < 0x10000; key += 0x11 {
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8), byte(key)})})
+	}
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lazy := &readCountingDB{TreeDB: memDB}
+	if _, err := NewBNBSparseMerkleTree(env.hasher, lazy, 16, nilHash); err != nil {
+		t.Fatal(err)
+	}
+	db := &readCountingDB{TreeDB: memDB}
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash, StreamingRestore(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.nodes != lazy.nodes+16 {
+		t.Fatalf("only the first level should be loaded eagerly, got %d nodes", db.nodes-lazy.nodes)
+	}
+
+	// the path below the first level, then the 14 other nodes of the level below the
+	// topmost faulted node, 0x12 holds the keys of the nodes 0x121 to 0x12f
+	nodes, multiGets := db.nodes, db.multiGets
+	key := uint64(0x1234)
+	if _, err := reopened.GetProof(key); err != nil {
+		t.Fatal(err)
+	}
+	if db.multiGets != multiGets+2 || db.nodes != nodes+3+14 {
+		t.Fatalf("the path and the prefetched level should be read with 2 MultiGets, got %d MultiGets of %d nodes",
+			db.multiGets-multiGets, db.nodes-nodes)
+	}
+
+	// a key near the read one only misses its leaf
+	nodes = db.nodes
+	proof, err := reopened.GetProof(0x12a9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.nodes != nodes+1 {
+		t.Fatalf("the prefetched nodes should not be read again, got %d nodes", db.nodes-nodes)
+	}
+	if !reopened.VerifyProof(0x12a9, proof) {
+		t.Fatal("the proof should verify against the prefetched nodes")
+	}
+	verifyItems(t, smt, reopened, items)
+}
+
+func Test_BNBSparseMerkleTree_CacheStats(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.Set(items[0].Key, items[0].Val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := reopened.(*BNBSparseMerkleTree)
+	for i := 0; i < 2; i++ {
+		if _, err := tree.Get(items[0].Key, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tree.GetProof(items[0].Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := tree.CacheStats()
+	if stats.Get != (CacheCounters{Hits: 1, Faults: 1}) {
+		t.Fatalf("unexpected get stats %+v", stats.Get)
+	}
+	// the path below the root is faulted in by the first proof
+	if stats.Proof != (CacheCounters{Hits: 2, Faults: 2}) {
+		t.Fatalf("unexpected proof stats %+v", stats.Proof)
+	}
+	if stats.Set != (CacheCounters{}) {
+		t.Fatalf("unexpected set stats %+v", stats.Set)
+	}
+}
+
+func Test_BNBSparseMerkleTree_SetHashesEagerly(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items {
+		root := smt.Root()
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(root, smt.Root()) {
+			t.Fatalf("the root should be updated by the set of key %d", item.Key)
+		}
+	}
+	root := smt.Root()
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, smt.Root()) {
+		t.Fatal("the root should not be changed by the commit")
+	}
+}
+
+func Test_VerifyProof_Standalone(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	root := smt.Root()
+	for _, item := range items {
+		proof, err := smt.GetProof(item.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyProof(env.hasher, root, 8, item.Key, item.Val, proof) {
+			t.Fatalf("verify proof of key %d failed", item.Key)
+		}
+		if VerifyProof(env.hasher, root, 8, item.Key, nilHash, proof) {
+			t.Fatalf("proof of key %d should not verify another value", item.Key)
+		}
+	}
+
+	proof, err := smt.GetProof(items[0].Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		VerifyProof(env.hasher, root, 8, items[0].Key, items[0].Val, proof)
+	})
+	if allocs != 0 {
+		t.Fatalf("verification should not allocate, got %v allocations", allocs)
+	}
+}
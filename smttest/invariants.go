@@ -0,0 +1,190 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package smttest
+
+import (
+	"bytes"
+	"math/rand"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// CheckOrderIndependence sets the leaves in new trees in rounds of permuted
+// orders, by single Sets and by MultiSets, and checks that every round
+// commits the root of the reference implementation.
+func CheckOrderIndependence(cfg *Config, items []bsmt.Item, rng *rand.Rand, rounds int) error {
+	leaves := make(map[uint64][]byte, len(items))
+	for _, item := range items {
+		leaves[item.Key] = item.Val
+	}
+	expected := cfg.Root(leaves)
+	for round := 0; round < rounds; round++ {
+		tree, db, err := cfg.NewTree()
+		if err != nil {
+			return err
+		}
+		permuted := make([]bsmt.Item, len(items))
+		for i, j := range rng.Perm(len(items)) {
+			permuted[i] = items[j]
+		}
+		if round%2 == 0 {
+			err = tree.MultiSet(permuted)
+		} else {
+			for _, item := range permuted {
+				if err = tree.Set(item.Key, item.Val); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			_, err = tree.Commit(nil)
+		}
+		root := tree.Root()
+		if cerr := closeTree(tree, db); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(root, expected) {
+			return errors.Wrapf(ErrInvariant, "round %d: root %x, expected %x", round, root, expected)
+		}
+	}
+	return nil
+}
+
+// CheckProofs checks that the proofs of the keys in the latest version of the
+// tree verify against its root, together with the values of the model.
+func CheckProofs(tree *bsmt.BNBSparseMerkleTree, m *Model, keys []uint64) error {
+	root, latest := tree.Root(), m.Latest()
+	for _, key := range keys {
+		proof, err := tree.GetProof(key)
+		if err != nil {
+			return errors.Wrapf(err, "proof of key %d", key)
+		}
+		if !bsmt.VerifyProof(m.cfg.Hasher, root, m.cfg.MaxDepth, key, m.Value(key, latest), proof) {
+			return errors.Wrapf(ErrInvariant, "invalid proof of key %d at version %d", key, latest)
+		}
+	}
+	return nil
+}
+
+// CheckValues checks that the values of the keys at every committed version
+// of the tree are the values of the model.
+func CheckValues(tree *bsmt.BNBSparseMerkleTree, m *Model, keys []uint64) error {
+	for v := tree.RecentVersion(); v <= m.Latest(); v++ {
+		version := v
+		for _, key := range keys {
+			val, err := m.cfg.value(tree, key, &version)
+			if err != nil {
+				return errors.Wrapf(err, "key %d at version %d", key, version)
+			}
+			if expected := m.Value(key, version); !bytes.Equal(val, expected) {
+				return errors.Wrapf(ErrInvariant, "key %d at version %d: value %x, expected %x", key, version, val, expected)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRollbacks applies n random operations of the generator to a new tree,
+// committing and rolling back at random, and checks the root after every
+// commit and rollback, the proofs of the random keys against it, and the
+// values of the keys at every version still committed.
+func CheckRollbacks(cfg *Config, g *Generator, n int) error {
+	tree, db, err := cfg.NewTree()
+	if err != nil {
+		return err
+	}
+	defer closeTree(tree, db)
+	return Run(tree, NewModel(cfg), g.Ops(n), g)
+}
+
+// Run applies the operations to the tree and to the model, and checks the
+// tree as CheckRollbacks does against the keys drawn from the generator.
+func Run(tree *bsmt.BNBSparseMerkleTree, m *Model, ops []Op, g *Generator) error {
+	for i, op := range ops {
+		if err := Apply(tree, m, op); err != nil {
+			return errors.WithMessagef(err, "operation %d", i)
+		}
+		if op.Kind == OpSet {
+			continue
+		}
+		keys := make([]uint64, 4)
+		for j := range keys {
+			keys[j] = g.Key()
+		}
+		if err := CheckProofs(tree, m, keys); err != nil {
+			return errors.WithMessagef(err, "operation %d", i)
+		}
+		if err := CheckValues(tree, m, keys); err != nil {
+			return errors.WithMessagef(err, "operation %d", i)
+		}
+	}
+	return nil
+}
+
+// CheckConsistency checks the database against the tree: a tree reopened from
+// the database must have the version and the root of the tree, and hold the
+// leaves of the model in its latest version, no more and no less. The pending
+// changes of the tree are not checked.
+func CheckConsistency(tree *bsmt.BNBSparseMerkleTree, db database.TreeDB, m *Model) error {
+	if err := tree.FlushWriteBehind(); err != nil {
+		return err
+	}
+	reopened, err := m.cfg.Open(db)
+	if err != nil {
+		return errors.Wrap(err, "reopen")
+	}
+	defer reopened.StopGC()
+
+	latest := tree.LatestVersion()
+	if reopened.LatestVersion() != latest {
+		return errors.Wrapf(ErrInvariant, "reopened version %d, expected %d", reopened.LatestVersion(), latest)
+	}
+	root, err := tree.RootAt(latest)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(reopened.Root(), root) {
+		return errors.Wrapf(ErrInvariant, "reopened root %x, expected %x", reopened.Root(), root)
+	}
+
+	scanner, err := reopened.Leaves(latest)
+	if err != nil {
+		return err
+	}
+	defer scanner.Release()
+	expected := m.Leaves(latest)
+	found := 0
+	for scanner.Next() {
+		leaf := scanner.Leaf()
+		if val, ok := expected[leaf.Key]; !ok || !bytes.Equal(val, leaf.Val) {
+			return errors.Wrapf(ErrInvariant, "stored key %d: value %x, expected %x", leaf.Key, leaf.Val, val)
+		}
+		found++
+	}
+	if err := scanner.Error(); err != nil {
+		return err
+	}
+	if found != len(expected) {
+		return errors.Wrapf(ErrInvariant, "%d leaves stored, expected %d", found, len(expected))
+	}
+	return nil
+}
+
+// closeTree stops the tree and closes its database.
+func closeTree(tree *bsmt.BNBSparseMerkleTree, db database.TreeDB) error {
+	if err := tree.WaitCommit(); err != nil {
+		db.Close()
+		return err
+	}
+	tree.StopGC()
+	return db.Close()
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package smttest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// OpKind is the kind of an operation applied to a tree.
+type OpKind uint8
+
+const (
+	// OpSet sets the leaves of the operation in the next version.
+	OpSet OpKind = iota
+	// OpCommit commits the pending changes.
+	OpCommit
+	// OpRollback rolls the tree back to the version of the operation.
+	OpRollback
+)
+
+// Op is an operation applied to a tree and to its Model.
+type Op struct {
+	Kind    OpKind
+	Items   []bsmt.Item
+	Version bsmt.Version
+}
+
+func (op Op) String() string {
+	switch op.Kind {
+	case OpSet:
+		return fmt.Sprintf("set %d leaves", len(op.Items))
+	case OpCommit:
+		return "commit"
+	default:
+		return fmt.Sprintf("rollback to %d", op.Version)
+	}
+}
+
+// Generator generates random leaves and operations for a tree of the
+// configuration, from a seeded source so a failure can be replayed.
+type Generator struct {
+	cfg *Config
+	rng *rand.Rand
+	// keys bounds the keys generated, so the operations overwrite the leaves
+	// set by the previous ones
+	keys uint64
+}
+
+// NewGenerator returns a generator seeded with the seed. The keys are drawn
+// from the first 1024 keys of the tree, or all of them in a smaller tree.
+func NewGenerator(cfg *Config, seed int64) *Generator {
+	keys := uint64(1024)
+	if cfg.MaxDepth < 10 {
+		keys = 1 << cfg.MaxDepth
+	}
+	return &Generator{cfg: cfg, rng: rand.New(rand.NewSource(seed)), keys: keys}
+}
+
+// Rand returns the random source of the generator.
+func (g *Generator) Rand() *rand.Rand {
+	return g.rng
+}
+
+// Key returns a random key.
+func (g *Generator) Key() uint64 {
+	return uint64(g.rng.Int63n(int64(g.keys)))
+}
+
+// Value returns a random leaf value, the nil hash deleting the leaf one time
+// in ten.
+func (g *Generator) Value() []byte {
+	if g.rng.Intn(10) == 0 {
+		return g.cfg.NilHash
+	}
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], g.rng.Uint64())
+	return g.cfg.Hasher.Hash(seed[:])
+}
+
+// Items returns up to n leaves of distinct keys with random values.
+func (g *Generator) Items(n int) []bsmt.Item {
+	seen := make(map[uint64]bool, n)
+	items := make([]bsmt.Item, 0, n)
+	for i := 0; i < n; i++ {
+		key := g.Key()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, bsmt.Item{Key: key, Val: g.Value()})
+	}
+	return items
+}
+
+// Ops returns n random operations. A commit follows every few sets, and the
+// rollbacks target the versions committed by the previous operations.
+func (g *Generator) Ops(n int) []Op {
+	ops := make([]Op, 0, n)
+	var latest bsmt.Version
+	for len(ops) < n {
+		switch r := g.rng.Intn(10); {
+		case r < 6:
+			ops = append(ops, Op{Kind: OpSet, Items: g.Items(1 + g.rng.Intn(16))})
+		case r < 9:
+			latest++
+			ops = append(ops, Op{Kind: OpCommit})
+		default:
+			if latest == 0 {
+				continue
+			}
+			latest = bsmt.Version(g.rng.Int63n(int64(latest) + 1))
+			ops = append(ops, Op{Kind: OpRollback, Version: latest})
+		}
+	}
+	return ops
+}
+
+// OpsFromBytes decodes the operations from arbitrary bytes, for the fuzz
+// tests: every input decodes to a valid sequence of operations.
+func OpsFromBytes(cfg *Config, data []byte) []Op {
+	keys := uint64(1) << 10
+	if cfg.MaxDepth < 10 {
+		keys = 1 << cfg.MaxDepth
+	}
+	var ops []Op
+	var latest bsmt.Version
+	for len(data) >= 3 {
+		kind, arg := data[0]%8, binary.BigEndian.Uint16(data[1:3])
+		data = data[3:]
+		switch {
+		case kind < 5:
+			value := cfg.NilHash
+			if kind > 0 {
+				value = cfg.Hasher.Hash([]byte{kind, byte(arg)})
+			}
+			ops = append(ops, Op{Kind: OpSet, Items: []bsmt.Item{{Key: uint64(arg) % keys, Val: value}}})
+		case kind < 7:
+			latest++
+			ops = append(ops, Op{Kind: OpCommit})
+		default:
+			latest = bsmt.Version(uint64(arg) % (uint64(latest) + 1))
+			ops = append(ops, Op{Kind: OpRollback, Version: latest})
+		}
+	}
+	return ops
+}
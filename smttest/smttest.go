@@ -0,0 +1,185 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package smttest provides the invariant checks and the random operation
+// generators the tree is tested with, so the integrations of the tree can be
+// fuzzed with the same machinery. The checks return an error describing the
+// first violation instead of failing a test, they can run in tests, fuzz
+// targets and long running soak jobs alike.
+package smttest
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// ErrInvariant is matched by every violation reported by the checks.
+var ErrInvariant = errors.New("invariant violated")
+
+// Config describes the trees under test.
+type Config struct {
+	Hasher   *bsmt.Hasher
+	MaxDepth uint8
+	NilHash  []byte
+	// NewDB returns the database of a new tree, an empty one on each call.
+	NewDB func() (database.TreeDB, error)
+	// Options are the options the trees are created with.
+	Options []bsmt.Option
+}
+
+// Open returns a tree of the configuration over the database.
+func (cfg *Config) Open(db database.TreeDB) (*bsmt.BNBSparseMerkleTree, error) {
+	tree, err := bsmt.NewBNBSparseMerkleTree(cfg.Hasher, db, cfg.MaxDepth, cfg.NilHash, cfg.Options...)
+	if err != nil {
+		return nil, err
+	}
+	return tree.(*bsmt.BNBSparseMerkleTree), nil
+}
+
+// NewTree returns a tree of the configuration over a new database.
+func (cfg *Config) NewTree() (*bsmt.BNBSparseMerkleTree, database.TreeDB, error) {
+	db, err := cfg.NewDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := cfg.Open(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return tree, db, nil
+}
+
+// Root returns the root of a tree holding the leaves, computed by a reference
+// implementation independent of the tree.
+func (cfg *Config) Root(leaves map[uint64][]byte) []byte {
+	items := make([]bsmt.Item, 0, len(leaves))
+	for key, val := range leaves {
+		items = append(items, bsmt.Item{Key: key, Val: val})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	nilHashes := make([][]byte, cfg.MaxDepth+1)
+	nilHashes[cfg.MaxDepth] = cfg.NilHash
+	for depth := int(cfg.MaxDepth) - 1; depth >= 0; depth-- {
+		nilHashes[depth] = cfg.Hasher.Hash(nilHashes[depth+1], nilHashes[depth+1])
+	}
+	var hash func(depth uint8, items []bsmt.Item) []byte
+	hash = func(depth uint8, items []bsmt.Item) []byte {
+		if len(items) == 0 {
+			return nilHashes[depth]
+		}
+		if depth == cfg.MaxDepth {
+			return items[0].Val
+		}
+		bit := uint64(1) << (cfg.MaxDepth - depth - 1)
+		mid := sort.Search(len(items), func(i int) bool { return items[i].Key&bit != 0 })
+		return cfg.Hasher.Hash(hash(depth+1, items[:mid]), hash(depth+1, items[mid:]))
+	}
+	return hash(0, items)
+}
+
+// value returns the value of the key read from the tree, the nil hash of an
+// absent leaf.
+func (cfg *Config) value(tree bsmt.SparseMerkleTree, key uint64, version *bsmt.Version) ([]byte, error) {
+	val, err := tree.Get(key, version)
+	if errors.Is(err, bsmt.ErrNodeNotFound) || errors.Is(err, bsmt.ErrEmptyRoot) {
+		return cfg.NilHash, nil
+	}
+	return val, err
+}
+
+// Model is the reference state of a tree: the leaves of each committed
+// version and the pending changes.
+type Model struct {
+	cfg      *Config
+	versions []map[uint64][]byte // versions[v] are the leaves of the version v
+	pending  map[uint64][]byte
+}
+
+// NewModel returns the model of an empty tree.
+func NewModel(cfg *Config) *Model {
+	return &Model{cfg: cfg, versions: []map[uint64][]byte{{}}, pending: map[uint64][]byte{}}
+}
+
+// Latest returns the latest committed version.
+func (m *Model) Latest() bsmt.Version {
+	return bsmt.Version(len(m.versions) - 1)
+}
+
+// Leaves returns the leaves of the committed version, without the deleted ones.
+func (m *Model) Leaves(version bsmt.Version) map[uint64][]byte {
+	return m.versions[version]
+}
+
+// Value returns the value of the key at the committed version.
+func (m *Model) Value(key uint64, version bsmt.Version) []byte {
+	if val, ok := m.versions[version][key]; ok {
+		return val
+	}
+	return m.cfg.NilHash
+}
+
+// Apply applies the operation to the model.
+func (m *Model) Apply(op Op) {
+	switch op.Kind {
+	case OpSet:
+		for _, item := range op.Items {
+			m.pending[item.Key] = item.Val
+		}
+	case OpCommit:
+		leaves := make(map[uint64][]byte, len(m.versions[m.Latest()])+len(m.pending))
+		for key, val := range m.versions[m.Latest()] {
+			leaves[key] = val
+		}
+		for key, val := range m.pending {
+			if bytes.Equal(val, m.cfg.NilHash) {
+				delete(leaves, key)
+			} else {
+				leaves[key] = val
+			}
+		}
+		m.versions = append(m.versions, leaves)
+		m.pending = map[uint64][]byte{}
+	case OpRollback:
+		m.versions = m.versions[:op.Version+1]
+		m.pending = map[uint64][]byte{}
+	}
+}
+
+// Apply applies the operation to the tree and to the model, and checks the
+// version and the root of the tree against the model after a commit or a
+// rollback.
+func Apply(tree *bsmt.BNBSparseMerkleTree, m *Model, op Op) error {
+	switch op.Kind {
+	case OpSet:
+		if err := tree.MultiSet(op.Items); err != nil {
+			return errors.Wrapf(err, "%s", op)
+		}
+	case OpCommit:
+		if _, err := tree.Commit(nil); err != nil {
+			return errors.Wrapf(err, "%s", op)
+		}
+	case OpRollback:
+		if err := tree.Rollback(op.Version); err != nil {
+			return errors.Wrapf(err, "%s", op)
+		}
+	}
+	m.Apply(op)
+	if op.Kind == OpSet {
+		return nil
+	}
+	if tree.LatestVersion() != m.Latest() {
+		return errors.Wrapf(ErrInvariant, "%s: version %d, expected %d", op, tree.LatestVersion(), m.Latest())
+	}
+	if root, expected := tree.Root(), m.cfg.Root(m.Leaves(m.Latest())); !bytes.Equal(root, expected) {
+		return errors.Wrapf(ErrInvariant, "%s: root %x, expected %x", op, root, expected)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package smttest
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func testConfig(depth uint8) *Config {
+	hasher := bsmt.NewHasherPool(sha256.New)
+	return &Config{
+		Hasher:   hasher,
+		MaxDepth: depth,
+		NilHash:  hasher.Hash([]byte("nilHash")),
+		NewDB:    func() (database.TreeDB, error) { return memory.NewMemoryDB(), nil },
+	}
+}
+
+func TestCheckOrderIndependence(t *testing.T) {
+	for _, depth := range []uint8{8, 16} {
+		cfg := testConfig(depth)
+		g := NewGenerator(cfg, 1)
+		if err := CheckOrderIndependence(cfg, g.Items(200), g.Rand(), 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckRollbacks(t *testing.T) {
+	cfg := testConfig(16)
+	for seed := int64(0); seed < 4; seed++ {
+		if err := CheckRollbacks(cfg, NewGenerator(cfg, seed), 200); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	cfg := testConfig(8)
+	g := NewGenerator(cfg, 2)
+	tree, db, err := cfg.NewTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeTree(tree, db)
+	m := NewModel(cfg)
+	if err := Run(tree, m, g.Ops(100), g); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckConsistency(tree, db, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// a leaf missing from the model is reported
+	if err := Apply(tree, m, Op{Kind: OpSet, Items: g.Items(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	m.Apply(Op{Kind: OpSet, Items: nil})
+	m.Apply(Op{Kind: OpCommit})
+	m.versions[m.Latest()] = m.versions[m.Latest()-1]
+	if err := CheckConsistency(tree, db, m); !errors.Is(err, ErrInvariant) {
+		t.Fatalf("expected ErrInvariant, got %v", err)
+	}
+}
+
+func FuzzOps(f *testing.F) {
+	f.Add([]byte{1, 0, 1, 2, 0, 2, 5, 0, 0, 7, 0, 0})
+	f.Add([]byte{1, 0, 1, 5, 0, 0, 0, 0, 1, 6, 0, 0, 7, 0, 1, 3, 0, 9, 5, 0, 0})
+	cfg := testConfig(8)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tree, db, err := cfg.NewTree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeTree(tree, db)
+		if err := Run(tree, NewModel(cfg), OpsFromBytes(cfg, data), NewGenerator(cfg, int64(len(data)))); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
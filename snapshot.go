@@ -0,0 +1,221 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// SnapshotFormat is the backup format of the snapshots written by
+// ExportSnapshot. The stream holds a header record, the leaves of the version
+// keyed by their 8 byte big endian keys in ascending order, and a trailer
+// record with the number of leaves.
+const SnapshotFormat = "smt-snapshot"
+
+var (
+	snapshotHeaderKey  = []byte("header")
+	snapshotTrailerKey = []byte("leaves")
+)
+
+var _ LeafIterator = (*SnapshotReader)(nil)
+
+// SnapshotInfo describes the state of a version captured by a snapshot.
+type SnapshotInfo struct {
+	Version  Version
+	MaxDepth uint8
+	Root     []byte
+	// Leaves is the number of leaves, known once the snapshot is read entirely.
+	Leaves uint64
+}
+
+func encodeSnapshotHeader(info *SnapshotInfo) []byte {
+	buf := make([]byte, 9, 9+len(info.Root))
+	binary.BigEndian.PutUint64(buf, uint64(info.Version))
+	buf[8] = info.MaxDepth
+	return append(buf, info.Root...)
+}
+
+// rootAt returns the root hash of the version.
+func (tree *BNBSparseMerkleTree) rootAt(version Version) []byte {
+	tree.root.mu.RLock()
+	defer tree.root.mu.RUnlock()
+	for i := len(tree.root.Versions) - 1; i >= 0; i-- {
+		if tree.root.Versions[i].Ver <= version {
+			return tree.root.Versions[i].Hash
+		}
+	}
+	return tree.nilHashes.Get(0)
+}
+
+// ExportSnapshot writes the committed leaves of the version to w, in the backup
+// format readable by NewSnapshotReader. Unlike a database backup, a snapshot
+// holds the state of a single version only, and is restored into a tree of any
+// backend by ImportSnapshot. The progress is called with the number of leaves
+// written so far, it may be nil.
+func (tree *BNBSparseMerkleTree) ExportSnapshot(version Version, w io.Writer, progress func(leaves uint64)) (*SnapshotInfo, error) {
+	scanner, err := tree.Leaves(version)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Release()
+
+	info := &SnapshotInfo{Version: version, MaxDepth: tree.maxDepth, Root: tree.rootAt(version)}
+	bw, err := database.NewBackupWriter(w, SnapshotFormat)
+	if err != nil {
+		return nil, err
+	}
+	if err := bw.Add(snapshotHeaderKey, encodeSnapshotHeader(info)); err != nil {
+		return nil, err
+	}
+	var key [8]byte
+	for scanner.Next() {
+		leaf := scanner.Leaf()
+		binary.BigEndian.PutUint64(key[:], leaf.Key)
+		if err := bw.Add(key[:], leaf.Val); err != nil {
+			return nil, err
+		}
+		info.Leaves++
+		if progress != nil {
+			progress(info.Leaves)
+		}
+	}
+	if err := scanner.Error(); err != nil {
+		return nil, err
+	}
+	var count [8]byte
+	binary.BigEndian.PutUint64(count[:], info.Leaves)
+	if err := bw.Add(snapshotTrailerKey, count[:]); err != nil {
+		return nil, err
+	}
+	return info, bw.Close()
+}
+
+// SnapshotReader reads a snapshot written by ExportSnapshot, and iterates over
+// its leaves.
+type SnapshotReader struct {
+	br   *database.BackupReader
+	info SnapshotInfo
+	leaf Item
+	read uint64
+	done bool
+	err  error
+}
+
+// NewSnapshotReader reads the header of the snapshot from r.
+func NewSnapshotReader(r io.Reader) (*SnapshotReader, error) {
+	br, err := database.NewBackupReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if br.Format() != SnapshotFormat {
+		return nil, database.ErrUnsupportedBackupFormat
+	}
+	key, value, err := br.Next()
+	if err != nil || !bytes.Equal(key, snapshotHeaderKey) || len(value) < 9 {
+		return nil, errors.Wrap(ErrInvalidSnapshot, "missing header")
+	}
+	return &SnapshotReader{
+		br: br,
+		info: SnapshotInfo{
+			Version:  Version(binary.BigEndian.Uint64(value)),
+			MaxDepth: value[8],
+			Root:     value[9:],
+		},
+	}, nil
+}
+
+// Info returns the description of the snapshot, the number of leaves is set
+// once the leaves are read entirely.
+func (s *SnapshotReader) Info() SnapshotInfo {
+	return s.info
+}
+
+// Next moves the reader to the next leaf of the snapshot.
+func (s *SnapshotReader) Next() bool {
+	if s.done {
+		return false
+	}
+	key, value, err := s.br.Next()
+	switch {
+	case err == io.EOF:
+		s.err = errors.Wrap(ErrInvalidSnapshot, "missing trailer")
+	case err != nil:
+		s.err = err
+	case bytes.Equal(key, snapshotTrailerKey) && len(value) == 8:
+		if count := binary.BigEndian.Uint64(value); count != s.read {
+			s.err = errors.Wrapf(ErrInvalidSnapshot, "%d leaves read, %d expected", s.read, count)
+		}
+		s.info.Leaves = s.read
+	case len(key) != 8:
+		s.err = errors.Wrap(ErrInvalidSnapshot, "malformed leaf record")
+	default:
+		s.leaf = Item{Key: binary.BigEndian.Uint64(key), Val: value}
+		s.read++
+		return true
+	}
+	s.done = true
+	return false
+}
+
+// Leaf returns the current leaf.
+func (s *SnapshotReader) Leaf() Item {
+	return s.leaf
+}
+
+// Error returns the failure that stopped the reader, if any.
+func (s *SnapshotReader) Error() error {
+	return s.err
+}
+
+// progressIterator reports the number of leaves iterated so far.
+type progressIterator struct {
+	LeafIterator
+	count    uint64
+	progress func(uint64)
+}
+
+func (it *progressIterator) Next() bool {
+	if !it.LeafIterator.Next() {
+		return false
+	}
+	it.count++
+	it.progress(it.count)
+	return true
+}
+
+// ImportSnapshot builds an empty tree of the depth of the snapshot from its
+// leaves, committed as the version of the snapshot, and verifies the root of
+// the built tree against the one recorded by the snapshot. A mismatching
+// root fails with ErrSnapshotMismatch, the built version is kept for
+// inspection then. The progress is called with the number of leaves read so
+// far, it may be nil.
+func (tree *BNBSparseMerkleTree) ImportSnapshot(s *SnapshotReader, progress func(leaves uint64)) (Version, error) {
+	info := s.Info()
+	if info.MaxDepth != tree.maxDepth {
+		return tree.version, errors.Wrapf(ErrSnapshotMismatch, "snapshot depth %d, tree depth %d", info.MaxDepth, tree.maxDepth)
+	}
+	if tree.version > 0 || !tree.IsEmpty() {
+		return tree.version, ErrTreeNotEmpty
+	}
+	var iter LeafIterator = s
+	if progress != nil {
+		iter = &progressIterator{LeafIterator: s, progress: progress}
+	}
+	version, err := tree.buildFrom(iter, info.Version)
+	if err != nil {
+		return version, err
+	}
+	if root := tree.Root(); !bytes.Equal(root, info.Root) {
+		return version, errors.Wrapf(ErrSnapshotMismatch, "root %x, snapshot root %x", root, info.Root)
+	}
+	return version, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func Test_BNBSparseMerkleTree_Snapshot(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	version, err := smt.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+	// the snapshot of an older version is exported
+	if err := smt.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var exported uint64
+	info, err := tree.ExportSnapshot(version, &buf, func(leaves uint64) { exported = leaves })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != version || !bytes.Equal(info.Root, root) || info.Leaves != uint64(len(items)) || exported != info.Leaves {
+		t.Fatalf("unexpected snapshot info %+v", info)
+	}
+	snapshot := buf.Bytes()
+
+	reader, err := NewSnapshotReader(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := restored.(*BNBSparseMerkleTree).ImportSnapshot(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != version || !bytes.Equal(restored.Root(), root) || reader.Info().Leaves != uint64(len(items)) {
+		t.Fatalf("unexpected import of version %d, info %+v", imported, reader.Info())
+	}
+	verifyItems(t, restored, restored, items)
+
+	// a tree of another depth is refused
+	reader, err = NewSnapshotReader(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.(*BNBSparseMerkleTree).ImportSnapshot(reader, nil); !errors.Is(err, ErrSnapshotMismatch) {
+		t.Fatalf("expected ErrSnapshotMismatch, got %v", err)
+	}
+
+	// a truncated snapshot is detected
+	reader, err = NewSnapshotReader(bytes.NewReader(snapshot[:len(snapshot)-20]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := truncated.(*BNBSparseMerkleTree).ImportSnapshot(reader, nil); err == nil {
+		t.Fatal("expected the truncated snapshot to fail")
+	}
+}
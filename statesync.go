@@ -0,0 +1,294 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/pkg/errors"
+)
+
+// maxChunkDepth bounds the number of state chunks of a version to 65536.
+const maxChunkDepth = 16
+
+// StateSyncManifest describes the chunks of the state of a version. The root
+// must be trusted by the receiver, such as the root of a finalized block, the
+// chunks are verified against it.
+type StateSyncManifest struct {
+	Version  Version
+	Root     []byte
+	MaxDepth uint8
+	// ChunkDepth is the depth of the subtrees held by the chunks, there are
+	// 1<<ChunkDepth chunks.
+	ChunkDepth uint8
+}
+
+// Chunks returns the number of chunks.
+func (m *StateSyncManifest) Chunks() uint64 {
+	return 1 << m.ChunkDepth
+}
+
+// MarshalBinary encodes the manifest to be sent to a peer.
+func (m *StateSyncManifest) MarshalBinary() ([]byte, error) {
+	return rlp.EncodeToBytes(m)
+}
+
+// UnmarshalBinary decodes a manifest encoded by MarshalBinary.
+func (m *StateSyncManifest) UnmarshalBinary(data []byte) error {
+	return rlp.DecodeBytes(data, m)
+}
+
+// StateChunk holds the leaves of the subtree at the chunk depth and index of a
+// version, with the proof of the root of the subtree.
+type StateChunk struct {
+	Version Version
+	Index   uint64
+	Leaves  []Item
+	// Proof are the sibling hashes from the root of the subtree up to the root.
+	Proof Proof
+}
+
+// MarshalBinary encodes the chunk to be sent to a peer.
+func (c *StateChunk) MarshalBinary() ([]byte, error) {
+	return rlp.EncodeToBytes(c)
+}
+
+// UnmarshalBinary decodes a chunk encoded by MarshalBinary.
+func (c *StateChunk) UnmarshalBinary(data []byte) error {
+	return rlp.DecodeBytes(data, c)
+}
+
+// StateSyncProvider serves the chunks of a version to the peers. The roots of
+// the chunks are read once by NewStateSyncProvider, each chunk then reads the
+// leaves of its subtree only.
+type StateSyncProvider struct {
+	tree     *BNBSparseMerkleTree
+	manifest StateSyncManifest
+	// levels[i] are the hashes of the nodes at the depth ChunkDepth-i
+	levels [][][]byte
+}
+
+// NewStateSyncProvider returns a provider of the chunks of the committed
+// version, split at the chunk depth, a multiple of 4 up to 16 and to the
+// depth of the tree.
+func (tree *BNBSparseMerkleTree) NewStateSyncProvider(version Version, chunkDepth uint8) (*StateSyncProvider, error) {
+	if chunkDepth%4 != 0 || chunkDepth > tree.maxDepth || chunkDepth > maxChunkDepth {
+		return nil, ErrInvalidDepth
+	}
+	root, err := tree.RootAt(version)
+	if err != nil {
+		return nil, err
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 1<<chunkDepth)
+	if chunkDepth == 0 {
+		chunks[0] = root
+	} else {
+		keys := make([][]byte, len(chunks))
+		arena := newNodeKeyArena(tree.nodeKeys, len(keys))
+		for i := range keys {
+			keys[i] = arena.key(chunkDepth, uint64(i))
+		}
+		values, err := tree.db.MultiGet(keys)
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			chunks[i] = tree.nilHashes.Get(chunkDepth)
+			if value == nil {
+				continue
+			}
+			node, err := decodeStorageTreeNode(keys[i], value)
+			if err != nil {
+				return nil, err
+			}
+			for j := len(node.Versions) - 1; j >= 0; j-- {
+				if node.Versions[j].Ver <= version {
+					chunks[i] = node.Versions[j].Hash
+					break
+				}
+			}
+		}
+	}
+
+	levels := [][][]byte{chunks}
+	for len(levels[len(levels)-1]) > 1 {
+		below := levels[len(levels)-1]
+		level := make([][]byte, len(below)/2)
+		for i := range level {
+			level[i] = tree.hasher.Hash(below[2*i], below[2*i+1])
+		}
+		levels = append(levels, level)
+	}
+	if top := levels[len(levels)-1][0]; !bytes.Equal(top, root) {
+		return nil, errors.Wrapf(ErrUnexpected, "the chunks of version %d hash to %x, root %x", version, top, root)
+	}
+	return &StateSyncProvider{
+		tree: tree,
+		manifest: StateSyncManifest{
+			Version:    version,
+			Root:       root,
+			MaxDepth:   tree.maxDepth,
+			ChunkDepth: chunkDepth,
+		},
+		levels: levels,
+	}, nil
+}
+
+// Manifest returns the manifest of the chunks.
+func (p *StateSyncProvider) Manifest() StateSyncManifest {
+	return p.manifest
+}
+
+// Chunk returns the chunk of the index.
+func (p *StateSyncProvider) Chunk(index uint64) (*StateChunk, error) {
+	if index >= p.manifest.Chunks() {
+		return nil, errors.Wrapf(ErrInvalidStateChunk, "chunk %d of %d", index, p.manifest.Chunks())
+	}
+	height := p.manifest.MaxDepth - p.manifest.ChunkDepth
+	first, last := index<<height, (index+1)<<height-1
+
+	scanner, err := p.tree.leavesFrom(p.manifest.Version, first)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Release()
+
+	chunk := &StateChunk{Version: p.manifest.Version, Index: index, Leaves: []Item{}}
+	for scanner.Next() {
+		leaf := scanner.Leaf()
+		if leaf.Key > last {
+			break
+		}
+		chunk.Leaves = append(chunk.Leaves, leaf)
+	}
+	if err := scanner.Error(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(p.levels)-1; i++ {
+		chunk.Proof = append(chunk.Proof, p.levels[i][index>>i^1])
+	}
+	return chunk, nil
+}
+
+// StateSync assembles a tree from the chunks of a manifest, received in any
+// order and from any number of peers. Each chunk is verified against the root
+// of the manifest as it is added, a chunk failing the verification is rejected
+// and can be requested again from another peer.
+type StateSync struct {
+	tree     *BNBSparseMerkleTree
+	manifest StateSyncManifest
+
+	mu     sync.Mutex
+	chunks map[uint64][]Item
+}
+
+// NewStateSync returns the assembly of the state of the manifest into the
+// tree, which must be empty.
+func (tree *BNBSparseMerkleTree) NewStateSync(manifest StateSyncManifest) (*StateSync, error) {
+	if manifest.MaxDepth != tree.maxDepth {
+		return nil, errors.Wrapf(ErrManifestMismatch, "manifest depth %d, tree depth %d", manifest.MaxDepth, tree.maxDepth)
+	}
+	if manifest.ChunkDepth%4 != 0 || manifest.ChunkDepth > tree.maxDepth || manifest.ChunkDepth > maxChunkDepth {
+		return nil, ErrInvalidDepth
+	}
+	if tree.version > 0 || !tree.IsEmpty() {
+		return nil, ErrTreeNotEmpty
+	}
+	return &StateSync{tree: tree, manifest: manifest, chunks: make(map[uint64][]Item)}, nil
+}
+
+// Add verifies the chunk and keeps its leaves, it fails with
+// ErrInvalidStateChunk if the chunk does not prove against the root.
+func (s *StateSync) Add(chunk *StateChunk) error {
+	if err := s.verify(chunk); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks[chunk.Index] = chunk.Leaves
+	return nil
+}
+
+func (s *StateSync) verify(chunk *StateChunk) error {
+	m := &s.manifest
+	if chunk.Version != m.Version || chunk.Index >= m.Chunks() || len(chunk.Proof) != int(m.ChunkDepth) {
+		return errors.Wrapf(ErrInvalidStateChunk, "chunk %d of version %d", chunk.Index, chunk.Version)
+	}
+	height := m.MaxDepth - m.ChunkDepth
+	first, last := chunk.Index<<height, (chunk.Index+1)<<height-1
+	for i, leaf := range chunk.Leaves {
+		if leaf.Key < first || leaf.Key > last || (i > 0 && leaf.Key <= chunk.Leaves[i-1].Key) {
+			return errors.Wrapf(ErrInvalidStateChunk, "key %d out of order in chunk %d", leaf.Key, chunk.Index)
+		}
+	}
+
+	hash := s.subtreeHash(m.ChunkDepth, chunk.Leaves)
+	for i, sibling := range chunk.Proof {
+		if chunk.Index>>i&1 == 0 {
+			hash = s.tree.hasher.Hash(hash, sibling)
+		} else {
+			hash = s.tree.hasher.Hash(sibling, hash)
+		}
+	}
+	if !bytes.Equal(hash, m.Root) {
+		return errors.Wrapf(ErrInvalidStateChunk, "chunk %d does not prove against root %x", chunk.Index, m.Root)
+	}
+	return nil
+}
+
+// subtreeHash returns the hash of the subtree at the depth holding the sorted leaves.
+func (s *StateSync) subtreeHash(depth uint8, leaves []Item) []byte {
+	if len(leaves) == 0 {
+		return s.tree.nilHashes.Get(depth)
+	}
+	if depth == s.tree.maxDepth {
+		return leaves[0].Val
+	}
+	bit := uint64(1) << (s.tree.maxDepth - depth - 1)
+	mid := sort.Search(len(leaves), func(i int) bool { return leaves[i].Key&bit != 0 })
+	return s.tree.hasher.Hash(s.subtreeHash(depth+1, leaves[:mid]), s.subtreeHash(depth+1, leaves[mid:]))
+}
+
+// Missing returns the indexes of the chunks not added yet.
+func (s *StateSync) Missing() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var missing []uint64
+	for i := uint64(0); i < s.manifest.Chunks(); i++ {
+		if _, ok := s.chunks[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Finish builds the tree from the chunks and commits the version of the
+// manifest, it fails with ErrStateSyncIncomplete unless all the chunks are added.
+func (s *StateSync) Finish() (Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if uint64(len(s.chunks)) != s.manifest.Chunks() {
+		return s.tree.version, errors.Wrapf(ErrStateSyncIncomplete, "%d of %d chunks", len(s.chunks), s.manifest.Chunks())
+	}
+	var leaves []Item
+	for i := uint64(0); i < s.manifest.Chunks(); i++ {
+		leaves = append(leaves, s.chunks[i]...)
+	}
+	version, err := s.tree.buildFrom(NewSliceLeafIterator(leaves), s.manifest.Version)
+	if err != nil {
+		return version, err
+	}
+	if root := s.tree.Root(); !bytes.Equal(root, s.manifest.Root) {
+		return version, errors.Wrapf(ErrUnexpected, "root %x, manifest root %x", root, s.manifest.Root)
+	}
+	return version, nil
+}
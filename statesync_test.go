@@ -0,0 +1,122 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database/memory"
+)
+
+func Test_BNBSparseMerkleTree_StateSync(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	version, err := smt.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := smt.Root()
+	// the state of an older version is synced
+	if err := smt.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chunkDepth := range []uint8{0, 4, 8} {
+		provider, err := tree.NewStateSyncProvider(version, chunkDepth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := (&StateSyncManifest{Version: version, Root: root, MaxDepth: 8, ChunkDepth: chunkDepth}).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest StateSyncManifest
+		if err := manifest.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+		if got := provider.Manifest(); !bytes.Equal(got.Root, manifest.Root) || got.Version != manifest.Version {
+			t.Fatalf("unexpected manifest %+v", got)
+		}
+
+		restored, err := NewBNBSparseMerkleTree(env.hasher, memory.NewMemoryDB(), 8, nilHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sync, err := restored.(*BNBSparseMerkleTree).NewStateSync(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the chunks are added in any order
+		for i := manifest.Chunks(); i > 0; i-- {
+			chunk, err := provider.Chunk(i - 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := chunk.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var received StateChunk
+			if err := received.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if len(received.Leaves) > 0 {
+				tampered := received
+				tampered.Leaves = append([]Item{}, received.Leaves...)
+				tampered.Leaves[0].Val = env.hasher.Hash([]byte("tampered"))
+				if err := sync.Add(&tampered); !errors.Is(err, ErrInvalidStateChunk) {
+					t.Fatalf("expected ErrInvalidStateChunk, got %v", err)
+				}
+			}
+			if i == 1 {
+				if _, err := sync.Finish(); !errors.Is(err, ErrStateSyncIncomplete) {
+					t.Fatalf("expected ErrStateSyncIncomplete, got %v", err)
+				}
+				if missing := sync.Missing(); len(missing) != 1 || missing[0] != 0 {
+					t.Fatalf("unexpected missing chunks %v", missing)
+				}
+			}
+			if err := sync.Add(&received); err != nil {
+				t.Fatal(err)
+			}
+		}
+		synced, err := sync.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if synced != version || !bytes.Equal(restored.Root(), root) {
+			t.Fatalf("unexpected sync of version %d, root %x", synced, restored.Root())
+		}
+		verifyItems(t, restored, restored, items)
+	}
+
+	if _, err := tree.NewStateSyncProvider(version, 6); !errors.Is(err, ErrInvalidDepth) {
+		t.Fatalf("expected ErrInvalidDepth, got %v", err)
+	}
+	if _, err := tree.NewStateSync(StateSyncManifest{Version: version, Root: root, MaxDepth: 8}); !errors.Is(err, ErrTreeNotEmpty) {
+		t.Fatalf("expected ErrTreeNotEmpty, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultStatsWindow is the sliding window of Metrics, unless set by MetricsWindow.
+	defaultStatsWindow = time.Minute
+	// statsSamples is the number of the latest samples kept per series, the
+	// older samples are dropped even within the window.
+	statsSamples = 1024
+)
+
+// LatencyStats summarize the durations of an operation within the window.
+type LatencyStats struct {
+	// Count is the number of operations.
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// TreeMetrics are the statistics of the tree operations over a sliding window,
+// maintained by the tree itself without a metrics backend.
+type TreeMetrics struct {
+	// Window is the span of the statistics.
+	Window time.Duration
+	// Commits are the durations of Commit, without the background write of a
+	// PipelinedCommit.
+	Commits LatencyStats
+	// KeysPerSecond is the rate of the leaves committed within the window.
+	KeysPerSecond float64
+	// Proofs are the durations of GetProof, GetProofs and GetMultiProof.
+	Proofs LatencyStats
+	// JournalSize is the number of dirty nodes waiting for the next commit.
+	JournalSize int
+	// MeanJournalSize and MaxJournalSize are the numbers of dirty nodes written
+	// by the commits within the window.
+	MeanJournalSize float64
+	MaxJournalSize  int
+}
+
+type statsSample struct {
+	at    time.Time
+	value int64
+}
+
+// statsSeries is a ring of the latest samples of a measurement.
+type statsSeries struct {
+	samples [statsSamples]statsSample
+	next    int
+	size    int
+}
+
+func (s *statsSeries) add(at time.Time, value int64) {
+	s.samples[s.next] = statsSample{at: at, value: value}
+	s.next = (s.next + 1) % statsSamples
+	if s.size < statsSamples {
+		s.size++
+	}
+}
+
+// since returns the values of the samples taken after the time.
+func (s *statsSeries) since(t time.Time) []int64 {
+	var values []int64
+	for i := 0; i < s.size; i++ {
+		sample := s.samples[(s.next-s.size+i+statsSamples)%statsSamples]
+		if sample.at.After(t) {
+			values = append(values, sample.value)
+		}
+	}
+	return values
+}
+
+// operationStats accumulates the samples of the tree operations.
+type operationStats struct {
+	mu       sync.Mutex
+	commits  statsSeries
+	keys     statsSeries
+	journals statsSeries
+	proofs   statsSeries
+}
+
+// commit records a commit of the leaves and dirty nodes started at start.
+func (s *operationStats) commit(start time.Time, leaves, nodes int) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits.add(now, int64(now.Sub(start)))
+	s.keys.add(now, int64(leaves))
+	s.journals.add(now, int64(nodes))
+}
+
+func (s *operationStats) proof(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proofs.add(time.Now(), int64(elapsed))
+}
+
+func latencyStats(values []int64) LatencyStats {
+	if len(values) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	return LatencyStats{
+		Count: len(values),
+		Mean:  time.Duration(sum / int64(len(values))),
+		P50:   time.Duration(values[(len(values)-1)/2]),
+		P99:   time.Duration(values[(len(values)-1)*99/100]),
+		Max:   time.Duration(values[len(values)-1]),
+	}
+}
+
+// Metrics returns the statistics of the commits and proofs over the sliding
+// window, one minute unless set by MetricsWindow.
+func (tree *BNBSparseMerkleTree) Metrics() TreeMetrics {
+	window := tree.statsWindow
+	if window <= 0 {
+		window = defaultStatsWindow
+	}
+	since := time.Now().Add(-window)
+
+	tree.opStats.mu.Lock()
+	commits := tree.opStats.commits.since(since)
+	keys := tree.opStats.keys.since(since)
+	journals := tree.opStats.journals.since(since)
+	proofs := tree.opStats.proofs.since(since)
+	tree.opStats.mu.Unlock()
+
+	m := TreeMetrics{
+		Window:      window,
+		Commits:     latencyStats(commits),
+		Proofs:      latencyStats(proofs),
+		JournalSize: tree.journal.len(),
+	}
+	var committed int64
+	for _, n := range keys {
+		committed += n
+	}
+	m.KeysPerSecond = float64(committed) / window.Seconds()
+	if len(journals) > 0 {
+		var sum int64
+		for _, n := range journals {
+			sum += n
+			if int(n) > m.MaxJournalSize {
+				m.MaxJournalSize = int(n)
+			}
+		}
+		m.MeanJournalSize = float64(sum) / float64(len(journals))
+	}
+	return m
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/metrics"
+)
+
+func Test_BNBSparseMerkleTree_Metrics(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, MetricsWindow(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	if m := tree.Metrics(); m.Commits.Count != 0 || m.Proofs.Count != 0 || m.Window != time.Hour {
+		t.Fatalf("a new tree should have no samples, got %+v", m)
+	}
+
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if m := tree.Metrics(); m.JournalSize == 0 {
+		t.Fatal("the dirty nodes should be reported before the commit")
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items[:3] {
+		if _, err := smt.GetProof(item.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := tree.Metrics()
+	if m.Commits.Count != 2 || m.Commits.Max < m.Commits.P50 || m.Commits.Max == 0 {
+		t.Fatalf("both commits should be reported, got %+v", m.Commits)
+	}
+	if m.Proofs.Count != 3 {
+		t.Fatalf("the proofs should be reported, got %+v", m.Proofs)
+	}
+	if expected := float64(len(items)+1) / time.Hour.Seconds(); m.KeysPerSecond != expected {
+		t.Fatalf("expected %f keys per second, got %f", expected, m.KeysPerSecond)
+	}
+	// the second commit writes the leaf and the root
+	if m.JournalSize != 0 || m.MaxJournalSize <= 2 || m.MeanJournalSize <= 2 {
+		t.Fatalf("unexpected journal sizes %+v", m)
+	}
+}
+
+func Test_StatsSeries(t *testing.T) {
+	var s statsSeries
+	start := time.Now()
+	for i := 0; i < statsSamples+10; i++ {
+		s.add(start.Add(time.Duration(i)), int64(i))
+	}
+	values := s.since(start)
+	if len(values) != statsSamples || values[0] != 10 || values[len(values)-1] != statsSamples+9 {
+		t.Fatalf("the latest samples should be kept in order, got %d samples from %d", len(values), values[0])
+	}
+	if values := s.since(start.Add(statsSamples + 8)); len(values) != 1 {
+		t.Fatalf("the samples before the window should be skipped, got %d", len(values))
+	}
+}
+
+// operationMetrics records the reported operations.
+type operationMetrics struct {
+	commits, proofs, gcRuns int
+	lookups                 map[string][2]uint64
+}
+
+func (m *operationMetrics) Version(uint64)                    {}
+func (m *operationMetrics) PrunedVersion(uint64)              {}
+func (m *operationMetrics) CurrentSize(uint64)                {}
+func (m *operationMetrics) ChangeSize(uint64)                 {}
+func (m *operationMetrics) CommitNum(int)                     {}
+func (m *operationMetrics) LatestGCVersion(uint64)            {}
+func (m *operationMetrics) GCThreshold(uint64)                {}
+func (m *operationMetrics) GCVersions([10]*metrics.GCVersion) {}
+func (m *operationMetrics) CommitDuration(time.Duration)      { m.commits++ }
+func (m *operationMetrics) ProofDuration(time.Duration)       { m.proofs++ }
+func (m *operationMetrics) GCRun(int, uint64, time.Duration)  { m.gcRuns++ }
+func (m *operationMetrics) CacheLookups(op string, hits, faults uint64) {
+	m.lookups[op] = [2]uint64{hits, faults}
+}
+
+func Test_BNBSparseMerkleTree_OperationMetrics(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := &operationMetrics{lookups: make(map[string][2]uint64)}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, EnableMetrics(m), GCHardLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.GetProof(items[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if m.commits != 2 || m.proofs != 1 {
+		t.Fatalf("expected 2 commits and 1 proof, got %d and %d", m.commits, m.proofs)
+	}
+	if m.gcRuns == 0 {
+		t.Fatal("the GC runs of the hard limit should be reported")
+	}
+	stats := smt.(*BNBSparseMerkleTree).CacheStats()
+	if got := m.lookups[metrics.CacheSet]; got != [2]uint64{stats.Set.Hits, stats.Set.Faults} {
+		t.Fatalf("expected the set lookups %+v, got %v", stats.Set, got)
+	}
+	if got := m.lookups[metrics.CacheProof]; got[0]+got[1] == 0 {
+		t.Fatal("the proof lookups should be reported")
+	}
+}
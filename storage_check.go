@@ -0,0 +1,251 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// NodeRef identifies a stored node by its depth and path.
+type NodeRef struct {
+	Depth uint8
+	Path  uint64
+}
+
+// StorageCheckReport is the result of CheckStorage.
+type StorageCheckReport struct {
+	// Version is the version the hashes are checked at.
+	Version Version
+	// Nodes is the number of the stored nodes scanned.
+	Nodes int
+	// Missing are the nodes referenced by their parent but not stored.
+	Missing []NodeRef
+	// Mismatched are the nodes whose hash at the version is not the one
+	// referenced by their parent, or not the one of their children.
+	Mismatched []NodeRef
+	// Corrupted are the stored nodes which cannot be decoded.
+	Corrupted []NodeRef
+	// Leaked are the stored nodes unreachable from the root, which no parent
+	// references.
+	Leaked []NodeRef
+}
+
+// OK reports whether no issue was found.
+func (r *StorageCheckReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0 && len(r.Corrupted) == 0 && len(r.Leaked) == 0
+}
+
+// CheckStorage walks the stored nodes down from the persisted root, and checks
+// that every node referenced by its parent is stored, with the hash referenced
+// at the latest version and the hash of its children, and lists the stored nodes
+// no parent references. It is the inverse of checking the tree against its
+// writes: it finds the dangling references and the storage leaks left by a bug
+// of the GC or of a repair. The levels are scanned in key order side by side
+// with their parent level, so the memory used does not grow with the tree, but
+// with the number of the leaked nodes.
+func (tree *BNBSparseMerkleTree) CheckStorage() (*StorageCheckReport, error) {
+	report := &StorageCheckReport{Version: tree.version}
+	if tree.db == nil {
+		return report, nil
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return nil, err
+	}
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	// the nodes below a leaked node are leaked as well, the ones below a
+	// corrupted node are not checked
+	skipped, err := tree.checkStoredRoot(report)
+	if err != nil {
+		return nil, err
+	}
+	for depth := uint8(4); depth <= tree.maxDepth; depth += 4 {
+		if skipped, err = tree.checkStoredLevel(report, depth, skipped); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// checkStoredRoot checks the stored root against the root of the tree.
+func (tree *BNBSparseMerkleTree) checkStoredRoot(report *StorageCheckReport) (map[uint64]bool, error) {
+	ref := NodeRef{Depth: 0, Path: 0}
+	key := tree.nodeKeys.key(0, 0)
+	value, err := tree.db.Get(key)
+	if errors.Is(err, database.ErrDatabaseNotFound) || (err == nil && value == nil) {
+		if !bytes.Equal(tree.rootAt(report.Version), tree.nilHashes.Get(0)) {
+			report.Missing = append(report.Missing, ref)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.Nodes++
+	node, err := decodeStorageTreeNode(key, value)
+	if err != nil {
+		report.Corrupted = append(report.Corrupted, ref)
+		return map[uint64]bool{0: true}, nil
+	}
+	hash := hashAt(node.Versions, report.Version)
+	if hash == nil {
+		hash = tree.nilHashes.Get(0)
+	}
+	if !bytes.Equal(hash, tree.rootAt(report.Version)) || !tree.checkStoredHash(node, 0, report.Version) {
+		report.Mismatched = append(report.Mismatched, ref)
+	}
+	return nil, nil
+}
+
+// checkStoredLevel checks the stored nodes at the depth against their parents.
+// The parents unreachable from the root are skipped, mapped to whether they are
+// corrupted, and the skipped nodes of the level are returned.
+func (tree *BNBSparseMerkleTree) checkStoredLevel(report *StorageCheckReport, depth uint8, skippedParents map[uint64]bool) (map[uint64]bool, error) {
+	var (
+		skipped     = make(map[uint64]bool)
+		version     = report.Version
+		parents     = tree.db.NewIterator(tree.nodeKeys.levelPrefix(depth-4), nil)
+		children    = tree.db.NewIterator(tree.nodeKeys.levelPrefix(depth), nil)
+		parent      *StorageTreeNode
+		parentPath  uint64
+		parentValid bool // the parent is decoded and reachable
+		matched     [16]bool
+		parentsDone bool
+	)
+	defer parents.Release()
+	defer children.Release()
+
+	// finishParent lists the children referenced by the current parent but not stored
+	finishParent := func() {
+		if !parentValid {
+			return
+		}
+		for nibble, child := range parent.Children {
+			if child != nil && len(child.Versions) > 0 && !matched[nibble] {
+				report.Missing = append(report.Missing, NodeRef{Depth: depth, Path: parentPath<<4 + uint64(nibble)})
+			}
+		}
+	}
+	nextParent := func() bool {
+		finishParent()
+		parent, parentValid, matched = nil, false, [16]bool{}
+		for parents.Next() {
+			path, ok := tree.nodeKeys.leafPath(parents.Key(), depth-4)
+			if !ok {
+				continue
+			}
+			parentPath = path
+			if _, ok := skippedParents[path]; ok {
+				return true
+			}
+			if node, err := decodeStorageTreeNode(parents.Key(), parents.Value()); err == nil {
+				parent, parentValid = node, true
+			}
+			return true
+		}
+		parentsDone = true
+		return false
+	}
+
+	started := false
+	for children.Next() {
+		path, ok := tree.nodeKeys.leafPath(children.Key(), depth)
+		if !ok {
+			continue
+		}
+		report.Nodes++
+		ref := NodeRef{Depth: depth, Path: path}
+		for !parentsDone && (!started || parentPath < path>>4) {
+			started = true
+			nextParent()
+		}
+
+		var stub *StorageLeafNode
+		if parentValid && parentPath == path>>4 {
+			stub = parent.Children[path&0xf]
+		}
+		linked := stub != nil && len(stub.Versions) > 0
+		if linked {
+			matched[path&0xf] = true
+		}
+
+		node, err := decodeStorageTreeNode(children.Key(), children.Value())
+		if err != nil {
+			report.Corrupted = append(report.Corrupted, ref)
+			skipped[path] = true
+			continue
+		}
+		if !linked {
+			if corrupted := skippedParents[path>>4]; corrupted {
+				skipped[path] = true
+				continue
+			}
+			report.Leaked = append(report.Leaked, ref)
+			skipped[path] = false
+			continue
+		}
+		hash := hashAt(node.Versions, version)
+		if !bytes.Equal(hash, hashAt(stub.Versions, version)) ||
+			(hash != nil && depth < tree.maxDepth && !tree.checkStoredHash(node, depth, version)) {
+			report.Mismatched = append(report.Mismatched, ref)
+		}
+	}
+	if err := children.Error(); err != nil {
+		return nil, err
+	}
+	if !started {
+		nextParent()
+	}
+	for !parentsDone {
+		nextParent()
+	}
+	if err := parents.Error(); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// checkStoredHash reports whether the hash of the stored node at the version
+// is the one of its children.
+func (tree *BNBSparseMerkleTree) checkStoredHash(node *StorageTreeNode, depth uint8, version Version) bool {
+	hash := hashAt(node.Versions, version)
+	if hash == nil {
+		return true
+	}
+	var level [16][]byte
+	for i, child := range node.Children {
+		if child != nil {
+			level[i] = hashAt(child.Versions, version)
+		}
+		if level[i] == nil {
+			level[i] = tree.nilHashes.Get(depth + 4)
+		}
+	}
+	hashes := level[:]
+	for len(hashes) > 1 {
+		next := make([][]byte, len(hashes)/2)
+		for i := range next {
+			next[i] = tree.hasher.Hash(hashes[2*i], hashes[2*i+1])
+		}
+		hashes = next
+	}
+	return bytes.Equal(hashes[0], hash)
+}
+
+// hashAt returns the hash of the versions at the version, nil if there is none.
+func hashAt(versions []*VersionInfo, version Version) []byte {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Ver <= version {
+			return versions[i].Hash
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_CheckStorage(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			defer tree.StopGC()
+			report, err := tree.CheckStorage()
+			if err != nil || !report.OK() || report.Nodes != 0 {
+				t.Fatalf("unexpected report of an empty tree %+v, %v", report, err)
+			}
+
+			items := prepareKVData(env.hasher)
+			if err := smt.MultiSet(items); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := smt.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+			report, err = tree.CheckStorage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || report.Nodes == 0 || report.Version != 2 {
+				t.Fatalf("unexpected report %+v", report)
+			}
+			nodes := report.Nodes
+
+			// a leaf which is not stored, a leaf with a value which is not the
+			// committed one, and a subtree no node references
+			missing, mismatched := items[1].Key, items[2].Key
+			if err := db.Delete(tree.nodeKeys.key(8, missing)); err != nil {
+				t.Fatal(err)
+			}
+			stale, err := encodeStorageTreeNode(&StorageTreeNode{
+				Versions: []*VersionInfo{{Ver: 1, Hash: env.hasher.Hash([]byte("stale"))}},
+				Path:     mismatched,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Set(tree.nodeKeys.key(8, mismatched), stale); err != nil {
+				t.Fatal(err)
+			}
+			leaked := uint64(0xa0)
+			if _, err := tree.Get(leaked, nil); err != ErrNodeNotFound {
+				t.Fatalf("the key %d should not be set, got %v", leaked, err)
+			}
+			leakedNode := &StorageTreeNode{Versions: []*VersionInfo{{Ver: 1, Hash: nilHash}}, Path: leaked >> 4}
+			leakedNode.Children[0] = &StorageLeafNode{Versions: []*VersionInfo{{Ver: 1, Hash: nilHash}}}
+			for depth, node := range map[uint8]*StorageTreeNode{
+				4: leakedNode,
+				8: {Versions: []*VersionInfo{{Ver: 1, Hash: nilHash}}, Path: leaked},
+			} {
+				data, err := encodeStorageTreeNode(node)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Set(tree.nodeKeys.key(depth, node.Path), data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.Set(tree.nodeKeys.key(8, 0xa1), []byte("garbage")); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err = tree.CheckStorage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Nodes != nodes+2 {
+				t.Fatalf("expected %d nodes, got %d", nodes+2, report.Nodes)
+			}
+			if len(report.Missing) != 1 || report.Missing[0] != (NodeRef{Depth: 8, Path: missing}) {
+				t.Fatalf("unexpected missing nodes %+v", report.Missing)
+			}
+			if len(report.Mismatched) != 1 || report.Mismatched[0] != (NodeRef{Depth: 8, Path: mismatched}) {
+				t.Fatalf("unexpected mismatched nodes %+v", report.Mismatched)
+			}
+			if len(report.Leaked) != 2 || report.Leaked[0] != (NodeRef{Depth: 4, Path: leaked >> 4}) ||
+				report.Leaked[1] != (NodeRef{Depth: 8, Path: leaked}) {
+				t.Fatalf("unexpected leaked nodes %+v", report.Leaked)
+			}
+			if len(report.Corrupted) != 1 || report.Corrupted[0] != (NodeRef{Depth: 8, Path: 0xa1}) {
+				t.Fatalf("unexpected corrupted nodes %+v", report.Corrupted)
+			}
+		})
+	}
+}
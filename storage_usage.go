@@ -0,0 +1,145 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sort"
+)
+
+// VersionUsage is the storage kept by a version in the stored nodes.
+type VersionUsage struct {
+	Version Version
+	// Nodes is the number of stored nodes holding an entry of the version,
+	// either for themselves or for one of their leaf children.
+	Nodes int
+	// Entries is the number of the version entries, a hash and a version each.
+	Entries int
+	// Bytes is the size of the entries, about the bytes a prune of the version
+	// would reclaim once the entries are superseded by a later version.
+	Bytes int64
+}
+
+// SubtreeUsage is the storage of the stored nodes under a path prefix.
+type SubtreeUsage struct {
+	// Prefix is the path of the subtree root at the prefix depth of the breakdown.
+	Prefix uint64
+	Nodes  int
+	// Entries is the number of the version entries of the nodes.
+	Entries int
+	// Bytes is the size of the keys and the records of the nodes.
+	Bytes int64
+}
+
+// StorageBreakdown is the storage of the stored nodes per version and per
+// subtree, as reported by AnalyzeStorage.
+type StorageBreakdown struct {
+	Nodes int
+	Bytes int64
+	// Versions are the versions with entries in the stored nodes, ordered by version.
+	Versions []VersionUsage
+	// PrefixDepth is the depth of the subtree roots of Subtrees.
+	PrefixDepth uint8
+	// Subtrees are the subtrees holding stored nodes, ordered by prefix.
+	Subtrees []SubtreeUsage
+	// Top is the usage of the nodes above PrefixDepth, which belong to no subtree.
+	Top SubtreeUsage
+}
+
+// AnalyzeStorage scans the stored nodes of the tree, and reports their number
+// and size per version and per subtree rooted at prefixDepth, which must be a
+// multiple of 4 not beyond the depth of the tree. The versions keeping many
+// entries which are superseded already are the ones worth pruning. The other
+// records of the tree, e.g. the orphans and the logs, are not counted.
+func (tree *BNBSparseMerkleTree) AnalyzeStorage(prefixDepth uint8) (*StorageBreakdown, error) {
+	if prefixDepth%4 != 0 || prefixDepth > tree.maxDepth {
+		return nil, ErrInvalidDepth
+	}
+	breakdown := &StorageBreakdown{PrefixDepth: prefixDepth}
+	if tree.db == nil {
+		return breakdown, nil
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return nil, err
+	}
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
+
+	versions := make(map[Version]*VersionUsage)
+	subtrees := make(map[uint64]*SubtreeUsage)
+	for depth := uint8(0); depth <= tree.maxDepth; depth += 4 {
+		it := tree.db.NewIterator(tree.nodeKeys.levelPrefix(depth), nil)
+		for it.Next() {
+			path, ok := tree.nodeKeys.leafPath(it.Key(), depth)
+			if !ok {
+				continue
+			}
+			node, err := decodeStorageTreeNode(it.Key(), it.Value())
+			if err != nil {
+				it.Release()
+				return nil, err
+			}
+			size := int64(len(it.Key()) + len(it.Value()))
+			breakdown.Nodes++
+			breakdown.Bytes += size
+
+			entries := 0
+			seen := make(map[Version]bool)
+			count := func(infos []*VersionInfo) {
+				for _, info := range infos {
+					usage, ok := versions[info.Ver]
+					if !ok {
+						usage = &VersionUsage{Version: info.Ver}
+						versions[info.Ver] = usage
+					}
+					if !seen[info.Ver] {
+						seen[info.Ver] = true
+						usage.Nodes++
+					}
+					usage.Entries++
+					usage.Bytes += int64(len(info.Hash) + 8)
+					entries++
+				}
+			}
+			count(node.Versions)
+			for _, child := range node.Children {
+				if child != nil {
+					count(child.Versions)
+				}
+			}
+
+			subtree := &breakdown.Top
+			if depth >= prefixDepth {
+				prefix := path >> (depth - prefixDepth)
+				if subtree, ok = subtrees[prefix]; !ok {
+					subtree = &SubtreeUsage{Prefix: prefix}
+					subtrees[prefix] = subtree
+				}
+			}
+			subtree.Nodes++
+			subtree.Entries += entries
+			subtree.Bytes += size
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, usage := range versions {
+		breakdown.Versions = append(breakdown.Versions, *usage)
+	}
+	sort.Slice(breakdown.Versions, func(i, j int) bool {
+		return breakdown.Versions[i].Version < breakdown.Versions[j].Version
+	})
+	for _, usage := range subtrees {
+		breakdown.Subtrees = append(breakdown.Subtrees, *usage)
+	}
+	sort.Slice(breakdown.Subtrees, func(i, j int) bool {
+		return breakdown.Subtrees[i].Prefix < breakdown.Subtrees[j].Prefix
+	})
+	return breakdown, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_AnalyzeStorage(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			defer tree.StopGC()
+			if err := smt.MultiSet([]Item{{Key: 1, Val: env.hasher.Hash([]byte("a"))}, {Key: 17, Val: env.hasher.Hash([]byte("b"))}}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := smt.Set(1, env.hasher.Hash([]byte("c"))); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			breakdown, err := tree.AnalyzeStorage(4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if breakdown.Nodes != 5 || breakdown.Bytes == 0 {
+				t.Fatalf("unexpected totals %d nodes, %d bytes", breakdown.Nodes, breakdown.Bytes)
+			}
+			// the version 2 rewrites the path of the key 1 only
+			if len(breakdown.Versions) != 2 ||
+				breakdown.Versions[0].Version != 1 || breakdown.Versions[0].Nodes != 5 || breakdown.Versions[0].Entries != 9 ||
+				breakdown.Versions[1].Version != 2 || breakdown.Versions[1].Nodes != 3 || breakdown.Versions[1].Entries != 5 {
+				t.Fatalf("unexpected versions %+v", breakdown.Versions)
+			}
+			if breakdown.Versions[1].Bytes != int64(5*(len(nilHash)+8)) {
+				t.Fatalf("unexpected bytes %d of version 2", breakdown.Versions[1].Bytes)
+			}
+			if len(breakdown.Subtrees) != 2 || breakdown.Subtrees[0].Prefix != 0 || breakdown.Subtrees[0].Nodes != 2 ||
+				breakdown.Subtrees[1].Prefix != 1 || breakdown.Subtrees[1].Nodes != 2 || breakdown.Top.Nodes != 1 {
+				t.Fatalf("unexpected subtrees %+v, top %+v", breakdown.Subtrees, breakdown.Top)
+			}
+			total := breakdown.Top.Bytes
+			for _, subtree := range breakdown.Subtrees {
+				total += subtree.Bytes
+			}
+			if total != breakdown.Bytes {
+				t.Fatalf("the subtrees sum up to %d bytes, expected %d", total, breakdown.Bytes)
+			}
+
+			if _, err := tree.AnalyzeStorage(6); err != ErrInvalidDepth {
+				t.Fatalf("expected ErrInvalidDepth, got %v", err)
+			}
+		})
+	}
+}
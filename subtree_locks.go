@@ -0,0 +1,49 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import "sync"
+
+// The children of the nodes are guarded by subtreeLockShards locks.
+const (
+	subtreeLockBits   = 8
+	subtreeLockShards = 1 << subtreeLockBits
+)
+
+// subtreeLocks is a sharded lock map guarding the children of the in-memory
+// nodes, so the reads faulting in nodes concurrently, such as Get and GetProof
+// serving many clients, only lock the parents they attach the nodes to. A read
+// of the nodes in memory takes the read locks of its path, the reads of
+// disjoint keys below the root never wait for each other.
+type subtreeLocks struct {
+	shards [subtreeLockShards]sync.RWMutex
+}
+
+// of returns the lock guarding the children of the node at the depth and path.
+func (l *subtreeLocks) of(depth uint8, path uint64) *sync.RWMutex {
+	h := (path ^ uint64(depth)<<56) * 0x9e3779b97f4a7c15
+	return &l.shards[h>>(64-subtreeLockBits)]
+}
+
+// child returns the child of the node at the nibble.
+func (tree *BNBSparseMerkleTree) child(node *TreeNode, nibble uint64) *TreeNode {
+	mu := tree.subtreeLocks.of(node.depth, node.path)
+	mu.RLock()
+	defer mu.RUnlock()
+	return node.Children[nibble]
+}
+
+// attachChild sets the child of the node at the nibble, unless another read
+// attached a loaded child already, and returns the child in place.
+func (tree *BNBSparseMerkleTree) attachChild(node *TreeNode, nibble uint64, child *TreeNode) *TreeNode {
+	mu := tree.subtreeLocks.of(node.depth, node.path)
+	mu.Lock()
+	defer mu.Unlock()
+	if current := node.Children[nibble]; current == nil || current.IsTemporary() {
+		node.Children[nibble] = child
+	}
+	return node.Children[nibble]
+}
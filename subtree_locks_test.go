@@ -0,0 +1,76 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func Test_BNBSparseMerkleTree_ConcurrentReads(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for key := uint64(0); key < 0x10000; key += 0x65 {
+		items = append(items, Item{Key: key, Val: env.hasher.Hash([]byte{byte(key >> 8), byte(key)})})
+	}
+	if _, err := smt.(*BNBSparseMerkleTree).BuildFrom(NewSliceLeafIterator(items)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the nodes are faulted in by the readers concurrently
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 16, nilHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := reopened.(*BNBSparseMerkleTree)
+	const readers = 8
+	errs := make(chan string, readers)
+	wg := sync.WaitGroup{}
+	for r := 0; r < readers; r++ {
+		r := r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := r; i < len(items); i += readers {
+				// the neighbours of other readers are proven as well
+				for _, item := range []Item{items[i], items[(i+1)%len(items)]} {
+					proof, err := reopened.GetProof(item.Key)
+					if err != nil || !reopened.VerifyProof(item.Key, proof) {
+						errs <- "invalid proof"
+						return
+					}
+					val, err := reopened.Get(item.Key, nil)
+					if err != nil || !bytes.Equal(val, item.Val) {
+						errs <- "invalid leaf"
+						return
+					}
+				}
+			}
+			if _, err := tree.GetMultiProof([]uint64{items[r].Key, items[len(items)-1-r].Key}); err != nil {
+				errs <- err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reopened.Root(), smt.Root()) {
+		t.Fatalf("root hash does not match, %x, %x", reopened.Root(), smt.Root())
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"context"
+	"time"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+	"github.com/bnb-chain/zkbnb-smt/tracing"
+)
+
+// noopSpan is the span of a tree without a tracer.
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+// startSpan starts a span of the tracer set by Tracing.
+func (tree *BNBSparseMerkleTree) startSpan(ctx context.Context, name string) (context.Context, tracing.Span) {
+	if tree.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tree.tracer.Start(ctx, name)
+}
+
+// endSpan records the error of a failed operation and ends its span.
+func endSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// tracedBatch traces each write of the batch, including the intermediate
+// writes of an auto flushing batch wrapping it.
+type tracedBatch struct {
+	database.Batcher
+	ctx  context.Context
+	tree *BNBSparseMerkleTree
+}
+
+func (b *tracedBatch) Write() error {
+	_, span := b.tree.startSpan(b.ctx, tracing.SpanBatchWrite)
+	span.SetAttribute(tracing.AttrBatchSize, b.Batcher.ValueSize())
+	err := b.Batcher.Write()
+	endSpan(span, err)
+	return err
+}
+
+// newBatch returns an auto flushing batch of the database, whose writes are
+// traced as children of the span of the context.
+func (tree *BNBSparseMerkleTree) newBatch(ctx context.Context) database.Batcher {
+	return database.NewAutoFlushBatch(tree.traceBatch(ctx, tree.db.NewBatch()), tree.batchSizeLimit)
+}
+
+// traceBatch traces the writes of the batch as children of the span of the context.
+func (tree *BNBSparseMerkleTree) traceBatch(ctx context.Context, batch database.Batcher) database.Batcher {
+	if tree.tracer != nil {
+		batch = &tracedBatch{Batcher: batch, ctx: ctx, tree: tree}
+	}
+	return batch
+}
+
+// CommitContext commits like Commit, tracing the commit as a child of the span
+// of the context, so a slow block is traced through the tree into the writes
+// of the database.
+func (tree *BNBSparseMerkleTree) CommitContext(ctx context.Context, recentVersion *Version) (Version, error) {
+	return tree.commitContext(ctx, recentVersion, nil)
+}
+
+func (tree *BNBSparseMerkleTree) commitContext(ctx context.Context, recentVersion *Version, newVersion *Version) (Version, error) {
+	ctx, span := tree.startSpan(ctx, tracing.SpanCommit)
+	span.SetAttribute(tracing.AttrNodes, tree.journal.len())
+	start := time.Now()
+	version, err := tree.commitWithNewVersion(ctx, recentVersion, newVersion)
+	tree.logSlow("commit", start, logger.F("version", version))
+	span.SetAttribute(tracing.AttrVersion, uint64(version))
+	endSpan(span, err)
+	return version, err
+}
+
+// RollbackContext rolls back like Rollback, tracing the rollback as a child of
+// the span of the context.
+func (tree *BNBSparseMerkleTree) RollbackContext(ctx context.Context, version Version) error {
+	ctx, span := tree.startSpan(ctx, tracing.SpanRollback)
+	span.SetAttribute(tracing.AttrVersion, uint64(version))
+	start := time.Now()
+	err := tree.rollbackTo(ctx, version)
+	tree.logSlow("rollback", start, logger.F("version", version))
+	endSpan(span, err)
+	return err
+}
+
+// GetProofContext returns the proof like GetProof, tracing it as a child of the
+// span of the context.
+func (tree *BNBSparseMerkleTree) GetProofContext(ctx context.Context, key uint64) (Proof, error) {
+	_, span := tree.startSpan(ctx, tracing.SpanGetProof)
+	span.SetAttribute(tracing.AttrKey, key)
+	start := time.Now()
+	proof, err := tree.getProofOf(key)
+	tree.logSlow("proof", start, logger.F("key", key))
+	endSpan(span, err)
+	return proof, err
+}
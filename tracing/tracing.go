@@ -0,0 +1,42 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+// Package tracing defines the tracer the tree reports its spans to. The tree
+// keeps no dependency on a tracing library, a backend such as OpenTelemetry is
+// plugged in by a small adapter of its tracer and spans.
+package tracing
+
+import "context"
+
+// Spans started by the tree
+const (
+	SpanCommit     = "smt.Commit"
+	SpanRollback   = "smt.Rollback"
+	SpanGetProof   = "smt.GetProof"
+	SpanBatchWrite = "smt.BatchWrite"
+)
+
+// Span attributes set by the tree
+const (
+	AttrVersion   = "smt.version"
+	AttrKey       = "smt.key"
+	AttrNodes     = "smt.nodes"
+	AttrBatchSize = "smt.batch_size"
+)
+
+type Tracer interface {
+	// Start starts a span as a child of the span of the context, and returns
+	// a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	// SetAttribute sets an attribute of the span.
+	SetAttribute(key string, value interface{})
+	// RecordError records the error the span failed with.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/bnb-chain/zkbnb-smt/tracing"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name, parent string
+	attributes   map[string]interface{}
+	err          error
+	ended        bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *recordedSpan) RecordError(err error)                      { s.err = err }
+func (s *recordedSpan) End()                                       { s.ended = true }
+
+// recordingTracer records the started spans and their parents.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+	span := &recordedSpan{name: name, attributes: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(string); ok {
+		span.parent = parent
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, name), span
+}
+
+func (t *recordingTracer) reset() []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := t.spans
+	t.spans = nil
+	return spans
+}
+
+func Test_BNBSparseMerkleTree_Tracing(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tracer := &recordingTracer{}
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, Tracing(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := smt.(*BNBSparseMerkleTree)
+	items := prepareKVData(env.hasher)
+	if err := smt.MultiSet(items); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), spanKey{}, "block")
+	if _, err := tree.CommitContext(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	spans := tracer.reset()
+	if len(spans) < 2 || spans[0].name != tracing.SpanCommit || spans[0].parent != "block" {
+		t.Fatalf("expected a commit span below the block, got %+v", spans)
+	}
+	if spans[0].attributes[tracing.AttrVersion] != uint64(1) || !spans[0].ended {
+		t.Fatalf("unexpected commit span %+v", spans[0])
+	}
+	for _, span := range spans[1:] {
+		if span.name != tracing.SpanBatchWrite || span.parent != tracing.SpanCommit || !span.ended {
+			t.Fatalf("expected the batch writes below the commit, got %+v", span)
+		}
+	}
+
+	if _, err := smt.GetProof(items[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.GetProof(1 << 8); err == nil {
+		t.Fatal("expected an invalid key")
+	}
+	spans = tracer.reset()
+	if len(spans) != 2 || spans[0].name != tracing.SpanGetProof || spans[0].err != nil || spans[1].err != ErrInvalidKey {
+		t.Fatalf("unexpected proof spans %+v", spans)
+	}
+
+	if err := smt.Set(items[0].Key, env.hasher.Hash([]byte("next"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	tracer.reset()
+	if err := tree.RollbackContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	spans = tracer.reset()
+	if len(spans) < 2 || spans[0].name != tracing.SpanRollback || spans[0].parent != "block" ||
+		spans[1].name != tracing.SpanBatchWrite || spans[1].parent != tracing.SpanRollback {
+		t.Fatalf("unexpected rollback spans %+v", spans)
+	}
+}
@@ -6,53 +6,139 @@
 package bsmt
 
 import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
 	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/bnb-chain/zkbnb-smt/utils"
 )
 
 const (
-	hashSize    = 32
-	versionSize = 40
+	hashSize     = 32
+	versionSize  = 40
+	checksumSize = 4
+	// packedHashSize is the size of a stored internal hash with its slice header
+	packedHashSize = hashSize + 24
 )
 
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
 func NewTreeNode(depth uint8, path uint64, nilHashes *nilHashes, hasher *Hasher) *TreeNode {
-	treeNode := &TreeNode{
-		nilHash:      nilHashes.Get(depth),
-		nilChildHash: nilHashes.Get(depth + 4),
-		path:         path,
-		depth:        depth,
-		hasher:       hasher,
-		internalMu:   make([]sync.RWMutex, 14),
-		internalVer:  make([]Version, 14),
-	}
-	for i := 0; i < 2; i++ {
-		treeNode.Internals[i] = nilHashes.Get(depth + 1)
-	}
-	for i := 2; i < 6; i++ {
-		treeNode.Internals[i] = nilHashes.Get(depth + 2)
-	}
-	for i := 6; i < 14; i++ {
-		treeNode.Internals[i] = nilHashes.Get(depth + 3)
+	return &TreeNode{
+		nilHashes: nilHashes,
+		path:      path,
+		depth:     depth,
+		hasher:    hasher,
 	}
+}
 
-	return treeNode
+// internalLevel returns the level of the internal hash idx within the node.
+func internalLevel(idx int) uint8 {
+	switch {
+	case idx < 2:
+		return 1
+	case idx < 6:
+		return 2
+	default:
+		return 3
+	}
 }
 
 type InternalNode []byte
 
+// packedInternals holds the internal hashes of a node which differ from the
+// nil hashes of their level, in the order of their index: bit i of the bitmap
+// is set if the hash i is stored. The other hashes are the shared nil hashes, so
+// a node with a few children only keeps the hashes on the paths to them.
+// The hashes are never modified in place, the copies of a node share them.
+type packedInternals struct {
+	bitmap uint16
+	hashes []InternalNode
+}
+
+// internalState holds the locks, versions and hashes of the internal hashes of
+// a node recomputed concurrently. The hashes are packed back once recomputed.
+type internalState struct {
+	mu   [14]sync.RWMutex
+	ver  [14]Version
+	hash [14]InternalNode
+}
+
 type TreeNode struct {
-	mu        sync.RWMutex
-	Children  [16]*TreeNode
-	Internals [14]InternalNode
-	Versions  []*VersionInfo
+	mu       sync.RWMutex
+	Children [16]*TreeNode
+	Versions []*VersionInfo
+
+	nilHashes *nilHashes
+	path      uint64
+	depth     uint8
+	hasher    *Hasher
+	temporary bool
+	packed    packedInternals
+	// pinned is set on the nodes on the paths of the keys pinned by PinKeys,
+	// which are never released from memory
+	pinned bool
+	// internals is shared by the copies of the node, it is only allocated
+	// once the node is recomputed concurrently by MultiSet.
+	internals *internalState
+}
+
+// Internals returns the 14 internal hashes of the 4 levels below the node,
+// level by level from the top.
+func (node *TreeNode) Internals() [14]InternalNode {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	return node.internalHashes()
+}
+
+// internal returns the internal hash idx, the caller must hold the lock of the
+// node or own it.
+func (node *TreeNode) internal(idx int) InternalNode {
+	bit := uint16(1) << idx
+	if node.packed.bitmap&bit == 0 {
+		return node.nilHashes.Get(node.depth + internalLevel(idx))
+	}
+	return node.packed.hashes[bits.OnesCount16(node.packed.bitmap&(bit-1))]
+}
 
-	nilHash      []byte
-	nilChildHash []byte
-	path         uint64
-	depth        uint8
-	hasher       *Hasher
-	temporary    bool
-	internalMu   []sync.RWMutex
-	internalVer  []Version
+// internalHashes unpacks the internal hashes of the node.
+func (node *TreeNode) internalHashes() [14]InternalNode {
+	var hashes [14]InternalNode
+	for i := range hashes {
+		hashes[i] = node.internal(i)
+	}
+	return hashes
+}
+
+// setInternals packs the internal hashes of the node, the nil hashes are not stored.
+func (node *TreeNode) setInternals(hashes *[14]InternalNode) {
+	var packed packedInternals
+	for i, hash := range hashes {
+		if hash != nil && !bytes.Equal(hash, node.nilHashes.Get(node.depth+internalLevel(i))) {
+			packed.bitmap |= 1 << i
+		}
+	}
+	if packed.bitmap != 0 {
+		packed.hashes = make([]InternalNode, 0, bits.OnesCount16(packed.bitmap))
+		for i, hash := range hashes {
+			if packed.bitmap&(1<<i) != 0 {
+				packed.hashes = append(packed.hashes, hash)
+			}
+		}
+	}
+	node.packed = packed
+}
+
+func (node *TreeNode) nilHash() []byte {
+	return node.nilHashes.Get(node.depth)
+}
+
+func (node *TreeNode) nilChildHash() []byte {
+	return node.nilHashes.Get(node.depth + 4)
 }
 
 // Root Get latest hash of a node
@@ -61,7 +147,7 @@ func (node *TreeNode) Root() []byte {
 	defer node.mu.RUnlock()
 
 	if len(node.Versions) == 0 {
-		return node.nilHash
+		return node.nilHash()
 	}
 	return node.Versions[len(node.Versions)-1].Hash
 }
@@ -69,7 +155,7 @@ func (node *TreeNode) Root() []byte {
 // Root Get latest hash of a node without a lock
 func (node *TreeNode) root() []byte {
 	if len(node.Versions) == 0 {
-		return node.nilHash
+		return node.nilHash()
 	}
 	return node.Versions[len(node.Versions)-1].Hash
 }
@@ -99,7 +185,7 @@ func (node *TreeNode) SetChildren(child *TreeNode, nibble int, version Version)
 
 	node.Children[nibble] = child
 
-	left, right := node.nilChildHash, node.nilChildHash
+	left, right := node.nilChildHash(), node.nilChildHash()
 	switch nibble % 2 {
 	case 0:
 		if node.Children[nibble] != nil {
@@ -116,24 +202,26 @@ func (node *TreeNode) SetChildren(child *TreeNode, nibble int, version Version)
 			left = node.Children[nibble^1].Root()
 		}
 	}
+	hashes := node.internalHashes()
 	prefix := 6
 	for i := 4; i >= 1; i >>= 1 {
 		nibble = nibble / 2
-		node.Internals[prefix+nibble] = node.hasher.Hash(left, right)
+		hashes[prefix+nibble] = node.hasher.Hash(left, right)
 		switch nibble % 2 {
 		case 0:
-			left = node.Internals[prefix+nibble]
-			right = node.Internals[prefix+nibble^1]
+			left = hashes[prefix+nibble]
+			right = hashes[prefix+nibble^1]
 		case 1:
-			right = node.Internals[prefix+nibble]
-			left = node.Internals[prefix+nibble^1]
+			right = hashes[prefix+nibble]
+			left = hashes[prefix+nibble^1]
 		}
 		prefix = prefix - i
 	}
+	node.setInternals(&hashes)
 	// update current root node
 	node.newVersion(&VersionInfo{
 		Ver:  version,
-		Hash: node.hasher.Hash(node.Internals[0], node.Internals[1]),
+		Hash: node.hasher.Hash(hashes[0], hashes[1]),
 	})
 }
 
@@ -142,21 +230,23 @@ func (node *TreeNode) ComputeInternalHash() {
 	node.mu.Lock()
 	defer node.mu.Unlock()
 
+	var hashes [14]InternalNode
 	// leaf node
 	for i := 0; i < 15; i += 2 {
-		left, right := node.nilChildHash, node.nilChildHash
+		left, right := node.nilChildHash(), node.nilChildHash()
 		if node.Children[i] != nil {
 			left = node.Children[i].Root()
 		}
 		if node.Children[i+1] != nil {
 			right = node.Children[i+1].Root()
 		}
-		node.Internals[6+i/2] = node.hasher.Hash(left, right)
+		hashes[6+i/2] = node.hasher.Hash(left, right)
 	}
 	// internal node
 	for i := 13; i > 1; i -= 2 {
-		node.Internals[i/2-1] = node.hasher.Hash(node.Internals[i-1], node.Internals[i])
+		hashes[i/2-1] = node.hasher.Hash(hashes[i-1], hashes[i])
 	}
+	node.setInternals(&hashes)
 }
 
 func (node *TreeNode) Copy() *TreeNode {
@@ -164,50 +254,104 @@ func (node *TreeNode) Copy() *TreeNode {
 	defer node.mu.RUnlock()
 
 	return &TreeNode{
-		Children:     node.Children,
-		Internals:    node.Internals,
-		Versions:     node.Versions,
-		nilHash:      node.nilHash,
-		nilChildHash: node.nilChildHash,
-		path:         node.path,
-		depth:        node.depth,
-		hasher:       node.hasher,
-		temporary:    node.temporary,
-		internalMu:   node.internalMu,
-		internalVer:  node.internalVer,
+		Children:  node.Children,
+		Versions:  node.Versions,
+		nilHashes: node.nilHashes,
+		path:      node.path,
+		depth:     node.depth,
+		hasher:    node.hasher,
+		temporary: node.temporary,
+		packed:    node.packed,
+		pinned:    node.pinned,
+		internals: node.internals,
 	}
 }
 
 func (node *TreeNode) mark(nibble int) {
-	//node.mu.Lock()
-	//defer node.mu.Unlock()
 	for _, i := range leafInternalMap[nibble] {
-		node.Internals[i] = nil
+		node.internals.mu[i].Lock()
+		node.internals.hash[i] = nil
+		node.internals.mu[i].Unlock()
+	}
+}
+
+// beginRecompute unpacks the internal hashes of a node for the concurrent recompute.
+func (node *TreeNode) beginRecompute() {
+	node.internals = new(internalState)
+	node.internals.hash = node.internalHashes()
+}
+
+// endRecompute packs the internal hashes recomputed concurrently.
+func (node *TreeNode) endRecompute() {
+	if node.internals == nil {
+		return
 	}
+	node.setInternals(&node.internals.hash)
+	node.internals = nil
 }
 
 func (node *TreeNode) Prune(oldestVersion Version) uint64 {
+	return node.prune(oldestVersion, nil)
+}
+
+// prune removes the versions older than oldestVersion except the pinned ones.
+func (node *TreeNode) prune(oldestVersion Version, pinned []Version) uint64 {
 	node.mu.Lock()
 	defer node.mu.Unlock()
 
-	if len(node.Versions) <= 1 {
-		return 0
+	originSize := len(node.Versions) * versionSize
+	node.Versions = pruneVersions(node.Versions, oldestVersion, pinned)
+	return uint64(originSize - len(node.Versions)*versionSize)
+}
+
+// trimLoaded prunes the versions older than oldestVersion, except the pinned
+// ones, from the node and its in-memory descendants.
+func (node *TreeNode) trimLoaded(oldestVersion Version, pinned []Version) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	node.Versions = pruneVersions(node.Versions, oldestVersion, pinned)
+	for _, child := range node.Children {
+		if child != nil {
+			child.trimLoaded(oldestVersion, pinned)
+		}
+	}
+}
+
+// pruneVersions removes the versions older than oldestVersion, keeping the
+// latest of them if oldestVersion itself is missing, so the state of
+// oldestVersion stays available. The states of the pinned versions are kept as well.
+func pruneVersions(versions []*VersionInfo, oldestVersion Version, pinned []Version) []*VersionInfo {
+	if len(versions) <= 1 {
+		return versions
 	}
 	i := 0
-	for ; i < len(node.Versions)-1; i++ {
-		if node.Versions[i].Ver >= oldestVersion {
+	for ; i < len(versions)-1; i++ {
+		if versions[i].Ver >= oldestVersion {
 			break
 		}
 	}
-
-	originSize := len(node.Versions) * versionSize
-	if i > 0 && node.Versions[i].Ver > oldestVersion {
-		node.Versions = node.Versions[i-1:]
-		return uint64(originSize - len(node.Versions)*versionSize)
+	if i > 0 && versions[i].Ver > oldestVersion {
+		i--
+	}
+	if i == 0 || len(pinned) == 0 {
+		return versions[i:]
 	}
 
-	node.Versions = node.Versions[i:]
-	return uint64(originSize - len(node.Versions)*versionSize)
+	var kept []*VersionInfo
+	for j := 0; j < i; j++ {
+		for _, pin := range pinned {
+			// the state of the pinned version is the latest version up to it
+			if versions[j].Ver <= pin && pin < versions[j+1].Ver {
+				kept = append(kept, versions[j])
+				break
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return versions[i:]
+	}
+	return append(kept, versions[i:]...)
 }
 
 func (node *TreeNode) Rollback(targetVersion Version) (bool, uint64) {
@@ -233,9 +377,7 @@ func (node *TreeNode) Rollback(targetVersion Version) (bool, uint64) {
 // The node has not been updated for a long time,
 // the subtree is emptied, and needs to be re-read from the database when it needs to be modified.
 func (node *TreeNode) archive() {
-	for i := 0; i < len(node.Internals); i++ {
-		node.Internals[i] = nil
-	}
+	node.packed = packedInternals{}
 	for i := 0; i < len(node.Children); i++ {
 		node.Children[i] = nil
 	}
@@ -258,29 +400,65 @@ func (node *TreeNode) Size() uint64 {
 	if node.temporary {
 		return uint64(len(node.Versions) * versionSize)
 	}
-	return uint64(len(node.Versions)*versionSize + hashSize*len(node.Internals))
+	return uint64(len(node.Versions)*versionSize + packedHashSize*len(node.packed.hashes))
 }
 
 // Release nodes that have not been updated for a long time from memory.
 // slowing down memory usage in runtime.
 func (node *TreeNode) Release(oldestVersion Version) uint64 {
+	size, _ := node.release(oldestVersion, nil)
+	return size
+}
+
+// release returns the remaining size of the subtree and the number of released nodes.
+// The released nodes are appended to cold unless it is nil.
+func (node *TreeNode) release(oldestVersion Version, cold *[]journalKey) (uint64, int) {
 	node.mu.Lock()
 	defer node.mu.Unlock()
 
-	size := node.Size()
+	size, released := node.Size(), 0
 	for i := 0; i < len(node.Children); i++ {
-		if node.Children[i] != nil {
-			length := len(node.Children[i].Versions)
-			if length > 0 && node.Children[i].Versions[length-1].Ver < oldestVersion {
-				// check for the latest version and release it if it is older than the pruned version
-				node.Children[i].archive()
-				size += node.Children[i].Size()
-			} else {
-				size += node.Children[i].Release(oldestVersion)
-			}
+		childSize, childReleased := node.releaseChild(i, oldestVersion, cold)
+		size += childSize
+		released += childReleased
+	}
+	return size, released
+}
+
+// releaseChild releases the subtree of the i-th child and returns its remaining size
+// and the number of released nodes, the caller must hold the lock of the node.
+func (node *TreeNode) releaseChild(i int, oldestVersion Version, cold *[]journalKey) (uint64, int) {
+	child := node.Children[i]
+	if child == nil {
+		return 0, 0
+	}
+	length := len(child.Versions)
+	if length > 0 && child.Versions[length-1].Ver < oldestVersion && !child.pinned {
+		// check for the latest version and release it if it is older than the pruned version
+		if child.temporary {
+			return child.Size(), 0
+		}
+		if cold != nil {
+			child.collect(cold)
+		}
+		child.archive()
+		return child.Size(), 1
+	}
+	return child.release(oldestVersion, cold)
+}
+
+// collect appends the nodes of the in-memory subtree, none of which is updated
+// later than the node itself.
+func (node *TreeNode) collect(keys *[]journalKey) {
+	*keys = append(*keys, journalKey{node.depth, node.path})
+	if node.temporary {
+		return
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			child.collect(keys)
 		}
 	}
-	return size
 }
 
 // The nodes without child data.
@@ -301,7 +479,7 @@ func (node *TreeNode) ToStorageTreeNode() *StorageTreeNode {
 	}
 	return &StorageTreeNode{
 		Children:  children,
-		Internals: node.Internals,
+		Internals: node.internalHashes(),
 		Versions:  node.Versions,
 		Path:      node.path,
 	}
@@ -323,28 +501,63 @@ type StorageTreeNode struct {
 	Path      uint64               `rlp:"optional"`
 }
 
+// encodeStorageTreeNode encodes the node as RLP followed by the CRC-32C checksum of the encoding.
+func encodeStorageTreeNode(node *StorageTreeNode) ([]byte, error) {
+	rb := recordBufferPool.Get().(*recordBuffer)
+	defer func() {
+		rb.buf.Reset()
+		recordBufferPool.Put(rb)
+	}()
+	if err := rlp.Encode(&rb.buf, node); err != nil {
+		return nil, err
+	}
+	return appendChecksum(rb.buf.Bytes()), nil
+}
+
+// decodeStorageTreeNode verifies the checksum of the record stored under key and decodes the node.
+// Records written before the checksums were introduced hold the RLP encoding only.
+func decodeStorageTreeNode(key, data []byte) (*StorageTreeNode, error) {
+	_, _, rest, err := rlp.Split(data)
+	if err != nil {
+		return nil, &CorruptedNodeError{Key: utils.CopyBytes(key)}
+	}
+	payload := data[:len(data)-len(rest)]
+	switch len(rest) {
+	case 0:
+	case checksumSize:
+		if binary.BigEndian.Uint32(rest) != crc32.Checksum(payload, crc32Table) {
+			return nil, &CorruptedNodeError{Key: utils.CopyBytes(key)}
+		}
+	default:
+		return nil, &CorruptedNodeError{Key: utils.CopyBytes(key)}
+	}
+
+	node := &StorageTreeNode{}
+	if err := rlp.DecodeBytes(payload, node); err != nil {
+		return nil, &CorruptedNodeError{Key: utils.CopyBytes(key)}
+	}
+	return node, nil
+}
+
 func (node *StorageTreeNode) ToTreeNode(depth uint8, nilHashes *nilHashes, hasher *Hasher) *TreeNode {
 	treeNode := &TreeNode{
-		Internals:    node.Internals,
-		Versions:     node.Versions,
-		nilHash:      nilHashes.Get(depth),
-		nilChildHash: nilHashes.Get(depth + 4),
-		path:         node.Path,
-		depth:        depth,
-		hasher:       hasher,
-		internalMu:   make([]sync.RWMutex, 14),
-		internalVer:  make([]Version, 14),
+		Versions:  node.Versions,
+		nilHashes: nilHashes,
+		path:      node.Path,
+		depth:     depth,
+		hasher:    hasher,
 	}
+	// the nil hashes are shared instead of keeping a decoded copy of each
+	treeNode.setInternals(&node.Internals)
 	for i := 0; i < 16; i++ {
 		if node.Children[i] != nil && len(node.Children[i].Versions) > 0 {
 			treeNode.Children[i] = &TreeNode{
-				Versions:     node.Children[i].Versions,
-				nilHash:      nilHashes.Get(depth + 4),
-				nilChildHash: nilHashes.Get(depth + 8),
-				hasher:       hasher,
-				temporary:    true,
-				depth:        depth + 4,
-				path:         treeNode.path<<4 + uint64(i),
+				Versions:  node.Children[i].Versions,
+				nilHashes: nilHashes,
+				hasher:    hasher,
+				temporary: true,
+				depth:     depth + 4,
+				path:      treeNode.path<<4 + uint64(i),
 			}
 		}
 	}
@@ -371,7 +584,7 @@ func (node *TreeNode) latestVersionWithLock() Version {
 // recompute inner node
 func (node *TreeNode) recompute(child *TreeNode, journals *journal, version Version) bool {
 	nibble := int(child.path & 0xf)
-	left, right := node.nilChildHash, node.nilChildHash
+	left, right := node.nilChildHash(), node.nilChildHash()
 	// if sibling haven't finished yet,quit; sibling will be charge for computing
 	switch nibble % 2 {
 	case 0:
@@ -417,30 +630,30 @@ func (node *TreeNode) recompute(child *TreeNode, journals *journal, version Vers
 		}
 		prefix = prefix - i
 	}
-	// update current root
-	node.newVersion(&VersionInfo{
-		Ver:  version,
-		Hash: node.hasher.Hash(node.Internals[0], node.Internals[1]),
-	})
+	// update current root, the siblings read the version under the lock
+	hash := node.hasher.Hash(node.getInternal(0), node.getInternal(1))
+	node.mu.Lock()
+	node.newVersion(&VersionInfo{Ver: version, Hash: hash})
+	node.mu.Unlock()
 	return true
 }
 
 func (node *TreeNode) setInternal(idx int, left []byte, right []byte, version Version) ([]byte, bool) {
-	node.internalMu[idx].Lock()
-	defer node.internalMu[idx].Unlock()
-	if node.Internals[idx] != nil {
-		return node.Internals[idx], true
+	node.internals.mu[idx].Lock()
+	defer node.internals.mu[idx].Unlock()
+	if node.internals.hash[idx] != nil {
+		return node.internals.hash[idx], true
 	}
 	hash := node.hasher.Hash(left, right)
-	node.Internals[idx] = hash
-	node.internalVer[idx] = version
+	node.internals.hash[idx] = hash
+	node.internals.ver[idx] = version
 	return hash, false
 }
 
 func (node *TreeNode) getInternal(idx int) []byte {
-	node.internalMu[idx].RLock()
-	defer node.internalMu[idx].RUnlock()
-	return node.Internals[idx]
+	node.internals.mu[idx].RLock()
+	defer node.internals.mu[idx].RUnlock()
+	return node.internals.hash[idx]
 }
 
 func (node *TreeNode) getChild(nibble int) *TreeNode {
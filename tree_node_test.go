@@ -10,6 +10,8 @@ import (
 	"crypto/sha256"
 	"hash"
 	"testing"
+
+	"github.com/pkg/errors"
 )
 
 func TestTreeNode_Copy(t *testing.T) {
@@ -29,7 +31,7 @@ func TestTreeNode_Copy(t *testing.T) {
 		copied.SetChildren(NewTreeNode(4, uint64(i), nilHashes, hasher), i, 0)
 	}
 	copied.ComputeInternalHash()
-	copied.Set(hasher.Hash(copied.Internals[0], copied.Internals[1]), 0)
+	copied.Set(hasher.Hash(copied.internal(0), copied.internal(1)), 0)
 
 	if bytes.Equal(node.Root(), copied.Root()) {
 		t.Fatal("root should not be equal")
@@ -55,9 +57,111 @@ func TestTreeNode_Copy(t *testing.T) {
 		}
 	}
 
-	for i := 0; i < len(node.Internals); i++ {
-		if bytes.Equal(node.Internals[i], copied.Internals[i]) {
+	internals, copiedInternals := node.Internals(), copied.Internals()
+	for i := 0; i < len(internals); i++ {
+		if bytes.Equal(internals[i], copiedInternals[i]) {
 			t.Fatalf("internal %d of node should be equal to copied node", i)
 		}
 	}
 }
+
+func TestStorageTreeNode_Checksum(t *testing.T) {
+	hasher := NewHasherPool(func() hash.Hash { return sha256.New() })
+	nilHashes := constructNilHashes(8, nilHash, hasher)
+	node := NewTreeNode(4, 1, nilHashes, hasher)
+	node.Set(hasher.Hash([]byte("val")), 1)
+
+	key := storageFullTreeNodeKey(4, 1)
+	data, err := encodeStorageTreeNode(node.ToStorageTreeNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeStorageTreeNode(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Path != 1 || len(decoded.Versions) != 1 {
+		t.Fatal("decoded node should be equal to the encoded one")
+	}
+
+	// records without checksum are still readable
+	if _, err := decodeStorageTreeNode(key, data[:len(data)-checksumSize]); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)/2] ^= 0x01
+	_, err = decodeStorageTreeNode(key, corrupted)
+	if !errors.Is(err, ErrCorruptedNode) {
+		t.Fatalf("corrupted record should be detected, got %v", err)
+	}
+	var corruptedErr *CorruptedNodeError
+	if !errors.As(err, &corruptedErr) || !bytes.Equal(corruptedErr.Key, key) {
+		t.Fatal("the error should carry the key of the corrupted node")
+	}
+}
+
+func TestTreeNode_SparseInternals(t *testing.T) {
+	hasher := NewHasherPool(func() hash.Hash { return sha256.New() })
+	nilHashes := constructNilHashes(8, nilHash, hasher)
+	child := NewTreeNode(4, 5, nilHashes, hasher)
+	child.Set(hasher.Hash([]byte("val")), 1)
+	node := NewTreeNode(0, 0, nilHashes, hasher)
+	node.SetChildren(child, 5, 1)
+
+	// only the hashes on the path to the child are stored
+	if len(node.packed.hashes) != 3 || node.Size() != versionSize+3*packedHashSize {
+		t.Fatalf("expected 3 stored hashes, got %d of size %d", len(node.packed.hashes), node.Size())
+	}
+	dense := node.Copy()
+	dense.ComputeInternalHash()
+	internals, denseInternals := node.Internals(), dense.Internals()
+	for i := range internals {
+		if !bytes.Equal(internals[i], denseInternals[i]) {
+			t.Fatalf("internal %d should be equal to the recomputed one", i)
+		}
+	}
+	if !bytes.Equal(internals[13], nilHashes.Get(3)) {
+		t.Fatal("the internals without children should be the nil hashes")
+	}
+
+	data, err := encodeTreeNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeStorageTreeNode(storageFullTreeNodeKey(0, 0), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := decoded.ToTreeNode(0, nilHashes, hasher)
+	if loaded.packed.bitmap != node.packed.bitmap {
+		t.Fatal("the loaded node should store the same hashes")
+	}
+	for i, internal := range loaded.Internals() {
+		if !bytes.Equal(internal, internals[i]) {
+			t.Fatalf("internal %d of the loaded node should be equal", i)
+		}
+	}
+}
+
+// BenchmarkTreeNode_SparseMemory reports the memory allocated per node loaded
+// from a record with a single child.
+func BenchmarkTreeNode_SparseMemory(b *testing.B) {
+	hasher := NewHasherPool(func() hash.Hash { return sha256.New() })
+	nilHashes := constructNilHashes(8, nilHash, hasher)
+	child := NewTreeNode(4, 5, nilHashes, hasher)
+	child.Set(hasher.Hash([]byte("val")), 1)
+	node := NewTreeNode(0, 0, nilHashes, hasher)
+	node.SetChildren(child, 5, 1)
+	stored := node.ToStorageTreeNode()
+	for i := range stored.Internals {
+		// the decoded hashes are not shared with the nil hashes
+		stored.Internals[i] = append(InternalNode(nil), stored.Internals[i]...)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stored.ToTreeNode(0, nilHashes, hasher)
+	}
+}
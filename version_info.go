@@ -0,0 +1,139 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// versionInfoPrefix is the prefix of the summary records of the versions,
+// format: versionInfo:${version}
+var versionInfoPrefix = []byte(`versionInfo:`)
+
+func versionInfoKey(version Version) []byte {
+	return append(append([]byte(nil), versionInfoPrefix...), encodeVersion(version)...)
+}
+
+// versionInfo is the stored summary of a committed version.
+type versionInfo struct {
+	ChangedKeys uint64
+	Metadata    []byte
+}
+
+// versionMetadata holds the metadata of the pending version.
+type versionMetadata struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// VersionSummary describes a retained version, for browsing the history of the tree.
+type VersionSummary struct {
+	Version Version
+	Root    []byte
+	// Time is the time the version was committed, zero for the versions
+	// committed before the commit times were recorded.
+	Time time.Time
+	// ChangedKeys is the number of the leaves written by the version.
+	ChangedKeys uint64
+	// Metadata is the metadata set by SetVersionMetadata for the version.
+	Metadata []byte
+	// Recorded is false for the versions committed before the changed keys and
+	// the metadata were recorded, both are unknown then.
+	Recorded bool
+}
+
+// SetVersionMetadata sets the metadata recorded with the next committed
+// version, e.g. the number and the hash of the block it belongs to. The
+// metadata is dropped once the version is committed or the pending changes
+// are reset.
+func (tree *BNBSparseMerkleTree) SetVersionMetadata(metadata []byte) {
+	tree.versionMetadata.mu.Lock()
+	tree.versionMetadata.data = append([]byte(nil), metadata...)
+	tree.versionMetadata.mu.Unlock()
+}
+
+// pendingMetadata returns the metadata of the pending version.
+func (tree *BNBSparseMerkleTree) pendingMetadata() []byte {
+	tree.versionMetadata.mu.Lock()
+	defer tree.versionMetadata.mu.Unlock()
+	return tree.versionMetadata.data
+}
+
+// discardMetadata drops the metadata of the pending version, once it is committed or discarded.
+func (tree *BNBSparseMerkleTree) discardMetadata() {
+	tree.versionMetadata.mu.Lock()
+	tree.versionMetadata.data = nil
+	tree.versionMetadata.mu.Unlock()
+}
+
+// writeVersionInfo writes the summary record of the version.
+func writeVersionInfo(batch database.Batcher, version Version, info *versionInfo) error {
+	data, err := rlp.EncodeToBytes(info)
+	if err != nil {
+		return err
+	}
+	return batch.Set(versionInfoKey(version), data)
+}
+
+// VersionHistory returns the summaries of the retained versions in [from, to],
+// in ascending order, with their roots, commit times, numbers of changed keys
+// and metadata, to power a state history page of an explorer.
+func (tree *BNBSparseMerkleTree) VersionHistory(from, to Version) ([]*VersionSummary, error) {
+	if from > to {
+		return nil, ErrInvalidVersionRange
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return nil, err
+	}
+	var summaries []*VersionSummary
+	for _, version := range tree.Versions() {
+		if version < from || version > to {
+			continue
+		}
+		root, err := tree.RootAt(version)
+		if err != nil {
+			// the versions the root keeps beneath the recent version are not readable
+			continue
+		}
+		summaries = append(summaries, &VersionSummary{Version: version, Root: root})
+	}
+	if len(summaries) == 0 || tree.db == nil {
+		return summaries, nil
+	}
+
+	keys := make([][]byte, 0, 2*len(summaries))
+	for _, summary := range summaries {
+		keys = append(keys, versionTimeKey(summary.Version), versionInfoKey(summary.Version))
+	}
+	values, err := tree.db.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, summary := range summaries {
+		if buf := values[2*i]; len(buf) > 0 {
+			if summary.Time, err = decodeVersionTime(buf); err != nil {
+				return nil, err
+			}
+		}
+		if buf := values[2*i+1]; len(buf) > 0 {
+			var info versionInfo
+			if err := rlp.DecodeBytes(buf, &info); err != nil {
+				return nil, errors.Wrapf(err, "version %d", summary.Version)
+			}
+			summary.ChangedKeys, summary.Recorded = info.ChangedKeys, true
+			if len(info.Metadata) > 0 {
+				summary.Metadata = info.Metadata
+			}
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_BNBSparseMerkleTree_VersionHistory(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := smt.(*BNBSparseMerkleTree)
+			defer tree.StopGC()
+			items := prepareKVData(env.hasher)
+			start := time.Now()
+			if _, err := tree.BuildFrom(NewSliceLeafIterator(items[:5])); err != nil {
+				t.Fatal(err)
+			}
+
+			// the metadata of the pending changes reset is dropped
+			tree.SetVersionMetadata([]byte("dropped"))
+			tree.Reset()
+			tree.SetVersionMetadata([]byte("block 2"))
+			if err := smt.MultiSet(items[5:8]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := smt.Set(items[0].Key, items[9].Val); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := smt.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			history, err := tree.VersionHistory(0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 3 {
+				t.Fatalf("expected 3 versions, got %d", len(history))
+			}
+			for i, expected := range []struct {
+				changed  uint64
+				metadata []byte
+			}{{5, nil}, {3, []byte("block 2")}, {1, nil}} {
+				summary := history[i]
+				root, err := tree.RootAt(Version(i + 1))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if summary.Version != Version(i+1) || !bytes.Equal(summary.Root, root) || !summary.Recorded ||
+					summary.ChangedKeys != expected.changed || !bytes.Equal(summary.Metadata, expected.metadata) {
+					t.Fatalf("unexpected summary %+v", summary)
+				}
+				if summary.Time.Before(start.Add(-time.Second)) || summary.Time.After(time.Now()) {
+					t.Fatalf("unexpected commit time %v of version %d", summary.Time, summary.Version)
+				}
+			}
+
+			if history, err = tree.VersionHistory(2, 2); err != nil || len(history) != 1 || history[0].Version != 2 {
+				t.Fatalf("unexpected history of version 2 %+v, %v", history, err)
+			}
+			if _, err := tree.VersionHistory(3, 2); err != ErrInvalidVersionRange {
+				t.Fatalf("expected ErrInvalidVersionRange, got %v", err)
+			}
+
+			// the summary of a rolled back version is removed with it
+			if err := smt.Rollback(2); err != nil {
+				t.Fatal(err)
+			}
+			if has, _ := db.Has(versionInfoKey(3)); has {
+				t.Fatal("the summary of the rolled back version should be removed")
+			}
+			if history, err = tree.VersionHistory(0, 10); err != nil || len(history) != 2 {
+				t.Fatalf("unexpected history after the rollback %+v, %v", history, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+)
+
+// versionTimePrefix is the prefix of the commit time records of the versions,
+// format: versionTime:${version}
+var versionTimePrefix = []byte(`versionTime:`)
+
+func versionTimeKey(version Version) []byte {
+	key := make([]byte, len(versionTimePrefix)+8)
+	copy(key, versionTimePrefix)
+	binary.BigEndian.PutUint64(key[len(versionTimePrefix):], uint64(version))
+	return key
+}
+
+func encodeVersionTime(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()))
+	return buf
+}
+
+func decodeVersionTime(buf []byte) (time.Time, error) {
+	if len(buf) != 8 {
+		return time.Time{}, ErrUnexpected
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf))), nil
+}
+
+// VersionTime returns the time the version was committed, ErrNodeNotFound is
+// returned for the versions committed before the commit times were recorded.
+func (tree *BNBSparseMerkleTree) VersionTime(version Version) (time.Time, error) {
+	if err := tree.awaitCommit(); err != nil {
+		return time.Time{}, err
+	}
+	buf, err := tree.db.Get(versionTimeKey(version))
+	if errors.Is(err, database.ErrDatabaseNotFound) {
+		return time.Time{}, ErrNodeNotFound
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return decodeVersionTime(buf)
+}
+
+// PruneOlderThan prunes the versions committed more than d ago, keeping the
+// state as of d ago queryable: the newest version committed before the cutoff
+// becomes the recent version. The commit time and the summary records of the
+// pruned versions are deleted.
+func (tree *BNBSparseMerkleTree) PruneOlderThan(d time.Duration) error {
+	if tree.archive {
+		return ErrArchiveMode
+	}
+	if err := tree.awaitCommit(); err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-d)
+
+	var (
+		target   Version
+		obsolete []Version
+	)
+	it := tree.db.NewIterator(versionTimePrefix, nil)
+	for it.Next() {
+		version := Version(binary.BigEndian.Uint64(it.Key()[len(versionTimePrefix):]))
+		if version > tree.LatestVersion() {
+			break
+		}
+		committed, err := decodeVersionTime(it.Value())
+		if err != nil {
+			it.Release()
+			return err
+		}
+		if committed.After(cutoff) {
+			break
+		}
+		if target > 0 {
+			obsolete = append(obsolete, target)
+		}
+		target = version
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if target <= tree.RecentVersion() {
+		return nil
+	}
+
+	if err := tree.Prune(target); err != nil {
+		return err
+	}
+	batch := tree.db.NewBatch()
+	for _, version := range obsolete {
+		// the prune gate may hold the recent version back
+		if version >= tree.RecentVersion() {
+			break
+		}
+		if err := batch.Delete(versionTimeKey(version)); err != nil {
+			return err
+		}
+		if err := batch.Delete(versionInfoKey(version)); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
@@ -0,0 +1,551 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/pkg/errors"
+
+	"github.com/bnb-chain/zkbnb-smt/database"
+	"github.com/bnb-chain/zkbnb-smt/logger"
+	"github.com/bnb-chain/zkbnb-smt/utils"
+)
+
+var (
+	_ database.TreeDB  = (*writeBehindDB)(nil)
+	_ database.Batcher = (*writeBehindBatch)(nil)
+
+	// writeBehindPrefix is the prefix of the journal records waiting to be materialized,
+	// format: writeBehind:${sequence}
+	writeBehindPrefix = []byte(`writeBehind:`)
+)
+
+func writeBehindKey(seq uint64) []byte {
+	key := make([]byte, len(writeBehindPrefix)+8)
+	copy(key, writeBehindPrefix)
+	binary.BigEndian.PutUint64(key[len(writeBehindPrefix):], seq)
+	return key
+}
+
+// writeBehindEntry is a buffered write of a journal record.
+type writeBehindEntry struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// writeBehindLeaf is a leaf version set by a journaled commit.
+type writeBehindLeaf struct {
+	Key     uint64
+	Version uint64
+	Value   []byte
+	Tag     string
+}
+
+// writeBehindCommit is the journal record of a commit, the leaves it set and
+// its version marker, from which its nodes are rebuilt.
+type writeBehindCommit struct {
+	Version  uint64
+	Recent   uint64 // the recent version of the commit, zero if it is kept
+	Metadata []byte
+	Leaves   []writeBehindLeaf
+}
+
+// writeBehindJournal is a journal record, either the writes of a batch or a commit.
+type writeBehindJournal struct {
+	Entries []writeBehindEntry
+	Commit  *writeBehindCommit `rlp:"nil"`
+}
+
+// writeBehindRecord is a durably journaled batch waiting to be materialized.
+type writeBehindRecord struct {
+	seq     uint64
+	entries []writeBehindEntry
+	// intent is the commit intent of a journaled commit, which is written ahead
+	// of its nodes and removed once they are
+	intent []byte
+}
+
+// overlayValue is the latest pending write of a key.
+type overlayValue struct {
+	value  []byte
+	delete bool
+	seq    uint64
+}
+
+// writeBehindDB persists every batch as a single journal record, and returns
+// as soon as the record is written. A commit is journaled by its leaves and its
+// version marker only, the nodes encoded by the commit are kept in memory.
+// The keys of the batch are materialized by a background writer, while reads
+// are served from the pending records. At most maxLag records are pending,
+// further writes block until the writer catches up. The pending records of a
+// previous process are replayed by the tree when it is opened.
+type writeBehindDB struct {
+	db     database.TreeDB
+	maxLag int
+
+	writeMu sync.Mutex // serializes the journal record writes
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	overlay map[string]overlayValue
+	queue   []*writeBehindRecord
+	nextSeq uint64
+	running bool
+	err     error
+	log     logger.Logger
+}
+
+func newWriteBehindDB(db database.TreeDB, maxLag int, log logger.Logger) *writeBehindDB {
+	wb := &writeBehindDB{
+		log:     log,
+		db:      db,
+		maxLag:  maxLag,
+		overlay: make(map[string]overlayValue),
+	}
+	wb.cond = sync.NewCond(&wb.mu)
+	return wb
+}
+
+// materialize writes the keys of the record and removes the record afterwards,
+// a record interrupted by a crash is replayed entirely. The nodes of a commit
+// are written after its intent, so a partial write is rolled back on startup
+// before the commit is rebuilt.
+func (wb *writeBehindDB) materialize(rec *writeBehindRecord) error {
+	if rec.intent != nil {
+		if err := wb.db.Set(commitIntentKey, rec.intent); err != nil {
+			return err
+		}
+	}
+	batch := database.NewAutoFlushBatch(wb.db.NewBatch(), 0)
+	for _, entry := range rec.entries {
+		var err error
+		if entry.Delete {
+			err = batch.Delete(entry.Key)
+		} else {
+			err = batch.Set(entry.Key, entry.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if rec.intent != nil {
+		if err := wb.db.Delete(commitIntentKey); err != nil {
+			return err
+		}
+	}
+	return wb.db.Delete(writeBehindKey(rec.seq))
+}
+
+// run materializes the pending records in order until the queue is drained.
+func (wb *writeBehindDB) run() {
+	for {
+		wb.mu.Lock()
+		if len(wb.queue) == 0 {
+			wb.running = false
+			wb.cond.Broadcast()
+			wb.mu.Unlock()
+			return
+		}
+		rec := wb.queue[0]
+		wb.mu.Unlock()
+
+		err := wb.materialize(rec)
+
+		wb.mu.Lock()
+		if err != nil {
+			// the record stays journaled and is replayed on the next start
+			wb.err = errors.Wrap(err, "write-behind materialization failed")
+			wb.log.Error("write-behind materialization failed, the record is replayed on restart",
+				logger.F("seq", rec.seq), logger.F("error", err))
+			wb.running = false
+			wb.cond.Broadcast()
+			wb.mu.Unlock()
+			return
+		}
+		wb.queue = wb.queue[1:]
+		for _, entry := range rec.entries {
+			if v, ok := wb.overlay[string(entry.Key)]; ok && v.seq == rec.seq {
+				delete(wb.overlay, string(entry.Key))
+			}
+		}
+		wb.cond.Broadcast()
+		wb.mu.Unlock()
+	}
+}
+
+// write journals the entries and queues them for materialization.
+func (wb *writeBehindDB) write(entries []writeBehindEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return wb.enqueue(&writeBehindJournal{Entries: entries}, &writeBehindRecord{entries: entries})
+}
+
+// commit journals the leaves of a commit and queues its nodes for materialization.
+func (wb *writeBehindDB) commit(commit *writeBehindCommit, intent []byte, entries []writeBehindEntry) error {
+	return wb.enqueue(&writeBehindJournal{Commit: commit}, &writeBehindRecord{entries: entries, intent: intent})
+}
+
+// enqueue writes the journal record and queues the record for materialization.
+func (wb *writeBehindDB) enqueue(journal *writeBehindJournal, rec *writeBehindRecord) error {
+	encoded, err := rlp.EncodeToBytes(journal)
+	if err != nil {
+		return err
+	}
+
+	wb.writeMu.Lock()
+	defer wb.writeMu.Unlock()
+
+	wb.mu.Lock()
+	for wb.err == nil && len(wb.queue) >= wb.maxLag {
+		wb.cond.Wait()
+	}
+	if wb.err != nil {
+		wb.mu.Unlock()
+		return wb.err
+	}
+	rec.seq = wb.nextSeq
+	wb.mu.Unlock()
+
+	if err := wb.db.Set(writeBehindKey(rec.seq), encoded); err != nil {
+		return err
+	}
+
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	wb.nextSeq++
+	wb.queue = append(wb.queue, rec)
+	for _, entry := range rec.entries {
+		wb.overlay[string(entry.Key)] = overlayValue{value: entry.Value, delete: entry.Delete, seq: rec.seq}
+	}
+	if !wb.running {
+		wb.running = true
+		go wb.run()
+	}
+	return nil
+}
+
+// flush blocks until all the pending records are materialized.
+func (wb *writeBehindDB) flush() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	for wb.err == nil && len(wb.queue) > 0 {
+		wb.cond.Wait()
+	}
+	return wb.err
+}
+
+func (wb *writeBehindDB) lookup(key []byte) (overlayValue, bool) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	v, ok := wb.overlay[string(key)]
+	return v, ok
+}
+
+// Has retrieves if a key is present in the pending records or the key-value store.
+func (wb *writeBehindDB) Has(key []byte) (bool, error) {
+	if v, ok := wb.lookup(key); ok {
+		return !v.delete, nil
+	}
+	return wb.db.Has(key)
+}
+
+// Get retrieves the given key from the pending records or the key-value store.
+func (wb *writeBehindDB) Get(key []byte) ([]byte, error) {
+	if v, ok := wb.lookup(key); ok {
+		if v.delete {
+			return nil, database.ErrDatabaseNotFound
+		}
+		return utils.CopyBytes(v.value), nil
+	}
+	return wb.db.Get(key)
+}
+
+// MultiGet retrieves the given keys from the pending records or the key-value store.
+func (wb *writeBehindDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	var missing [][]byte
+	var indexes []int
+	for i, key := range keys {
+		if v, ok := wb.lookup(key); ok {
+			if !v.delete {
+				values[i] = utils.CopyBytes(v.value)
+			}
+			continue
+		}
+		missing = append(missing, key)
+		indexes = append(indexes, i)
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	fetched, err := wb.db.MultiGet(missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		values[i] = fetched[j]
+	}
+	return values, nil
+}
+
+// Set journals the given value.
+func (wb *writeBehindDB) Set(key []byte, value []byte) error {
+	return wb.write([]writeBehindEntry{{Key: utils.CopyBytes(key), Value: utils.CopyBytes(value)}})
+}
+
+// Delete journals the key removal.
+func (wb *writeBehindDB) Delete(key []byte) error {
+	return wb.write([]writeBehindEntry{{Key: utils.CopyBytes(key), Delete: true}})
+}
+
+// NewIterator waits for the pending records to be materialized and iterates
+// over the key-value store.
+func (wb *writeBehindDB) NewIterator(prefix []byte, start []byte) database.Iterator {
+	if err := wb.flush(); err != nil {
+		return database.NewErrorIterator(err)
+	}
+	it := wb.db.NewIterator(prefix, start)
+	if !bytes.HasPrefix(writeBehindPrefix, prefix) {
+		return it
+	}
+	// hide the journal records written meanwhile
+	return &writeBehindIterator{Iterator: it}
+}
+
+// NewBatch creates a batch which is journaled as a single record.
+func (wb *writeBehindDB) NewBatch() database.Batcher {
+	return &writeBehindBatch{
+		db: wb,
+	}
+}
+
+// newCommitBatch creates the batch of a commit, which is journaled by the
+// given commit record instead of its writes.
+func (wb *writeBehindDB) newCommitBatch(commit *writeBehindCommit, intent []byte) database.Batcher {
+	return &writeBehindBatch{
+		db:     wb,
+		commit: commit,
+		intent: intent,
+	}
+}
+
+// Ping reports a failed materialization, or checks the key-value store.
+func (wb *writeBehindDB) Ping() error {
+	wb.mu.Lock()
+	err := wb.err
+	wb.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return wb.db.Ping()
+}
+
+// Close materializes the pending records and closes the key-value store.
+func (wb *writeBehindDB) Close() error {
+	if err := wb.flush(); err != nil {
+		return err
+	}
+	return wb.db.Close()
+}
+
+// writeBehindIterator skips the journal records.
+type writeBehindIterator struct {
+	database.Iterator
+}
+
+// Next moves the iterator to the next key/value pair which is not a journal record.
+func (it *writeBehindIterator) Next() bool {
+	for it.Iterator.Next() {
+		if !bytes.HasPrefix(it.Key(), writeBehindPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBehindBatch buffers the writes of a journal record.
+type writeBehindBatch struct {
+	db      *writeBehindDB
+	entries []writeBehindEntry
+	size    int
+
+	commit *writeBehindCommit
+	intent []byte
+}
+
+// Set inserts the given value into the batch for later committing.
+func (b *writeBehindBatch) Set(key, value []byte) error {
+	b.entries = append(b.entries, writeBehindEntry{Key: utils.CopyBytes(key), Value: utils.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *writeBehindBatch) Delete(key []byte) error {
+	b.entries = append(b.entries, writeBehindEntry{Key: utils.CopyBytes(key), Delete: true})
+	b.size += len(key)
+	return nil
+}
+
+// Write journals the batch as a single record.
+func (b *writeBehindBatch) Write() error {
+	if b.commit != nil {
+		return b.db.commit(b.commit, b.intent, b.entries)
+	}
+	return b.db.write(b.entries)
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *writeBehindBatch) ValueSize() int {
+	return b.size
+}
+
+// Reset resets the batch for reuse.
+func (b *writeBehindBatch) Reset() {
+	b.entries = nil
+	b.size = 0
+}
+
+// writeBehindCommit returns the journal record of the pending commit.
+func (tree *BNBSparseMerkleTree) writeBehindCommit(newVer Version, recentVersion *Version) (*writeBehindCommit, error) {
+	commit := &writeBehindCommit{Version: uint64(newVer), Metadata: tree.pendingMetadata()}
+	if recentVersion != nil {
+		commit.Recent = uint64(*recentVersion)
+	}
+	err := tree.journal.iterate(func(key journalKey, node *TreeNode) error {
+		if key.depth != tree.maxDepth {
+			return nil
+		}
+		tag := tree.writtenTag(node.path)
+		for _, v := range node.Versions {
+			if v.Ver > tree.version {
+				commit.Leaves = append(commit.Leaves, writeBehindLeaf{Key: node.path, Version: uint64(v.Ver), Value: v.Hash, Tag: tag})
+			}
+		}
+		return nil
+	})
+	return commit, err
+}
+
+// replayWriteBehind materializes the journal records left by a previous process
+// in order. A journaled commit is rebuilt by committing its leaves again, unless
+// it was materialized before the process stopped.
+func (tree *BNBSparseMerkleTree) replayWriteBehind() error {
+	var (
+		keys    [][]byte
+		records []writeBehindJournal
+	)
+	it := tree.db.NewIterator(writeBehindPrefix, nil)
+	for it.Next() {
+		var record writeBehindJournal
+		if err := rlp.DecodeBytes(it.Value(), &record); err != nil {
+			it.Release()
+			return err
+		}
+		keys = append(keys, utils.CopyBytes(it.Key()))
+		records = append(records, record)
+	}
+	err := it.Error()
+	it.Release()
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	// the tree is read again once records are written beneath it
+	stale := false
+	for i, record := range records {
+		if record.Commit == nil {
+			batch := database.NewAutoFlushBatch(tree.db.NewBatch(), tree.batchSizeLimit)
+			for _, entry := range record.Entries {
+				if entry.Delete {
+					err = batch.Delete(entry.Key)
+				} else {
+					err = batch.Set(entry.Key, entry.Value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			stale = true
+		} else {
+			if stale {
+				if err := tree.reload(); err != nil {
+					return err
+				}
+				stale = false
+			}
+			if err := tree.replayCommit(record.Commit); err != nil {
+				return err
+			}
+		}
+		if err := tree.db.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	tree.log.Warn("replayed the write-behind journal", logger.F("records", len(records)),
+		logger.F("version", tree.version))
+	if stale {
+		return tree.reload()
+	}
+	return nil
+}
+
+// replayCommit commits the leaves of a journaled commit again.
+func (tree *BNBSparseMerkleTree) replayCommit(commit *writeBehindCommit) error {
+	version := Version(commit.Version)
+	if version <= tree.version {
+		// the nodes were materialized before the process stopped
+		return nil
+	}
+	for _, leaf := range commit.Leaves {
+		if err := tree.SetWithVersion(leaf.Key, leaf.Value, Version(leaf.Version)); err != nil {
+			return err
+		}
+		if tree.auditLog && leaf.Tag != "" {
+			tree.auditTags.mu.Lock()
+			tree.auditTags.pending[leaf.Key] = leaf.Tag
+			tree.auditTags.mu.Unlock()
+		}
+	}
+	tree.versionMetadata.mu.Lock()
+	tree.versionMetadata.data = commit.Metadata
+	tree.versionMetadata.mu.Unlock()
+
+	var recentVersion *Version
+	if commit.Recent > 0 {
+		recent := Version(commit.Recent)
+		recentVersion = &recent
+	}
+	if _, err := tree.CommitWithNewVersion(recentVersion, &version); err != nil {
+		return err
+	}
+	return tree.awaitCommit()
+}
+
+// reload reads the tree from the database again.
+func (tree *BNBSparseMerkleTree) reload() error {
+	if err := tree.initFromStorage(); err != nil {
+		return err
+	}
+	tree.lastSaveRoot = tree.root
+	tree.dbCache.Purge()
+	if tree.preloadLevels > 0 {
+		return tree.preload(tree.preloadLevels)
+	}
+	return nil
+}
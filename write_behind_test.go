@@ -0,0 +1,179 @@
+// Copyright 2022 bnb-chain. All Rights Reserved.
+//
+// Distributed under MIT license.
+// See file LICENSE for detail or copy at https://opensource.org/licenses/MIT
+
+package bsmt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/pkg/errors"
+)
+
+func Test_BNBSparseMerkleTree_WriteBehind(t *testing.T) {
+	for _, env := range prepareEnv() {
+		t.Run(env.tag, func(t *testing.T) {
+			db, err := env.db()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, WriteBehind(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := prepareKVData(env.hasher)
+			for i, item := range items {
+				if err := smt.Set(item.Key, item.Val); err != nil {
+					t.Fatal(err)
+				}
+				if i%8 == 7 || i == len(items)-1 {
+					if _, err := smt.Commit(nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// reads are served while the nodes are materialized
+			for _, item := range items {
+				val, err := smt.Get(item.Key, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(val, item.Val) {
+					t.Fatalf("leaf node does not match the origin, %x, %x\n", val, item.Val)
+				}
+			}
+
+			if err := smt.(*BNBSparseMerkleTree).FlushWriteBehind(); err != nil {
+				t.Fatal(err)
+			}
+			it := db.NewIterator(writeBehindPrefix, nil)
+			if it.Next() {
+				t.Fatal("journal records should be removed once materialized")
+			}
+			it.Release()
+
+			reopened, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifyItems(t, smt, reopened, items)
+		})
+	}
+}
+
+func Test_WriteBehind_Replay(t *testing.T) {
+	env := prepareEnv()[0]
+	db, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	record, err := rlp.EncodeToBytes(&writeBehindJournal{Entries: []writeBehindEntry{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("b"), Delete: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set([]byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(writeBehindKey(0), record); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, WriteBehind(1)); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := db.Get([]byte("a")); err != nil || !bytes.Equal(val, []byte("1")) {
+		t.Fatalf("pending record should be replayed, got %q %v", val, err)
+	}
+	if has, _ := db.Has([]byte("b")); has {
+		t.Fatal("pending deletion should be replayed")
+	}
+	if has, _ := db.Has(writeBehindKey(0)); has {
+		t.Fatal("replayed record should be removed")
+	}
+}
+
+func Test_WriteBehind_RebuildCommit(t *testing.T) {
+	env := prepareEnv()[0]
+	memDB, err := env.db()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+	db := &faultyDB{TreeDB: memDB}
+
+	smt, err := NewBNBSparseMerkleTree(env.hasher, db, 8, nilHash, WriteBehind(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := prepareKVData(env.hasher)
+	for _, item := range items[:8] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.(*BNBSparseMerkleTree).FlushWriteBehind(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the nodes of the second commit are written partially, then the process stops
+	db.cutAfter = storageFullTreeNodeKey(4, items[8].Key>>4)
+	for _, item := range items[8:] {
+		if err := smt.Set(item.Key, item.Val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := smt.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := smt.(*BNBSparseMerkleTree).FlushWriteBehind(); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+
+	// the commit is journaled by its leaves and its version marker only
+	data, err := memDB.Get(writeBehindKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record writeBehindJournal
+	if err := rlp.DecodeBytes(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Entries) != 0 || record.Commit == nil || record.Commit.Version != 2 ||
+		len(record.Commit.Leaves) != len(items)-8 {
+		t.Fatalf("unexpected journal record %+v", record)
+	}
+	if has, _ := memDB.Has(commitIntentKey); !has {
+		t.Fatal("the intent should be written ahead of the nodes")
+	}
+
+	reopened, err := NewBNBSparseMerkleTree(env.hasher, memDB, 8, nilHash, WriteBehind(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.LatestVersion() != 2 {
+		t.Fatalf("the journaled commit should be rebuilt, got version %d", reopened.LatestVersion())
+	}
+	if !bytes.Equal(reopened.Root(), smt.Root()) {
+		t.Fatalf("root hash does not match, %x, %x\n", reopened.Root(), smt.Root())
+	}
+	if has, _ := memDB.Has(writeBehindKey(1)); has {
+		t.Fatal("replayed record should be removed")
+	}
+	if has, _ := memDB.Has(commitIntentKey); has {
+		t.Fatal("the interrupted materialization should be repaired")
+	}
+	verifyItems(t, smt, reopened, items)
+}